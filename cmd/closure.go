@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+
+	g "github.com/AJMBrands/SoftwareThatMatters/graph"
+	"github.com/spf13/cobra"
+)
+
+var (
+	closureInPath  string
+	closureIsMaven bool
+)
+
+// closureCmd represents the closure command
+var closureCmd = &cobra.Command{
+	Use:   "closure <package> <version>",
+	Short: "Prints the transitive dependencies of a package as CSV",
+	Long: `Creates the graph from a JSON file and prints every package version the given version of a package depends on,
+directly or indirectly, as CSV with the depth at which each dependency is first reached.`,
+	Args:         usageArgs(cobra.ExactArgs(2)),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		directed, _, stringIDToNodeInfo, idToNodeInfo, _ := g.CreateGraph(closureInPath, closureIsMaven)
+		closure, err := g.NewGraphFromMaps(directed, stringIDToNodeInfo, idToNodeInfo).TransitiveDependencies(args[0], args[1])
+		if err != nil {
+			return err
+		}
+
+		writer := csv.NewWriter(os.Stdout)
+		writer.Write([]string{"name", "version", "depth"})
+		for _, dependency := range closure {
+			writer.Write([]string{dependency.Name, dependency.Version, strconv.Itoa(dependency.Depth)})
+		}
+		writer.Flush()
+		return writer.Error()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(closureCmd)
+
+	closureCmd.Flags().StringVar(&closureInPath, "in", "data/input/test_data.json", "The JSON file to create the graph from")
+	closureCmd.Flags().BoolVar(&closureIsMaven, "maven", false, "Whether the packages come from Maven")
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// applyConfig sets the flags of cmd to the settings of the config file at path, as if they had been given on the
+// command line, except for the flags that actually were, which take precedence. Settings are matched to flags by their
+// YAML key. Errors in the file are usage errors.
+func applyConfig(cmd *cobra.Command, path string) error {
+	config, err := ingest.LoadConfig(path)
+	if err != nil {
+		return usageError{err}
+	}
+
+	value := reflect.ValueOf(config)
+	for i := 0; i < value.NumField(); i++ {
+		setting := value.Field(i)
+		if setting.IsNil() {
+			continue
+		}
+		name := strings.Split(value.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil {
+			return fmt.Errorf("the config setting %s has no flag", name)
+		}
+		if flag.Changed {
+			continue
+		}
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			if err := slice.Replace(setting.Interface().([]string)); err != nil {
+				return usageErrorf("%s: %s: %v", path, name, err)
+			}
+			flag.Changed = true
+			continue
+		}
+		if err := cmd.Flags().Set(name, fmt.Sprint(setting.Elem().Interface())); err != nil {
+			return usageErrorf("%s: %s: %v", path, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+	"github.com/spf13/cobra"
+)
+
+// dedupeCmd represents the dedupe command
+var dedupeCmd = &cobra.Command{
+	Use:   "dedupe <in> <out>",
+	Short: "Removes repeated packages from a CSV file written by ingest",
+	Long: `Copies a CSV file written by ingest, such as the outputs of several runs that were concatenated, leaving out
+every row that repeats an earlier one and keeping the first. Rows of a file of versions are compared by package id and
+version number, rows of other files with a name and a platform column by platform and name, and the rows of any other
+file, such as dependencies.csv, as a whole. Either file may be gzip-compressed, and out may be the same as in: out is
+only replaced once the copy is complete, so an interrupted or failed run leaves both files as they were.`,
+	Args:         usageArgs(cobra.ExactArgs(2)),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		written, duplicates, err := ingest.DedupeCSV(cmd.Context(), args[0], args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Kept %d rows, removed %d duplicates\n", written, duplicates)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dedupeCmd)
+}
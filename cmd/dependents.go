@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/AJMBrands/SoftwareThatMatters/graph"
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dependentsInPath     string
+	dependentsFormat     string
+	dependentsTransitive bool
+)
+
+// dependentsCmd represents the dependents command
+var dependentsCmd = &cobra.Command{
+	Use:   "dependents <platform> <name>",
+	Short: "Prints the packages that depend on a package",
+	Long: `Builds the dependency graph of a file written by ingest and prints every package version that depends on any
+version of the given package, directly or, unless --transitive=false, indirectly. Each one is printed once with its
+depth, the length of the shortest dependency path to the package, so direct dependents have depth 1. The output is CSV
+or, with --format json, a JSON array, and is written while the graph is searched.`,
+	Args: usageArgs(cobra.ExactArgs(2)),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format := strings.ToLower(dependentsFormat)
+		if format != "csv" && format != "json" {
+			return usageErrorf("--format must be csv or json, got %q", dependentsFormat)
+		}
+		projects, err := ingest.ReadProjects(dependentsInPath)
+		if err != nil {
+			return err
+		}
+		g := graph.FromIngest(projects)
+
+		out := bufio.NewWriter(os.Stdout)
+		write, finish := dependentsWriter(out, format)
+		if err := g.PackageDependents(args[0], args[1], dependentsTransitive, write); err != nil {
+			return err
+		}
+		if err := finish(); err != nil {
+			return err
+		}
+		return out.Flush()
+	},
+}
+
+// dependentRecord is a dependent as printed by the dependents command.
+type dependentRecord struct {
+	Platform string `json:"platform"`
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Depth    int    `json:"depth"`
+}
+
+// dependentsWriter returns a function that writes a dependent to out in the given format, csv or json, and one that
+// finishes the output after the last dependent.
+func dependentsWriter(out *bufio.Writer, format string) (write func(graph.Dependent) error, finish func() error) {
+	record := func(dependent graph.Dependent) dependentRecord {
+		platform, name, version := graph.SplitPackageKey(dependent.Key)
+		return dependentRecord{Platform: platform, Name: name, Version: version, Depth: dependent.Depth}
+	}
+
+	if format == "json" {
+		count := 0
+		write = func(dependent graph.Dependent) error {
+			data, err := json.Marshal(record(dependent))
+			if err != nil {
+				return fmt.Errorf("encoding %s: %w", dependent.Key, err)
+			}
+			separator := ",\n  "
+			if count == 0 {
+				separator = "[\n  "
+			}
+			count++
+			out.WriteString(separator)
+			_, err = out.Write(data)
+			return err
+		}
+		finish = func() error {
+			if count == 0 {
+				_, err := out.WriteString("[]\n")
+				return err
+			}
+			_, err := out.WriteString("\n]\n")
+			return err
+		}
+		return write, finish
+	}
+
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"platform", "name", "version", "depth"})
+	write = func(dependent graph.Dependent) error {
+		r := record(dependent)
+		writer.Write([]string{r.Platform, r.Name, r.Version, strconv.Itoa(r.Depth)})
+		return writer.Error()
+	}
+	finish = func() error {
+		writer.Flush()
+		return writer.Error()
+	}
+	return write, finish
+}
+
+func init() {
+	rootCmd.AddCommand(dependentsCmd)
+
+	dependentsCmd.Flags().StringVar(&dependentsInPath, "in", "data/out/result.csv", "The CSV, NDJSON or JSON file written by ingest to build the graph from")
+	dependentsCmd.Flags().StringVar(&dependentsFormat, "format", "csv", "The output format, csv or json")
+	dependentsCmd.Flags().BoolVar(&dependentsTransitive, "transitive", true, "Also print the packages that depend on the package indirectly (--transitive=false prints only direct dependents)")
+}
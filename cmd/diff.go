@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	g "github.com/AJMBrands/SoftwareThatMatters/graph"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffInPath  string
+	diffIsMaven bool
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff <package> <version-a> <version-b>",
+	Short: "Prints how the dependencies of two versions of a package differ",
+	Long: `Creates the graph from a JSON file and compares the direct dependencies of two versions of a package, e.g.
+diff express 4.17.1 4.18.2. Dependencies only <version-b> has are printed with +, those only <version-a> has with -,
+and those whose versions changed with ~, together with the versions each of them depends on.`,
+	Args:         usageArgs(cobra.ExactArgs(3)),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pkg, versionA, versionB := args[0], args[1], args[2]
+		directed, _, stringIDToNodeInfo, idToNodeInfo, _ := g.CreateGraph(diffInPath, diffIsMaven)
+		graph := g.NewGraphFromMaps(directed, stringIDToNodeInfo, idToNodeInfo)
+		added, removed, changed, err := g.DiffVersions(graph, pkg, versionA, versionB)
+		if err != nil {
+			return err
+		}
+		// versions returns the versions of dependency the given version of pkg depends on
+		versions := func(version, dependency string) string {
+			var matching []string
+			for _, neighbor := range graph.Neighbors(fmt.Sprintf("%s-%s", pkg, version)) {
+				if neighbor.Name == dependency {
+					matching = append(matching, neighbor.Version)
+				}
+			}
+			return strings.Join(matching, ",")
+		}
+		out := cmd.OutOrStdout()
+		for _, name := range added {
+			fmt.Fprintf(out, "+ %s %s\n", name, versions(versionB, name))
+		}
+		for _, name := range removed {
+			fmt.Fprintf(out, "- %s %s\n", name, versions(versionA, name))
+		}
+		for _, name := range changed {
+			fmt.Fprintf(out, "~ %s %s -> %s\n", name, versions(versionA, name), versions(versionB, name))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringVar(&diffInPath, "in", "data/input/test_data.json", "The JSON file to create the graph from")
+	diffCmd.Flags().BoolVar(&diffIsMaven, "maven", false, "Whether the packages come from Maven")
+}
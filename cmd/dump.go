@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dumpProjects     string
+	dumpVersions     string
+	dumpDependencies string
+	dumpPlatforms    []string
+	dumpOutDir       string
+	dumpStatsOut     string
+)
+
+// dumpCmd represents the ingest dump command
+var dumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Converts the CSV files of the libraries.io open data release into the normalized output of ingest",
+	Long: `Reads the projects, versions and dependencies CSV files of a libraries.io open data release, which may be
+gzip-compressed if their names end in .gz, and writes the packages, versions and dependencies CSV files of
+ingest --normalized to --out-dir without sending any requests. The files are streamed, so they may be larger than
+memory, and only the dependencies of the latest release of every package are kept.`,
+	Args: usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if dumpProjects == "" || dumpVersions == "" || dumpDependencies == "" {
+			return usageErrorf("--projects, --versions and --dependencies must name the files of the dump")
+		}
+		stats, err := ingest.IngestDumpContext(cmd.Context(), dumpPlatforms, dumpProjects, dumpVersions, dumpDependencies, dumpOutDir)
+		if err != nil {
+			return platformError(err)
+		}
+		return writeStats(dumpStatsOut, stats)
+	},
+}
+
+func init() {
+	ingestCmd.AddCommand(dumpCmd)
+
+	dumpCmd.Flags().StringVar(&dumpProjects, "projects", "", "The projects CSV file of the dump, e.g. projects-1.6.0-2020-01-12.csv")
+	dumpCmd.Flags().StringVar(&dumpVersions, "versions", "", "The versions CSV file of the dump")
+	dumpCmd.Flags().StringVar(&dumpDependencies, "dependencies", "", "The dependencies CSV file of the dump")
+	dumpCmd.Flags().StringSliceVar(&dumpPlatforms, "platforms", nil, "A comma-separated list of the platforms to keep (defaults to all of them)")
+	dumpCmd.Flags().StringVar(&dumpOutDir, "out-dir", "data/out", "The directory to write the packages, versions and dependencies CSV files to")
+	dumpCmd.Flags().StringVar(&dumpStatsOut, "stats-out", "", "Also write statistics about the ingestion as JSON to this path")
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/AJMBrands/SoftwareThatMatters/graph"
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat   string
+	exportOutPath  string
+	exportTop      int
+	exportCompress bool
+)
+
+// graphFormat is a --format value that writes the dependency graph of the packages instead of the packages.
+type graphFormat struct {
+	// suffix replaces the extension of the input in the default output path
+	suffix string
+	write  func(g *graph.PackageGraph, outPath string) error
+}
+
+var graphFormats = map[string]graphFormat{
+	"graphml": {".graphml", func(g *graph.PackageGraph, outPath string) error {
+		return writeGraphFiles([]string{outPath}, func(w []io.Writer) error { return g.WriteGraphML(w[0]) })
+	}},
+	"dot": {".dot", func(g *graph.PackageGraph, outPath string) error {
+		return writeGraphFiles([]string{outPath}, func(w []io.Writer) error { return g.WriteDOT(w[0]) })
+	}},
+	"cyclonedx": {".cdx.json", func(g *graph.PackageGraph, outPath string) error {
+		return writeGraphFiles([]string{outPath}, func(w []io.Writer) error { return g.WriteCycloneDX(w[0]) })
+	}},
+	// The edge list is a directory with a file of nodes and a file of edges
+	"edgelist": {"-edgelist", func(g *graph.PackageGraph, outPath string) error {
+		paths := []string{filepath.Join(outPath, "nodes.csv"), filepath.Join(outPath, "edges.csv")}
+		if exportCompress {
+			for i := range paths {
+				paths[i] += ingest.CompressedExt
+			}
+		}
+		return writeGraphFiles(paths, func(w []io.Writer) error { return g.WriteEdgeList(w[0], w[1]) })
+	}},
+}
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "Converts the output of ingest into another format",
+	Long: `Reads a CSV, NDJSON or JSON file written by ingest and writes its packages in the format given by --format.
+The format of the input is taken from its extension. A SQLite database cannot be read back. Without --out, the output
+is written next to the input with the extension of the new format.
+
+With --format graphml or dot, the dependency graph of the packages is written instead, for Gephi or Graphviz. Its
+nodes are package versions and its edges point from the latest release of a package to the versions its dependencies
+resolve to. --format edgelist writes the graph to nodes.csv and edges.csv in the directory given by --out, with integer
+node ids for igraph or networkx. The ids follow the order of the keys, so exporting the same data again gives identical
+files. --top limits the graph to the nodes with the most edges. Graphs are built from the file alone, without
+requests to libraries.io.
+
+An input that is gzip-compressed is decompressed while it is read, and an --out ending in .gz, or --compress, writes
+the output gzip-compressed. With --format edgelist, --compress compresses both files.
+
+--format cyclonedx writes the graph as a CycloneDX 1.5 JSON SBOM for supply-chain scanners, with a package URL such
+as pkg:npm/left-pad@1.3.0 for every component.`,
+	Args: usageArgs(cobra.ExactArgs(1)),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inPath := args[0]
+		if format, ok := ingest.FormatForPath(inPath); !ok || format == ingest.FormatSQLite {
+			return usageErrorf("cannot export %s: expected a .csv, .ndjson or .json file", inPath)
+		}
+		graphFormat, isGraph := graphFormats[strings.ToLower(exportFormat)]
+		if exportTop < 0 {
+			return usageErrorf("--top must not be negative, got %d", exportTop)
+		}
+		if exportTop > 0 && !isGraph {
+			return usageErrorf("--top only applies to --format graphml, dot, edgelist or cyclonedx")
+		}
+		suffix := graphFormat.suffix
+		var format ingest.Format
+		if !isGraph {
+			var err error
+			if format, err = ingest.ParseFormat(exportFormat); err != nil {
+				return usageError{err}
+			}
+			suffix = "." + format.String()
+		}
+		outPath := exportOutPath
+		if outPath == "" {
+			uncompressed := ingest.TrimCompressedExt(inPath)
+			outPath = strings.TrimSuffix(uncompressed, filepath.Ext(uncompressed)) + suffix
+		}
+		if exportCompress && !ingest.IsCompressedPath(outPath) && graphFormat.suffix != "-edgelist" {
+			outPath += ingest.CompressedExt
+		}
+		if filepath.Clean(outPath) == filepath.Clean(inPath) {
+			return usageErrorf("the output %s would overwrite the input: pass another --out or --format", outPath)
+		}
+		if isGraph {
+			return exportGraph(inPath, outPath, graphFormat)
+		}
+		_, err := ingest.Convert(cmd.Context(), inPath, outPath, format)
+		return err
+	},
+}
+
+// exportGraph builds the dependency graph of the packages in inPath, limited to the --top nodes with the most edges,
+// and writes it to outPath in the given format.
+func exportGraph(inPath, outPath string, format graphFormat) error {
+	projects, err := ingest.ReadProjects(inPath)
+	if err != nil {
+		return err
+	}
+	return format.write(graph.FromIngest(projects).TopByDegree(exportTop), outPath)
+}
+
+// writeGraphFiles creates the files at paths, along with their directories, and passes them to write in the same
+// order. Files whose path ends in .gz are gzip-compressed. Each file is written to a temporary file that is renamed to
+// its path once write succeeds, so the files that were there before are left untouched if writing fails.
+func writeGraphFiles(paths []string, write func(w []io.Writer) error) (err error) {
+	files := make([]*ingest.AtomicFile, 0, len(paths))
+	compressors := make([]*gzip.Writer, len(paths))
+	defer func() {
+		for i := range files {
+			// The end of the gzip stream has to be written before the file is closed
+			if gz := compressors[i]; gz != nil && err == nil {
+				if closeErr := gz.Close(); closeErr != nil {
+					err = fmt.Errorf("compressing %s: %w", paths[i], closeErr)
+				}
+			}
+		}
+		for _, f := range files {
+			if err != nil {
+				f.Abort()
+				continue
+			}
+			err = f.Commit()
+		}
+	}()
+
+	writers := make([]io.Writer, 0, len(paths))
+	for _, path := range paths {
+		f, err := ingest.CreateAtomic(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		if ingest.IsCompressedPath(path) {
+			compressors[len(files)-1] = gzip.NewWriter(f)
+			writers = append(writers, compressors[len(files)-1])
+			continue
+		}
+		writers = append(writers, f)
+	}
+	return write(writers)
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVar(&exportFormat, "format", "ndjson", "The format to convert to, csv, ndjson, json or sqlite, or graphml, dot, edgelist or cyclonedx for the dependency graph")
+	exportCmd.Flags().IntVar(&exportTop, "top", 0, "Only write the given number of nodes with the most edges to a graph (0 writes all)")
+	exportCmd.Flags().BoolVar(&exportCompress, "compress", false, "Gzip the output, adding .gz to --out")
+	exportCmd.Flags().StringVar(&exportOutPath, "out", "", "The path of the file to write (defaults to the input with the extension of --format)")
+}
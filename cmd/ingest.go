@@ -0,0 +1,577 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	ingestPlatforms  []string
+	ingestInputs     []string
+	ingestSplit      bool
+	ingestAPIKey     string
+	ingestPerPage    int
+	ingestOutPath    string
+	ingestMaxPages   int
+	ingestMax        int
+	ingestRate       int
+	ingestWorkers    int
+	ingestAttempts   int
+	ingestFormat     string
+	ingestDecode     string
+	ingestColumns    []string
+	ingestNormalized bool
+	ingestDeps       bool
+	ingestVulns      bool
+	ingestVersions   bool
+	ingestPrerelease bool
+	ingestUndated    bool
+	ingestNoLicenses []string
+	ingestKeywords   []string
+	ingestLanguages  []string
+	ingestMinStars   int
+	ingestMinRank    int
+	ingestStatsOut   string
+	ingestCacheDir   string
+	ingestCacheTTL   time.Duration
+	ingestNoCache    bool
+	ingestRefresh    bool
+	ingestRestart    bool
+	ingestUpdate     bool
+	ingestTimeout    time.Duration
+	ingestReqTimeout time.Duration
+	ingestConfig     string
+	ingestSource     string
+	ingestPackages   []string
+	ingestQuery      string
+	ingestNamesFile  string
+	ingestSince      string
+	ingestProgress   bool
+	ingestCompress   bool
+	ingestLevel      int
+	ingestDryRun     bool
+)
+
+// ingestCmd represents the ingest command
+var ingestCmd = &cobra.Command{
+	Use:   "ingest",
+	Short: "Downloads package metadata from libraries.io into a CSV, NDJSON or JSON file or a SQLite database",
+	Long: `Downloads package metadata of one or more platforms from libraries.io and writes it to a CSV, NDJSON or JSON file or
+a SQLite database.
+The libraries.io API key is read from the ` + ingest.APIKeyEnvVar + ` environment variable, falling back to --api-key.
+With --names-file, the packages of the single platform given with --platforms are read from a file with one name
+per line instead of searching for them, and their details and the dependencies of their latest release are
+downloaded. # starts a comment. The packages libraries.io does not know or that have no releases left are listed in
+skipped_packages.csv next to --out.
+With --input, the packages are read from local JSON files in the shape of a libraries.io search response instead,
+which needs neither an API key nor network access. The output, the filters, --columns and --max-packages work as
+they do for libraries.io, while the flags that shape the requests, such as --per-page or --dependencies, are rejected.
+With --config, the settings are read from a YAML file whose keys are named like the flags, e.g.
+
+  platforms: [NPM, Pypi]
+  requests-per-minute: 30
+  timeout: 2h
+
+Flags given on the command line override the settings of the file.
+With --source npm, the packages given with --packages are downloaded from the npm registry instead, which needs no
+API key and has no rate limit of its own. The output has the same columns and fields as with libraries.io, and the
+dependencies of the latest release are always included.
+With --source goproxy, the Go modules given with --packages, e.g. github.com/spf13/cobra, are downloaded from the Go
+module proxy in the same way, with the versions it lists and the require directives of the go.mod file of their latest
+release as dependencies.
+With --source registries, the packages given with --packages as platform:name, e.g. npm:react,
+go:github.com/spf13/cobra, pypi:requests, cargo:serde or maven:org.slf4j:slf4j-api, are each downloaded from the
+registry of their platform and written to the same output, whose platform column tells them apart. As with
+--names-file, the packages that are left out are listed in skipped_packages.csv.
+With --source crates, the crates matching --query, or all crates without it, are searched for on crates.io and
+downloaded from there, at most one request per second as crates.io asks. --per-page and --max-pages apply to the
+search pages.
+With --source goindex, the modules the Go module index lists from --since on are written, with the dependencies of
+their go.mod files if --dependencies is given. The command prints the --since of the next run, which continues where
+this one stopped.
+With --update, an existing output is kept fresh: the search pages are requested again, but packages without a new
+release since the last run with --update keep their versions and dependencies from the output instead of fetching
+them again. When packages last changed is tracked in a state file next to the output, e.g. result.csv.state.json.
+With --since, e.g. --since 2024-01-01, only packages whose latest release was published after that date or RFC 3339
+timestamp are written, which libraries.io is asked for newest first, so that the search stops at the first page of
+older packages. Packages without a release time are skipped unless --include-undated is given. --since last continues
+from when the last ingestion into the directory of --out finished, as its manifest records, and the output can be
+combined with the earlier ones by the merge command.
+With --dry-run, only the first page of search results of every platform is requested, and the number of pages and
+requests the run would take, how long they take at --requests-per-minute and roughly how large the output gets are
+printed instead. Nothing is written.`,
+	Args: usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ingestConfig != "" {
+			if err := applyConfig(cmd, ingestConfig); err != nil {
+				return err
+			}
+		}
+		source, err := validateSource(cmd)
+		if err != nil {
+			return err
+		}
+		if len(ingestInputs) > 0 && ingestDryRun {
+			return usageErrorf("--dry-run cannot be combined with --input")
+		}
+		if err := validateInputFlags(cmd); err != nil {
+			return err
+		}
+		if ingestNamesFile != "" && (ingestNormalized || ingestSplit || ingestUpdate || ingestDryRun) {
+			return usageErrorf("--names-file cannot be combined with --normalized, --split, --update or --dry-run")
+		}
+		if ingestNamesFile != "" && len(ingestPlatforms) != 1 {
+			return usageErrorf("--names-file needs exactly one platform in --platforms, got %d", len(ingestPlatforms))
+		}
+		apiKey := ingest.APIKeyFromEnv()
+		if apiKey == "" {
+			apiKey = ingestAPIKey
+		}
+		if apiKey == "" && source == ingest.SourceLibrariesIO && len(ingestInputs) == 0 {
+			return usageError{errors.New("no libraries.io API key found: set " + ingest.APIKeyEnvVar + " or pass --api-key")}
+		}
+		if err := validateIngestFlags(); err != nil {
+			return err
+		}
+
+		format, err := ingest.ParseFormat(ingestFormat)
+		if err != nil {
+			return usageError{err}
+		}
+		decodeMode, err := ingest.ParseDecodeMode(ingestDecode)
+		if err != nil {
+			return usageError{err}
+		}
+		// Without --format the extension of --out decides, and without --out the format decides the extension
+		if pathFormat, ok := ingest.FormatForPath(ingestOutPath); ok && !cmd.Flags().Changed("format") {
+			format = pathFormat
+		} else if !cmd.Flags().Changed("out") {
+			ingestOutPath = strings.TrimSuffix(ingestOutPath, filepath.Ext(ingestOutPath)) + "." + format.String()
+		}
+		if ingestCompress && !ingest.IsCompressedPath(ingestOutPath) {
+			ingestOutPath += ingest.CompressedExt
+		}
+		if ingest.IsCompressedPath(ingestOutPath) && format == ingest.FormatSQLite {
+			return usageErrorf("a SQLite database cannot be compressed")
+		}
+		if ingestUpdate && format == ingest.FormatSQLite {
+			return usageErrorf("--update needs a CSV, NDJSON or JSON output, not a SQLite database")
+		}
+
+		since, err := parseSince(ingestSince, ingestOutPath)
+		if err != nil {
+			return err
+		}
+		opts := ingest.Options{
+			PerPage:           ingestPerPage,
+			APIKey:            apiKey,
+			MaxPages:          ingestMaxPages,
+			MaxPackages:       ingestMax,
+			RequestsPerMinute: ingestRate,
+			MaxAttempts:       ingestAttempts,
+			Workers:           ingestWorkers,
+			Format:            format,
+			Columns:           ingestColumns,
+			Dependencies:      ingestDeps,
+			Vulnerabilities:   ingestVulns,
+			Versions:          ingestVersions,
+			IncludePrerelease: ingestPrerelease,
+			ExcludeLicenses:   ingestNoLicenses,
+			Keywords:          ingestKeywords,
+			Languages:         ingestLanguages,
+			MinStars:          ingestMinStars,
+			MinRank:           ingestMinRank,
+			CacheDir:          ingestCacheDir,
+			CacheTTL:          ingestCacheTTL,
+			RefreshCache:      ingestRefresh,
+			Restart:           ingestRestart,
+			Update:            ingestUpdate,
+			RequestTimeout:    ingestReqTimeout,
+			CompressionLevel:  ingestLevel,
+			DecodeMode:        decodeMode,
+		}
+		if source == ingest.SourceLibrariesIO {
+			opts.Since, opts.IncludeUndated = since, ingestUndated
+		}
+		if ingestProgress {
+			opts.Progress = printProgress(cmd.ErrOrStderr())
+		}
+		if ingestNoCache {
+			opts.CacheDir = ""
+		}
+		ctx := cmd.Context()
+		if ingestTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, ingestTimeout)
+			defer cancel()
+		}
+		if len(ingestColumns) > 0 && (format != ingest.FormatCSV || ingestNormalized) {
+			return usageErrorf("--columns only applies to a single CSV file")
+		}
+		if ingestDryRun {
+			if source != ingest.SourceLibrariesIO {
+				return usageErrorf("--dry-run only applies to --source %s", ingest.SourceLibrariesIO)
+			}
+			estimate, err := ingest.EstimateIngest(ctx, opts, ingestPlatforms)
+			if err != nil {
+				return platformError(err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Estimated %s\n", estimate)
+			return nil
+		}
+		if len(ingestInputs) > 0 {
+			stats, err := ingest.IngestFromFiles(ctx, opts, ingestInputs, ingestOutPath)
+			if err != nil {
+				return platformError(err)
+			}
+			return writeStats(ingestStatsOut, stats)
+		}
+		switch source {
+		case ingest.SourceNPM:
+			stats, err := ingest.IngestNPM(ctx, opts, ingestPackages, ingestOutPath)
+			if err != nil {
+				return platformError(err)
+			}
+			return writeStats(ingestStatsOut, stats)
+		case ingest.SourceGoProxy:
+			stats, err := ingest.IngestGoModules(ctx, opts, ingestPackages, ingestOutPath)
+			if err != nil {
+				return platformError(err)
+			}
+			return writeStats(ingestStatsOut, stats)
+		case ingest.SourceRegistries:
+			stats, err := ingest.IngestRegistries(ctx, opts, ingestPackages, ingestOutPath)
+			if err != nil {
+				return platformError(err)
+			}
+			return writeStats(ingestStatsOut, stats)
+		case ingest.SourceCrates:
+			stats, err := ingest.IngestCrates(ctx, opts, ingestQuery, ingestOutPath)
+			if err != nil {
+				return platformError(err)
+			}
+			return writeStats(ingestStatsOut, stats)
+		case ingest.SourceGoIndex:
+			stats, next, err := ingest.IngestGoIndex(ctx, opts, since, ingestOutPath)
+			if err != nil {
+				return platformError(err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Continue with --since %s\n", next.Format(time.RFC3339Nano))
+			return writeStats(ingestStatsOut, stats)
+		}
+		if ingestNamesFile != "" {
+			stats, err := ingest.NewClient(nil, "").IngestList(ctx, opts, ingestPlatforms[0], ingestNamesFile, ingestOutPath)
+			if err != nil {
+				return platformError(err)
+			}
+			return writeStats(ingestStatsOut, stats)
+		}
+		if ingestNormalized {
+			outDir := filepath.Dir(ingestOutPath)
+			stats, err := ingest.IngestNormalized(ctx, opts, ingestPlatforms, outDir)
+			if err != nil {
+				return platformError(err)
+			}
+			return writeStats(ingestStatsOut, stats)
+		}
+		if !ingestSplit {
+			stats, err := ingest.IngestPlatforms(ctx, opts, ingestPlatforms, ingestOutPath)
+			if err != nil {
+				return platformError(err)
+			}
+			return writeStats(ingestStatsOut, stats)
+		}
+
+		for _, platform := range ingestPlatforms {
+			opts.Platform = platform
+			outPath := platformOutPath(ingestOutPath, platform)
+			stats, err := ingest.IngestContext(ctx, opts, outPath)
+			if err != nil {
+				return platformError(fmt.Errorf("ingesting %s: %w", platform, err))
+			}
+			if ingestStatsOut != "" {
+				if err := writeStats(platformOutPath(ingestStatsOut, platform), stats); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	},
+}
+
+// inputRequestFlags are the flags that shape the requests to libraries.io, and with them what is written, which is
+// why they cannot be given with --input.
+var inputRequestFlags = []string{"platforms", "per-page", "max-pages", "dependencies", "vulnerabilities", "versions", "decode"}
+
+// validateInputFlags checks that the flags given with --input apply to the files it reads.
+func validateInputFlags(cmd *cobra.Command) error {
+	if len(ingestInputs) == 0 {
+		return nil
+	}
+	if ingestNormalized || ingestSplit || ingestUpdate || ingestNamesFile != "" {
+		return usageErrorf("--input cannot be combined with --normalized, --split, --update or --names-file")
+	}
+	for _, name := range inputRequestFlags {
+		if cmd.Flags().Changed(name) {
+			return usageErrorf("--%s does not apply to --input, which sends no requests", name)
+		}
+	}
+	return nil
+}
+
+// validateSource checks the flags that pick where the packages come from, and returns the source in lower case.
+func validateSource(cmd *cobra.Command) (string, error) {
+	source := strings.ToLower(ingestSource)
+	switch source {
+	case ingest.SourceLibrariesIO, ingest.SourceNPM, ingest.SourceGoIndex, ingest.SourceGoProxy, ingest.SourceRegistries,
+		ingest.SourceCrates:
+	default:
+		return "", usageErrorf("--source must be %s, %s, %s, %s, %s or %s, got %q", ingest.SourceLibrariesIO, ingest.SourceNPM,
+			ingest.SourceGoIndex, ingest.SourceGoProxy, ingest.SourceRegistries, ingest.SourceCrates, ingestSource)
+	}
+	if ingestQuery != "" && source != ingest.SourceCrates {
+		return source, usageErrorf("--query only applies to --source %s", ingest.SourceCrates)
+	}
+	if len(ingestPackages) > 0 && source != ingest.SourceNPM && source != ingest.SourceGoProxy && source != ingest.SourceRegistries {
+		return source, usageErrorf("--packages only applies to --source %s, %s and %s", ingest.SourceNPM, ingest.SourceGoProxy,
+			ingest.SourceRegistries)
+	}
+	if err := validateSince(source); err != nil {
+		return source, err
+	}
+	if source == ingest.SourceLibrariesIO {
+		return source, nil
+	}
+	switch {
+	case source == ingest.SourceNPM && len(ingestPackages) == 0:
+		return source, usageErrorf("--source npm needs the names of the packages to ingest in --packages")
+	case source == ingest.SourceGoProxy && len(ingestPackages) == 0:
+		return source, usageErrorf("--source goproxy needs the paths of the modules to ingest in --packages")
+	case source == ingest.SourceRegistries && len(ingestPackages) == 0:
+		return source, usageErrorf("--source registries needs the packages to ingest in --packages, e.g. npm:react,maven:org.slf4j:slf4j-api")
+	case len(ingestInputs) > 0 || ingestNormalized || ingestSplit:
+		return source, usageErrorf("--source %s cannot be combined with --input, --normalized or --split", source)
+	case cmd.Flags().Changed("platforms"):
+		return source, usageErrorf("--platforms only applies to --source %s", ingest.SourceLibrariesIO)
+	case ingestUpdate:
+		return source, usageErrorf("--update only applies to --source %s", ingest.SourceLibrariesIO)
+	case ingestNamesFile != "":
+		return source, usageErrorf("--names-file only applies to --source %s", ingest.SourceLibrariesIO)
+	}
+	if source == ingest.SourceRegistries {
+		for _, pkg := range ingestPackages {
+			if _, _, err := ingest.ParseRegistryPackage(pkg); err != nil {
+				return source, usageError{err}
+			}
+		}
+	}
+	return source, nil
+}
+
+// validateSince checks --since and --include-undated for the given source.
+func validateSince(source string) error {
+	switch {
+	case ingestSince == "" && ingestUndated:
+		return usageErrorf("--include-undated only applies with --since")
+	case ingestSince == "":
+		return nil
+	case source != ingest.SourceLibrariesIO && source != ingest.SourceGoIndex:
+		return usageErrorf("--since only applies to --source %s and %s", ingest.SourceLibrariesIO, ingest.SourceGoIndex)
+	case source == ingest.SourceGoIndex && (ingestSince == ingest.SinceLastRun || ingestUndated):
+		return usageErrorf("--since %s and --include-undated only apply to --source %s", ingest.SinceLastRun, ingest.SourceLibrariesIO)
+	case len(ingestInputs) > 0 || ingestNamesFile != "" || ingestDryRun:
+		return usageErrorf("--since cannot be combined with --input, --names-file or --dry-run")
+	case ingestSince == ingest.SinceLastRun:
+		return nil
+	}
+	if _, err := ingest.ParseSince(ingestSince); err != nil {
+		return usageErrorf("--since %v", err)
+	}
+	return nil
+}
+
+// parseSince parses the --since flag, a date or an RFC 3339 timestamp, or last for the time the last ingestion from
+// libraries.io into the directory of outPath finished. Without it every package is ingested, and the Go module index
+// is read from its start.
+func parseSince(since, outPath string) (time.Time, error) {
+	switch since {
+	case "":
+		return time.Time{}, nil
+	case ingest.SinceLastRun:
+		finished, err := ingest.LastRunFinished(outPath)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("--since %s: %w", since, err)
+		}
+		return finished, nil
+	}
+	// Already validated by validateSince
+	parsed, _ := ingest.ParseSince(since)
+	return parsed, nil
+}
+
+// validateIngestFlags checks the flags of the ingest command that would otherwise be silently replaced by defaults.
+func validateIngestFlags() error {
+	switch {
+	case len(ingestPlatforms) == 0:
+		return usageErrorf("--platforms must name at least one platform")
+	case ingestPerPage < 1 || ingestPerPage > ingest.MaxPerPage:
+		return usageErrorf("--per-page must be between 1 and %d, got %d", ingest.MaxPerPage, ingestPerPage)
+	case ingestMaxPages < 0:
+		return usageErrorf("--max-pages must not be negative, got %d", ingestMaxPages)
+	case ingestMax < 0:
+		return usageErrorf("--max-packages must not be negative, got %d", ingestMax)
+	case ingestMinStars < 0:
+		return usageErrorf("--min-stars must not be negative, got %d", ingestMinStars)
+	case ingestMinRank < 0:
+		return usageErrorf("--min-rank must not be negative, got %d", ingestMinRank)
+	case ingestWorkers < 1:
+		return usageErrorf("--workers must be at least 1, got %d", ingestWorkers)
+	case ingestAttempts < 1:
+		return usageErrorf("--max-attempts must be at least 1, got %d", ingestAttempts)
+	case ingestTimeout < 0:
+		return usageErrorf("--timeout must not be negative, got %v", ingestTimeout)
+	case ingestSplit && ingestNormalized:
+		return usageErrorf("--split and --normalized cannot be combined")
+	case ingestUpdate && ingestNormalized:
+		return usageErrorf("--update and --normalized cannot be combined")
+	case ingestLevel < 0 || ingestLevel > gzip.BestCompression:
+		return usageErrorf("--compression-level must be between 1 and %d, got %d", gzip.BestCompression, ingestLevel)
+	case ingestCompress && ingestNormalized:
+		return usageErrorf("--compress only applies to a single output file, not to --normalized")
+	}
+	return nil
+}
+
+// platformError turns the errors about a platform libraries.io does not support or an unknown column, which are only
+// found out once the options are validated, into usage errors.
+func platformError(err error) error {
+	if errors.Is(err, ingest.ErrUnknownPlatform) || errors.Is(err, ingest.ErrUnknownColumn) {
+		return usageError{err}
+	}
+	return err
+}
+
+// platformOutPath derives the output file of a single platform from the --out path, e.g. data/out/result-npm.csv, or
+// data/out/result-npm.csv.gz for compressed output.
+func platformOutPath(outPath, platform string) string {
+	uncompressed := ingest.TrimCompressedExt(outPath)
+	ext := filepath.Ext(uncompressed)
+	return strings.TrimSuffix(uncompressed, ext) + "-" + strings.ToLower(platform) + ext + outPath[len(uncompressed):]
+}
+
+// progressInterval is how often --progress prints a line at most.
+const progressInterval = time.Second
+
+// printProgress returns a progress callback that prints a line such as "Ingested 120/500 packages" to w, at most once
+// per progressInterval apart from the line for the last package.
+func printProgress(w io.Writer) func(fetched, total int) {
+	var last time.Time
+	return func(fetched, total int) {
+		if time.Since(last) < progressInterval && fetched != total {
+			return
+		}
+		last = time.Now()
+		if total < 0 {
+			fmt.Fprintf(w, "Ingested %d packages\n", fetched)
+			return
+		}
+		fmt.Fprintf(w, "Ingested %d/%d packages\n", fetched, total)
+	}
+}
+
+// ingestFlagAliases are other names the ingest flags are accepted under, such as the --platform and --pages of the
+// original command line.
+var ingestFlagAliases = map[string]string{
+	"platform": "platforms",
+	"pages":    "max-pages",
+}
+
+// normalizeIngestFlag resolves the aliases in ingestFlagAliases to the flags they stand for.
+func normalizeIngestFlag(_ *pflag.FlagSet, name string) pflag.NormalizedName {
+	if flag, ok := ingestFlagAliases[name]; ok {
+		name = flag
+	}
+	return pflag.NormalizedName(name)
+}
+
+// writeStats writes the stats of an ingestion to path as JSON, replacing the file there only once it is complete.
+// Nothing is written if path is empty.
+func writeStats(path string, stats ingest.Stats) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding stats: %w", err)
+	}
+	f, err := ingest.CreateAtomic(path)
+	if err != nil {
+		return fmt.Errorf("writing stats: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Abort()
+		return fmt.Errorf("writing stats: %w", err)
+	}
+	return f.Commit()
+}
+
+func init() {
+	rootCmd.AddCommand(ingestCmd)
+
+	ingestCmd.Flags().StringVar(&ingestConfig, "config", "", "A YAML file with settings for the other flags, e.g. stm.yaml, which the flags given override")
+	ingestCmd.Flags().StringVar(&ingestSource, "source", ingest.SourceLibrariesIO, "Where to download the packages from, librariesio, npm for the npm registry, goindex for the Go module index, goproxy for the Go module proxy, registries for the registry of each package's platform or crates for a crates.io search")
+	ingestCmd.Flags().StringVar(&ingestQuery, "query", "", "What to search crates.io for with --source crates, e.g. serde (defaults to all crates)")
+	ingestCmd.Flags().StringSliceVar(&ingestPackages, "packages", nil, "A comma-separated list of the packages to download with --source npm, goproxy or registries, e.g. react,@babel/core, or npm:react,maven:org.slf4j:slf4j-api for registries")
+	ingestCmd.Flags().StringVar(&ingestSince, "since", "", "A date or RFC 3339 timestamp, e.g. 2024-01-01, to ingest only packages released after, or to read the Go module index from with --source goindex (last continues from the last run into the directory of --out)")
+	ingestCmd.Flags().StringSliceVar(&ingestPlatforms, "platforms", []string{"NPM"}, "A comma-separated list of the libraries.io platforms to ingest, also accepted as --platform")
+	ingestCmd.Flags().StringVar(&ingestNamesFile, "names-file", "", "A file with one package name per line of the platform in --platforms to download instead of searching, e.g. data/top-npm.txt")
+	ingestCmd.Flags().StringSliceVar(&ingestInputs, "input", nil, "A comma-separated list of JSON files, directories or globs to read packages from instead of libraries.io, e.g. data/input/*.json")
+	ingestCmd.Flags().BoolVar(&ingestSplit, "split", false, "Write one file per platform, named after --out, instead of a single combined file")
+	ingestCmd.Flags().StringVar(&ingestAPIKey, "api-key", "", "The libraries.io API key, used when "+ingest.APIKeyEnvVar+" is not set")
+	ingestCmd.Flags().IntVar(&ingestPerPage, "per-page", 20, "The number of packages to request per page, at most 100")
+	ingestCmd.Flags().StringVar(&ingestOutPath, "out", "data/out/result.csv", "The path of the file to write")
+	ingestCmd.Flags().BoolVar(&ingestDeps, "dependencies", false, "Also fetch the dependencies of the latest release of every package, which takes an extra request per package")
+	ingestCmd.Flags().BoolVar(&ingestVulns, "vulnerabilities", false, "Also count the known vulnerabilities of the latest release of every package in the OSV database, which takes an extra request per page")
+	ingestCmd.Flags().BoolVar(&ingestVersions, "versions", true, "Fetch the versions of packages whose search result lists none, which takes an extra request per such package (--versions=false skips them)")
+	ingestCmd.Flags().BoolVar(&ingestPrerelease, "include-prerelease", false, "Keep prerelease versions such as 2.0.0-beta.1, which are left out by default")
+	ingestCmd.Flags().BoolVar(&ingestUndated, "include-undated", false, "With --since, keep packages whose latest release time is not known, which are left out by default")
+	ingestCmd.Flags().StringSliceVar(&ingestNoLicenses, "exclude-licenses", nil, "A comma-separated list of licenses, e.g. Proprietary,GPL-3.0, to leave out packages licensed only under them")
+	ingestCmd.Flags().StringSliceVar(&ingestKeywords, "keywords", nil, "A comma-separated list of keywords, e.g. crypto,hash, to keep only packages tagged with at least one of them")
+	ingestCmd.Flags().StringSliceVar(&ingestLanguages, "languages", nil, "A comma-separated list of languages, e.g. JavaScript,TypeScript, to keep only packages written in one of them")
+	ingestCmd.Flags().IntVar(&ingestMinStars, "min-stars", 0, "Keep only packages whose repository has at least this many stars (0 means no minimum)")
+	ingestCmd.Flags().IntVar(&ingestMinRank, "min-rank", 0, "Keep only packages with at least this libraries.io SourceRank (0 means no minimum)")
+	ingestCmd.Flags().BoolVar(&ingestNormalized, "normalized", false, "Write separate packages, versions and dependencies CSV files to the directory of --out")
+	ingestCmd.Flags().BoolVar(&ingestProgress, "progress", false, "Print the number of packages ingested so far to stderr every second")
+	ingestCmd.Flags().StringVar(&ingestStatsOut, "stats-out", "", "Also write statistics about the ingestion as JSON to this path, e.g. data/out/result.stats.json (with --split, one file per platform)")
+	ingestCmd.Flags().StringVar(&ingestCacheDir, "cache-dir", "data/cache", "The directory in which libraries.io responses are cached between runs")
+	ingestCmd.Flags().DurationVar(&ingestCacheTTL, "cache-ttl", 24*time.Hour, "How long cached responses are used (0 means forever)")
+	ingestCmd.Flags().BoolVar(&ingestNoCache, "no-cache", false, "Neither read nor write cached responses")
+	ingestCmd.Flags().BoolVar(&ingestRefresh, "refresh", false, "Ignore cached responses and overwrite them with fresh ones")
+	ingestCmd.Flags().BoolVar(&ingestRestart, "restart", false, "Ignore the checkpoint of an interrupted run and start over instead of resuming it")
+	ingestCmd.Flags().BoolVar(&ingestUpdate, "update", false, "Refresh an existing output, fetching the versions and dependencies of new and changed packages only")
+	ingestCmd.Flags().StringVar(&ingestFormat, "format", "csv", "The output format, csv, ndjson, json or sqlite (defaults to the extension of --out)")
+	ingestCmd.Flags().StringVar(&ingestDecode, "decode", "strict", "What to do with a package in the search results that cannot be decoded, strict to fail or lenient to skip it with a warning")
+	ingestCmd.Flags().BoolVar(&ingestCompress, "compress", false, "Gzip the output file, adding .gz to --out (an --out ending in .gz is always compressed)")
+	ingestCmd.Flags().IntVar(&ingestLevel, "compression-level", 0, "The gzip level of compressed output, from 1 (fastest) to 9 (smallest) (0 means the default level)")
+	ingestCmd.Flags().StringSliceVar(&ingestColumns, "columns", nil, "A comma-separated list of the CSV columns to write, in order, e.g. name,latest_release_number (defaults to all of them)")
+	ingestCmd.Flags().IntVar(&ingestMaxPages, "max-pages", 0, "The maximum number of pages to request per platform, also accepted as --pages (0 means no limit)")
+	ingestCmd.Flags().IntVar(&ingestMax, "max-packages", 0, "The maximum number of packages to ingest per platform (0 means no limit)")
+	ingestCmd.Flags().IntVar(&ingestRate, "requests-per-minute", 60, "The maximum number of requests sent to libraries.io per minute (negative means no limit)")
+	ingestCmd.Flags().IntVar(&ingestAttempts, "max-attempts", 5, "How often a request is sent before giving up on transient failures")
+	ingestCmd.Flags().DurationVar(&ingestTimeout, "timeout", 0, "Stop the whole ingestion after this long, leaving the previous output untouched (0 means no limit)")
+	ingestCmd.Flags().DurationVar(&ingestReqTimeout, "request-timeout", 30*time.Second, "Give up on a single attempt of a request after this long and retry it (negative means no limit)")
+	ingestCmd.Flags().BoolVar(&ingestDryRun, "dry-run", false, "Only request the first page of every platform and print an estimate of the pages, requests, time and output size of the run, without writing anything")
+	ingestCmd.Flags().IntVar(&ingestWorkers, "workers", 4, "The number of pages, and of versions and dependencies per page, to fetch concurrently")
+	ingestCmd.Flags().SetNormalizeFunc(normalizeIngestFlag)
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIngestFlagAliases(t *testing.T) {
+	platforms, maxPages := ingestPlatforms, ingestMaxPages
+	t.Cleanup(func() {
+		ingestPlatforms, ingestMaxPages = platforms, maxPages
+		for _, name := range []string{"platforms", "max-pages"} {
+			ingestCmd.Flags().Lookup(name).Changed = false
+		}
+	})
+
+	if err := ingestCmd.Flags().Parse([]string{"--platform", "Pypi,NPM", "--pages", "5"}); err != nil {
+		t.Fatalf("Expected --platform and --pages to be accepted, got %v", err)
+	}
+	if actual := strings.Join(ingestPlatforms, ","); actual != "Pypi,NPM" {
+		t.Errorf("Expected --platform to set the platforms, got %s", actual)
+	}
+	if ingestMaxPages != 5 {
+		t.Errorf("Expected --pages to set the maximum number of pages, got %d", ingestMaxPages)
+	}
+	if !ingestCmd.Flags().Changed("platforms") || !ingestCmd.Flags().Changed("max-pages") {
+		t.Error("Expected the aliases to count as the flags they stand for")
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	localDir        string
+	localOutPath    string
+	localFormat     string
+	localColumns    []string
+	localNormalized bool
+	localStatsOut   string
+)
+
+// localCmd represents the ingest local command
+var localCmd = &cobra.Command{
+	Use:   "local",
+	Short: "Reads the package.json and package-lock.json files of a directory tree into the output of ingest",
+	Long: `Searches --dir, e.g. a corpus of checked-out repositories, for package.json, package-lock.json and
+npm-shrinkwrap.json files and writes the npm packages they describe with the same columns and fields as ingest,
+without sending any requests. node_modules and hidden directories are left out.
+Every package.json contributes its package with the dependencies it declares, whose kind tells whether they come from
+dependencies, devDependencies or peerDependencies, and every lockfile the packages it installs. Dependencies on local
+paths, such as file:../shared, are written as they are and not resolved.`,
+	Args: usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if localDir == "" {
+			return usageErrorf("--dir must name the directory to read")
+		}
+		format, err := ingest.ParseFormat(localFormat)
+		if err != nil {
+			return usageError{err}
+		}
+		// Without --format the extension of --out decides, and without --out the format decides the extension
+		if pathFormat, ok := ingest.FormatForPath(localOutPath); ok && !cmd.Flags().Changed("format") {
+			format = pathFormat
+		} else if !cmd.Flags().Changed("out") {
+			localOutPath = strings.TrimSuffix(localOutPath, filepath.Ext(localOutPath)) + "." + format.String()
+		}
+		if len(localColumns) > 0 && (format != ingest.FormatCSV || localNormalized) {
+			return usageErrorf("--columns only applies to a single CSV file")
+		}
+
+		opts := ingest.Options{Format: format, Columns: localColumns}
+		var stats ingest.Stats
+		if localNormalized {
+			stats, err = ingest.IngestLocalNormalized(cmd.Context(), opts, localDir, filepath.Dir(localOutPath))
+		} else {
+			stats, err = ingest.IngestLocal(cmd.Context(), opts, localDir, localOutPath)
+		}
+		if err != nil {
+			return platformError(err)
+		}
+		return writeStats(localStatsOut, stats)
+	},
+}
+
+func init() {
+	ingestCmd.AddCommand(localCmd)
+
+	localCmd.Flags().StringVar(&localDir, "dir", "", "The directory to search for package.json and package-lock.json files, e.g. ./corpus")
+	localCmd.Flags().StringVar(&localOutPath, "out", "data/out/local.csv", "The path of the file to write")
+	localCmd.Flags().StringVar(&localFormat, "format", "csv", "The output format, csv, ndjson, json or sqlite (defaults to the extension of --out)")
+	localCmd.Flags().StringSliceVar(&localColumns, "columns", nil, "A comma-separated list of the CSV columns to write, in order, e.g. name,latest_release_number (defaults to all of them)")
+	localCmd.Flags().BoolVar(&localNormalized, "normalized", false, "Write separate packages, versions and dependencies CSV files to the directory of --out")
+	localCmd.Flags().StringVar(&localStatsOut, "stats-out", "", "Also write statistics about the ingestion as JSON to this path")
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mavenRepoURL       string
+	mavenMetadataFiles []string
+	mavenOutPath       string
+)
+
+// mavenCmd represents the maven command
+var mavenCmd = &cobra.Command{
+	Use:   "maven [group:artifact...]",
+	Short: "Writes the versions of Maven artifacts to a CSV file",
+	Long: `Reads the maven-metadata.xml of every given artifact and writes one CSV row per version to --out.
+The metadata is fetched from --repo for group:artifact coordinates, such as junit:junit, or read from local files
+with --metadata-file. Artifacts the repository does not know are skipped with a warning.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && len(mavenMetadataFiles) == 0 {
+			return usageErrorf("expected group:artifact coordinates or --metadata-file")
+		}
+		if len(args) > 0 && len(mavenMetadataFiles) > 0 {
+			return usageErrorf("coordinates and --metadata-file cannot be combined")
+		}
+		for _, coordinate := range args {
+			groupID, artifactID, ok := strings.Cut(coordinate, ":")
+			if !ok || groupID == "" || artifactID == "" {
+				return usageErrorf("invalid Maven coordinate %q: expected group:artifact", coordinate)
+			}
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(mavenMetadataFiles) > 0 {
+			_, err := ingest.IngestMavenFiles(cmd.Context(), mavenMetadataFiles, mavenOutPath)
+			return err
+		}
+		_, err := ingest.IngestMaven(cmd.Context(), mavenRepoURL, args, mavenOutPath)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mavenCmd)
+
+	mavenCmd.Flags().StringVar(&mavenRepoURL, "repo", ingest.MavenCentralURL, "The base URL of the Maven repository to fetch the metadata from, e.g. a mirror or a Nexus instance")
+	mavenCmd.Flags().StringSliceVar(&mavenMetadataFiles, "metadata-file", nil, "A comma-separated list of local maven-metadata.xml files to read instead of fetching coordinates")
+	mavenCmd.Flags().StringVar(&mavenOutPath, "out", "data/out/maven.csv", "The path of the CSV file to write")
+}
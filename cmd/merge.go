@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+	"github.com/spf13/cobra"
+)
+
+var mergeOutPath string
+
+// mergeCmd represents the merge command
+var mergeCmd = &cobra.Command{
+	Use:   "merge --out <file> <input>...",
+	Short: "Combines CSV files written by ingest into one",
+	Long: `Merges CSV files written by ingest, such as the outputs of runs per platform or per week, into the file given
+by --out. The inputs must all have the same columns. A package that is in more than one of them is written once, with
+the row whose latest release was published last; if that is the same, the row of the later input is kept, so inputs
+are best given from the oldest run to the newest.
+
+The packages that more than one input has with different data are listed in merge_conflicts.csv next to the output,
+to audit how the data changed between runs, and the output is recorded in the manifest of its directory. Any of the
+files may be gzip-compressed, and --out may be one of the inputs, which is only replaced once the merge is complete.`,
+	Args:         usageArgs(cobra.MinimumNArgs(1)),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if mergeOutPath == "" {
+			return usageErrorf("--out is required")
+		}
+		stats, err := ingest.Merge(cmd.Context(), args, mergeOutPath)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Merged %d packages, removed %d duplicates\n", stats.Packages, stats.Duplicates)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+
+	mergeCmd.Flags().StringVar(&mergeOutPath, "out", "", "The path of the CSV file to write")
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+
+	g "github.com/AJMBrands/SoftwareThatMatters/graph"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pathInPath  string
+	pathIsMaven bool
+)
+
+// pathCmd represents the path command
+var pathCmd = &cobra.Command{
+	Use:   "path <from> <to>",
+	Short: "Prints the chain of dependencies through which one package version depends on another",
+	Long: `Creates the graph from a JSON file and prints one of the shortest chains of dependencies that lead from one
+package version to the other, one per line, starting with <from>. Both are given as name-version, e.g.
+express-4.18.2. Exits with an error if <from> does not depend on <to>, even indirectly.`,
+	Args:         usageArgs(cobra.ExactArgs(2)),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		directed, _, stringIDToNodeInfo, idToNodeInfo, _ := g.CreateGraph(pathInPath, pathIsMaven)
+		path, err := g.ShortestPath(g.NewGraphFromMaps(directed, stringIDToNodeInfo, idToNodeInfo), args[0], args[1])
+		if err != nil {
+			return err
+		}
+		for _, node := range path {
+			fmt.Fprintln(cmd.OutOrStdout(), node)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pathCmd)
+
+	pathCmd.Flags().StringVar(&pathInPath, "in", "data/input/test_data.json", "The JSON file to create the graph from")
+	pathCmd.Flags().BoolVar(&pathIsMaven, "maven", false, "Whether the packages come from Maven")
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+	"runtime/pprof"
+
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+)
+
+var (
+	cpuProfilePath string
+	memProfilePath string
+)
+
+// stopProfiling finishes the profiles that startProfiling started. Execute calls it once the command has returned.
+var stopProfiling = func() {}
+
+// startProfiling starts a CPU profile at --cpuprofile and prepares a heap profile at --memprofile, which is written
+// when stopProfiling is called. If either is given, stopProfiling also logs how much memory the command allocated.
+func startProfiling() error {
+	if cpuProfilePath == "" && memProfilePath == "" {
+		return nil
+	}
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	var cpuProfile *ingest.AtomicFile
+	if cpuProfilePath != "" {
+		f, err := ingest.CreateAtomic(cpuProfilePath)
+		if err != nil {
+			return fmt.Errorf("creating the CPU profile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Abort()
+			return fmt.Errorf("starting the CPU profile: %w", err)
+		}
+		cpuProfile = f
+	}
+
+	stopProfiling = func() {
+		stopProfiling = func() {}
+		if cpuProfile != nil {
+			pprof.StopCPUProfile()
+			if err := cpuProfile.Commit(); err != nil {
+				slog.Error("Could not write the CPU profile", "path", cpuProfilePath, "error", err)
+			}
+		}
+		if memProfilePath != "" {
+			if err := writeHeapProfile(memProfilePath); err != nil {
+				slog.Error("Could not write the heap profile", "path", memProfilePath, "error", err)
+			}
+		}
+		var after runtime.MemStats
+		runtime.ReadMemStats(&after)
+		slog.Info("Memory", "allocated_bytes", after.TotalAlloc-before.TotalAlloc, "heap_bytes_before", before.HeapAlloc,
+			"heap_bytes_after", after.HeapAlloc, "gc_cycles", after.NumGC-before.NumGC)
+	}
+	return nil
+}
+
+// writeHeapProfile writes a heap profile to path, after a garbage collection so that it reflects live objects.
+func writeHeapProfile(path string) error {
+	f, err := ingest.CreateAtomic(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
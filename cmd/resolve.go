@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"os"
+	"strings"
+
+	"github.com/AJMBrands/SoftwareThatMatters/graph"
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	resolveFormat  string
+	resolveOutPath string
+)
+
+// resolveCmd represents the resolve command
+var resolveCmd = &cobra.Command{
+	Use:   "resolve <platform> <package> <version>",
+	Short: "Prints the dependency graph deps.dev resolved for a package version",
+	Long: `Fetches the dependency graph of a package version from deps.dev, whose edges point to the exact versions the
+dependencies resolved to rather than to the version ranges libraries.io reports, and includes the indirect
+dependencies. deps.dev covers Cargo, Go, Maven, NPM, NuGet, Pypi and Rubygems.
+
+Without --out, the edges are printed as CSV with the dependent, the dependency and the requirement that resolved to
+it. With --out, the graph is written in the --format of export instead, e.g. graphml, dot, edgelist or cyclonedx.`,
+	Args:         usageArgs(cobra.ExactArgs(3)),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, isGraph := graphFormats[strings.ToLower(resolveFormat)]
+		if resolveOutPath != "" && !isGraph {
+			return usageErrorf("--format must be graphml, dot, edgelist or cyclonedx, got %q", resolveFormat)
+		}
+		if resolveOutPath == "" && resolveFormat != "" {
+			return usageErrorf("--format needs --out")
+		}
+		platform, name, version := args[0], args[1], args[2]
+		dependencies, err := ingest.FetchResolvedDependencies(cmd.Context(), platform, name, version)
+		if err != nil {
+			return platformError(err)
+		}
+		if resolveOutPath != "" {
+			g := graph.NewPackageGraph()
+			g.AddResolved(platform, dependencies)
+			return format.write(g, resolveOutPath)
+		}
+
+		writer := csv.NewWriter(os.Stdout)
+		writer.Write([]string{"name", "version", "dependency", "dependency_version", "requirement"})
+		for _, dependency := range dependencies {
+			writer.Write([]string{dependency.From.Name, dependency.From.Version, dependency.To.Name, dependency.To.Version, dependency.Requirement})
+		}
+		writer.Flush()
+		return writer.Error()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resolveCmd)
+
+	resolveCmd.Flags().StringVar(&resolveFormat, "format", "", "The graph format to write to --out, graphml, dot, edgelist or cyclonedx")
+	resolveCmd.Flags().StringVar(&resolveOutPath, "out", "", "The path of the graph to write instead of printing the edges")
+}
@@ -1,30 +1,131 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
 	"github.com/spf13/cobra"
 )
 
+const (
+	// exitFailure is the exit status after a command failed
+	exitFailure = 1
+	// exitUsage is the exit status after a command was given invalid flags or arguments
+	exitUsage = 2
+	// exitInterrupted is the exit status after a command was stopped by SIGINT or SIGTERM, following the shell
+	// convention of 128 plus the signal number of SIGINT
+	exitInterrupted = 130
+)
+
+var (
+	verbose  bool
+	quiet    bool
+	logLevel string
+)
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "stm-graph",
 	Short: "SoftwareThatMatters-Graph is an application that creates a graph from a JSON file and allows you to query it",
 	Long: `SoftwareThatMatters-Graph is an application that loads a list of packages and their dependencies
 from a JSON, creates a time-dependent graph from and allows you to query it.
-The accepted json format can be found at TODO: Point to JSON format.`,
+The accepted json format can be found at TODO: Point to JSON format.
+Every command exits with status 0 on success, 1 on failure, 2 on invalid flags or arguments and 130 when it was
+interrupted.`,
+	// Errors in flags and arguments print the usage in Execute, any other error only the error itself
+	SilenceUsage: true,
 
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := setUpLogging(cmd); err != nil {
+			return err
+		}
+		return startProfiling()
+	},
+}
+
+// setUpLogging sends logs to stderr, keeping stdout free for output that is piped on. --log-level picks the lowest
+// level that is logged, debug, info, warn or error. --verbose is short for debug, which adds a log per request and
+// response, and --quiet for warn.
+func setUpLogging(cmd *cobra.Command) error {
+	level := slog.LevelInfo
+	switch flags := cmd.Flags(); {
+	case verbose && quiet:
+		return usageErrorf("--verbose and --quiet cannot be combined")
+	case flags.Changed("log-level") && (verbose || quiet):
+		return usageErrorf("--log-level cannot be combined with --verbose or --quiet")
+	case verbose:
+		level = slog.LevelDebug
+	case quiet:
+		level = slog.LevelWarn
+	default:
+		if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+			return usageErrorf("--log-level must be debug, info, warn or error, got %q", logLevel)
+		}
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+	return nil
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// SIGINT and SIGTERM cancel the context of the command, so that it can stop cleanly. A second signal kills the process.
 func Execute() {
-	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	cmd, err := rootCmd.ExecuteContextC(ctx)
+	stop()
+	stopProfiling()
+	var usageErr usageError
+	switch {
+	case errors.Is(err, ingest.ErrInterrupted):
+		os.Exit(exitInterrupted)
+	case errors.As(err, &usageErr):
+		cmd.PrintErrln(cmd.UsageString())
+		os.Exit(exitUsage)
+	case err != nil:
+		os.Exit(exitFailure)
+	}
+}
+
+// usageError is an error in the flags or arguments of a command, after which Execute prints the usage of the command
+// and exits with exitUsage.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e usageError) Unwrap() error {
+	return e.err
+}
+
+// usageErrorf formats an error as a usageError.
+func usageErrorf(format string, args ...interface{}) error {
+	return usageError{fmt.Errorf(format, args...)}
+}
+
+// usageArgs turns the errors of validate into usage errors.
+func usageArgs(validate cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := validate(cmd, args); err != nil {
+			return usageError{err}
+		}
+		return nil
 	}
 }
 
@@ -34,6 +135,14 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.SoftwareThatMatters.yaml)")
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return usageError{err}
+	})
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Also log debug messages, such as every request sent")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only log warnings and errors")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "The lowest level to log, debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&cpuProfilePath, "cpuprofile", "", "Write a CPU profile of the command to the given file, for go tool pprof")
+	rootCmd.PersistentFlags().StringVar(&memProfilePath, "memprofile", "", "Write a heap profile to the given file once the command is done, for go tool pprof")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+	"github.com/spf13/cobra"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify [manifest]",
+	Short: "Checks that the outputs of ingest still match their manifest",
+	Long: `Hashes the files listed in a manifest.json written by ingest again and prints for each of them whether it still
+has the SHA-256 and size recorded when it was written. The manifest may be given as the file or as the directory it is
+in, and defaults to the one in the current directory. Exits with an error if any file is missing or changed.`,
+	Args:         usageArgs(cobra.MaximumNArgs(1)),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := "."
+		if len(args) == 1 {
+			path = args[0]
+		}
+		checks, err := ingest.VerifyManifest(path)
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, check := range checks {
+			if check.Err != nil {
+				failed++
+				fmt.Fprintf(cmd.OutOrStdout(), "FAILED %s: %v\n", check.Path, check.Err)
+				continue
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "OK     %s\n", check.Path)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d files do not match the manifest", failed, len(checks))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
@@ -0,0 +1,161 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// PackageVersion is a version of a package reached while computing a transitive closure.
+type PackageVersion struct {
+	Name    string
+	Version string
+	// Depth is the length of the shortest dependency path leading to this version, 1 for direct dependencies.
+	Depth int
+}
+
+// TransitiveDependencies returns every package version the given version of a package depends on, directly or
+// indirectly, each one once at the depth it is first reached at by a breadth-first search. Cycles are handled, and the
+// package itself is only part of the result if it depends on itself through a cycle. The result is sorted by depth,
+// then by name and version. An error is returned if the package version is not in the graph.
+func (g *Graph) TransitiveDependencies(name, version string) ([]PackageVersion, error) {
+	root, ok := g.Node(fmt.Sprintf("%s-%s", name, version))
+	if !ok {
+		return nil, fmt.Errorf("package %s version %s not found", name, version)
+	}
+
+	depths := g.dependencyDepths(root.id)
+	result := make([]PackageVersion, 0, len(depths))
+	for id, depth := range depths {
+		nodeInfo := g.idToNodeInfo[id]
+		result = append(result, PackageVersion{Name: nodeInfo.Name, Version: nodeInfo.Version, Depth: depth})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Depth != result[j].Depth {
+			return result[i].Depth < result[j].Depth
+		}
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
+
+// TransitiveDeps returns the stringIDs of every node reachable from root by following depends-on edges, each one once
+// and sorted. Like TransitiveDependencies it handles cycles, and root is only part of the result if it lies on one. An
+// error is returned if root is not in the graph.
+func TransitiveDeps(g *Graph, root string) ([]string, error) {
+	rootInfo, ok := g.Node(root)
+	if !ok {
+		return nil, fmt.Errorf("node %s not found", root)
+	}
+	depths := g.dependencyDepths(rootInfo.id)
+	result := make([]string, 0, len(depths))
+	for id := range depths {
+		result = append(result, g.idToNodeInfo[id].stringID)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// ReverseDeps returns the stringIDs of the nodes that depend on target, sorted. With transitive set, the nodes that
+// depend on it indirectly are included as well, which is everything affected by a problem in target. Like
+// TransitiveDeps it handles cycles. Nil is returned if target is not in the graph.
+func ReverseDeps(g *Graph, target string, transitive bool) []string {
+	targetInfo, ok := g.Node(target)
+	if !ok {
+		return nil
+	}
+	var ids []int64
+	if transitive {
+		for id := range g.reachableDepths(targetInfo.id, g.directed.To) {
+			ids = append(ids, id)
+		}
+	} else {
+		for dependents := g.directed.To(targetInfo.id); dependents.Next(); {
+			ids = append(ids, dependents.Node().ID())
+		}
+	}
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, g.idToNodeInfo[id].stringID)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ErrNoPath is returned by ShortestPath when no chain of dependencies leads from one node to the other.
+var ErrNoPath = errors.New("no dependency path")
+
+// ShortestPath returns the stringIDs along one of the shortest chains of dependencies through which from depends on
+// to, starting with from and ending with to, as found by a breadth-first search along the depends-on edges. Each node
+// is visited once, so cycles are handled, and dependencies are visited in order of their stringIDs, so the same path
+// is found every time. A node's path to itself is only that node. An error is returned if either node is not in the
+// graph, and one wrapping ErrNoPath if from does not depend on to.
+func ShortestPath(g *Graph, from, to string) ([]string, error) {
+	fromInfo, ok := g.Node(from)
+	if !ok {
+		return nil, fmt.Errorf("node %s not found", from)
+	}
+	toInfo, ok := g.Node(to)
+	if !ok {
+		return nil, fmt.Errorf("node %s not found", to)
+	}
+	parents := map[int64]int64{fromInfo.id: fromInfo.id}
+	queue := []int64{fromInfo.id}
+	for len(queue) > 0 {
+		if _, reached := parents[toInfo.id]; reached {
+			break
+		}
+		current := queue[0]
+		queue = queue[1:]
+		for _, dependency := range g.Neighbors(g.idToNodeInfo[current].stringID) {
+			if _, seen := parents[dependency.id]; !seen {
+				parents[dependency.id] = current
+				queue = append(queue, dependency.id)
+			}
+		}
+	}
+	if _, reached := parents[toInfo.id]; !reached {
+		return nil, fmt.Errorf("%w from %s to %s", ErrNoPath, from, to)
+	}
+	path := []string{to}
+	for id := toInfo.id; id != fromInfo.id; id = parents[id] {
+		path = append(path, g.idToNodeInfo[parents[id]].stringID)
+	}
+	// The path was collected backwards
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, nil
+}
+
+// dependencyDepths does a breadth-first search along the depends-on edges from root and returns the depth at which
+// every reachable node is first reached, 1 for direct dependencies.
+func (g *Graph) dependencyDepths(root int64) map[int64]int {
+	return g.reachableDepths(root, g.directed.From)
+}
+
+// reachableDepths does a breadth-first search from root, following the edges that next returns for a node, and
+// returns the depth at which every reachable node is first reached.
+func (g *Graph) reachableDepths(root int64, next func(id int64) graph.Nodes) map[int64]int {
+	depths := map[int64]int{}
+	queue := []int64{root}
+	for depth := 1; len(queue) > 0; depth++ {
+		var following []int64
+		for _, id := range queue {
+			for neighbors := next(id); neighbors.Next(); {
+				neighbor := neighbors.Node().ID()
+				if _, seen := depths[neighbor]; !seen {
+					depths[neighbor] = depth
+					following = append(following, neighbor)
+				}
+			}
+		}
+		queue = following
+	}
+	return depths
+}
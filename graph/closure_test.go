@@ -0,0 +1,169 @@
+package graph
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTransitiveDependencies(t *testing.T) {
+	// A depends on B and C, which both depend on D, and D depends back on B
+	g := newTestGraph(t, []string{"A", "B", "C", "D", "E"}, [][2]string{
+		{"A", "B"}, {"A", "C"}, {"B", "D"}, {"C", "D"}, {"D", "B"},
+	})
+
+	t.Run("Reports every dependency once at its shortest depth", func(t *testing.T) {
+		closure, err := g.TransitiveDependencies("A", "1.0.0")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expected := []PackageVersion{
+			{Name: "B", Version: "1.0.0", Depth: 1},
+			{Name: "C", Version: "1.0.0", Depth: 1},
+			{Name: "D", Version: "1.0.0", Depth: 2},
+		}
+		if !reflect.DeepEqual(closure, expected) {
+			t.Errorf("Expected %v, got %v", expected, closure)
+		}
+	})
+
+	t.Run("Includes the package itself when it is part of a cycle", func(t *testing.T) {
+		closure, err := g.TransitiveDependencies("B", "1.0.0")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expected := []PackageVersion{
+			{Name: "D", Version: "1.0.0", Depth: 1},
+			{Name: "B", Version: "1.0.0", Depth: 2},
+		}
+		if !reflect.DeepEqual(closure, expected) {
+			t.Errorf("Expected %v, got %v", expected, closure)
+		}
+	})
+
+	t.Run("Returns an empty closure for packages without dependencies", func(t *testing.T) {
+		closure, err := g.TransitiveDependencies("E", "1.0.0")
+		if err != nil || len(closure) != 0 {
+			t.Errorf("Expected an empty closure, got %v and %v", closure, err)
+		}
+	})
+
+	t.Run("Rejects unknown packages", func(t *testing.T) {
+		if _, err := g.TransitiveDependencies("F", "1.0.0"); err == nil {
+			t.Error("Expected an error for an unknown package")
+		}
+	})
+}
+
+func TestTransitiveDeps(t *testing.T) {
+	g := newTestGraph(t, []string{"A", "B", "C", "D", "E"}, [][2]string{
+		{"A", "B"}, {"A", "C"}, {"B", "D"}, {"C", "D"}, {"D", "B"},
+	})
+
+	t.Run("Deduplicates reachable nodes and survives cycles", func(t *testing.T) {
+		expected := []string{"B-1.0.0", "C-1.0.0", "D-1.0.0"}
+		actual, err := TransitiveDeps(g, "A-1.0.0")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Includes the root when it is part of a cycle", func(t *testing.T) {
+		expected := []string{"B-1.0.0", "D-1.0.0"}
+		if actual, _ := TransitiveDeps(g, "B-1.0.0"); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Rejects unknown roots", func(t *testing.T) {
+		if _, err := TransitiveDeps(g, "F-1.0.0"); err == nil {
+			t.Error("Expected an error for an unknown root")
+		}
+	})
+}
+
+func TestReverseDeps(t *testing.T) {
+	g := newTestGraph(t, []string{"app", "left", "right", "base", "lonely"}, [][2]string{
+		{"app", "left"}, {"app", "right"}, {"left", "base"}, {"right", "base"},
+	})
+
+	t.Run("Finds direct dependents", func(t *testing.T) {
+		expected := []string{"left-1.0.0", "right-1.0.0"}
+		if actual := ReverseDeps(g, "base-1.0.0", false); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Finds the full blast radius", func(t *testing.T) {
+		expected := []string{"app-1.0.0", "left-1.0.0", "right-1.0.0"}
+		if actual := ReverseDeps(g, "base-1.0.0", true); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Survives cycles", func(t *testing.T) {
+		g := newTestGraph(t, []string{"A", "B", "C"}, [][2]string{{"A", "B"}, {"B", "A"}, {"C", "A"}})
+		expected := []string{"A-1.0.0", "B-1.0.0", "C-1.0.0"}
+		if actual := ReverseDeps(g, "A-1.0.0", true); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Returns nothing for unknown or unused nodes", func(t *testing.T) {
+		if actual := ReverseDeps(g, "ghost-1.0.0", true); actual != nil {
+			t.Errorf("Expected nil for an unknown node, got %v", actual)
+		}
+		if actual := ReverseDeps(g, "lonely-1.0.0", true); len(actual) != 0 {
+			t.Errorf("Expected no dependents, got %v", actual)
+		}
+	})
+}
+
+func TestShortestPath(t *testing.T) {
+	g := newTestGraph(t, []string{"A", "B", "C", "D", "E", "F"}, [][2]string{
+		{"A", "B"}, {"B", "C"}, {"C", "D"}, {"A", "E"}, {"E", "D"}, {"D", "B"},
+	})
+
+	t.Run("Finds the shortest chain", func(t *testing.T) {
+		expected := []string{"A-1.0.0", "E-1.0.0", "D-1.0.0"}
+		actual, err := ShortestPath(g, "A-1.0.0", "D-1.0.0")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Follows cycles", func(t *testing.T) {
+		expected := []string{"C-1.0.0", "D-1.0.0", "B-1.0.0"}
+		if actual, _ := ShortestPath(g, "C-1.0.0", "B-1.0.0"); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Returns the node itself", func(t *testing.T) {
+		if actual, _ := ShortestPath(g, "A-1.0.0", "A-1.0.0"); !reflect.DeepEqual(actual, []string{"A-1.0.0"}) {
+			t.Errorf("Expected only A, got %v", actual)
+		}
+	})
+
+	t.Run("Reports missing paths", func(t *testing.T) {
+		// B only reaches the cycle it is part of
+		if _, err := ShortestPath(g, "B-1.0.0", "A-1.0.0"); !errors.Is(err, ErrNoPath) {
+			t.Errorf("Expected ErrNoPath, got %v", err)
+		}
+		if _, err := ShortestPath(g, "A-1.0.0", "F-1.0.0"); !errors.Is(err, ErrNoPath) {
+			t.Errorf("Expected ErrNoPath, got %v", err)
+		}
+	})
+
+	t.Run("Rejects unknown nodes", func(t *testing.T) {
+		if _, err := ShortestPath(g, "A-1.0.0", "G-1.0.0"); err == nil || errors.Is(err, ErrNoPath) {
+			t.Errorf("Expected an error for an unknown node, got %v", err)
+		}
+	})
+}
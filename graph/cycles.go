@@ -0,0 +1,67 @@
+package graph
+
+import (
+	"sort"
+
+	"gonum.org/v1/gonum/graph/topo"
+)
+
+// FindCycles returns one representative cycle for every strongly connected component of g that contains a cycle, as
+// found by Tarjan's algorithm. Each cycle lists the stringIDs of its nodes in dependency order, starting at the
+// smallest stringID of the component, and is one of the shortest cycles through that node; the edge back to the first
+// node is implied. The cycles are sorted by their first node. Removing one edge of every cycle does not necessarily
+// make g acyclic, since a component can contain several cycles, but every component must lose at least one edge.
+func FindCycles(g *Graph) [][]string {
+	var cycles [][]string
+	for _, component := range topo.TarjanSCC(g.directed) {
+		// Edges to self are never added, so a component of a single node has no cycle
+		if len(component) < 2 {
+			continue
+		}
+		members := make(map[int64]bool, len(component))
+		start := component[0].ID()
+		for _, node := range component {
+			members[node.ID()] = true
+			if g.idToNodeInfo[node.ID()].stringID < g.idToNodeInfo[start].stringID {
+				start = node.ID()
+			}
+		}
+		cycles = append(cycles, g.shortestCycle(start, members))
+	}
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i][0] < cycles[j][0]
+	})
+	return cycles
+}
+
+// shortestCycle does a breadth-first search from start within members, which must form a strongly connected
+// component, and returns the stringIDs along the first path that leads back to start.
+func (g *Graph) shortestCycle(start int64, members map[int64]bool) []string {
+	parents := map[int64]int64{start: start}
+	queue := []int64{start}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		// Visit the dependencies in a fixed order so the same cycle is found every time
+		for _, dependency := range g.Neighbors(g.idToNodeInfo[current].stringID) {
+			if dependency.id == start {
+				var cycle []string
+				for id := current; id != start; id = parents[id] {
+					cycle = append(cycle, g.idToNodeInfo[id].stringID)
+				}
+				cycle = append(cycle, g.idToNodeInfo[start].stringID)
+				// The path was collected backwards
+				for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+					cycle[i], cycle[j] = cycle[j], cycle[i]
+				}
+				return cycle
+			}
+			if _, seen := parents[dependency.id]; !seen && members[dependency.id] {
+				parents[dependency.id] = current
+				queue = append(queue, dependency.id)
+			}
+		}
+	}
+	// Unreachable for a strongly connected component
+	return nil
+}
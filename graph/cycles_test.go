@@ -0,0 +1,55 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+// newTestGraph creates a Graph with a node of version 1.0.0 for every name and the given edges between them.
+func newTestGraph(t *testing.T, names []string, edges [][2]string) *Graph {
+	t.Helper()
+	g := NewGraph()
+	for _, name := range names {
+		g.AddNode(name, "1.0.0", "")
+	}
+	for _, edge := range edges {
+		if err := g.AddEdge(edge[0]+"-1.0.0", edge[1]+"-1.0.0"); err != nil {
+			t.Fatalf("Could not add edge %v: %v", edge, err)
+		}
+	}
+	return g
+}
+
+func TestFindCycles(t *testing.T) {
+	t.Run("Finds no cycles in a DAG", func(t *testing.T) {
+		g := newTestGraph(t, []string{"A", "B", "C"}, [][2]string{{"A", "B"}, {"A", "C"}, {"B", "C"}})
+		if cycles := FindCycles(g); len(cycles) != 0 {
+			t.Errorf("Expected no cycles, got %v", cycles)
+		}
+	})
+
+	t.Run("Finds one cycle per strongly connected component", func(t *testing.T) {
+		g := newTestGraph(t, []string{"A", "B", "C", "D", "E", "F"}, [][2]string{
+			{"C", "A"}, {"A", "B"}, {"B", "C"}, // A -> B -> C -> A
+			{"D", "E"}, {"E", "D"}, // D <-> E
+			{"E", "F"}, // F only hangs off the second cycle
+		})
+		expected := [][]string{
+			{"A-1.0.0", "B-1.0.0", "C-1.0.0"},
+			{"D-1.0.0", "E-1.0.0"},
+		}
+		if actual := FindCycles(g); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected cycles %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Returns the shortest cycle of a component", func(t *testing.T) {
+		g := newTestGraph(t, []string{"A", "B", "C", "D"}, [][2]string{
+			{"A", "B"}, {"B", "C"}, {"C", "D"}, {"D", "A"}, {"B", "A"},
+		})
+		expected := [][]string{{"A-1.0.0", "B-1.0.0"}}
+		if actual := FindCycles(g); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected cycles %v, got %v", expected, actual)
+		}
+	})
+}
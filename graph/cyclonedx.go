@@ -0,0 +1,126 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+)
+
+// cycloneDXSpecVersion is the version of the CycloneDX specification the SBOMs follow.
+const cycloneDXSpecVersion = "1.5"
+
+type cycloneDXBOM struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	Version      int                   `json:"version"`
+	Metadata     cycloneDXMetadata     `json:"metadata"`
+	Components   []cycloneDXComponent  `json:"components"`
+	Dependencies []cycloneDXDependency `json:"dependencies"`
+}
+
+type cycloneDXMetadata struct {
+	Tools struct {
+		Components []cycloneDXComponent `json:"components"`
+	} `json:"tools"`
+}
+
+type cycloneDXComponent struct {
+	Type    string `json:"type"`
+	BOMRef  string `json:"bom-ref,omitempty"`
+	Group   string `json:"group,omitempty"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	PURL    string `json:"purl,omitempty"`
+}
+
+type cycloneDXDependency struct {
+	Ref string `json:"ref"`
+	// DependsOn is empty rather than left out for components without dependencies, as the specification asks
+	DependsOn []string `json:"dependsOn"`
+}
+
+// WriteCycloneDX writes g to w as a CycloneDX 1.5 JSON SBOM. Every node becomes a library component, referenced by its
+// stringID, and the edges become the dependencies section. Components get a package URL if their platform was recorded
+// with SetPlatforms and has a purl type, e.g. pkg:npm/%40babel/core@7.0.0 or pkg:maven/org.slf4j/slf4j-api@1.7.36.
+// Components are sorted by stringID and no timestamp is included, so the same graph always gives the same document.
+func WriteCycloneDX(g *Graph, w io.Writer) error {
+	stringIDs := make([]string, 0, g.Len())
+	for stringID := range g.stringIDToNodeInfo {
+		stringIDs = append(stringIDs, stringID)
+	}
+	sort.Strings(stringIDs)
+
+	bom := newCycloneDXBOM(len(stringIDs))
+	for _, stringID := range stringIDs {
+		nodeInfo := g.stringIDToNodeInfo[stringID]
+		bom.Components = append(bom.Components, newCycloneDXComponent(stringID, g.Platform(stringID), nodeInfo.Name, nodeInfo.Version))
+		dependency := cycloneDXDependency{Ref: stringID, DependsOn: []string{}}
+		for _, neighbor := range g.Neighbors(stringID) {
+			dependency.DependsOn = append(dependency.DependsOn, neighbor.stringID)
+		}
+		bom.Dependencies = append(bom.Dependencies, dependency)
+	}
+	return writeCycloneDX(w, bom)
+}
+
+// WriteCycloneDX writes g to w as a CycloneDX 1.5 JSON SBOM like the WriteCycloneDX function, with the node keys as
+// references and the platform of every component taken from its key.
+func (g *PackageGraph) WriteCycloneDX(w io.Writer) error {
+	nodes := g.Nodes()
+	bom := newCycloneDXBOM(len(nodes))
+	for _, key := range nodes {
+		platform, name, version := SplitPackageKey(key)
+		bom.Components = append(bom.Components, newCycloneDXComponent(key, platform, name, version))
+		dependencies := g.Dependencies(key)
+		if dependencies == nil {
+			dependencies = []string{}
+		}
+		bom.Dependencies = append(bom.Dependencies, cycloneDXDependency{Ref: key, DependsOn: dependencies})
+	}
+	return writeCycloneDX(w, bom)
+}
+
+func newCycloneDXBOM(components int) cycloneDXBOM {
+	bom := cycloneDXBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  cycloneDXSpecVersion,
+		Version:      1,
+		Components:   make([]cycloneDXComponent, 0, components),
+		Dependencies: make([]cycloneDXDependency, 0, components),
+	}
+	bom.Metadata.Tools.Components = []cycloneDXComponent{{Type: "application", Name: "SoftwareThatMatters"}}
+	return bom
+}
+
+// newCycloneDXComponent returns the component of a package version. Maven names of the form group:artifact are split
+// into the group and name of the component.
+func newCycloneDXComponent(ref, platform, name, version string) cycloneDXComponent {
+	component := cycloneDXComponent{Type: "library", BOMRef: ref, Name: name, Version: version, PURL: PackageURL(platform, name, version)}
+	if group, artifact, ok := strings.Cut(name, ":"); ok && strings.EqualFold(platform, "maven") {
+		component.Group, component.Name = group, artifact
+	}
+	return component
+}
+
+func writeCycloneDX(w io.Writer, bom cycloneDXBOM) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(bom); err != nil {
+		return fmt.Errorf("writing CycloneDX: %w", err)
+	}
+	return nil
+}
+
+// PackageURL returns the package URL of a version of a package on a libraries.io platform as ingest.ToPURL builds it,
+// e.g. pkg:npm/%40babel/core@7.0.0. It returns "" if the platform has no purl type or the name is empty.
+func PackageURL(platform, name, version string) string {
+	purl, err := ingest.ToPURL(platform, name, version)
+	if err != nil {
+		return ""
+	}
+	return purl
+}
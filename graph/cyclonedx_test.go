@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestPackageURL(t *testing.T) {
+	if actual := PackageURL("NPM", "@babel/core", "7.0.0"); actual != "pkg:npm/%40babel/core@7.0.0" {
+		t.Errorf("Expected pkg:npm/%%40babel/core@7.0.0, got %s", actual)
+	}
+	if actual := PackageURL("Bower", "jquery", "3.0.0"); actual != "" {
+		t.Errorf("Expected no purl for Bower, got %s", actual)
+	}
+}
+
+// decodeCycloneDX decodes an SBOM written by one of the WriteCycloneDX functions.
+func decodeCycloneDX(t *testing.T, data []byte) cycloneDXBOM {
+	t.Helper()
+	var bom cycloneDXBOM
+	if err := json.Unmarshal(data, &bom); err != nil {
+		t.Fatalf("Expected valid JSON, got %v", err)
+	}
+	if bom.BOMFormat != "CycloneDX" || bom.SpecVersion != "1.5" || bom.Version != 1 {
+		t.Errorf("Expected a CycloneDX 1.5 document, got %+v", bom)
+	}
+	return bom
+}
+
+func TestWriteCycloneDX(t *testing.T) {
+	g := newTestGraph(t, []string{"A", "B", "org.example:lib"}, [][2]string{{"A", "B"}, {"A", "org.example:lib"}})
+	g.SetPlatforms(map[string]string{"A-1.0.0": "NPM", "B-1.0.0": "NPM", "org.example:lib-1.0.0": "Maven"})
+
+	var buf bytes.Buffer
+	if err := WriteCycloneDX(g, &buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	bom := decodeCycloneDX(t, buf.Bytes())
+
+	expectedComponents := []cycloneDXComponent{
+		{Type: "library", BOMRef: "A-1.0.0", Name: "A", Version: "1.0.0", PURL: "pkg:npm/a@1.0.0"},
+		{Type: "library", BOMRef: "B-1.0.0", Name: "B", Version: "1.0.0", PURL: "pkg:npm/b@1.0.0"},
+		{Type: "library", BOMRef: "org.example:lib-1.0.0", Group: "org.example", Name: "lib", Version: "1.0.0", PURL: "pkg:maven/org.example/lib@1.0.0"},
+	}
+	if !slices.Equal(bom.Components, expectedComponents) {
+		t.Errorf("Expected the components %+v, got %+v", expectedComponents, bom.Components)
+	}
+	if len(bom.Dependencies) != 3 || !slices.Equal(bom.Dependencies[0].DependsOn, []string{"B-1.0.0", "org.example:lib-1.0.0"}) {
+		t.Errorf("Expected A to depend on B and lib, got %+v", bom.Dependencies)
+	}
+
+	t.Run("Lists components without dependencies", func(t *testing.T) {
+		if !bytes.Contains(buf.Bytes(), []byte(`"ref": "B-1.0.0",
+      "dependsOn": []`)) {
+			t.Errorf("Expected an empty dependsOn for B, got\n%s", buf.String())
+		}
+	})
+}
+
+func TestPackageGraphWriteCycloneDX(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newTestPackageGraph().WriteCycloneDX(&buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	bom := decodeCycloneDX(t, buf.Bytes())
+
+	if len(bom.Components) != 2 || bom.Components[0].PURL != "pkg:npm/%40babel/core@7.0.0" || bom.Components[0].Name != "@babel/core" {
+		t.Errorf("Expected @babel/core and @babel/types, got %+v", bom.Components)
+	}
+	expected := []cycloneDXDependency{
+		{Ref: "NPM/@babel/core@7.0.0", DependsOn: []string{"NPM/@babel/types@7.1.0"}},
+		{Ref: "NPM/@babel/types@7.1.0", DependsOn: []string{}},
+	}
+	if len(bom.Dependencies) != 2 || !slices.Equal(bom.Dependencies[0].DependsOn, expected[0].DependsOn) ||
+		bom.Dependencies[1].Ref != expected[1].Ref || len(bom.Dependencies[1].DependsOn) != 0 {
+		t.Errorf("Expected the dependencies %+v, got %+v", expected, bom.Dependencies)
+	}
+}
@@ -0,0 +1,157 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// Graph is a dependency graph of package versions. A node is a single version of a package, identified by its
+// stringID (name-version), and an edge points from a dependent to one of its dependencies. It bundles the Gonum graph
+// with the maps CreateGraph returns separately, so that nodes and their info cannot get out of sync. Nodes and edges can
+// be added one at a time, e.g. while dependencies are being parsed. Graph is not safe for concurrent use.
+type Graph struct {
+	directed           *simple.DirectedGraph
+	stringIDToNodeInfo map[string]NodeInfo
+	idToNodeInfo       map[int64]NodeInfo
+	// attributes maps the name of a numeric node attribute, such as a PageRank score, to its value per stringID
+	attributes map[string]map[string]float64
+	// platforms maps stringIDs to the ecosystem of the package, e.g. NPM, where it is known
+	platforms map[string]string
+}
+
+// NewGraph creates an empty Graph.
+func NewGraph() *Graph {
+	return &Graph{
+		directed:           simple.NewDirectedGraph(),
+		stringIDToNodeInfo: make(map[string]NodeInfo),
+		idToNodeInfo:       make(map[int64]NodeInfo),
+	}
+}
+
+// NewGraphFromMaps wraps a graph and the node info maps returned by CreateGraph in a Graph. The maps must describe
+// exactly the nodes of directed, and are used by the Graph from then on.
+func NewGraphFromMaps(directed *simple.DirectedGraph, stringIDToNodeInfo map[string]NodeInfo, idToNodeInfo map[int64]NodeInfo) *Graph {
+	return &Graph{
+		directed:           directed,
+		stringIDToNodeInfo: stringIDToNodeInfo,
+		idToNodeInfo:       idToNodeInfo,
+	}
+}
+
+// AddNode adds a node for the given version of a package and returns its info. If the version is already in the
+// graph, the existing node is returned unchanged.
+func (g *Graph) AddNode(name, version, timestamp string) NodeInfo {
+	stringID := fmt.Sprintf("%s-%s", name, version)
+	if nodeInfo, ok := g.stringIDToNodeInfo[stringID]; ok {
+		return nodeInfo
+	}
+	// Delegate the work of creating a unique ID to Gonum
+	node := g.directed.NewNode()
+	g.directed.AddNode(node)
+	nodeInfo := *NewNodeInfo(node.ID(), name, version, timestamp)
+	g.stringIDToNodeInfo[stringID] = nodeInfo
+	g.idToNodeInfo[node.ID()] = nodeInfo
+	return nodeInfo
+}
+
+// AddEdge adds a depends-on edge from the node with stringID from to the node with stringID to. Both nodes must have
+// been added before. Edges from a node to itself are ignored, since some packages declare themselves as a dependency.
+func (g *Graph) AddEdge(from, to string) error {
+	fromInfo, ok := g.stringIDToNodeInfo[from]
+	if !ok {
+		return fmt.Errorf("node %s not found", from)
+	}
+	toInfo, ok := g.stringIDToNodeInfo[to]
+	if !ok {
+		return fmt.Errorf("node %s not found", to)
+	}
+	if fromInfo.id == toInfo.id {
+		return nil
+	}
+	g.directed.SetEdge(simple.Edge{F: g.directed.Node(fromInfo.id), T: g.directed.Node(toInfo.id)})
+	return nil
+}
+
+// Node returns the info of the node with the given stringID and whether it exists.
+func (g *Graph) Node(stringID string) (NodeInfo, bool) {
+	nodeInfo, ok := g.stringIDToNodeInfo[stringID]
+	return nodeInfo, ok
+}
+
+// Neighbors returns the direct dependencies of the node with the given stringID, sorted by stringID. It returns nil
+// if the node does not exist.
+func (g *Graph) Neighbors(stringID string) []NodeInfo {
+	nodeInfo, ok := g.stringIDToNodeInfo[stringID]
+	if !ok {
+		return nil
+	}
+	nodes := g.directed.From(nodeInfo.id)
+	neighbors := make([]NodeInfo, 0, nodes.Len())
+	for nodes.Next() {
+		neighbors = append(neighbors, g.idToNodeInfo[nodes.Node().ID()])
+	}
+	// Gonum iterates over a map, so sort for a stable result
+	sort.Slice(neighbors, func(i, j int) bool {
+		return neighbors[i].stringID < neighbors[j].stringID
+	})
+	return neighbors
+}
+
+// Len returns the number of nodes in the graph.
+func (g *Graph) Len() int {
+	return len(g.stringIDToNodeInfo)
+}
+
+// Directed returns the underlying Gonum graph, for use with the functions of this package that work on a
+// simple.DirectedGraph. Nodes must only be added through the Graph.
+func (g *Graph) Directed() *simple.DirectedGraph {
+	return g.directed
+}
+
+// SetAttribute attaches a numeric attribute with the given name to the nodes, e.g. the scores returned by PageRank.
+// values maps stringIDs to the value of their node, and nodes that are missing simply do not have the attribute. An
+// attribute that was set before under the same name is replaced. Exporters such as WriteGraphML include the attributes.
+func (g *Graph) SetAttribute(name string, values map[string]float64) {
+	if g.attributes == nil {
+		g.attributes = make(map[string]map[string]float64)
+	}
+	g.attributes[name] = values
+}
+
+// Attribute returns the values of the node attribute with the given name per stringID, or nil if it was never set.
+func (g *Graph) Attribute(name string) map[string]float64 {
+	return g.attributes[name]
+}
+
+// AttributeNames returns the names of all node attributes, sorted.
+func (g *Graph) AttributeNames() []string {
+	names := make([]string, 0, len(g.attributes))
+	for name := range g.attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetPlatforms records the ecosystem of the nodes, e.g. NPM, Maven or Pypi, as a map of stringIDs to platform names.
+// Exporters use it to tell ecosystems apart. Nodes that are missing have no known platform.
+func (g *Graph) SetPlatforms(platforms map[string]string) {
+	g.platforms = platforms
+}
+
+// Platform returns the platform recorded for the node with the given stringID, or "" if it is not known.
+func (g *Graph) Platform(stringID string) string {
+	return g.platforms[stringID]
+}
+
+// StringIDToNodeInfo returns the mapping of stringIDs to NodeInfo. It must not be modified.
+func (g *Graph) StringIDToNodeInfo() map[string]NodeInfo {
+	return g.stringIDToNodeInfo
+}
+
+// IDToNodeInfo returns the mapping of Gonum node IDs to NodeInfo. It must not be modified.
+func (g *Graph) IDToNodeInfo() map[int64]NodeInfo {
+	return g.idToNodeInfo
+}
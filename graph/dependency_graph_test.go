@@ -0,0 +1,75 @@
+package graph
+
+import "testing"
+
+func TestGraphAddNode(t *testing.T) {
+	g := NewGraph()
+	a := g.AddNode("A", "1.0.0", "2021-04-01T20:15:37")
+	b := g.AddNode("B", "1.0.0", "2021-04-22T20:15:37")
+
+	t.Run("Creates one node per package version", func(t *testing.T) {
+		if g.Len() != 2 || g.Directed().Nodes().Len() != 2 {
+			t.Errorf("Expected 2 nodes, got %d in the graph and %d in Gonum", g.Len(), g.Directed().Nodes().Len())
+		}
+		if a.id == b.id {
+			t.Errorf("Node IDs were equal (%d == %d)", a.id, b.id)
+		}
+	})
+
+	t.Run("Returns the existing node for a known version", func(t *testing.T) {
+		again := g.AddNode("A", "1.0.0", "ignored")
+		if again.id != a.id || again.Timestamp != a.Timestamp {
+			t.Errorf("Expected the existing node %v, got %v", a, again)
+		}
+		if g.Len() != 2 {
+			t.Errorf("Expected 2 nodes, got %d", g.Len())
+		}
+	})
+
+	t.Run("Looks nodes up by stringID", func(t *testing.T) {
+		if nodeInfo, ok := g.Node("B-1.0.0"); !ok || nodeInfo.id != b.id {
+			t.Errorf("Expected to find B-1.0.0, got %v", nodeInfo)
+		}
+		if _, ok := g.Node("C-1.0.0"); ok {
+			t.Error("Expected C-1.0.0 not to exist")
+		}
+	})
+}
+
+func TestGraphAddEdge(t *testing.T) {
+	g := NewGraph()
+	g.AddNode("A", "1.0.0", "")
+	g.AddNode("B", "1.0.0", "")
+	g.AddNode("C", "1.0.0", "")
+
+	for _, edge := range [][2]string{{"B-1.0.0", "C-1.0.0"}, {"B-1.0.0", "A-1.0.0"}, {"B-1.0.0", "B-1.0.0"}} {
+		if err := g.AddEdge(edge[0], edge[1]); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	t.Run("Returns the dependencies as neighbors", func(t *testing.T) {
+		neighbors := g.Neighbors("B-1.0.0")
+		if len(neighbors) != 2 || neighbors[0].stringID != "A-1.0.0" || neighbors[1].stringID != "C-1.0.0" {
+			t.Errorf("Expected A-1.0.0 and C-1.0.0, got %v", neighbors)
+		}
+	})
+
+	t.Run("Creates the edge with the correct direction (dependent -> dependency)", func(t *testing.T) {
+		if neighbors := g.Neighbors("A-1.0.0"); len(neighbors) != 0 {
+			t.Errorf("Expected no dependencies for A-1.0.0, got %v", neighbors)
+		}
+	})
+
+	t.Run("Ignores edges to self", func(t *testing.T) {
+		if g.Directed().Edges().Len() != 2 {
+			t.Errorf("Expected 2 edges, got %d", g.Directed().Edges().Len())
+		}
+	})
+
+	t.Run("Rejects unknown nodes", func(t *testing.T) {
+		if err := g.AddEdge("B-1.0.0", "D-1.0.0"); err == nil {
+			t.Error("Expected an error for an unknown node")
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Dependent is a node of a PackageGraph that depends on a package, found by PackageDependents.
+type Dependent struct {
+	Key string
+	// Depth is the length of the shortest dependency path from this node to the package, 1 for direct dependents.
+	Depth int
+}
+
+// PackageDependents calls visit with every node that depends on a version of the package, which is matched by its
+// platform regardless of case and by its name. Without transitive, only the direct dependents are visited. With it,
+// the nodes that depend on the package indirectly are visited as well, which is everything affected by a problem in
+// the package. Nodes are visited breadth-first, once each at the depth they are first reached at, so cycles are not
+// counted twice and versions of the package itself are never visited. Within a depth, nodes are visited in key order.
+// Only the nodes of the current depth and those already visited are kept in memory, not a list of all results.
+// The error of visit stops the search and is returned, as is an error if no version of the package is in the graph.
+func (g *PackageGraph) PackageDependents(platform, name string, transitive bool, visit func(dependent Dependent) error) error {
+	seen := make(map[int64]bool)
+	var queue []int64
+	for key, id := range g.keyToID {
+		keyPlatform, keyName, _ := SplitPackageKey(key)
+		if strings.EqualFold(keyPlatform, platform) && keyName == name {
+			seen[id] = true
+			queue = append(queue, id)
+		}
+	}
+	if len(queue) == 0 {
+		return fmt.Errorf("package %s/%s not found", platform, name)
+	}
+
+	for depth := 1; len(queue) > 0 && (transitive || depth == 1); depth++ {
+		var following []int64
+		for _, id := range queue {
+			for dependents := g.directed.To(id); dependents.Next(); {
+				dependent := dependents.Node().ID()
+				if !seen[dependent] {
+					seen[dependent] = true
+					following = append(following, dependent)
+				}
+			}
+		}
+		sort.Slice(following, func(i, j int) bool {
+			return g.idToKey[following[i]] < g.idToKey[following[j]]
+		})
+		for _, id := range following {
+			if err := visit(Dependent{Key: g.idToKey[id], Depth: depth}); err != nil {
+				return err
+			}
+		}
+		queue = following
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package graph
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPackageDependents(t *testing.T) {
+	// app and tool depend on lib, which depends on both versions of base, and base@2.0.0 depends back on lib
+	g := NewPackageGraph()
+	g.AddEdge("NPM/app@1.0.0", "NPM/lib@1.0.0")
+	g.AddEdge("NPM/tool@1.0.0", "NPM/lib@1.0.0")
+	g.AddEdge("NPM/lib@1.0.0", "NPM/base@1.0.0")
+	g.AddEdge("NPM/lib@1.0.0", "NPM/base@2.0.0")
+	g.AddEdge("NPM/base@2.0.0", "NPM/lib@1.0.0")
+	g.AddNode("NPM/lonely@1.0.0")
+
+	collect := func(t *testing.T, name string, transitive bool) []Dependent {
+		var dependents []Dependent
+		err := g.PackageDependents("npm", name, transitive, func(dependent Dependent) error {
+			dependents = append(dependents, dependent)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return dependents
+	}
+
+	t.Run("Finds the direct dependents of every version", func(t *testing.T) {
+		expected := []Dependent{{Key: "NPM/lib@1.0.0", Depth: 1}}
+		if actual := collect(t, "base", false); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Visits every transitive dependent once despite the cycle", func(t *testing.T) {
+		expected := []Dependent{
+			{Key: "NPM/lib@1.0.0", Depth: 1},
+			{Key: "NPM/app@1.0.0", Depth: 2},
+			{Key: "NPM/tool@1.0.0", Depth: 2},
+		}
+		if actual := collect(t, "base", true); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Includes the nodes of a cycle through the package", func(t *testing.T) {
+		expected := []Dependent{
+			{Key: "NPM/app@1.0.0", Depth: 1},
+			{Key: "NPM/base@2.0.0", Depth: 1},
+			{Key: "NPM/tool@1.0.0", Depth: 1},
+		}
+		if actual := collect(t, "lib", true); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Visits nothing for a package without dependents", func(t *testing.T) {
+		if actual := collect(t, "lonely", true); len(actual) != 0 {
+			t.Errorf("Expected no dependents, got %v", actual)
+		}
+	})
+
+	t.Run("Stops at the error of visit", func(t *testing.T) {
+		stop := errors.New("stop")
+		visited := 0
+		err := g.PackageDependents("NPM", "base", true, func(Dependent) error {
+			visited++
+			return stop
+		})
+		if !errors.Is(err, stop) || visited != 1 {
+			t.Errorf("Expected to stop after the first dependent, visited %d and got %v", visited, err)
+		}
+	})
+
+	t.Run("Reports unknown packages", func(t *testing.T) {
+		if err := g.PackageDependents("NPM", "ghost", true, func(Dependent) error { return nil }); err == nil {
+			t.Error("Expected an error for an unknown package")
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package graph
+
+import (
+	"sort"
+
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// DependencyDepth returns the length of the longest path from root down its dependencies in g, 0 if root has none and
+// -1 if it is not in the graph. A dependency that is already on the path, because it depends back on root or on
+// another package along the way, counts as a leaf, so cycles end the path instead of making it endless. Within a cycle
+// the depth thus depends on where the path enters it; dependencies are followed in order of their stringIDs, so the
+// result is the same every time.
+func DependencyDepth(g *Graph, root string) int {
+	rootInfo, ok := g.Node(root)
+	if !ok {
+		return -1
+	}
+	return newDepthSearch(g.directed, g.stringIDLess).depth(rootInfo.id)
+}
+
+// DependencyDepths returns DependencyDepth for every node of g, keyed by stringID. The searches share what they found,
+// so this takes a single pass over the graph rather than one per node. For nodes on a cycle, the depth may differ from
+// the one DependencyDepth returns, since the cycle may be entered from a node that depends on it; the nodes are
+// searched from in order of their stringIDs.
+func DependencyDepths(g *Graph) map[string]int {
+	ids := make([]int64, 0, len(g.idToNodeInfo))
+	for id := range g.idToNodeInfo {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return g.stringIDLess(ids[i], ids[j]) })
+	search := newDepthSearch(g.directed, g.stringIDLess)
+	depths := make(map[string]int, len(ids))
+	for _, id := range ids {
+		depths[g.idToNodeInfo[id].stringID] = search.depth(id)
+	}
+	return depths
+}
+
+// DepthHistogram counts the nodes of g by their DependencyDepths, mapping every depth to the number of nodes with it.
+func DepthHistogram(g *Graph) map[int]int {
+	histogram := make(map[int]int)
+	for _, depth := range DependencyDepths(g) {
+		histogram[depth]++
+	}
+	return histogram
+}
+
+// DependencyDepths returns the depth of every node of g, keyed by node key, like the DependencyDepths function does for
+// a Graph. Nodes are searched from, and dependencies followed, in key order.
+func (g *PackageGraph) DependencyDepths() map[string]int {
+	search := newDepthSearch(g.directed, func(a, b int64) bool { return g.idToKey[a] < g.idToKey[b] })
+	keys := g.Nodes()
+	depths := make(map[string]int, len(keys))
+	for _, key := range keys {
+		depths[key] = search.depth(g.keyToID[key])
+	}
+	return depths
+}
+
+// stringIDLess orders the nodes with the given IDs by stringID.
+func (g *Graph) stringIDLess(a, b int64) bool {
+	return g.idToNodeInfo[a].stringID < g.idToNodeInfo[b].stringID
+}
+
+// depthSearch finds the longest dependency paths of a graph depth-first, remembering the depth of every node it has
+// finished so that later searches can reuse it.
+type depthSearch struct {
+	directed *simple.DirectedGraph
+	// less orders the dependencies of a node, which are followed in that order
+	less   func(a, b int64) bool
+	depths map[int64]int
+	// onPath holds the nodes of the path that is being searched, which count as leaves when they are reached again
+	onPath map[int64]bool
+}
+
+func newDepthSearch(directed *simple.DirectedGraph, less func(a, b int64) bool) *depthSearch {
+	return &depthSearch{directed: directed, less: less, depths: make(map[int64]int), onPath: make(map[int64]bool)}
+}
+
+// depth returns the length of the longest path from the node with the given ID down its dependencies.
+func (s *depthSearch) depth(id int64) int {
+	if depth, ok := s.depths[id]; ok {
+		return depth
+	}
+	var dependencies []int64
+	for nodes := s.directed.From(id); nodes.Next(); {
+		dependencies = append(dependencies, nodes.Node().ID())
+	}
+	sort.Slice(dependencies, func(i, j int) bool { return s.less(dependencies[i], dependencies[j]) })
+
+	s.onPath[id] = true
+	depth := 0
+	for _, dependency := range dependencies {
+		if s.onPath[dependency] {
+			depth = max(depth, 1)
+			continue
+		}
+		depth = max(depth, s.depth(dependency)+1)
+	}
+	delete(s.onPath, id)
+	s.depths[id] = depth
+	return depth
+}
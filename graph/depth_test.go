@@ -0,0 +1,57 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDependencyDepth(t *testing.T) {
+	t.Run("Finds the longest path", func(t *testing.T) {
+		g := newTestGraph(t, []string{"A", "B", "C", "D", "E"}, [][2]string{
+			{"A", "B"}, {"B", "C"}, {"C", "D"}, {"A", "D"},
+		})
+		for root, expected := range map[string]int{"A-1.0.0": 3, "B-1.0.0": 2, "D-1.0.0": 0, "E-1.0.0": 0} {
+			if actual := DependencyDepth(g, root); actual != expected {
+				t.Errorf("Expected %s to have depth %d, got %d", root, expected, actual)
+			}
+		}
+	})
+
+	t.Run("Ends paths at cycles", func(t *testing.T) {
+		g := newTestGraph(t, []string{"A", "B", "C", "D"}, [][2]string{
+			{"A", "B"}, {"B", "C"}, {"C", "D"}, {"D", "B"},
+		})
+		// A -> B -> C -> D -> B, where B is on the path already
+		if actual := DependencyDepth(g, "A-1.0.0"); actual != 4 {
+			t.Errorf("Expected depth 4, got %d", actual)
+		}
+		if actual := DependencyDepth(g, "D-1.0.0"); actual != 3 {
+			t.Errorf("Expected depth 3, got %d", actual)
+		}
+	})
+
+	t.Run("Returns -1 for unknown roots", func(t *testing.T) {
+		if actual := DependencyDepth(NewGraph(), "A-1.0.0"); actual != -1 {
+			t.Errorf("Expected -1, got %d", actual)
+		}
+	})
+}
+
+func TestDepthHistogram(t *testing.T) {
+	g := newTestGraph(t, []string{"A", "B", "C", "D"}, [][2]string{{"A", "B"}, {"A", "C"}, {"B", "C"}})
+	expectedDepths := map[string]int{"A-1.0.0": 2, "B-1.0.0": 1, "C-1.0.0": 0, "D-1.0.0": 0}
+	if actual := DependencyDepths(g); !reflect.DeepEqual(actual, expectedDepths) {
+		t.Errorf("Expected %v, got %v", expectedDepths, actual)
+	}
+	expected := map[int]int{0: 2, 1: 1, 2: 1}
+	if actual := DepthHistogram(g); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func TestPackageGraphDependencyDepths(t *testing.T) {
+	expected := map[string]int{"NPM/@babel/core@7.0.0": 1, "NPM/@babel/types@7.1.0": 0}
+	if actual := newTestPackageGraph().DependencyDepths(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
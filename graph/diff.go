@@ -0,0 +1,56 @@
+package graph
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// DiffVersions compares the direct dependencies of two versions of the package pkg, e.g. before and after an upgrade.
+// It returns the names of the packages only versionB depends on as added, those only versionA depends on as removed,
+// and those both depend on but in different versions as changed, each sorted. A dependency edge leads to every
+// version of a package that satisfies the constraint, so a dependency changed if the set of those versions differs,
+// which is the case when the constraint was bumped. The versions themselves are found with Neighbors. An error is
+// returned if either version of pkg is not in the graph.
+func DiffVersions(g *Graph, pkg, versionA, versionB string) (added, removed, changed []string, err error) {
+	before, err := dependencyVersions(g, pkg, versionA)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	after, err := dependencyVersions(g, pkg, versionB)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for name, versions := range after {
+		previous, ok := before[name]
+		switch {
+		case !ok:
+			added = append(added, name)
+		case !slices.Equal(previous, versions):
+			changed = append(changed, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed, nil
+}
+
+// dependencyVersions maps the name of every direct dependency of the given version of pkg to the versions of it that
+// version depends on, sorted by stringID.
+func dependencyVersions(g *Graph, pkg, version string) (map[string][]string, error) {
+	stringID := fmt.Sprintf("%s-%s", pkg, version)
+	if _, ok := g.Node(stringID); !ok {
+		return nil, fmt.Errorf("package %s version %s not found", pkg, version)
+	}
+	versions := make(map[string][]string)
+	for _, dependency := range g.Neighbors(stringID) {
+		versions[dependency.Name] = append(versions[dependency.Name], dependency.Version)
+	}
+	return versions, nil
+}
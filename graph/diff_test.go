@@ -0,0 +1,45 @@
+package graph
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffVersions(t *testing.T) {
+	g := NewGraph()
+	for _, stringID := range [][2]string{
+		{"app", "1.0.0"}, {"app", "2.0.0"},
+		{"left-pad", "1.0.0"}, {"lodash", "3.0.0"}, {"lodash", "4.0.0"}, {"debug", "2.6.9"}, {"ms", "2.1.3"},
+	} {
+		g.AddNode(stringID[0], stringID[1], "")
+	}
+	for _, edge := range [][2]string{
+		{"app-1.0.0", "left-pad-1.0.0"}, {"app-1.0.0", "lodash-3.0.0"}, {"app-1.0.0", "debug-2.6.9"},
+		{"app-2.0.0", "lodash-3.0.0"}, {"app-2.0.0", "lodash-4.0.0"}, {"app-2.0.0", "debug-2.6.9"}, {"app-2.0.0", "ms-2.1.3"},
+	} {
+		if err := g.AddEdge(edge[0], edge[1]); err != nil {
+			t.Fatalf("Could not add edge %v: %v", edge, err)
+		}
+	}
+
+	added, removed, changed, err := DiffVersions(g, "app", "1.0.0", "2.0.0")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !slices.Equal(added, []string{"ms"}) || !slices.Equal(removed, []string{"left-pad"}) || !slices.Equal(changed, []string{"lodash"}) {
+		t.Errorf("Expected ms added, left-pad removed and lodash changed, got %v, %v and %v", added, removed, changed)
+	}
+
+	t.Run("Finds no differences between a version and itself", func(t *testing.T) {
+		added, removed, changed, err := DiffVersions(g, "app", "2.0.0", "2.0.0")
+		if err != nil || len(added)+len(removed)+len(changed) != 0 {
+			t.Errorf("Expected no differences, got %v, %v, %v and %v", added, removed, changed, err)
+		}
+	})
+
+	t.Run("Fails for unknown versions", func(t *testing.T) {
+		if _, _, _, err := DiffVersions(g, "app", "1.0.0", "3.0.0"); err == nil {
+			t.Error("Expected an error for an unknown version")
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// platformColors are the fill colors of the nodes of each platform in WriteDOT, keyed by lowercase platform name.
+var platformColors = map[string]string{
+	"npm":      "#f4cccc",
+	"maven":    "#cfe2f3",
+	"pypi":     "#d9ead3",
+	"cargo":    "#fce5cd",
+	"go":       "#d0e0e3",
+	"nuget":    "#d9d2e9",
+	"rubygems": "#ead1dc",
+}
+
+// unknownPlatformColor fills nodes whose platform is set but has no color of its own.
+const unknownPlatformColor = "#eeeeee"
+
+// WriteDOT writes g to w in the Graphviz DOT language, e.g. to render it with dot -Tsvg. Nodes are labelled
+// name@version and, if their platform was recorded with SetPlatforms, filled with a color per platform. Edges point
+// from a dependent to its dependency. All identifiers are quoted, so any package name is safe. Nodes and edges are
+// sorted by stringID.
+func WriteDOT(g *Graph, w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+	buffered.WriteString("digraph {\n")
+
+	stringIDs := make([]string, 0, g.Len())
+	for stringID := range g.stringIDToNodeInfo {
+		stringIDs = append(stringIDs, stringID)
+	}
+	sort.Strings(stringIDs)
+	for _, stringID := range stringIDs {
+		nodeInfo := g.stringIDToNodeInfo[stringID]
+		attributes := "label=" + quoteDOT(nodeInfo.Name+"@"+nodeInfo.Version)
+		if platform := g.Platform(stringID); platform != "" {
+			color, ok := platformColors[strings.ToLower(platform)]
+			if !ok {
+				color = unknownPlatformColor
+			}
+			attributes += ", style=filled, fillcolor=" + quoteDOT(color) + ", tooltip=" + quoteDOT(platform)
+		}
+		fmt.Fprintf(buffered, "  %s [%s];\n", quoteDOT(stringID), attributes)
+	}
+	for _, stringID := range stringIDs {
+		for _, dependency := range g.Neighbors(stringID) {
+			fmt.Fprintf(buffered, "  %s -> %s;\n", quoteDOT(stringID), quoteDOT(dependency.stringID))
+		}
+	}
+
+	buffered.WriteString("}\n")
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("writing DOT: %w", err)
+	}
+	return nil
+}
+
+// quoteDOT returns s as a quoted DOT identifier. Inside quotes only the quote itself needs escaping, but backslashes
+// are escaped as well since DOT gives some of their sequences a meaning in labels, and line breaks become \n.
+func quoteDOT(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+	return `"` + replacer.Replace(s) + `"`
+}
+
+// WriteDOT writes g to w in the Graphviz DOT language. Nodes are identified by their quoted key, which keeps names
+// such as @babel/core intact, labelled name@version and filled with a color per platform like in the WriteDOT
+// function. They carry the platform, name, version and, where libraries.io reported them, the stars of the package as
+// attributes, and edges the requirement and kind of the dependency they were resolved from. Nodes and edges are sorted
+// by key and written one at a time.
+func (g *PackageGraph) WriteDOT(w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+	buffered.WriteString("digraph {\n")
+
+	nodes := g.Nodes()
+	for _, key := range nodes {
+		platform, name, version := SplitPackageKey(key)
+		attributes := "label=" + quoteDOT(name+"@"+version)
+		if platform != "" {
+			color, ok := platformColors[strings.ToLower(platform)]
+			if !ok {
+				color = unknownPlatformColor
+			}
+			attributes += ", style=filled, fillcolor=" + quoteDOT(color)
+		}
+		attributes += ", platform=" + quoteDOT(platform) + ", name=" + quoteDOT(name) + ", version=" + quoteDOT(version)
+		if stars, ok := g.stars[key]; ok {
+			attributes += ", stars=" + strconv.Itoa(stars)
+		}
+		fmt.Fprintf(buffered, "  %s [%s];\n", quoteDOT(key), attributes)
+	}
+	for _, key := range nodes {
+		for _, dependency := range g.Dependencies(key) {
+			if declared, ok := g.dependencies[PackageEdge{From: key, To: dependency}]; ok {
+				fmt.Fprintf(buffered, "  %s -> %s [requirement=%s, kind=%s];\n", quoteDOT(key), quoteDOT(dependency),
+					quoteDOT(declared.Requirements), quoteDOT(declared.Kind))
+				continue
+			}
+			fmt.Fprintf(buffered, "  %s -> %s;\n", quoteDOT(key), quoteDOT(dependency))
+		}
+	}
+
+	buffered.WriteString("}\n")
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("writing DOT: %w", err)
+	}
+	return nil
+}
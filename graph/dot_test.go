@@ -0,0 +1,56 @@
+package graph
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+)
+
+func TestWriteDOT(t *testing.T) {
+	g := newTestGraph(t, []string{"A", "B"}, [][2]string{{"A", "B"}})
+	g.AddNode(`say "hi"\now`, "1.0.0", "")
+	g.SetPlatforms(map[string]string{"A-1.0.0": "NPM", "B-1.0.0": "Hackage"})
+
+	var buf bytes.Buffer
+	if err := WriteDOT(g, &buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := `digraph {
+  "A-1.0.0" [label="A@1.0.0", style=filled, fillcolor="#f4cccc", tooltip="NPM"];
+  "B-1.0.0" [label="B@1.0.0", style=filled, fillcolor="#eeeeee", tooltip="Hackage"];
+  "say \"hi\"\\now-1.0.0" [label="say \"hi\"\\now@1.0.0"];
+  "A-1.0.0" -> "B-1.0.0";
+}
+`
+	if actual := buf.String(); actual != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, actual)
+	}
+}
+
+// newTestPackageGraph builds a PackageGraph of two scoped NPM packages, one of which depends on the other.
+func newTestPackageGraph() *PackageGraph {
+	stars := 42
+	return FromIngest([]ingest.Project{
+		{Name: "@babel/core", Platform: "NPM", LatestReleaseNumber: "7.0.0", Stars: &stars, Dependencies: []ingest.Dependency{
+			{Name: "@babel/types", Platform: "NPM", Requirements: "^7.0.0", Kind: "runtime"},
+		}},
+		{Name: "@babel/types", Platform: "NPM", Versions: []ingest.Version{{Number: "7.1.0"}}},
+	})
+}
+
+func TestPackageGraphWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newTestPackageGraph().WriteDOT(&buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := `digraph {
+  "NPM/@babel/core@7.0.0" [label="@babel/core@7.0.0", style=filled, fillcolor="#f4cccc", platform="NPM", name="@babel/core", version="7.0.0", stars=42];
+  "NPM/@babel/types@7.1.0" [label="@babel/types@7.1.0", style=filled, fillcolor="#f4cccc", platform="NPM", name="@babel/types", version="7.1.0"];
+  "NPM/@babel/core@7.0.0" -> "NPM/@babel/types@7.1.0" [requirement="^7.0.0", kind="runtime"];
+}
+`
+	if actual := buf.String(); actual != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, actual)
+	}
+}
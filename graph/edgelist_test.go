@@ -0,0 +1,48 @@
+package graph
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteEdgeList(t *testing.T) {
+	var nodes, edges bytes.Buffer
+	if err := newTestPackageGraph().WriteEdgeList(&nodes, &edges); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	t.Run("Numbers the nodes in key order", func(t *testing.T) {
+		expected := "id,platform,name,version,stars,depth\n0,NPM,@babel/core,7.0.0,42,1\n1,NPM,@babel/types,7.1.0,,0\n"
+		if actual := nodes.String(); actual != expected {
+			t.Errorf("Expected\n%s\ngot\n%s", expected, actual)
+		}
+	})
+
+	t.Run("Writes the edges by id", func(t *testing.T) {
+		expected := "source_id,target_id,kind,requirement\n0,1,runtime,^7.0.0\n"
+		if actual := edges.String(); actual != expected {
+			t.Errorf("Expected\n%s\ngot\n%s", expected, actual)
+		}
+	})
+
+	t.Run("Writes identical files for the same data", func(t *testing.T) {
+		write := func() (string, string) {
+			g, err := FromCSV(filepath.Join("testdata", "packages.csv"))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			var nodes, edges bytes.Buffer
+			if err := g.WriteEdgeList(&nodes, &edges); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			return nodes.String(), edges.String()
+		}
+		firstNodes, firstEdges := write()
+		for i := 0; i < 5; i++ {
+			if nodes, edges := write(); nodes != firstNodes || edges != firstEdges {
+				t.Fatalf("Expected the same files on every export, got\n%s\n%s\nand\n%s\n%s", firstNodes, firstEdges, nodes, edges)
+			}
+		}
+	})
+}
@@ -140,8 +140,10 @@ func VisualizationNodeInfo(iDToNodeInfo *map[string]NodeInfo, graph *simple.Dire
 // TODO: Discuss removing pointers from maps since they are reference types without the need of using * : https://stackoverflow.com/questions/40680981/are-maps-passed-by-value-or-by-reference-in-go
 func CreateEdges(graph *simple.DirectedGraph, inputList *[]PackageInfo, stringIDToNodeInfo map[string]NodeInfo, nameToVersionMap map[string][]string, isMaven bool) {
 	r, _ := regexp.Compile("((?P<open>[\\(\\[])(?P<bothVer>((?P<firstVer>(0|[1-9]+)(\\.(0|[1-9]+)(\\.(0|[1-9]+))?)?)(?P<comma1>,)(?P<secondVer1>(0|[1-9]+)(\\.(0|[1-9]+)(\\.(0|[1-9]+))?)?)?)|((?P<comma2>,)?(?P<secondVer2>(0|[1-9]+)(\\.(0|[1-9]+)(\\.(0|[1-9]+))?)?)?))(?P<close>[\\)\\]]))|(?P<simplevers>(0|[1-9]+)(\\.(0|[1-9]+)(\\.(0|[1-9]+))?)?)")
-	for id, packageInfo := range *inputList {
-		for _, dependencyInfo := range packageInfo.Versions {
+	for _, packageInfo := range *inputList {
+		for packageVersion, dependencyInfo := range packageInfo.Versions {
+			// The edges start at the node of the version that declares the dependencies
+			packageNode := graph.Node(stringIDToNodeInfo[fmt.Sprintf("%s-%s", packageInfo.Name, packageVersion)].id)
 			for dependencyName, dependencyVersion := range dependencyInfo.Dependencies {
 				finaldep := dependencyVersion
 				if isMaven {
@@ -167,7 +169,6 @@ func CreateEdges(graph *simple.DirectedGraph, inputList *[]PackageInfo, stringID
 					if constraint.Check(newVersion) {
 						dependencyNameVersionString := fmt.Sprintf("%s-%s", dependencyName, v)
 						dependencyNode := graph.Node(stringIDToNodeInfo[dependencyNameVersionString].id)
-						packageNode := graph.Node(int64(id))
 						// Ensure that we do not create edges to self because some packages do that...
 						if dependencyNode != packageNode {
 							graph.SetEdge(simple.Edge{F: packageNode, T: dependencyNode})
@@ -134,10 +134,16 @@ func TestNodeCreationMediumComplexity(t *testing.T) {
 	nameVersion := CreateNameToVersionMap(&mediumPackageInfo)
 	CreateEdges(graph, &mediumPackageInfo, stringNodeInfo, nameVersion, false)
 
-	t.Run("Creates 8 nodes, one for every package version", func(t *testing.T) {
+	t.Run("Creates 9 edges, from the version that declares each dependency", func(t *testing.T) {
 
-		if numNodes := graph.Edges().Len(); numNodes != 8 {
-			t.Errorf("Expected 8 edges, got %d", numNodes)
+		// B-1.0.0 depends on the four stable versions of A and on C-1.0.0, C-1.0.0 on A-0.9.0 and C-2.0.0 on the three
+		// stable versions of A below 2.0.0
+		if numEdges := graph.Edges().Len(); numEdges != 9 {
+			t.Errorf("Expected 9 edges, got %d", numEdges)
+		}
+		id := func(stringID string) int64 { return stringNodeInfo[stringID].id }
+		if !graph.HasEdgeFromTo(id("C-2.0.0"), id("A-1.1.0")) || graph.HasEdgeFromTo(id("C-1.0.0"), id("A-1.1.0")) {
+			t.Error("Expected the edges to start at the version that declares the dependency")
 		}
 
 	})
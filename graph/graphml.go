@@ -0,0 +1,186 @@
+package graph
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// graphMLNamespace is the XML namespace of GraphML documents.
+const graphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+// graphMLKey declares a node or edge attribute in a GraphML document.
+type graphMLKey struct {
+	XMLName xml.Name `xml:"key"`
+	ID      string   `xml:"id,attr"`
+	For     string   `xml:"for,attr"`
+	Name    string   `xml:"attr.name,attr"`
+	Type    string   `xml:"attr.type,attr"`
+}
+
+// graphMLData is the value of an attribute of a node or edge.
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	XMLName xml.Name      `xml:"node"`
+	ID      string        `xml:"id,attr"`
+	Data    []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	XMLName xml.Name      `xml:"edge"`
+	Source  string        `xml:"source,attr"`
+	Target  string        `xml:"target,attr"`
+	Data    []graphMLData `xml:"data"`
+}
+
+// WriteGraphML writes g to w as a directed GraphML document, which viewers such as Gephi can open. Nodes are identified
+// by their stringID and carry the package name, version, timestamp and platform as well as every attribute set with
+// SetAttribute. Edges point from a dependent to its dependency. Nodes and edges are sorted by stringID and written one
+// at a time, so the document is never held in memory as a whole.
+func WriteGraphML(g *Graph, w io.Writer) error {
+	// Attribute names are user supplied, so the keys get generated ids that cannot clash
+	keys := []graphMLKey{
+		{ID: "d0", For: "node", Name: "name", Type: "string"},
+		{ID: "d1", For: "node", Name: "version", Type: "string"},
+		{ID: "d2", For: "node", Name: "timestamp", Type: "string"},
+		{ID: "d3", For: "node", Name: "platform", Type: "string"},
+	}
+	const firstAttributeKey = 4
+	attributeNames := g.AttributeNames()
+	for i, name := range attributeNames {
+		keys = append(keys, graphMLKey{ID: "d" + strconv.Itoa(firstAttributeKey+i), For: "node", Name: name, Type: "double"})
+	}
+
+	return writeGraphML(w, keys, func(encoder *xml.Encoder) error {
+		stringIDs := make([]string, 0, g.Len())
+		for stringID := range g.stringIDToNodeInfo {
+			stringIDs = append(stringIDs, stringID)
+		}
+		sort.Strings(stringIDs)
+		for _, stringID := range stringIDs {
+			nodeInfo := g.stringIDToNodeInfo[stringID]
+			node := graphMLNode{ID: stringID, Data: []graphMLData{
+				{Key: "d0", Value: nodeInfo.Name},
+				{Key: "d1", Value: nodeInfo.Version},
+			}}
+			if nodeInfo.Timestamp != "" {
+				node.Data = append(node.Data, graphMLData{Key: "d2", Value: nodeInfo.Timestamp})
+			}
+			if platform := g.Platform(stringID); platform != "" {
+				node.Data = append(node.Data, graphMLData{Key: "d3", Value: platform})
+			}
+			for i, name := range attributeNames {
+				if value, ok := g.attributes[name][stringID]; ok {
+					node.Data = append(node.Data, graphMLData{Key: keys[firstAttributeKey+i].ID, Value: strconv.FormatFloat(value, 'g', -1, 64)})
+				}
+			}
+			if err := encoder.Encode(node); err != nil {
+				return fmt.Errorf("writing GraphML node %s: %w", stringID, err)
+			}
+		}
+		for _, stringID := range stringIDs {
+			for _, dependency := range g.Neighbors(stringID) {
+				if err := encoder.Encode(graphMLEdge{Source: stringID, Target: dependency.stringID}); err != nil {
+					return fmt.Errorf("writing GraphML edge %s -> %s: %w", stringID, dependency.stringID, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// writeGraphML writes a directed GraphML document with the given keys to w. body encodes the nodes and edges of the
+// graph, one at a time, with encoder.
+func writeGraphML(w io.Writer, keys []graphMLKey, body func(encoder *xml.Encoder) error) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("writing GraphML: %w", err)
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	graphml := xml.StartElement{
+		Name: xml.Name{Local: "graphml"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: graphMLNamespace}},
+	}
+	if err := encoder.EncodeToken(graphml); err != nil {
+		return fmt.Errorf("writing GraphML: %w", err)
+	}
+	for _, key := range keys {
+		if err := encoder.Encode(key); err != nil {
+			return fmt.Errorf("writing GraphML key %s: %w", key.Name, err)
+		}
+	}
+
+	graph := xml.StartElement{
+		Name: xml.Name{Local: "graph"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "id"}, Value: "G"}, {Name: xml.Name{Local: "edgedefault"}, Value: "directed"}},
+	}
+	if err := encoder.EncodeToken(graph); err != nil {
+		return fmt.Errorf("writing GraphML: %w", err)
+	}
+	if err := body(encoder); err != nil {
+		return err
+	}
+	if err := encoder.EncodeToken(graph.End()); err != nil {
+		return fmt.Errorf("writing GraphML: %w", err)
+	}
+	if err := encoder.EncodeToken(graphml.End()); err != nil {
+		return fmt.Errorf("writing GraphML: %w", err)
+	}
+	if err := encoder.Flush(); err != nil {
+		return fmt.Errorf("writing GraphML: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteGraphML writes g to w as a directed GraphML document. Nodes are identified by their key and carry the platform,
+// name and version of the package and, where libraries.io reported them, its stars. Edges point from a dependent to
+// its dependency and carry the requirement and kind of the dependency they were resolved from. Like the WriteGraphML
+// function, nodes and edges are sorted by key and written one at a time.
+func (g *PackageGraph) WriteGraphML(w io.Writer) error {
+	keys := []graphMLKey{
+		{ID: "d0", For: "node", Name: "platform", Type: "string"},
+		{ID: "d1", For: "node", Name: "name", Type: "string"},
+		{ID: "d2", For: "node", Name: "version", Type: "string"},
+		{ID: "d3", For: "node", Name: "stars", Type: "int"},
+		{ID: "d4", For: "edge", Name: "requirement", Type: "string"},
+		{ID: "d5", For: "edge", Name: "kind", Type: "string"},
+	}
+
+	return writeGraphML(w, keys, func(encoder *xml.Encoder) error {
+		nodes := g.Nodes()
+		for _, key := range nodes {
+			platform, name, version := SplitPackageKey(key)
+			node := graphMLNode{ID: key, Data: []graphMLData{
+				{Key: "d0", Value: platform},
+				{Key: "d1", Value: name},
+				{Key: "d2", Value: version},
+			}}
+			if stars, ok := g.stars[key]; ok {
+				node.Data = append(node.Data, graphMLData{Key: "d3", Value: strconv.Itoa(stars)})
+			}
+			if err := encoder.Encode(node); err != nil {
+				return fmt.Errorf("writing GraphML node %s: %w", key, err)
+			}
+		}
+		for _, key := range nodes {
+			for _, dependency := range g.Dependencies(key) {
+				edge := graphMLEdge{Source: key, Target: dependency}
+				if declared, ok := g.dependencies[PackageEdge{From: key, To: dependency}]; ok {
+					edge.Data = []graphMLData{{Key: "d4", Value: declared.Requirements}, {Key: "d5", Value: declared.Kind}}
+				}
+				if err := encoder.Encode(edge); err != nil {
+					return fmt.Errorf("writing GraphML edge %s -> %s: %w", key, dependency, err)
+				}
+			}
+		}
+		return nil
+	})
+}
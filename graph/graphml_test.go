@@ -0,0 +1,135 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteGraphML(t *testing.T) {
+	g := newTestGraph(t, []string{"A", "B", "C"}, [][2]string{{"A", "B"}, {"A", "C"}, {"B", "C"}})
+	g.AddNode("<odd & name>", "2.0.0", "2021-01-01T00:00:00Z")
+	g.SetAttribute("pagerank", map[string]float64{"A-1.0.0": 0.25, "C-1.0.0": 0.5})
+	g.SetPlatforms(map[string]string{"A-1.0.0": "NPM"})
+
+	var buf bytes.Buffer
+	if err := WriteGraphML(g, &buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "<?xml") {
+		t.Errorf("Expected an XML declaration, got %q", buf.String()[:20])
+	}
+
+	var document struct {
+		XMLName xml.Name     `xml:"http://graphml.graphdrawing.org/xmlns graphml"`
+		Keys    []graphMLKey `xml:"key"`
+		Graph   struct {
+			EdgeDefault string        `xml:"edgedefault,attr"`
+			Nodes       []graphMLNode `xml:"node"`
+			Edges       []graphMLEdge `xml:"edge"`
+		} `xml:"graph"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &document); err != nil {
+		t.Fatalf("Expected valid GraphML, got %v:\n%s", err, buf.String())
+	}
+
+	t.Run("Declares the attributes", func(t *testing.T) {
+		var names []string
+		for _, key := range document.Keys {
+			names = append(names, key.Name+":"+key.Type)
+		}
+		expected := []string{"name:string", "version:string", "timestamp:string", "platform:string", "pagerank:double"}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("Expected keys %v, got %v", expected, names)
+		}
+	})
+
+	t.Run("Writes nodes with their data", func(t *testing.T) {
+		if len(document.Graph.Nodes) != 4 {
+			t.Fatalf("Expected 4 nodes, got %d", len(document.Graph.Nodes))
+		}
+		odd := document.Graph.Nodes[0]
+		if odd.ID != "<odd & name>-2.0.0" || odd.Data[0].Value != "<odd & name>" || len(odd.Data) != 3 {
+			t.Errorf("Expected the escaped node to round-trip, got %+v", odd)
+		}
+		a := document.Graph.Nodes[1]
+		expected := []graphMLData{{Key: "d0", Value: "A"}, {Key: "d1", Value: "1.0.0"}, {Key: "d3", Value: "NPM"}, {Key: "d4", Value: "0.25"}}
+		if a.ID != "A-1.0.0" || !reflect.DeepEqual(a.Data, expected) {
+			t.Errorf("Expected node A with data %v, got %+v", expected, a)
+		}
+		if b := document.Graph.Nodes[2]; len(b.Data) != 2 {
+			t.Errorf("Expected node B to have no score, got %+v", b)
+		}
+	})
+
+	t.Run("Writes directed edges", func(t *testing.T) {
+		if document.Graph.EdgeDefault != "directed" {
+			t.Errorf("Expected a directed graph, got %q", document.Graph.EdgeDefault)
+		}
+		var edges []string
+		for _, edge := range document.Graph.Edges {
+			edges = append(edges, edge.Source+">"+edge.Target)
+		}
+		expected := []string{"A-1.0.0>B-1.0.0", "A-1.0.0>C-1.0.0", "B-1.0.0>C-1.0.0"}
+		if !reflect.DeepEqual(edges, expected) {
+			t.Errorf("Expected edges %v, got %v", expected, edges)
+		}
+	})
+}
+
+func TestPackageGraphWriteGraphML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newTestPackageGraph().WriteGraphML(&buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var document struct {
+		Keys  []graphMLKey `xml:"key"`
+		Graph struct {
+			Nodes []graphMLNode `xml:"node"`
+			Edges []graphMLEdge `xml:"edge"`
+		} `xml:"graph"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &document); err != nil {
+		t.Fatalf("Expected valid GraphML, got %v:\n%s", err, buf.String())
+	}
+
+	t.Run("Declares node and edge attributes", func(t *testing.T) {
+		var keys []string
+		for _, key := range document.Keys {
+			keys = append(keys, key.For+":"+key.Name)
+		}
+		expected := []string{"node:platform", "node:name", "node:version", "node:stars", "edge:requirement", "edge:kind"}
+		if !reflect.DeepEqual(keys, expected) {
+			t.Errorf("Expected keys %v, got %v", expected, keys)
+		}
+	})
+
+	t.Run("Writes nodes with their data", func(t *testing.T) {
+		if len(document.Graph.Nodes) != 2 {
+			t.Fatalf("Expected 2 nodes, got %d", len(document.Graph.Nodes))
+		}
+		expected := graphMLNode{ID: "NPM/@babel/core@7.0.0", Data: []graphMLData{
+			{Key: "d0", Value: "NPM"}, {Key: "d1", Value: "@babel/core"}, {Key: "d2", Value: "7.0.0"}, {Key: "d3", Value: "42"},
+		}}
+		actual := document.Graph.Nodes[0]
+		actual.XMLName = xml.Name{}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected node %+v, got %+v", expected, actual)
+		}
+	})
+
+	t.Run("Writes edges with the dependency", func(t *testing.T) {
+		expected := []graphMLEdge{{Source: "NPM/@babel/core@7.0.0", Target: "NPM/@babel/types@7.1.0", Data: []graphMLData{
+			{Key: "d4", Value: "^7.0.0"}, {Key: "d5", Value: "runtime"},
+		}}}
+		actual := document.Graph.Edges
+		for i := range actual {
+			actual[i].XMLName = xml.Name{}
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected edges %+v, got %+v", expected, actual)
+		}
+	})
+}
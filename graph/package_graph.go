@@ -0,0 +1,281 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+	"gonum.org/v1/gonum/graph/topo"
+)
+
+// PackageGraph is a dependency graph built from ingested packages. Its nodes are package versions keyed by
+// PackageKey, so packages of different platforms can live in the same graph, and its edges point from a dependent to
+// one of its dependencies. PackageGraph is not safe for concurrent use.
+type PackageGraph struct {
+	directed *simple.DirectedGraph
+	keyToID  map[string]int64
+	idToKey  map[int64]string
+	// stars maps node keys to the number of stars of their package, where libraries.io reported it
+	stars map[string]int
+	// dependencies maps the edges built from ingested packages to the dependency they were resolved from
+	dependencies map[PackageEdge]ingest.Dependency
+}
+
+// PackageEdge is a depends-on edge between two nodes of a PackageGraph.
+type PackageEdge struct {
+	From string
+	To   string
+}
+
+// PackageKey returns the key of a package version in a PackageGraph, e.g. NPM/left-pad@1.3.0.
+func PackageKey(platform, name, version string) string {
+	return fmt.Sprintf("%s/%s@%s", platform, name, version)
+}
+
+// SplitPackageKey splits a key returned by PackageKey into its parts. Names may contain slashes and at signs, as in
+// NPM/@babel/core@7.0.0, but platforms and versions do not. Keys of other forms are returned as the name.
+func SplitPackageKey(key string) (platform, name, version string) {
+	slash := strings.Index(key, "/")
+	at := strings.LastIndex(key, "@")
+	if slash < 0 || at <= slash+1 {
+		return "", key, ""
+	}
+	return key[:slash], key[slash+1 : at], key[at+1:]
+}
+
+// NewPackageGraph creates an empty PackageGraph.
+func NewPackageGraph() *PackageGraph {
+	return &PackageGraph{
+		directed:     simple.NewDirectedGraph(),
+		keyToID:      make(map[string]int64),
+		idToKey:      make(map[int64]string),
+		stars:        make(map[string]int),
+		dependencies: make(map[PackageEdge]ingest.Dependency),
+	}
+}
+
+// FromCSV builds a PackageGraph from a CSV file written by ingest.Ingest, which may be gzip-compressed. See FromIngest
+// for how the edges are derived.
+func FromCSV(path string) (*PackageGraph, error) {
+	projects, err := ingest.ReadCSV(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromIngest(projects), nil
+}
+
+// FromIngest builds a PackageGraph with a node for every version of the projects. Each dependency of a project's latest
+// release becomes an edge to the version of the dependency that ingest.ResolveVersion picks for its requirements.
+// Dependencies on packages that were not ingested, or whose requirements no ingested version satisfies, are left out.
+func FromIngest(projects []ingest.Project) *PackageGraph {
+	g, _ := buildPackageGraph(projects)
+	return g
+}
+
+// buildPackageGraph builds the graph of FromIngest and also returns the dependencies on ingested packages that could
+// not be resolved, such as ranges that none of the versions of the package satisfies.
+func buildPackageGraph(projects []ingest.Project) (*PackageGraph, []DanglingEdge) {
+	g := NewPackageGraph()
+	versions := make(map[string][]string, len(projects))
+	for _, project := range projects {
+		packageKey := project.Platform + "/" + project.Name
+		if _, ok := versions[packageKey]; !ok {
+			// Known packages without versions make the dependencies on them dangling instead of unknown
+			versions[packageKey] = nil
+		}
+		keys := make([]string, 0, len(project.Versions)+1)
+		for _, version := range project.Versions {
+			keys = append(keys, PackageKey(project.Platform, project.Name, version.Number))
+			versions[packageKey] = append(versions[packageKey], version.Number)
+		}
+		if project.LatestReleaseNumber != "" {
+			keys = append(keys, PackageKey(project.Platform, project.Name, project.LatestReleaseNumber))
+		}
+		for _, key := range keys {
+			g.AddNode(key)
+			if project.Stars != nil {
+				g.stars[key] = *project.Stars
+			}
+		}
+	}
+
+	var dangling []DanglingEdge
+	for _, project := range projects {
+		if project.LatestReleaseNumber == "" {
+			continue
+		}
+		from := PackageKey(project.Platform, project.Name, project.LatestReleaseNumber)
+		for _, dependency := range project.Dependencies {
+			candidates, ok := versions[dependency.Platform+"/"+dependency.Name]
+			if !ok {
+				continue
+			}
+			resolved, err := ingest.ResolveVersion(dependency.Requirements, candidates)
+			if err != nil {
+				dangling = append(dangling, DanglingEdge{From: from, Dependency: dependency})
+				continue
+			}
+			to := PackageKey(dependency.Platform, dependency.Name, resolved)
+			g.AddEdge(from, to)
+			// A package may list the same dependency more than once, e.g. for several kinds, and the first one wins
+			edge := PackageEdge{From: from, To: to}
+			if _, ok := g.dependencies[edge]; !ok && from != to {
+				g.dependencies[edge] = dependency
+			}
+		}
+	}
+	return g, dangling
+}
+
+// AddNode adds a node with the given key if it does not exist yet.
+func (g *PackageGraph) AddNode(key string) {
+	if _, ok := g.keyToID[key]; ok {
+		return
+	}
+	node := g.directed.NewNode()
+	g.directed.AddNode(node)
+	g.keyToID[key] = node.ID()
+	g.idToKey[node.ID()] = key
+}
+
+// AddEdge adds a depends-on edge between two nodes, adding the nodes as well if needed. Edges from a node to itself
+// are ignored.
+func (g *PackageGraph) AddEdge(from, to string) {
+	if from == to {
+		return
+	}
+	g.AddNode(from)
+	g.AddNode(to)
+	g.directed.SetEdge(simple.Edge{F: g.directed.Node(g.keyToID[from]), T: g.directed.Node(g.keyToID[to])})
+}
+
+// Has reports whether the graph has a node with the given key.
+func (g *PackageGraph) Has(key string) bool {
+	_, ok := g.keyToID[key]
+	return ok
+}
+
+// Nodes returns the keys of all nodes, sorted.
+func (g *PackageGraph) Nodes() []string {
+	keys := make([]string, 0, len(g.keyToID))
+	for key := range g.keyToID {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Edges returns all edges, sorted by their From and then their To key.
+func (g *PackageGraph) Edges() []PackageEdge {
+	edges := make([]PackageEdge, 0, g.directed.Edges().Len())
+	for it := g.directed.Edges(); it.Next(); {
+		edge := it.Edge()
+		edges = append(edges, PackageEdge{From: g.idToKey[edge.From().ID()], To: g.idToKey[edge.To().ID()]})
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	return edges
+}
+
+// Dependencies returns the keys of the direct dependencies of node, sorted. It returns nil for unknown nodes.
+func (g *PackageGraph) Dependencies(node string) []string {
+	id, ok := g.keyToID[node]
+	if !ok {
+		return nil
+	}
+	return g.sortedKeys(g.directed.From(id))
+}
+
+// Dependents returns the keys of the nodes that directly depend on node, sorted. It returns nil for unknown nodes.
+func (g *PackageGraph) Dependents(node string) []string {
+	id, ok := g.keyToID[node]
+	if !ok {
+		return nil
+	}
+	return g.sortedKeys(g.directed.To(id))
+}
+
+func (g *PackageGraph) sortedKeys(nodes graph.Nodes) []string {
+	keys := make([]string, 0, nodes.Len())
+	for nodes.Next() {
+		keys = append(keys, g.idToKey[nodes.Node().ID()])
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TopByDegree returns the subgraph of the n nodes with the most edges, counting both dependencies and dependents, and
+// the edges between them. Ties are broken by key. The nodes and edges keep their attributes. If n is not positive or
+// the graph has at most n nodes, g itself is returned.
+func (g *PackageGraph) TopByDegree(n int) *PackageGraph {
+	if n <= 0 || n >= len(g.keyToID) {
+		return g
+	}
+	keys := g.Nodes()
+	degree := make(map[string]int, len(keys))
+	for _, key := range keys {
+		id := g.keyToID[key]
+		degree[key] = g.directed.From(id).Len() + g.directed.To(id).Len()
+	}
+	// Nodes returns the keys sorted, so a stable sort breaks ties by key
+	sort.SliceStable(keys, func(i, j int) bool {
+		return degree[keys[i]] > degree[keys[j]]
+	})
+
+	top := NewPackageGraph()
+	for _, key := range keys[:n] {
+		top.AddNode(key)
+		if stars, ok := g.stars[key]; ok {
+			top.stars[key] = stars
+		}
+	}
+	for _, key := range keys[:n] {
+		for _, dependency := range g.Dependencies(key) {
+			if !top.Has(dependency) {
+				continue
+			}
+			top.AddEdge(key, dependency)
+			edge := PackageEdge{From: key, To: dependency}
+			if declared, ok := g.dependencies[edge]; ok {
+				top.dependencies[edge] = declared
+			}
+		}
+	}
+	return top
+}
+
+// Cycles returns the strongly connected components of the graph that contain a cycle, each as a sorted list of
+// keys. The components are sorted by their first key. Algorithms that assume a DAG can use it to find the nodes to
+// leave out.
+func (g *PackageGraph) Cycles() [][]string {
+	var cycles [][]string
+	for _, component := range topo.TarjanSCC(g.directed) {
+		// Self-edges are not allowed, so only components of several nodes are cyclic
+		if len(component) < 2 {
+			continue
+		}
+		keys := make([]string, 0, len(component))
+		for _, node := range component {
+			keys = append(keys, g.idToKey[node.ID()])
+		}
+		sort.Strings(keys)
+		cycles = append(cycles, keys)
+	}
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i][0] < cycles[j][0]
+	})
+	return cycles
+}
+
+// HasCycles reports whether the graph contains a cycle.
+func (g *PackageGraph) HasCycles() bool {
+	_, err := topo.Sort(g.directed)
+	return err != nil
+}
@@ -0,0 +1,149 @@
+package graph
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+)
+
+func TestFromCSV(t *testing.T) {
+	g, err := FromCSV(filepath.Join("testdata", "packages.csv"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	t.Run("Creates a node for every version", func(t *testing.T) {
+		expected := []string{
+			"NPM/a@1.0.0", "NPM/app@1.0.0", "NPM/b@1.0.0", "NPM/base@1.0.0", "NPM/base@1.0.1", "NPM/c@1.0.0",
+			"NPM/left@1.0.0", "NPM/left@1.1.0", "NPM/lonely@0.1.0", "NPM/right@2.0.0",
+		}
+		if actual := g.Nodes(); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected nodes %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Resolves dependencies to the highest matching version", func(t *testing.T) {
+		expected := []string{"NPM/left@1.1.0", "NPM/right@2.0.0"}
+		if actual := g.Dependencies("NPM/app@1.0.0"); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected dependencies %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Finds both dependents of the bottom of a diamond", func(t *testing.T) {
+		expected := []string{"NPM/left@1.1.0", "NPM/right@2.0.0"}
+		if actual := g.Dependents("NPM/base@1.0.1"); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected dependents %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Leaves isolated nodes without edges", func(t *testing.T) {
+		if len(g.Dependencies("NPM/lonely@0.1.0")) != 0 || len(g.Dependents("NPM/lonely@0.1.0")) != 0 {
+			t.Error("Expected NPM/lonely@0.1.0 to have no edges")
+		}
+	})
+
+	t.Run("Lists all edges", func(t *testing.T) {
+		if actual := len(g.Edges()); actual != 7 {
+			t.Errorf("Expected 7 edges, got %d: %v", actual, g.Edges())
+		}
+	})
+
+	t.Run("Detects the cycle", func(t *testing.T) {
+		if !g.HasCycles() {
+			t.Error("Expected the graph to have a cycle")
+		}
+		expected := [][]string{{"NPM/a@1.0.0", "NPM/b@1.0.0", "NPM/c@1.0.0"}}
+		if actual := g.Cycles(); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected cycles %v, got %v", expected, actual)
+		}
+	})
+}
+
+func TestFromIngestKeepsPlatformsApart(t *testing.T) {
+	release := []ingest.Version{{Number: "18.0.0"}}
+	g := FromIngest([]ingest.Project{
+		{Name: "react", Platform: "NPM", Versions: release, LatestReleaseNumber: "18.0.0"},
+		{Name: "react", Platform: "Maven", Versions: release, LatestReleaseNumber: "18.0.0"},
+		{Name: "app", Platform: "NPM", LatestReleaseNumber: "1.0.0",
+			Dependencies: []ingest.Dependency{{Name: "react", Platform: "NPM", Requirements: "^18.0.0"}}},
+	})
+
+	expected := []string{"Maven/react@18.0.0", "NPM/app@1.0.0", "NPM/react@18.0.0"}
+	if actual := g.Nodes(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected nodes %v, got %v", expected, actual)
+	}
+	if actual := g.Dependents("Maven/react@18.0.0"); len(actual) != 0 {
+		t.Errorf("Expected no dependents of the Maven package, got %v", actual)
+	}
+	if actual := g.Dependencies("NPM/app@1.0.0"); !reflect.DeepEqual(actual, []string{"NPM/react@18.0.0"}) {
+		t.Errorf("Expected the dependency on the npm package, got %v", actual)
+	}
+}
+
+func TestPackageGraphWithoutCycles(t *testing.T) {
+	g := NewPackageGraph()
+	g.AddEdge("NPM/app@1.0.0", "NPM/base@1.0.0")
+	g.AddEdge("NPM/base@1.0.0", "NPM/base@1.0.0")
+
+	if g.HasCycles() || len(g.Cycles()) != 0 {
+		t.Errorf("Expected no cycles, got %v", g.Cycles())
+	}
+	if !g.Has("NPM/app@1.0.0") || g.Has("NPM/other@1.0.0") {
+		t.Error("Expected exactly the nodes of the added edge")
+	}
+	if g.Dependencies("NPM/other@1.0.0") != nil {
+		t.Error("Expected no dependencies for an unknown node")
+	}
+}
+
+func TestTopByDegree(t *testing.T) {
+	g := NewPackageGraph()
+	g.AddEdge("NPM/hub@1.0.0", "NPM/x@1.0.0")
+	g.AddEdge("NPM/hub@1.0.0", "NPM/y@1.0.0")
+	g.AddEdge("NPM/hub@1.0.0", "NPM/z@1.0.0")
+	g.AddEdge("NPM/y@1.0.0", "NPM/z@1.0.0")
+
+	t.Run("Keeps the nodes with the most edges and breaks ties by key", func(t *testing.T) {
+		top := g.TopByDegree(2)
+		expected := []string{"NPM/hub@1.0.0", "NPM/y@1.0.0"}
+		if actual := top.Nodes(); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected nodes %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Keeps the edges between the remaining nodes", func(t *testing.T) {
+		expected := []PackageEdge{
+			{From: "NPM/hub@1.0.0", To: "NPM/y@1.0.0"},
+			{From: "NPM/hub@1.0.0", To: "NPM/z@1.0.0"},
+			{From: "NPM/y@1.0.0", To: "NPM/z@1.0.0"},
+		}
+		if actual := g.TopByDegree(3).Edges(); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected edges %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Returns the graph itself when there is nothing to leave out", func(t *testing.T) {
+		if g.TopByDegree(0) != g || g.TopByDegree(4) != g {
+			t.Error("Expected the graph itself")
+		}
+	})
+}
+
+func TestSplitPackageKey(t *testing.T) {
+	tests := []struct {
+		key, platform, name, version string
+	}{
+		{"NPM/left-pad@1.3.0", "NPM", "left-pad", "1.3.0"},
+		{"NPM/@babel/core@7.0.0", "NPM", "@babel/core", "7.0.0"},
+		{"Go/github.com/pkg/errors@v0.9.1", "Go", "github.com/pkg/errors", "v0.9.1"},
+		{"unrelated", "", "unrelated", ""},
+	}
+	for _, test := range tests {
+		platform, name, version := SplitPackageKey(test.key)
+		if platform != test.platform || name != test.name || version != test.version {
+			t.Errorf("Expected %s, %s and %s for %s, got %s, %s and %s", test.platform, test.name, test.version, test.key, platform, name, version)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package graph
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// PageRank scores the importance of every node of g with the iterative PageRank algorithm, keyed by stringID. Edges
+// point from dependents to their dependencies, so rank flows towards the packages many others rely on. damping is the
+// probability of following an edge rather than jumping to a random node, usually 0.85, and iterations is the number
+// of update rounds. The rank of dangling nodes, which have no dependencies, is spread uniformly over all nodes, so the
+// scores always sum to 1.
+func PageRank(g *Graph, damping float64, iterations int) map[string]float64 {
+	n := g.Len()
+	scores := make(map[string]float64, n)
+	if n == 0 {
+		return scores
+	}
+
+	// Work on dense indexes rather than maps, since every iteration touches every edge
+	ids := make([]int64, 0, n)
+	for id := range g.idToNodeInfo {
+		ids = append(ids, id)
+	}
+	index := make(map[int64]int, n)
+	for i, id := range ids {
+		index[id] = i
+	}
+	outDegrees := make([]int, n)
+	incoming := make([][]int, n)
+	for i, id := range ids {
+		dependencies := g.directed.From(id)
+		outDegrees[i] = dependencies.Len()
+		for dependencies.Next() {
+			j := index[dependencies.Node().ID()]
+			incoming[j] = append(incoming[j], i)
+		}
+	}
+
+	rank, _ := pageRank(outDegrees, incoming, damping, iterations, 0)
+	for i, id := range ids {
+		scores[g.idToNodeInfo[id].stringID] = rank[i]
+	}
+	return scores
+}
+
+// pageRank runs the PageRank iteration on a graph of dense node indexes, where outDegrees holds the number of
+// dependencies of every node and incoming the indexes of its dependents. It stops after iterations rounds, or earlier
+// once the scores change by less than tolerance in total, and returns the scores with the number of rounds run.
+func pageRank(outDegrees []int, incoming [][]int, damping float64, iterations int, tolerance float64) ([]float64, int) {
+	n := len(outDegrees)
+	rank := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	next := make([]float64, n)
+	for iteration := 0; iteration < iterations; iteration++ {
+		dangling := 0.0
+		for i, degree := range outDegrees {
+			if degree == 0 {
+				dangling += rank[i]
+			}
+		}
+		base := (1-damping)/float64(n) + damping*dangling/float64(n)
+		change := 0.0
+		for i := range next {
+			sum := 0.0
+			for _, j := range incoming[i] {
+				sum += rank[j] / float64(outDegrees[j])
+			}
+			next[i] = base + damping*sum
+			change += math.Abs(next[i] - rank[i])
+		}
+		rank, next = next, rank
+		if change < tolerance {
+			return rank, iteration + 1
+		}
+	}
+	return rank, iterations
+}
+
+// PageRank scores the importance of every node of g with PageRank, keyed by node key, like the PageRank function does
+// for a Graph: rank flows from dependents to their dependencies, so a package scores high if many packages depend on
+// it, and the rank of dangling nodes is spread over all nodes. It runs the given number of iterations.
+func (g *PackageGraph) PageRank(damping float64, iterations int) map[string]float64 {
+	scores, _ := g.PageRankUntil(damping, iterations, 0)
+	return scores
+}
+
+// PageRankUntil is PageRank, but stops before maxIterations once an iteration changes the scores by less than
+// tolerance in total, i.e. in L1 norm. It also returns the number of iterations it ran.
+func (g *PackageGraph) PageRankUntil(damping float64, maxIterations int, tolerance float64) (map[string]float64, int) {
+	keys := g.Nodes()
+	index := make(map[int64]int, len(keys))
+	for i, key := range keys {
+		index[g.keyToID[key]] = i
+	}
+	outDegrees := make([]int, len(keys))
+	incoming := make([][]int, len(keys))
+	for i, key := range keys {
+		dependencies := g.directed.From(g.keyToID[key])
+		outDegrees[i] = dependencies.Len()
+		for dependencies.Next() {
+			j := index[dependencies.Node().ID()]
+			incoming[j] = append(incoming[j], i)
+		}
+	}
+
+	scores := make(map[string]float64, len(keys))
+	if len(keys) == 0 {
+		return scores, 0
+	}
+	rank, iterations := pageRank(outDegrees, incoming, damping, maxIterations, tolerance)
+	for i, key := range keys {
+		scores[key] = rank[i]
+	}
+	return scores, iterations
+}
+
+// DegreeCentrality scores every node of g, keyed by node key, by the fraction of the other nodes that depend on it
+// directly. A node all others depend on scores 1. In a graph of a single node, it scores 0.
+func (g *PackageGraph) DegreeCentrality() map[string]float64 {
+	scores := make(map[string]float64, len(g.keyToID))
+	for key, id := range g.keyToID {
+		scores[key] = 0
+		if others := len(g.keyToID) - 1; others > 0 {
+			scores[key] = float64(g.directed.To(id).Len()) / float64(others)
+		}
+	}
+	return scores
+}
+
+// WritePackageScores writes scores keyed by node key, such as those of PackageGraph.PageRank, as CSV with the columns
+// package, version and score, from the highest to the lowest score. The package is the platform and name of the node,
+// e.g. NPM/left-pad.
+func WritePackageScores(w io.Writer, scores map[string]float64) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"package", "version", "score"})
+	for _, key := range SortByScore(scores) {
+		platform, name, version := SplitPackageKey(key)
+		if platform != "" {
+			name = platform + "/" + name
+		}
+		writer.Write([]string{name, version, strconv.FormatFloat(scores[key], 'g', -1, 64)})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("writing scores: %w", err)
+	}
+	return nil
+}
+
+// SortByScore returns the keys of scores ordered from the highest to the lowest score. Keys with equal scores are
+// ordered by key, so the result is stable.
+func SortByScore(scores map[string]float64) []string {
+	keys := make([]string, 0, len(scores))
+	for key := range scores {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if scores[keys[i]] != scores[keys[j]] {
+			return scores[keys[i]] > scores[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
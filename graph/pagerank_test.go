@@ -0,0 +1,104 @@
+package graph
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestPageRank(t *testing.T) {
+	// B, C and D all depend on A, and D also depends on C
+	g := newTestGraph(t, []string{"A", "B", "C", "D"}, [][2]string{{"B", "A"}, {"C", "A"}, {"D", "A"}, {"D", "C"}})
+	scores := PageRank(g, 0.85, 50)
+
+	t.Run("Sums to one despite the dangling node", func(t *testing.T) {
+		sum := 0.0
+		for _, score := range scores {
+			sum += score
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("Expected the scores to sum to 1, got %f", sum)
+		}
+	})
+
+	t.Run("Ranks the most depended upon package first", func(t *testing.T) {
+		expected := []string{"A-1.0.0", "C-1.0.0", "B-1.0.0", "D-1.0.0"}
+		if actual := SortByScore(scores); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected the ranking %v, got %v (scores %v)", expected, actual, scores)
+		}
+	})
+
+	t.Run("Returns the uniform distribution without iterations", func(t *testing.T) {
+		for key, score := range PageRank(g, 0.85, 0) {
+			if score != 0.25 {
+				t.Errorf("Expected %s to score 0.25, got %f", key, score)
+			}
+		}
+	})
+
+	t.Run("Handles an empty graph", func(t *testing.T) {
+		if scores := PageRank(NewGraph(), 0.85, 10); len(scores) != 0 {
+			t.Errorf("Expected no scores, got %v", scores)
+		}
+	})
+}
+
+func TestPackageGraphPageRank(t *testing.T) {
+	// a and b both depend on c, which depends on nothing. With ra = rb = x and rc = 1 - 2x, the stationary scores solve
+	// x = 0.15/3 + 0.85*rc/3, so x = 1/4.7 and rc = 2.7/4.7
+	g := NewPackageGraph()
+	g.AddEdge("NPM/a@1.0.0", "NPM/c@1.0.0")
+	g.AddEdge("NPM/b@1.0.0", "NPM/c@1.0.0")
+	expected := map[string]float64{"NPM/a@1.0.0": 1 / 4.7, "NPM/b@1.0.0": 1 / 4.7, "NPM/c@1.0.0": 2.7 / 4.7}
+
+	t.Run("Matches the hand-computed scores", func(t *testing.T) {
+		for key, score := range g.PageRank(0.85, 100) {
+			if math.Abs(score-expected[key]) > 1e-9 {
+				t.Errorf("Expected %s to score %f, got %f", key, expected[key], score)
+			}
+		}
+	})
+
+	t.Run("Stops once the scores converge", func(t *testing.T) {
+		scores, iterations := g.PageRankUntil(0.85, 1000, 1e-6)
+		if iterations >= 1000 || iterations < 2 {
+			t.Errorf("Expected to stop well before 1000 iterations, ran %d", iterations)
+		}
+		for key, score := range scores {
+			if math.Abs(score-expected[key]) > 1e-5 {
+				t.Errorf("Expected %s to score about %f, got %f", key, expected[key], score)
+			}
+		}
+	})
+
+	t.Run("Handles an empty graph", func(t *testing.T) {
+		if scores := NewPackageGraph().PageRank(0.85, 10); len(scores) != 0 {
+			t.Errorf("Expected no scores, got %v", scores)
+		}
+	})
+}
+
+func TestDegreeCentrality(t *testing.T) {
+	g := NewPackageGraph()
+	g.AddEdge("NPM/a@1.0.0", "NPM/c@1.0.0")
+	g.AddEdge("NPM/b@1.0.0", "NPM/c@1.0.0")
+	g.AddEdge("NPM/b@1.0.0", "NPM/a@1.0.0")
+
+	expected := map[string]float64{"NPM/a@1.0.0": 0.5, "NPM/b@1.0.0": 0, "NPM/c@1.0.0": 1}
+	if actual := g.DegreeCentrality(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func TestWritePackageScores(t *testing.T) {
+	var buf bytes.Buffer
+	scores := map[string]float64{"NPM/a@1.0.0": 0.25, "NPM/@babel/core@7.0.0": 0.5, "NPM/b@1.0.0": 0.25}
+	if err := WritePackageScores(&buf, scores); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := "package,version,score\nNPM/@babel/core,7.0.0,0.5\nNPM/a,1.0.0,0.25\nNPM/b,1.0.0,0.25\n"
+	if actual := buf.String(); actual != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,33 @@
+package graph
+
+import "github.com/AJMBrands/SoftwareThatMatters/ingest"
+
+// AddResolved adds the edges of a dependency graph resolved by deps.dev, as ingest.FetchResolvedDependencies returns
+// them, to g, along with the package versions they connect. Unlike the edges FromIngest guesses from version ranges,
+// they point to the exact versions the dependencies resolved to. The versions are recorded as packages of platform
+// unless g knows their platform already.
+func (g *Graph) AddResolved(platform string, dependencies []ingest.ResolvedDependency) {
+	if g.platforms == nil {
+		g.platforms = make(map[string]string)
+	}
+	for _, dependency := range dependencies {
+		from := g.AddNode(dependency.From.Name, dependency.From.Version, "")
+		to := g.AddNode(dependency.To.Name, dependency.To.Version, "")
+		// Both nodes were just added, which is all AddEdge can fail on
+		g.AddEdge(from.stringID, to.stringID)
+		for _, stringID := range []string{from.stringID, to.stringID} {
+			if _, ok := g.platforms[stringID]; !ok {
+				g.platforms[stringID] = platform
+			}
+		}
+	}
+}
+
+// AddResolved adds the edges of a dependency graph resolved by deps.dev to g like the AddResolved method of Graph,
+// keying the versions by PackageKey with the given platform.
+func (g *PackageGraph) AddResolved(platform string, dependencies []ingest.ResolvedDependency) {
+	for _, dependency := range dependencies {
+		g.AddEdge(PackageKey(platform, dependency.From.Name, dependency.From.Version),
+			PackageKey(platform, dependency.To.Name, dependency.To.Version))
+	}
+}
@@ -0,0 +1,46 @@
+package graph
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+)
+
+// testResolved is a resolved graph in which A depends directly on B and indirectly on C.
+var testResolved = []ingest.ResolvedDependency{
+	{From: ingest.ResolvedVersion{Name: "A", Version: "1.0.0"}, To: ingest.ResolvedVersion{Name: "B", Version: "2.1.0"}, Requirement: "^2.0.0"},
+	{From: ingest.ResolvedVersion{Name: "B", Version: "2.1.0"}, To: ingest.ResolvedVersion{Name: "C", Version: "0.3.0"}, Requirement: "~0.3"},
+}
+
+func TestGraphAddResolved(t *testing.T) {
+	g := newTestGraph(t, []string{"A"}, nil)
+	g.SetPlatforms(map[string]string{"A-1.0.0": "Maven"})
+	g.AddResolved("NPM", testResolved)
+
+	if g.Len() != 3 {
+		t.Errorf("Expected 3 nodes, got %d", g.Len())
+	}
+	var neighbors []string
+	for _, neighbor := range g.Neighbors("B-2.1.0") {
+		neighbors = append(neighbors, neighbor.stringID)
+	}
+	if !slices.Equal(neighbors, []string{"C-0.3.0"}) {
+		t.Errorf("Expected B to depend on C, got %v", neighbors)
+	}
+	if g.Platform("A-1.0.0") != "Maven" || g.Platform("C-0.3.0") != "NPM" {
+		t.Errorf("Expected the known platform of A to be kept and the others to be NPM, got %s and %s", g.Platform("A-1.0.0"), g.Platform("C-0.3.0"))
+	}
+}
+
+func TestPackageGraphAddResolved(t *testing.T) {
+	g := NewPackageGraph()
+	g.AddResolved("NPM", testResolved)
+
+	if dependencies := g.Dependencies("NPM/A@1.0.0"); !slices.Equal(dependencies, []string{"NPM/B@2.1.0"}) {
+		t.Errorf("Expected A to depend on B, got %v", dependencies)
+	}
+	if len(g.Nodes()) != 3 {
+		t.Errorf("Expected 3 nodes, got %v", g.Nodes())
+	}
+}
@@ -0,0 +1,59 @@
+package graph
+
+import (
+	"time"
+
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+)
+
+// DanglingEdge is a dependency of an ingested package on another ingested package that could not become an edge,
+// because none of the versions of the dependency satisfies its requirements.
+type DanglingEdge struct {
+	// From is the key of the dependent node.
+	From       string
+	Dependency ingest.Dependency
+}
+
+// BuildSnapshot builds the PackageGraph as it existed at cutoff: only the versions published before cutoff become
+// nodes, and dependencies resolve against those versions like in FromIngest. Versions without a publication time are
+// left out, since we cannot tell whether they existed, so packages without any version before cutoff disappear.
+//
+// libraries.io only lists the dependencies of the latest release, so they are attributed to the highest version of a
+// package published before cutoff. Dependencies on ingested packages that no such version satisfies, including
+// packages that were not published yet, are returned as dangling edges.
+func BuildSnapshot(projects []ingest.Project, cutoff time.Time) (*PackageGraph, []DanglingEdge) {
+	snapshot := make([]ingest.Project, 0, len(projects))
+	for _, project := range projects {
+		snapshot = append(snapshot, projectAt(project, cutoff))
+	}
+	return buildPackageGraph(snapshot)
+}
+
+// projectAt returns project with only the versions published before cutoff. Its latest release becomes the highest of
+// them, preferring releases over prereleases, or empty if there are none.
+func projectAt(project ingest.Project, cutoff time.Time) ingest.Project {
+	var versions []ingest.Version
+	var numbers []string
+	for _, version := range project.Versions {
+		if published, ok := version.PublishedTime(); ok && published.Before(cutoff) {
+			versions = append(versions, version)
+			numbers = append(numbers, version.Number)
+		}
+	}
+	project.Versions = versions
+	project.LatestReleaseNumber = ""
+	project.LatestReleasePublishedAt = ""
+	if len(numbers) > 0 {
+		// The highest release, or the last version listed if none of them is semver
+		project.LatestReleaseNumber = numbers[len(numbers)-1]
+		if latest, err := ingest.ResolveVersion("*", numbers); err == nil {
+			project.LatestReleaseNumber = latest
+		}
+		for _, version := range versions {
+			if version.Number == project.LatestReleaseNumber {
+				project.LatestReleasePublishedAt = version.PublishedAt
+			}
+		}
+	}
+	return project
+}
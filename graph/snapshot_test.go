@@ -0,0 +1,81 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AJMBrands/SoftwareThatMatters/ingest"
+)
+
+func TestBuildSnapshot(t *testing.T) {
+	dependency := func(name, requirements string) ingest.Dependency {
+		return ingest.Dependency{Name: name, Platform: "NPM", Requirements: requirements}
+	}
+	projects := []ingest.Project{
+		{Name: "base", Platform: "NPM", LatestReleaseNumber: "2.0.0", Versions: []ingest.Version{
+			{Number: "1.0.0", PublishedAt: "2020-01-01T00:00:00Z"},
+			{Number: "2.0.0", PublishedAt: "2022-01-01T00:00:00Z"},
+		}},
+		{Name: "app", Platform: "NPM", LatestReleaseNumber: "1.1.0", Versions: []ingest.Version{
+			{Number: "1.0.0", PublishedAt: "2020-06-01T00:00:00Z"},
+			{Number: "1.1.0", PublishedAt: "2021-06-01T00:00:00Z"},
+		}, Dependencies: []ingest.Dependency{dependency("base", "^2.0.0"), dependency("lib", "^1.0.0")}},
+		{Name: "lib", Platform: "NPM", LatestReleaseNumber: "1.0.0", Versions: []ingest.Version{
+			{Number: "0.9.0"},
+			{Number: "1.0.0", PublishedAt: "2021-01-01T00:00:00Z"},
+		}, Dependencies: []ingest.Dependency{dependency("base", "^1.0.0")}},
+		{Name: "late", Platform: "NPM", LatestReleaseNumber: "1.0.0", Versions: []ingest.Version{
+			{Number: "1.0.0", PublishedAt: "2022-06-01T00:00:00Z"},
+		}, Dependencies: []ingest.Dependency{dependency("base", "*"), dependency("ghost", "*")}},
+	}
+
+	tests := []struct {
+		cutoff                 string
+		nodes, edges, dangling int
+	}{
+		{"2021-01-01T00:00:00Z", 2, 0, 2},
+		{"2022-01-01T00:00:00Z", 4, 2, 1},
+		{"2023-01-01T00:00:00Z", 6, 4, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.cutoff, func(t *testing.T) {
+			cutoff, err := time.Parse(time.RFC3339, test.cutoff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g, dangling := BuildSnapshot(projects, cutoff)
+			if actual := len(g.Nodes()); actual != test.nodes {
+				t.Errorf("Expected %d nodes, got %d: %v", test.nodes, actual, g.Nodes())
+			}
+			if actual := len(g.Edges()); actual != test.edges {
+				t.Errorf("Expected %d edges, got %d: %v", test.edges, actual, g.Edges())
+			}
+			if len(dangling) != test.dangling {
+				t.Errorf("Expected %d dangling edges, got %d: %v", test.dangling, len(dangling), dangling)
+			}
+		})
+	}
+
+	t.Run("Attributes the dependencies to the highest version before the cutoff", func(t *testing.T) {
+		g, dangling := BuildSnapshot(projects, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+		expected := []DanglingEdge{
+			{From: "NPM/app@1.0.0", Dependency: dependency("base", "^2.0.0")},
+			{From: "NPM/app@1.0.0", Dependency: dependency("lib", "^1.0.0")},
+		}
+		if !reflect.DeepEqual(dangling, expected) {
+			t.Errorf("Expected dangling edges %v, got %v", expected, dangling)
+		}
+		if g.Has("NPM/lib@0.9.0") || g.Has("NPM/late@1.0.0") {
+			t.Errorf("Expected versions without a publication time or after the cutoff to be left out, got %v", g.Nodes())
+		}
+	})
+
+	t.Run("Resolves ranges against the versions before the cutoff", func(t *testing.T) {
+		g, _ := BuildSnapshot(projects, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+		expected := []string{"NPM/base@1.0.0"}
+		if actual := g.Dependencies("NPM/lib@1.0.0"); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected dependencies %v, got %v", expected, actual)
+		}
+	})
+}
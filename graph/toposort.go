@@ -0,0 +1,68 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TopoSort returns the stringIDs of all nodes of g in dependency order, every node after all of its dependencies, using
+// Kahn's algorithm. Nodes become ready in waves, and each wave is sorted by stringID so the order is stable. If g has a
+// cycle no order exists, and an error naming one of the nodes on a cycle is returned instead.
+func TopoSort(g *Graph) ([]string, error) {
+	// remaining counts the dependencies of each node that have not been emitted yet
+	remaining := make(map[int64]int, g.directed.Nodes().Len())
+	var ready []string
+	for nodes := g.directed.Nodes(); nodes.Next(); {
+		id := nodes.Node().ID()
+		remaining[id] = g.directed.From(id).Len()
+		if remaining[id] == 0 {
+			ready = append(ready, g.idToNodeInfo[id].stringID)
+		}
+	}
+
+	order := make([]string, 0, len(remaining))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		order = append(order, ready...)
+		var next []string
+		for _, stringID := range ready {
+			for dependents := g.directed.To(g.stringIDToNodeInfo[stringID].id); dependents.Next(); {
+				dependent := dependents.Node().ID()
+				remaining[dependent]--
+				if remaining[dependent] == 0 {
+					next = append(next, g.idToNodeInfo[dependent].stringID)
+				}
+			}
+		}
+		ready = next
+	}
+
+	if len(order) < len(remaining) {
+		return nil, fmt.Errorf("dependency graph has a cycle through %s", g.nodeOnCycle(remaining))
+	}
+	return order, nil
+}
+
+// nodeOnCycle returns the stringID of a node on a cycle, given the dependency counts TopoSort is left with. Every node
+// with dependencies left has one of them left, so following those dependencies must eventually come back to a node
+// that was already visited, which lies on a cycle.
+func (g *Graph) nodeOnCycle(remaining map[int64]int) string {
+	var start string
+	for id, count := range remaining {
+		if stringID := g.idToNodeInfo[id].stringID; count > 0 && (start == "" || stringID < start) {
+			start = stringID
+		}
+	}
+	visited := map[string]bool{}
+	current := start
+	for !visited[current] {
+		visited[current] = true
+		for _, dependency := range g.Neighbors(current) {
+			if remaining[dependency.id] > 0 {
+				current = dependency.stringID
+				break
+			}
+		}
+	}
+	return current
+}
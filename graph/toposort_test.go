@@ -0,0 +1,47 @@
+package graph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTopoSort(t *testing.T) {
+	t.Run("Orders dependencies before dependents", func(t *testing.T) {
+		g := newTestGraph(t, []string{"app", "left", "right", "base", "lonely"}, [][2]string{
+			{"app", "left"}, {"app", "right"}, {"left", "base"}, {"right", "base"}, {"app", "base"},
+		})
+		expected := []string{"base-1.0.0", "lonely-1.0.0", "left-1.0.0", "right-1.0.0", "app-1.0.0"}
+		actual, err := TopoSort(g)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected order %v, got %v", expected, actual)
+		}
+	})
+
+	t.Run("Sorts an empty graph", func(t *testing.T) {
+		actual, err := TopoSort(NewGraph())
+		if err != nil || len(actual) != 0 {
+			t.Errorf("Expected an empty order, got %v and %v", actual, err)
+		}
+	})
+
+	t.Run("Names a node on the cycle", func(t *testing.T) {
+		// A only depends on the cycle, so it must not be named
+		g := newTestGraph(t, []string{"A", "B", "C", "D"}, [][2]string{
+			{"A", "B"}, {"B", "C"}, {"C", "B"}, {"C", "D"},
+		})
+		order, err := TopoSort(g)
+		if err == nil {
+			t.Fatalf("Expected an error, got order %v", order)
+		}
+		if !strings.Contains(err.Error(), "B-1.0.0") && !strings.Contains(err.Error(), "C-1.0.0") {
+			t.Errorf("Expected the error to name B or C, got %v", err)
+		}
+		if order != nil {
+			t.Errorf("Expected no partial order, got %v", order)
+		}
+	})
+}
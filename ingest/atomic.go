@@ -0,0 +1,164 @@
+package ingest
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tempSuffix is put between the path of an output file and the id of the process writing it to name the temporary
+// file the output is written to first, e.g. result.csv.tmp-4242.
+const tempSuffix = ".tmp-"
+
+// tempPath returns the temporary file this process writes the output for path to.
+func tempPath(path string) string {
+	return path + tempSuffix + strconv.Itoa(os.Getpid())
+}
+
+// isTempPath reports whether temp is the temporary file of some process for path.
+func isTempPath(path, temp string) bool {
+	_, ok := tempPID(path, temp)
+	return ok
+}
+
+// tempPID returns the id of the process whose temporary file for path temp is, if it is one.
+func tempPID(path, temp string) (int, bool) {
+	pid, ok := strings.CutPrefix(temp, path+tempSuffix)
+	if !ok || pid == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(pid)
+	return n, err == nil
+}
+
+// removeStaleTemps removes the temporary files of path that runs which crashed left behind. The files of processes
+// that are still running, such as this one or another run writing the same output, are left alone.
+func removeStaleTemps(path string) {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		temp := filepath.Join(filepath.Dir(path), entry.Name())
+		pid, ok := tempPID(path, temp)
+		if entry.IsDir() || !ok || pid == os.Getpid() || processAlive(pid) {
+			continue
+		}
+		if err := os.Remove(temp); err == nil {
+			slog.Info("Removed the temporary file of an earlier run", "path", temp)
+		}
+	}
+}
+
+// AtomicFile is an output file that is written to a temporary file next to it, named like result.csv.tmp-4242 after
+// the id of the process, and only renamed into place by Commit. Until then, a crash or a failure leaves whatever file
+// was at its path untouched, so readers never see half of an output.
+type AtomicFile struct {
+	*os.File
+	path string
+}
+
+// CreateAtomic creates the directory of path if it is missing, removes the temporary files of path that crashed runs
+// left behind and creates the temporary file of this process for writing.
+func CreateAtomic(path string) (*AtomicFile, error) {
+	return createAtomicAt(path, resumePoint{})
+}
+
+// createAtomicAt is like CreateAtomic, but if resume.offset is positive, the temporary file starts with the first
+// resume.offset bytes of resume.from. That is either path itself, whose bytes are copied, or the temporary file of a
+// run that crashed, which is taken over.
+func createAtomicAt(path string, resume resumePoint) (*AtomicFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating output directory: %w", err)
+	}
+	temp := tempPath(path)
+	// The temporary file of the crashed run is moved out of the way of removeStaleTemps first
+	if resume.offset > 0 && resume.from != path {
+		if err := os.Rename(resume.from, temp); err != nil {
+			return nil, fmt.Errorf("taking over %s: %w", resume.from, err)
+		}
+	}
+	removeStaleTemps(path)
+
+	if resume.offset <= 0 {
+		f, err := os.Create(temp)
+		if err != nil {
+			return nil, fmt.Errorf("creating output file %s: %w", temp, err)
+		}
+		return &AtomicFile{File: f, path: path}, nil
+	}
+	if resume.from == path {
+		if err := copyPrefix(path, temp, resume.offset); err != nil {
+			os.Remove(temp)
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(temp, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening output file %s: %w", temp, err)
+	}
+	atomic := &AtomicFile{File: f, path: path}
+	// Whatever follows the offset was written after the last checkpoint and may be incomplete
+	if err := f.Truncate(resume.offset); err != nil {
+		atomic.Abort()
+		return nil, fmt.Errorf("truncating output file %s: %w", temp, err)
+	}
+	if _, err := f.Seek(resume.offset, io.SeekStart); err != nil {
+		atomic.Abort()
+		return nil, fmt.Errorf("seeking in output file %s: %w", temp, err)
+	}
+	return atomic, nil
+}
+
+// copyPrefix copies the first n bytes of the file at from to a new file at to, failing if from is shorter.
+func copyPrefix(from, to string, n int64) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return fmt.Errorf("opening output file %s: %w", from, err)
+	}
+	defer src.Close()
+	dst, err := os.Create(to)
+	if err != nil {
+		return fmt.Errorf("creating output file %s: %w", to, err)
+	}
+	_, err = io.CopyN(dst, src, n)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("copying %s: %w", from, err)
+	}
+	return nil
+}
+
+// Path returns the path the file is renamed to by Commit.
+func (f *AtomicFile) Path() string {
+	return f.path
+}
+
+// Commit flushes the file to disk, closes it and renames it to its path, replacing the file there. If any of that
+// fails, the temporary file is removed.
+func (f *AtomicFile) Commit() error {
+	err := f.Sync()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("writing %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// Abort closes and removes the temporary file, leaving the file at its path as it was.
+func (f *AtomicFile) Abort() {
+	f.Close()
+	os.Remove(f.Name())
+}
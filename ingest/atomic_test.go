@@ -0,0 +1,162 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// dirEntries returns the names of the files in dir.
+func dirEntries(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Could not list %s: %v", dir, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+// exitedPID returns the id of a process that has exited.
+func exitedPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Could not run %s: %v", os.Args[0], err)
+	}
+	return cmd.ProcessState.Pid()
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "result.csv")
+	if err := os.WriteFile(outPath, []byte("previous\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	crashed := "result.csv.tmp-" + strconv.Itoa(exitedPID(t))
+	// Written by a run that is still going
+	running := "result.csv.tmp-" + strconv.Itoa(os.Getppid())
+	// Left behind by a run that crashed, unlike the files of running processes and those that merely look alike
+	for _, name := range []string{crashed, running, "result.csv.tmp-x", "other.csv.tmp-1"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("Keeps the previous output if writing fails", func(t *testing.T) {
+		_, err := writeFile(context.Background(), outPath, func(w io.Writer) (int, error) {
+			if _, err := os.Stat(tempPath(outPath)); err != nil {
+				t.Errorf("Expected the output to be written to a temporary file, got %v", err)
+			}
+			io.WriteString(w, "half")
+			return 0, errors.New("failed")
+		})
+		if err == nil {
+			t.Fatalf("Expected the error of write")
+		}
+		if data, _ := os.ReadFile(outPath); string(data) != "previous\n" {
+			t.Errorf("Expected the previous output, got %q", data)
+		}
+		expected := []string{"other.csv.tmp-1", "result.csv", running, "result.csv.tmp-x"}
+		slices.Sort(expected)
+		if names := dirEntries(t, dir); !slices.Equal(names, expected) {
+			t.Errorf("Expected %v, got %v", expected, names)
+		}
+	})
+
+	t.Run("Replaces the output once it is complete", func(t *testing.T) {
+		_, err := writeFile(context.Background(), outPath, func(w io.Writer) (int, error) {
+			_, err := io.WriteString(w, "next\n")
+			return 1, err
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if data, _ := os.ReadFile(outPath); string(data) != "next\n" {
+			t.Errorf("Expected the new output, got %q", data)
+		}
+		if names := dirEntries(t, dir); len(names) != 4 {
+			t.Errorf("Expected no temporary file to be left, got %v", names)
+		}
+	})
+
+	t.Run("Keeps the previous output if the write is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err := writeFile(ctx, outPath, func(w io.Writer) (int, error) {
+			io.WriteString(w, "partial\n")
+			cancel()
+			return 1, ctx.Err()
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected the cancellation, got %v", err)
+		}
+		if data, _ := os.ReadFile(outPath); string(data) != "next\n" {
+			t.Errorf("Expected the previous output, got %q", data)
+		}
+		if names := dirEntries(t, dir); len(names) != 4 {
+			t.Errorf("Expected no temporary file to be left, got %v", names)
+		}
+	})
+}
+
+func TestWriteSQLiteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "result.sqlite")
+	if err := os.WriteFile(outPath, []byte("previous"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := writeSQLiteFile(context.Background(), outPath, func(writer projectWriter) (int, error) {
+		return 0, errors.New("failed")
+	})
+	if err == nil {
+		t.Fatalf("Expected the error of write")
+	}
+	if data, _ := os.ReadFile(outPath); string(data) != "previous" {
+		t.Errorf("Expected the previous output, got %q", data)
+	}
+	if names := dirEntries(t, dir); !slices.Equal(names, []string{"result.sqlite"}) {
+		t.Errorf("Expected no temporary file to be left, got %v", names)
+	}
+}
+
+func TestCreateAtomic(t *testing.T) {
+	outPath := filepath.Join(t.TempDir(), "nested", "stats.json")
+	f, err := CreateAtomic(outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	f.WriteString("{}\n")
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing at %s before the commit, got %v", outPath, err)
+	}
+	if err := f.Commit(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if data, _ := os.ReadFile(outPath); string(data) != "{}\n" {
+		t.Errorf("Expected the committed content, got %q", data)
+	}
+
+	t.Run("Abort", func(t *testing.T) {
+		f, err := CreateAtomic(outPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		f.WriteString("[]\n")
+		f.Abort()
+		if data, _ := os.ReadFile(outPath); string(data) != "{}\n" {
+			t.Errorf("Expected the committed content, got %q", data)
+		}
+		if names := dirEntries(t, filepath.Dir(outPath)); len(names) != 1 {
+			t.Errorf("Expected the temporary file to be removed, got %v", names)
+		}
+	})
+}
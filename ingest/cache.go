@@ -0,0 +1,170 @@
+package ingest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// validatorsSuffix is appended to the file of an entry to get the file that holds the validators of its response.
+const validatorsSuffix = ".validators"
+
+// responseCache keeps response bodies on disk, one file per request URL, so that repeated runs do not send the same
+// requests again. Entries are written to a temporary file first and then renamed into place, so several processes can
+// share a cache directory without reading half written entries. The validators of a response, if the server sent any,
+// are kept next to its entry, so that an entry that expired can be revalidated with a conditional request instead of
+// being downloaded again.
+type responseCache struct {
+	dir string
+	// ttl is how long an entry is used after it was written. Zero or less means entries do not expire.
+	ttl time.Duration
+	// refresh ignores existing entries, so every response is fetched again and overwrites its entry
+	refresh bool
+}
+
+// newResponseCache returns the cache configured in opts, or nil if caching is disabled.
+func newResponseCache(opts Options) *responseCache {
+	if opts.CacheDir == "" {
+		return nil
+	}
+	return &responseCache{dir: opts.CacheDir, ttl: opts.CacheTTL, refresh: opts.RefreshCache}
+}
+
+// path returns the file of the entry for query. The API key is left out of the key, so that entries survive a new key
+// and the key is not needed to find them.
+func (c *responseCache) path(query string) string {
+	sum := sha256.Sum256([]byte(withoutAPIKey(query)))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// get returns the cached body for query and whether there was a fresh entry. A nil cache never has one.
+func (c *responseCache) get(query string) ([]byte, bool) {
+	if c == nil || c.refresh {
+		return nil, false
+	}
+	path := c.path(query)
+	info, err := os.Stat(path)
+	if err != nil || (c.ttl > 0 && now().Sub(info.ModTime()) > c.ttl) {
+		return nil, false
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return body, true
+}
+
+// stale returns the cached body for query whatever its age, along with the validators of the response, and reports
+// whether there was an entry with validators. Unlike get it ignores the TTL, since a conditional request asks the
+// server whether the entry is still current.
+func (c *responseCache) stale(query string) ([]byte, cacheValidators, bool) {
+	if c == nil || c.refresh {
+		return nil, cacheValidators{}, false
+	}
+	path := c.path(query)
+	data, err := os.ReadFile(path + validatorsSuffix)
+	if err != nil {
+		return nil, cacheValidators{}, false
+	}
+	var validators cacheValidators
+	if err := json.Unmarshal(data, &validators); err != nil || validators.empty() {
+		return nil, cacheValidators{}, false
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, cacheValidators{}, false
+	}
+	return body, validators, true
+}
+
+// touch makes the entry for query fresh again, after the server answered a conditional request for it with 304 Not
+// Modified.
+func (c *responseCache) touch(query string) error {
+	if c == nil {
+		return nil
+	}
+	modified := now()
+	if err := os.Chtimes(c.path(query), modified, modified); err != nil {
+		return fmt.Errorf("refreshing cache entry: %w", err)
+	}
+	return nil
+}
+
+// put stores body as the entry for query, along with the validators of the response. A nil cache does nothing. The
+// validators of the previous entry are removed before it is replaced, so that they are never taken for those of
+// another body.
+func (c *responseCache) put(query string, body []byte, validators cacheValidators) error {
+	if c == nil {
+		return nil
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("creating cache directory: %w", err)
+	}
+	path := c.path(query)
+	if err := os.Remove(path + validatorsSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("writing cache entry: %w", err)
+	}
+	if err := c.write(path, body); err != nil {
+		return err
+	}
+	if validators.empty() {
+		return nil
+	}
+	data, err := json.Marshal(validators)
+	if err != nil {
+		return fmt.Errorf("encoding cache validators: %w", err)
+	}
+	return c.write(path+validatorsSuffix, data)
+}
+
+// write writes data to a temporary file in the cache directory and renames it to path.
+func (c *responseCache) write(path string, data []byte) error {
+	f, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating cache entry: %w", err)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("writing cache entry: %w", err)
+	}
+	return nil
+}
+
+// cacheValidators are the headers of a response that a conditional request sends back to ask whether it changed.
+type cacheValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// responseValidators returns the validators in the header of a response.
+func responseValidators(header http.Header) cacheValidators {
+	return cacheValidators{ETag: header.Get("ETag"), LastModified: header.Get("Last-Modified")}
+}
+
+func (v cacheValidators) empty() bool {
+	return v.ETag == "" && v.LastModified == ""
+}
+
+// requestHeader returns the header of a conditional request for a response with the validators v.
+func (v cacheValidators) requestHeader() http.Header {
+	header := make(http.Header)
+	if v.ETag != "" {
+		header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		header.Set("If-Modified-Since", v.LastModified)
+	}
+	return header
+}
@@ -0,0 +1,196 @@
+package ingest
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIngestCache(t *testing.T) {
+	var requests int64
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if r.URL.Path == "/" {
+			w.Write([]byte(testProjectsPage))
+			return
+		}
+		w.Write([]byte(`{"dependencies": [{"name": "tape", "platform": "NPM", "requirements": "^4.0.0", "latest": "4.0.0"}]}`))
+	})
+	cacheDir := t.TempDir()
+	opts := Options{Platform: "NPM", APIKey: "secret", Workers: 1, Dependencies: true, CacheDir: cacheDir}
+	ingest := func(t *testing.T, opts Options) Stats {
+		t.Helper()
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+		stats, err := Ingest(opts, outPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stats.Packages != 1 {
+			t.Errorf("Expected 1 package, got %d", stats.Packages)
+		}
+		return stats
+	}
+
+	first := ingest(t, opts)
+	sent := atomic.LoadInt64(&requests)
+	if sent == 0 || first.Requests != sent || first.CacheHits != 0 {
+		t.Fatalf("Expected the first run to send all requests, got %d sent and %+v", sent, first)
+	}
+
+	t.Run("Sends no requests on the second run", func(t *testing.T) {
+		atomic.StoreInt64(&requests, 0)
+		// A different key must not matter
+		opts := opts
+		opts.APIKey = "another secret"
+		second := ingest(t, opts)
+		if actual := atomic.LoadInt64(&requests); actual != 0 {
+			t.Errorf("Expected no requests, got %d", actual)
+		}
+		if second.Requests != 0 || second.CacheHits != first.Requests {
+			t.Errorf("Expected %d cache hits and no requests, got %+v", first.Requests, second)
+		}
+	})
+
+	t.Run("Bypasses the cache when it is disabled", func(t *testing.T) {
+		atomic.StoreInt64(&requests, 0)
+		opts := opts
+		opts.CacheDir = ""
+		ingest(t, opts)
+		if actual := atomic.LoadInt64(&requests); actual != sent {
+			t.Errorf("Expected %d requests, got %d", sent, actual)
+		}
+	})
+
+	t.Run("Refreshes entries", func(t *testing.T) {
+		atomic.StoreInt64(&requests, 0)
+		opts := opts
+		opts.RefreshCache = true
+		ingest(t, opts)
+		if actual := atomic.LoadInt64(&requests); actual != sent {
+			t.Errorf("Expected %d requests, got %d", sent, actual)
+		}
+	})
+
+	t.Run("Fetches expired entries again", func(t *testing.T) {
+		entries, err := os.ReadDir(cacheDir)
+		if err != nil || len(entries) == 0 {
+			t.Fatalf("Expected cache entries, got %v and %v", entries, err)
+		}
+		old := time.Now().Add(-2 * time.Hour)
+		for _, entry := range entries {
+			if err := os.Chtimes(filepath.Join(cacheDir, entry.Name()), old, old); err != nil {
+				t.Fatalf("Could not age %s: %v", entry.Name(), err)
+			}
+		}
+		atomic.StoreInt64(&requests, 0)
+		opts := opts
+		opts.CacheTTL = time.Hour
+		ingest(t, opts)
+		if actual := atomic.LoadInt64(&requests); actual != sent {
+			t.Errorf("Expected %d requests, got %d", sent, actual)
+		}
+	})
+}
+
+func TestResponseCacheLeavesNoTemporaryFiles(t *testing.T) {
+	cache := &responseCache{dir: t.TempDir()}
+	for i := 0; i < 3; i++ {
+		if err := cache.put("https://libraries.io/api/search?api_key=secret&page=1", []byte("[]"), cacheValidators{}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	entries, err := os.ReadDir(cache.dir)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected a single entry, got %v and %v", entries, err)
+	}
+	if body, ok := cache.get("https://libraries.io/api/search?page=1"); !ok || string(body) != "[]" {
+		t.Errorf("Expected the entry to be found without the API key, got %q and %v", body, ok)
+	}
+}
+
+func TestIngestConditionalRequests(t *testing.T) {
+	var requests, conditional int64
+	etag := `"v1"`
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if r.Header.Get("If-None-Match") != "" {
+			atomic.AddInt64(&conditional, 1)
+		}
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if r.URL.Path == "/" {
+			w.Write([]byte(testProjectsPage))
+			return
+		}
+		w.Write([]byte(`{"dependencies": [{"name": "tape", "platform": "NPM", "requirements": "^4.0.0", "latest": "4.0.0"}]}`))
+	})
+	cacheDir := t.TempDir()
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+	opts := Options{Platform: "NPM", APIKey: "secret", Workers: 1, Dependencies: true, CacheDir: cacheDir, CacheTTL: time.Hour}
+	ingest := func(t *testing.T) Stats {
+		t.Helper()
+		atomic.StoreInt64(&requests, 0)
+		atomic.StoreInt64(&conditional, 0)
+		stats, err := Ingest(opts, outPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return stats
+	}
+	expire := func(t *testing.T) {
+		t.Helper()
+		entries, err := os.ReadDir(cacheDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-2 * time.Hour)
+		for _, entry := range entries {
+			if err := os.Chtimes(filepath.Join(cacheDir, entry.Name()), old, old); err != nil {
+				t.Fatalf("Could not age %s: %v", entry.Name(), err)
+			}
+		}
+	}
+
+	first := ingest(t)
+	if conditional := atomic.LoadInt64(&conditional); first.Requests == 0 || conditional != 0 {
+		t.Fatalf("Expected unconditional requests on the first run, got %d of %d", conditional, first.Requests)
+	}
+	expected := readCSV(t, outPath)
+
+	t.Run("Revalidates expired entries", func(t *testing.T) {
+		expire(t)
+		second := ingest(t)
+		conditional := atomic.LoadInt64(&conditional)
+		if conditional != first.Requests || second.NotModified != first.Requests || second.Bytes != 0 {
+			t.Errorf("Expected %d conditional requests answered with 304, got %d and %+v", first.Requests, conditional, second)
+		}
+		if actual := readCSV(t, outPath); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected the cached data to be written, got %v", actual)
+		}
+	})
+
+	t.Run("Keeps revalidated entries fresh", func(t *testing.T) {
+		if third := ingest(t); third.Requests != 0 || third.CacheHits != first.Requests {
+			t.Errorf("Expected only cache hits, got %+v", third)
+		}
+	})
+
+	t.Run("Stores changed responses", func(t *testing.T) {
+		expire(t)
+		etag = `"v2"`
+		if stats := ingest(t); stats.NotModified != 0 || stats.Bytes == 0 {
+			t.Errorf("Expected the responses to be downloaded again, got %+v", stats)
+		}
+		expire(t)
+		if stats := ingest(t); stats.NotModified != first.Requests {
+			t.Errorf("Expected the new ETag to be sent, got %+v", stats)
+		}
+	})
+}
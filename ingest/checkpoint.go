@@ -0,0 +1,227 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// checkpointSuffix is appended to the output path to get the path of its checkpoint file.
+const checkpointSuffix = ".checkpoint.json"
+
+// checkpoint records how far an ingestion into an output file got, so that an interrupted run can continue after the
+// last page that was written completely. The settings that determine the content of the file are recorded as well,
+// since continuing with different ones would mix up the pages.
+type checkpoint struct {
+	Platforms []string `json:"platforms"`
+	PerPage   int      `json:"per_page"`
+	Format    string   `json:"format"`
+	Columns   []string `json:"columns,omitempty"`
+	// Keywords and Languages are part of the search, so the pages of a run with different ones hold other packages,
+	// and so does a run with or without a Since, which sorts them by release
+	Keywords  []string `json:"keywords,omitempty"`
+	Languages []string `json:"languages,omitempty"`
+	Since     string   `json:"since,omitempty"`
+	// Platform is the index in Platforms of the platform being ingested
+	Platform int `json:"platform"`
+	// Page is the last page of that platform that was written completely, 0 if none was
+	Page int `json:"page"`
+	// PlatformPackages is the number of packages of that platform written so far
+	PlatformPackages int `json:"platform_packages"`
+	// Packages is the number of packages in the output file
+	Packages int `json:"packages"`
+	// Offset is the size of the output file after the last page
+	Offset int64 `json:"offset"`
+	// Temp is the temporary file the output was written to, which is continued instead of the output file if the run
+	// was cancelled or crashed before renaming it into place
+	Temp string `json:"temp,omitempty"`
+}
+
+// checkpointPath returns the path of the checkpoint file of the given output file.
+func checkpointPath(outPath string) string {
+	return outPath + checkpointSuffix
+}
+
+// loadCheckpoint reads the checkpoint of outPath. It is only used if it was written with the same settings as fresh,
+// and if the first Offset bytes of the output file hold exactly the recorded number of packages. The output file is
+// the temporary file of the checkpoint if it is still there, and outPath otherwise, in which case Temp is cleared.
+// Otherwise fresh is returned, which starts a clean run. The packages in those bytes are returned as well, so that the
+// resumed run does not write them again.
+func loadCheckpoint(outPath string, fresh checkpoint) (checkpoint, packageSet) {
+	data, err := os.ReadFile(checkpointPath(outPath))
+	if err != nil {
+		return fresh, packageSet{}
+	}
+	var saved checkpoint
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fresh, packageSet{}
+	}
+	if !reflect.DeepEqual(saved.Platforms, fresh.Platforms) || saved.PerPage != fresh.PerPage ||
+		saved.Format != fresh.Format || strings.Join(saved.Columns, ",") != strings.Join(fresh.Columns, ",") ||
+		strings.Join(saved.Keywords, ",") != strings.Join(fresh.Keywords, ",") ||
+		strings.Join(saved.Languages, ",") != strings.Join(fresh.Languages, ",") || saved.Since != fresh.Since ||
+		saved.Offset <= 0 {
+		return fresh, packageSet{}
+	}
+	format, err := ParseFormat(saved.Format)
+	if err != nil {
+		return fresh, packageSet{}
+	}
+	// Only a temporary file of outPath is taken over, whatever the checkpoint says
+	if _, err := os.Stat(saved.Temp); err != nil || !isTempPath(outPath, saved.Temp) {
+		saved.Temp = ""
+	}
+	from := saved.Temp
+	if from == "" {
+		from = outPath
+	}
+	written, packages, err := readPackages(from, saved.Offset, format)
+	if err != nil || packages != saved.Packages {
+		return fresh, packageSet{}
+	}
+	return saved, written
+}
+
+// save writes the checkpoint of outPath. Like the response cache, it writes a temporary file first and renames it,
+// so a crash never leaves a half written checkpoint behind.
+func (c checkpoint) save(outPath string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("encoding checkpoint: %w", err)
+	}
+	path := checkpointPath(outPath)
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating checkpoint: %w", err)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// readPackages reads the packages in the first size bytes of the output file at path and returns them as a set along
+// with their number. CSV output without a name or platform column only gives the number.
+func readPackages(path string, size int64, format Format) (packageSet, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil || info.Size() < size {
+		return nil, 0, fmt.Errorf("%s is shorter than its checkpoint", path)
+	}
+	r := bufio.NewReaderSize(io.LimitReader(f, size), outputBufferSize)
+	written := packageSet{}
+
+	switch format {
+	case FormatNDJSON:
+		packages := 0
+		decoder := json.NewDecoder(r)
+		for {
+			var project Project
+			if err := decoder.Decode(&project); err == io.EOF {
+				return written, packages, nil
+			} else if err != nil {
+				return nil, 0, err
+			}
+			written.add(project)
+			packages++
+		}
+	case FormatJSON:
+		// The checkpoint lies before the closing bracket
+		var projects []Project
+		if err := json.NewDecoder(io.MultiReader(r, strings.NewReader("]"))).Decode(&projects); err != nil {
+			return nil, 0, err
+		}
+		for _, project := range projects {
+			written.add(project)
+		}
+		return written, len(projects), nil
+	}
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, 0, fmt.Errorf("%s has no CSV header: %v", path, err)
+	}
+	name, platform := slices.Index(records[0], "name"), slices.Index(records[0], "platform")
+	if name >= 0 && platform >= 0 {
+		for _, record := range records[1:] {
+			written.add(Project{Name: record[name], Platform: record[platform]})
+		}
+	}
+	return written, len(records) - 1, nil
+}
+
+// checkpointer keeps the checkpoint of an ingestion up to date. A nil checkpointer starts every platform at the first
+// page and records nothing.
+type checkpointer struct {
+	outPath    string
+	out        *outputFile
+	checkpoint checkpoint
+}
+
+// firstPlatform returns the index of the platform to continue with. The ones before it are done.
+func (c *checkpointer) firstPlatform() int {
+	if c == nil {
+		return 0
+	}
+	return c.checkpoint.Platform
+}
+
+// start returns the page to continue the given platform at and the number of its packages written before.
+func (c *checkpointer) start(platform int) (page, written int) {
+	if c == nil || c.checkpoint.Platform != platform {
+		return 1, 0
+	}
+	return c.checkpoint.Page + 1, c.checkpoint.PlatformPackages
+}
+
+// attach hands the checkpointer the output file it records. A resumed run continues its output in a temporary file of
+// its own, so the checkpoint is moved to that file right away, which a cancellation before the next page keeps.
+func (c *checkpointer) attach(out *outputFile) error {
+	if c == nil {
+		return nil
+	}
+	c.out = out
+	if c.checkpoint.Offset <= 0 {
+		return nil
+	}
+	c.checkpoint.Temp = out.temp
+	out.checkpointed = true
+	return c.checkpoint.save(c.outPath)
+}
+
+// pageWritten records that a page with the given number of packages was written, after which written packages of the
+// platform are in the output.
+func (c *checkpointer) pageWritten(platform, page, packages, written int) error {
+	if c == nil {
+		return nil
+	}
+	offset, err := c.out.sync()
+	if err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	c.checkpoint.Platform = platform
+	c.checkpoint.Page = page
+	c.checkpoint.PlatformPackages = written
+	c.checkpoint.Packages += packages
+	c.checkpoint.Offset = offset
+	c.checkpoint.Temp = c.out.temp
+	c.out.checkpointed = true
+	return c.checkpoint.save(c.outPath)
+}
@@ -0,0 +1,297 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIngestResume(t *testing.T) {
+	for _, format := range []Format{FormatCSV, FormatNDJSON, FormatJSON} {
+		t.Run(format.String(), func(t *testing.T) {
+			const total = 7
+			outPath := filepath.Join(t.TempDir(), "result."+format.String())
+			opts := Options{Platform: "NPM", APIKey: "secret", PerPage: 2, Workers: 1, Format: format}
+
+			var pages []int
+			paged := pagedHandler(total, &pages)
+			ctx, cancel := context.WithCancel(context.Background())
+			var resumed int32
+			useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if atomic.LoadInt32(&resumed) == 0 && r.URL.Query().Get("page") == "3" {
+					// Wait for a page to be recorded, so the run has something to resume, then stop it
+					for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+						if _, err := os.Stat(checkpointPath(outPath)); err == nil {
+							break
+						}
+					}
+					cancel()
+					<-r.Context().Done()
+					return
+				}
+				paged(w, r)
+			})
+
+			if _, err := IngestContext(ctx, opts, outPath); !errors.Is(err, context.Canceled) {
+				t.Fatalf("Expected the run to be cancelled, got %v", err)
+			}
+			saved := readCheckpoint(t, outPath)
+			if saved.Page < 1 {
+				t.Fatalf("Expected a page to be checkpointed, got %+v", saved)
+			}
+			if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+				t.Fatalf("Expected the cancelled run to leave no output, got %v", err)
+			}
+			// A page that was cut off halfway must not end up in the output
+			appendFile(t, saved.Temp, "half a page")
+
+			atomic.StoreInt32(&resumed, 1)
+			pages = nil
+			stats, err := IngestContext(context.Background(), opts, outPath)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(pages) == 0 || pages[0] != saved.Page+1 {
+				t.Errorf("Expected to continue at page %d, got requests for %v", saved.Page+1, pages)
+			}
+			if stats.Packages != total-saved.Packages {
+				t.Errorf("Expected %d packages in the resumed run, got %d", total-saved.Packages, stats.Packages)
+			}
+			names := readPackageNames(t, outPath, format)
+			if len(names) != total {
+				t.Fatalf("Expected %d packages, got %v", total, names)
+			}
+			for i, name := range names {
+				if name != fmt.Sprintf("package-%d", i) {
+					t.Errorf("Expected package-%d at position %d, got %s", i, i, name)
+				}
+			}
+			if _, err := os.Stat(checkpointPath(outPath)); !os.IsNotExist(err) {
+				t.Errorf("Expected the checkpoint to be removed after the run, got %v", err)
+			}
+		})
+	}
+}
+
+func TestIngestResumeSkipsWrittenPackages(t *testing.T) {
+	var pages []int
+	pagedServer(t, 4, &pages)
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+	// The first run wrote package-2 on page 1, before it moved to page 2
+	output := strings.Join(csvHeader, ",") + "\n" + strings.Join(Project{Name: "package-2", Platform: "NPM"}.csvRecord(), ",") + "\n"
+	if err := os.WriteFile(outPath, []byte(output), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	saved := checkpoint{Platforms: []string{"NPM"}, PerPage: 2, Format: "csv", Page: 1, PlatformPackages: 1, Packages: 1, Offset: int64(len(output))}
+	if err := saved.save(outPath); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := IngestContext(context.Background(), Options{Platform: "NPM", APIKey: "secret", PerPage: 2, Workers: 1}, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if names := readPackageNames(t, outPath, FormatCSV); !slices.Equal(names, []string{"package-2", "package-3"}) {
+		t.Errorf("Expected package-2 to be written once, got %v", names)
+	}
+	if stats.Duplicates != 1 {
+		t.Errorf("Expected 1 duplicate, got %d", stats.Duplicates)
+	}
+}
+
+func TestIngestResumeFromTemporaryFile(t *testing.T) {
+	var pages []int
+	pagedServer(t, 4, &pages)
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+	// A complete output of an earlier run, and the temporary file of a run that crashed after page 1
+	if err := os.WriteFile(outPath, []byte("previous\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := strings.Join(csvHeader, ",") + "\n" + strings.Join(Project{Name: "package-0", Platform: "NPM"}.csvRecord(), ",") + "\n"
+	temp := outPath + tempSuffix + "999999"
+	if err := os.WriteFile(temp, []byte(output+"half a page"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	saved := checkpoint{Platforms: []string{"NPM"}, PerPage: 2, Format: "csv", Page: 1, PlatformPackages: 1, Packages: 1, Offset: int64(len(output)), Temp: temp}
+	if err := saved.save(outPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := IngestContext(context.Background(), Options{Platform: "NPM", APIKey: "secret", PerPage: 2, Workers: 1}, outPath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if names := readPackageNames(t, outPath, FormatCSV); !slices.Equal(names, []string{"package-0", "package-2", "package-3"}) {
+		t.Errorf("Expected the temporary file to be continued, got %v", names)
+	}
+	if _, err := os.Stat(temp); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary file to be taken over, got %v", err)
+	}
+
+	t.Run("Ignores a temporary file of another output", func(t *testing.T) {
+		other := filepath.Join(filepath.Dir(outPath), "other.csv")
+		if err := os.WriteFile(other, []byte(output), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		saved.Temp = other
+		if err := saved.save(outPath); err != nil {
+			t.Fatal(err)
+		}
+		if loaded, _ := loadCheckpoint(outPath, checkpoint{Platforms: []string{"NPM"}, PerPage: 2, Format: "csv"}); loaded.Temp != "" {
+			t.Errorf("Expected the temporary file to be ignored, got %+v", loaded)
+		}
+	})
+}
+
+func TestIngestResumeCancelledBeforeAPage(t *testing.T) {
+	var pages []int
+	pagedServer(t, 4, &pages)
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+	if err := os.WriteFile(outPath, []byte("previous\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := strings.Join(csvHeader, ",") + "\n" + strings.Join(Project{Name: "package-0", Platform: "NPM"}.csvRecord(), ",") + "\n"
+	temp := outPath + tempSuffix + "999999"
+	if err := os.WriteFile(temp, []byte(output), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	saved := checkpoint{Platforms: []string{"NPM"}, PerPage: 2, Format: "csv", Page: 1, PlatformPackages: 1, Packages: 1, Offset: int64(len(output)), Temp: temp}
+	if err := saved.save(outPath); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Platform: "NPM", APIKey: "secret", PerPage: 2, Workers: 1}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := IngestContext(ctx, opts, outPath); !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("Expected ErrInterrupted, got %v", err)
+	}
+	// The checkpoint follows the temporary file to the run that took it over
+	if moved := readCheckpoint(t, outPath); moved.Temp != tempPath(outPath) || moved.Offset != saved.Offset {
+		t.Errorf("Expected the checkpoint to move to %s, got %+v", tempPath(outPath), moved)
+	}
+	if data, _ := os.ReadFile(outPath); string(data) != "previous\n" {
+		t.Errorf("Expected the previous output, got %q", data)
+	}
+
+	if _, err := IngestContext(context.Background(), opts, outPath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if names := readPackageNames(t, outPath, FormatCSV); !slices.Equal(names, []string{"package-0", "package-2", "package-3"}) {
+		t.Errorf("Expected the temporary file to be continued, got %v", names)
+	}
+}
+
+func TestIngestIgnoresCheckpoint(t *testing.T) {
+	opts := Options{Platform: "NPM", APIKey: "secret", PerPage: 2, Workers: 1}
+	tests := []struct {
+		name       string
+		checkpoint checkpoint
+		restart    bool
+	}{
+		{"Different page size", checkpoint{Platforms: []string{"NPM"}, PerPage: 3, Format: "csv", Page: 1, Packages: 1, Offset: 1}, false},
+		{"Row count mismatch", checkpoint{Platforms: []string{"NPM"}, PerPage: 2, Format: "csv", Page: 1, Packages: 5, Offset: 1}, false},
+		{"Restart", checkpoint{Platforms: []string{"NPM"}, PerPage: 2, Format: "csv", Page: 1, Packages: 0}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var pages []int
+			pagedServer(t, 3, &pages)
+			outPath := filepath.Join(t.TempDir(), "result.csv")
+			header := "name\n"
+			if err := os.WriteFile(outPath, []byte(header), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			test.checkpoint.Offset = int64(len(header))
+			if err := test.checkpoint.save(outPath); err != nil {
+				t.Fatal(err)
+			}
+			opts := opts
+			opts.Restart = test.restart
+
+			if _, err := IngestContext(context.Background(), opts, outPath); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(pages) == 0 || pages[0] != 1 {
+				t.Errorf("Expected to start at the first page, got requests for %v", pages)
+			}
+			if records := readCSV(t, outPath); len(records) != 4 {
+				t.Errorf("Expected a header and 3 rows, got %d rows", len(records))
+			}
+		})
+	}
+}
+
+func readCheckpoint(t *testing.T, outPath string) checkpoint {
+	t.Helper()
+	data, err := os.ReadFile(checkpointPath(outPath))
+	if err != nil {
+		t.Fatalf("Expected a checkpoint, got %v", err)
+	}
+	var c checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatalf("Checkpoint was not valid JSON: %v", err)
+	}
+	return c
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readPackageNames returns the names of the packages in an output file of the given format.
+func readPackageNames(t *testing.T, path string, format Format) []string {
+	t.Helper()
+	var names []string
+	switch format {
+	case FormatCSV:
+		records := readCSV(t, path)
+		if len(records) == 0 || records[0][0] != csvHeader[0] {
+			t.Fatalf("Expected a single header at the top, got %v", records)
+		}
+		for _, record := range records[1:] {
+			names = append(names, record[0])
+		}
+	default:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var projects []Project
+		if format == FormatJSON {
+			if err := json.Unmarshal(data, &projects); err != nil {
+				t.Fatalf("Output was not a valid JSON array: %v", err)
+			}
+		} else {
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			for decoder.More() {
+				var project Project
+				if err := decoder.Decode(&project); err != nil {
+					t.Fatalf("Output was not valid NDJSON: %v", err)
+				}
+				projects = append(projects, project)
+			}
+		}
+		for _, project := range projects {
+			names = append(names, project.Name)
+		}
+	}
+	return names
+}
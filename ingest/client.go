@@ -0,0 +1,80 @@
+package ingest
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultBaseURL is the base URL of the libraries.io API.
+const DefaultBaseURL = "https://libraries.io/api"
+
+// Doer sends HTTP requests. *http.Client implements it, and tests can pass a stub that answers without a server.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client sends the requests of an ingestion to a libraries.io API. The package-level functions, such as Ingest, use a
+// client for the public API that sends requests through http.DefaultClient. NewClient creates one for another
+// server, e.g. an httptest.Server in tests, or with an HTTP client of its own. A Client is safe for concurrent use.
+type Client struct {
+	httpClient Doer
+	// searchURL is the search endpoint, projectURL the base of the project endpoints
+	searchURL  string
+	projectURL string
+}
+
+// NewClient creates a client for the libraries.io API at baseURL, e.g. DefaultBaseURL, which sends requests through
+// httpClient. A nil httpClient uses http.DefaultClient and an empty baseURL uses DefaultBaseURL.
+func NewClient(httpClient Doer, baseURL string) *Client {
+	if client, ok := httpClient.(*http.Client); httpClient == nil || ok && client == nil {
+		httpClient = http.DefaultClient
+	}
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return &Client{httpClient: httpClient, searchURL: baseURL + "/search", projectURL: baseURL}
+}
+
+// defaultClient returns the client the package-level functions use.
+func defaultClient() *Client {
+	return &Client{httpClient: http.DefaultClient, searchURL: discoveryEndpoint, projectURL: projectEndpoint}
+}
+
+// discoveryURL constructs the search query for a single page of packages of the given platform. The keywords and
+// languages, if any, narrow the search down to packages with one of them, and sort, if set, is the field libraries.io
+// orders the results by, in descending order.
+func (c *Client) discoveryURL(platform string, page, perPage int, apiKey string, keywords, languages []string, sort string) string {
+	params := url.Values{}
+	params.Set("platforms", platform)
+	params.Set("page", strconv.Itoa(page))
+	params.Set("per_page", strconv.Itoa(perPage))
+	if len(keywords) > 0 {
+		params.Set("keywords", strings.Join(keywords, ","))
+	}
+	if len(languages) > 0 {
+		params.Set("languages", strings.Join(languages, ","))
+	}
+	if sort != "" {
+		params.Set("sort", sort)
+	}
+	params.Set("api_key", apiKey)
+	return c.searchURL + "?" + params.Encode()
+}
+
+// projectURLFor constructs the query for a single package, which includes all of its versions.
+func (c *Client) projectURLFor(platform, name, apiKey string) string {
+	params := url.Values{}
+	params.Set("api_key", apiKey)
+	return c.projectURL + "/" + url.PathEscape(platform) + "/" + url.PathEscape(name) + "?" + params.Encode()
+}
+
+// dependenciesURL constructs the query for the dependencies of a single version of a package.
+func (c *Client) dependenciesURL(platform, name, version, apiKey string) string {
+	params := url.Values{}
+	params.Set("api_key", apiKey)
+	return c.projectURL + "/" + url.PathEscape(platform) + "/" + url.PathEscape(name) + "/" +
+		url.PathEscape(version) + "/dependencies?" + params.Encode()
+}
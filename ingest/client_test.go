@@ -0,0 +1,300 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fixtureServer starts a server for a libraries.io API at /api. Search requests are answered by search and all others
+// by project, and both are recorded in requests.
+func fixtureServer(t *testing.T, search, project http.HandlerFunc, requests *[]string) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.URL.Path)
+		if r.URL.Path == "/api/search" {
+			search(w, r)
+			return
+		}
+		project(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return NewClient(server.Client(), server.URL+"/api/")
+}
+
+// serveFile answers requests with the contents of a file in testdata.
+func serveFile(t *testing.T, name string) http.HandlerFunc {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Could not read fixture: %v", err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}
+}
+
+// serveStatus answers requests with an empty response with the given status.
+func serveStatus(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}
+}
+
+// stubDoer answers requests by calling a function instead of sending them.
+type stubDoer func(req *http.Request) (*http.Response, error)
+
+func (f stubDoer) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// stubResponse creates a response with the given status and body.
+func stubResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestClientDiscoveryURL(t *testing.T) {
+	u, err := url.Parse(NewClient(nil, "https://example.com/api/").discoveryURL("NPM", 3, 50, "secret", nil, nil, ""))
+	if err != nil {
+		t.Fatalf("Expected a valid URL, got %v", err)
+	}
+	if u.Path != "/api/search" {
+		t.Errorf("Expected the search endpoint below the base URL, got %s", u.Path)
+	}
+	expected := map[string]string{
+		"platforms": "NPM",
+		"page":      "3",
+		"per_page":  "50",
+		"api_key":   "secret",
+	}
+	for key, value := range expected {
+		if actual := u.Query().Get(key); actual != value {
+			t.Errorf("Expected %s=%s, got %s", key, value, actual)
+		}
+	}
+}
+
+func TestClientIngest(t *testing.T) {
+	opts := Options{Platform: "NPM", APIKey: "secret", Workers: 1, MaxPages: 1, Dependencies: true}
+
+	t.Run("Writes the packages of a successful response", func(t *testing.T) {
+		var requests []string
+		client := fixtureServer(t, serveFile(t, "libraries-io-search.json"), serveFile(t, "libraries-io-dependencies.json"), &requests)
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+
+		stats, err := client.IngestContext(context.Background(), opts, outPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stats.Packages != 2 {
+			t.Errorf("Expected 2 packages, got %d", stats.Packages)
+		}
+		expected := "/api/search,/api/NPM/left-pad/1.3.0/dependencies,/api/NPM/tape/5.5.3/dependencies"
+		if actual := strings.Join(requests, ","); actual != expected {
+			t.Errorf("Expected requests for %s, got %s", expected, actual)
+		}
+		records := readCSV(t, outPath)
+		if len(records) != 3 {
+			t.Fatalf("Expected a header and 2 rows, got %d rows", len(records))
+		}
+		if row := strings.Join(records[1], "|"); !strings.HasPrefix(row, "left-pad|NPM|String left pad|") || !strings.HasSuffix(row, "|tape@*|18|1103|112|318473|WTFPL|https://github.com/stevemao/left-pad||pkg:npm/left-pad@1.3.0") {
+			t.Errorf("Expected the row of left-pad with its dependency, got %s", row)
+		}
+	})
+
+	t.Run("Retries a 429", func(t *testing.T) {
+		var requests []string
+		limited := true
+		search := func(w http.ResponseWriter, r *http.Request) {
+			if limited {
+				limited = false
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			serveFile(t, "libraries-io-search.json")(w, r)
+		}
+		client := fixtureServer(t, search, serveFile(t, "libraries-io-dependencies.json"), &requests)
+
+		stats, err := client.IngestContext(context.Background(), opts, filepath.Join(t.TempDir(), "result.csv"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stats.Retries != 1 || stats.Packages != 2 {
+			t.Errorf("Expected 2 packages after a retry, got %d packages and %d retries", stats.Packages, stats.Retries)
+		}
+	})
+
+	t.Run("Gives up on a persistent 500", func(t *testing.T) {
+		var requests []string
+		client := fixtureServer(t, serveStatus(http.StatusInternalServerError), serveStatus(http.StatusNotFound), &requests)
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+
+		_, err := client.IngestContext(context.Background(), Options{Platform: "NPM", APIKey: "secret", Workers: 1, MaxAttempts: 3}, outPath)
+		var statusErr *statusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+			t.Errorf("Expected a 500 status error, got %v", err)
+		}
+		if len(requests) != 3 {
+			t.Errorf("Expected 3 attempts, got %d", len(requests))
+		}
+		if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+			t.Errorf("Expected the output to be removed, got %v", err)
+		}
+	})
+
+	t.Run("Fails on malformed JSON without retrying", func(t *testing.T) {
+		var requests []string
+		malformed := func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[{"name": "left-pad", "versions": `))
+		}
+		client := fixtureServer(t, malformed, serveStatus(http.StatusNotFound), &requests)
+
+		_, err := client.IngestContext(context.Background(), opts, filepath.Join(t.TempDir(), "result.csv"))
+		if err == nil || !strings.Contains(err.Error(), "decoding libraries.io response") {
+			t.Errorf("Expected a decoding error, got %v", err)
+		}
+		if len(requests) != 1 {
+			t.Errorf("Expected a single request, got %d", len(requests))
+		}
+	})
+}
+
+func TestClientIngestPopularity(t *testing.T) {
+	var requests []string
+	client := fixtureServer(t, serveFile(t, "libraries-io-search.json"), serveStatus(http.StatusNotFound), &requests)
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+
+	if _, err := client.IngestContext(context.Background(), Options{Platform: "NPM", APIKey: "secret", MaxPages: 1}, outPath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	records := readCSV(t, outPath)
+	if len(records) != 3 {
+		t.Fatalf("Expected a header and 2 rows, got %d rows", len(records))
+	}
+	expectedHeader := "name,platform,description,homepage,language,keywords,latest_release_number," +
+		"latest_release_published_at,versions,dependencies,rank,stars,forks,dependent_repos_count,licenses,repository_url,vulnerabilities,purl"
+	if header := strings.Join(records[0], ","); header != expectedHeader {
+		t.Errorf("Expected header %s, got %s", expectedHeader, header)
+	}
+	rank := slices.Index(csvHeader, "rank")
+	popularity := func(record []string) string {
+		return strings.Join(record[rank:rank+4], "|")
+	}
+	if actual := popularity(records[1]); actual != "18|1103|112|318473" {
+		t.Errorf("Expected all counts of left-pad, got %s", actual)
+	}
+	// Zero stars are kept apart from the forks and dependents libraries.io left out
+	if actual := popularity(records[2]); actual != "25|0||" {
+		t.Errorf("Expected the counts of tape with the missing ones empty, got %s", actual)
+	}
+
+	projects, err := ReadCSV(outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if tape := projects[1]; tape.Stars == nil || *tape.Stars != 0 || tape.Forks != nil {
+		t.Errorf("Expected ReadCSV to tell zero and missing counts apart, got stars %v and forks %v", tape.Stars, tape.Forks)
+	}
+}
+
+func TestIngestHTTPClient(t *testing.T) {
+	t.Run("Sends requests through the stub of the options", func(t *testing.T) {
+		var pages []string
+		doer := stubDoer(func(req *http.Request) (*http.Response, error) {
+			pages = append(pages, req.URL.Query().Get("page"))
+			if req.URL.Query().Get("page") == "1" {
+				return stubResponse(http.StatusOK, `[{"name": "left-pad"}, {"name": "tape"}]`), nil
+			}
+			return stubResponse(http.StatusOK, `[{"name": "nyc"}]`), nil
+		})
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+
+		stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", PerPage: 2, Workers: 1, HTTPClient: doer}, outPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stats.Packages != 3 {
+			t.Errorf("Expected 3 packages, got %d", stats.Packages)
+		}
+		if actual := strings.Join(pages, ","); actual != "1,2" {
+			t.Errorf("Expected requests for pages 1,2, got %s", actual)
+		}
+	})
+
+	t.Run("Retries errors of the stub", func(t *testing.T) {
+		attempts := 0
+		doer := stubDoer(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			switch attempts {
+			case 1:
+				return nil, errors.New("connection reset by peer")
+			case 2:
+				return stubResponse(http.StatusBadGateway, ""), nil
+			}
+			return stubResponse(http.StatusOK, `[{"name": "left-pad"}]`), nil
+		})
+		client := NewClient(doer, "")
+
+		stats, err := client.IngestContext(context.Background(), Options{Platform: "NPM", APIKey: "secret", Workers: 1}, filepath.Join(t.TempDir(), "result.csv"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if attempts != 3 || stats.Retries != 2 {
+			t.Errorf("Expected 3 attempts and 2 retries, got %d and %d", attempts, stats.Retries)
+		}
+	})
+
+	t.Run("Uses http.DefaultClient for a nil *http.Client", func(t *testing.T) {
+		var client *http.Client
+		if doer := NewClient(client, "").httpClient; doer != http.DefaultClient {
+			t.Errorf("Expected http.DefaultClient, got %v", doer)
+		}
+	})
+}
+
+func TestClientFetchDependencies(t *testing.T) {
+	t.Setenv(APIKeyEnvVar, "secret")
+
+	t.Run("Decodes the dependencies", func(t *testing.T) {
+		var requests []string
+		client := fixtureServer(t, serveStatus(http.StatusNotFound), serveFile(t, "libraries-io-dependencies.json"), &requests)
+
+		dependencies, err := client.FetchDependencies(context.Background(), "npm", "left-pad", "1.3.0")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expected := Dependency{Name: "tape", Platform: "NPM", Requirements: "*", Kind: "Development", Resolved: true}
+		if len(dependencies) != 1 || dependencies[0] != expected {
+			t.Errorf("Expected %+v, got %+v", expected, dependencies)
+		}
+		if len(requests) != 1 || requests[0] != "/api/NPM/left-pad/1.3.0/dependencies" {
+			t.Errorf("Expected a request for the normalized platform, got %v", requests)
+		}
+	})
+
+	t.Run("Reports a 404 as ErrVersionNotFound", func(t *testing.T) {
+		var requests []string
+		client := fixtureServer(t, serveStatus(http.StatusNotFound), serveStatus(http.StatusNotFound), &requests)
+
+		if _, err := client.FetchDependencies(context.Background(), "NPM", "left-pad", "0.0.1"); !errors.Is(err, ErrVersionNotFound) {
+			t.Errorf("Expected ErrVersionNotFound, got %v", err)
+		}
+		if len(requests) != 1 {
+			t.Errorf("Expected a 404 not to be retried, got %d requests", len(requests))
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CompressedExt is the extension that makes the output files of Ingest and Convert gzip-compressed, e.g. result.csv.gz.
+const CompressedExt = ".gz"
+
+// gzipMagic are the first bytes of every gzip stream, by which compressed input is recognized.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// IsCompressedPath reports whether the output written to path is gzip-compressed, which it is if the path ends in
+// CompressedExt.
+func IsCompressedPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), CompressedExt)
+}
+
+// TrimCompressedExt returns path without CompressedExt, e.g. result.csv for result.csv.gz, and path itself if it does
+// not end in it.
+func TrimCompressedExt(path string) string {
+	if IsCompressedPath(path) {
+		return path[:len(path)-len(CompressedExt)]
+	}
+	return path
+}
+
+// inputFile is a file opened by openInput, which decompresses it on the fly if it is compressed.
+type inputFile struct {
+	io.Reader
+	file *os.File
+	gz   *gzip.Reader
+}
+
+func (f *inputFile) Close() error {
+	if f.gz != nil {
+		f.gz.Close()
+	}
+	return f.file.Close()
+}
+
+// openInput opens the file at path for reading through a buffer. A file that starts with the gzip magic bytes is
+// decompressed, whatever its name, so that compressed output can be read back like any other.
+func openInput(path string) (*inputFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	buffered := bufio.NewReaderSize(f, outputBufferSize)
+	in := &inputFile{Reader: buffered, file: f}
+	// A file shorter than the magic bytes is not compressed, and reading it reports the same error again
+	if magic, _ := buffered.Peek(len(gzipMagic)); !bytes.Equal(magic, gzipMagic) {
+		return in, nil
+	}
+	in.gz, err = gzip.NewReader(buffered)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("decompressing %s: %w", path, err)
+	}
+	in.Reader = in.gz
+	return in, nil
+}
@@ -0,0 +1,153 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// readGzipCSV decompresses the file at path with compress/gzip alone and decodes it as CSV, failing the test if the
+// gzip stream is incomplete.
+func readGzipCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Could not open output: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Output was not gzip-compressed: %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("Output was not a complete gzip stream: %v", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatalf("Output was not valid CSV: %v", err)
+	}
+	return records
+}
+
+func TestIngestCompressed(t *testing.T) {
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testProjectsPage))
+	})
+	outPath := filepath.Join(t.TempDir(), "result.csv.gz")
+
+	stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", CompressionLevel: gzip.BestSpeed}, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if records := readGzipCSV(t, outPath); len(records) != stats.Packages+1 || records[1][0] != "left-pad" {
+		t.Errorf("Expected %d rows including the header, got %v", stats.Packages+1, records)
+	}
+	if _, err := os.Stat(checkpointPath(outPath)); !os.IsNotExist(err) {
+		t.Errorf("Expected no checkpoint for compressed output, got %v", err)
+	}
+
+	t.Run("Reads the output back", func(t *testing.T) {
+		projects, err := ReadCSV(outPath)
+		if err != nil || len(projects) != stats.Packages || projects[0].Name != "left-pad" {
+			t.Errorf("Expected the packages written, got %v and %v", projects, err)
+		}
+	})
+
+	t.Run("Recognizes compressed input by its content", func(t *testing.T) {
+		data, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatalf("Could not read the output: %v", err)
+		}
+		renamed := filepath.Join(t.TempDir(), "result.csv")
+		if err := os.WriteFile(renamed, data, 0o644); err != nil {
+			t.Fatalf("Could not copy the output: %v", err)
+		}
+		if projects, err := ReadCSV(renamed); err != nil || len(projects) != stats.Packages {
+			t.Errorf("Expected the packages written, got %v and %v", projects, err)
+		}
+	})
+
+	t.Run("Rejects an invalid level", func(t *testing.T) {
+		_, err := Ingest(Options{Platform: "NPM", APIKey: "secret", CompressionLevel: 10}, outPath)
+		if err == nil {
+			t.Errorf("Expected an error for level 10")
+		}
+	})
+}
+
+func TestIngestCompressedCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "3" {
+			cancel()
+			<-r.Context().Done()
+			return
+		}
+		json.NewEncoder(w).Encode(pageOfProjects(r, defaultPerPage))
+	})
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "result.json.gz")
+	if err := os.WriteFile(outPath, []byte("previous"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := IngestContext(ctx, Options{Platform: "NPM", APIKey: "secret", Workers: 1, Format: FormatJSON}, outPath)
+	if !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("Expected ErrInterrupted, got %v", err)
+	}
+	// A gzip stream cannot be continued, so nothing is kept for the next run
+	if data, _ := os.ReadFile(outPath); string(data) != "previous" {
+		t.Errorf("Expected the previous output, got %q", data)
+	}
+	if names := dirEntries(t, dir); !slices.Equal(names, []string{"result.json.gz"}) {
+		t.Errorf("Expected no temporary file or checkpoint, got %v", names)
+	}
+}
+
+func TestIngestFromCompressedFiles(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(`[{"name": "left-pad", "platform": "NPM"}]`))
+	gz.Close()
+	dir := writeInputFiles(t, map[string]string{
+		"a.json.gz": compressed.String(),
+		"b.json":    `[{"name": "right-pad", "platform": "NPM"}]`,
+	})
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+
+	if stats, err := IngestFromFiles(context.Background(), Options{}, []string{dir}, outPath); err != nil || stats.Packages != 2 {
+		t.Errorf("Expected both packages, got %d and %v", stats.Packages, err)
+	}
+}
+
+func TestConvertCompressed(t *testing.T) {
+	inPath := filepath.Join(t.TempDir(), "result.ndjson")
+	if err := os.WriteFile(inPath, []byte(`{"name": "left-pad", "platform": "NPM"}`+"\n"), 0o644); err != nil {
+		t.Fatalf("Could not write the input: %v", err)
+	}
+	outPath := filepath.Join(t.TempDir(), "result.csv.gz")
+
+	if _, err := Convert(context.Background(), inPath, outPath, FormatCSV); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if records := readGzipCSV(t, outPath); len(records) != 2 || records[1][0] != "left-pad" {
+		t.Errorf("Expected a single row for left-pad, got %v", records)
+	}
+
+	t.Run("Cannot compress a database", func(t *testing.T) {
+		if _, err := Convert(context.Background(), inPath, filepath.Join(t.TempDir(), "result.sqlite.gz"), FormatSQLite); err == nil {
+			t.Errorf("Expected an error for a compressed database")
+		}
+	})
+}
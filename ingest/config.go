@@ -0,0 +1,210 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MaxPerPage is the largest page size libraries.io accepts.
+const MaxPerPage = 100
+
+// The sources an ingestion can read packages from: libraries.io, through Ingest, the npm registry, through IngestNPM,
+// the Go module index, through IngestGoIndex, the Go module proxy, through IngestGoModules, the registries of several
+// platforms at once, through IngestRegistries, or a search of crates.io, through IngestCrates.
+const (
+	SourceLibrariesIO = "librariesio"
+	SourceNPM         = "npm"
+	SourceGoIndex     = "goindex"
+	SourceGoProxy     = "goproxy"
+	SourceRegistries  = "registries"
+	SourceCrates      = "crates"
+)
+
+// IngestConfig holds the settings of an ingestion read from a YAML file by LoadConfig. Its keys are named like the
+// flags of the ingest command, e.g. requests-per-minute, so that a run can be reproduced from a file instead of a long
+// command line. Every field is nil when the file leaves it out, which keeps the default.
+type IngestConfig struct {
+	Source            *string        `yaml:"source"`
+	Packages          []string       `yaml:"packages"`
+	Query             *string        `yaml:"query"`
+	NamesFile         *string        `yaml:"names-file"`
+	Since             *string        `yaml:"since"`
+	Platforms         []string       `yaml:"platforms"`
+	APIKey            *string        `yaml:"api-key"`
+	Out               *string        `yaml:"out"`
+	Format            *string        `yaml:"format"`
+	Decode            *string        `yaml:"decode"`
+	Columns           []string       `yaml:"columns"`
+	Compress          *bool          `yaml:"compress"`
+	CompressionLevel  *int           `yaml:"compression-level"`
+	PerPage           *int           `yaml:"per-page"`
+	MaxPages          *int           `yaml:"max-pages"`
+	MaxPackages       *int           `yaml:"max-packages"`
+	RequestsPerMinute *int           `yaml:"requests-per-minute"`
+	MaxAttempts       *int           `yaml:"max-attempts"`
+	Workers           *int           `yaml:"workers"`
+	Timeout           *time.Duration `yaml:"timeout"`
+	RequestTimeout    *time.Duration `yaml:"request-timeout"`
+	Dependencies      *bool          `yaml:"dependencies"`
+	Vulnerabilities   *bool          `yaml:"vulnerabilities"`
+	Versions          *bool          `yaml:"versions"`
+	IncludePrerelease *bool          `yaml:"include-prerelease"`
+	IncludeUndated    *bool          `yaml:"include-undated"`
+	ExcludeLicenses   []string       `yaml:"exclude-licenses"`
+	Keywords          []string       `yaml:"keywords"`
+	Languages         []string       `yaml:"languages"`
+	MinStars          *int           `yaml:"min-stars"`
+	MinRank           *int           `yaml:"min-rank"`
+	CacheDir          *string        `yaml:"cache-dir"`
+	CacheTTL          *time.Duration `yaml:"cache-ttl"`
+	StatsOut          *string        `yaml:"stats-out"`
+	Update            *bool          `yaml:"update"`
+}
+
+// ConfigError is an invalid setting in a config file, located by the line of the offending value.
+type ConfigError struct {
+	Path string
+	Line int
+	// Field is the key of the setting, followed by the position of the item in a list, e.g. platforms[1].
+	Field string
+	Err   error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s:%d: %s: %v", e.Path, e.Line, e.Field, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// LoadConfig reads an IngestConfig from the YAML file at path. Unknown keys and values of the wrong type are rejected
+// with the line they are on, and settings that the ingest command would reject, such as an unknown platform or a
+// negative number of workers, with a *ConfigError. An empty file is a valid config that sets nothing.
+func LoadConfig(path string) (IngestConfig, error) {
+	var config IngestConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("reading the config: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return config, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	// The document is decoded a second time as nodes, which know their lines
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return config, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		var configErr *ConfigError
+		if errors.As(err, &configErr) {
+			configErr.Path = path
+			configErr.Line = lineOf(&document, configErr.Field)
+		}
+		return config, err
+	}
+	return config, nil
+}
+
+// validate checks the settings that are known to be invalid without sending a request. The errors are *ConfigErrors
+// without a path and line.
+func (c IngestConfig) validate() error {
+	invalid := func(field string, format string, args ...interface{}) error {
+		return &ConfigError{Field: field, Err: fmt.Errorf(format, args...)}
+	}
+	if c.Source != nil && !slices.ContainsFunc([]string{SourceLibrariesIO, SourceNPM, SourceGoIndex, SourceGoProxy, SourceRegistries, SourceCrates},
+		func(source string) bool { return strings.EqualFold(*c.Source, source) }) {
+		return invalid("source", "must be %s, %s, %s, %s, %s or %s, got %q", SourceLibrariesIO, SourceNPM, SourceGoIndex,
+			SourceGoProxy, SourceRegistries, SourceCrates, *c.Source)
+	}
+	if c.Since != nil && *c.Since != SinceLastRun {
+		if _, err := ParseSince(*c.Since); err != nil {
+			return &ConfigError{Field: "since", Err: err}
+		}
+	}
+	if c.Platforms != nil && len(c.Platforms) == 0 {
+		return invalid("platforms", "must name at least one platform")
+	}
+	for i, platform := range c.Platforms {
+		if _, err := normalizePlatform(platform); err != nil {
+			return &ConfigError{Field: "platforms[" + strconv.Itoa(i) + "]", Err: err}
+		}
+	}
+	if c.Format != nil {
+		if _, err := ParseFormat(*c.Format); err != nil {
+			return &ConfigError{Field: "format", Err: err}
+		}
+	}
+	if c.Decode != nil {
+		if _, err := ParseDecodeMode(*c.Decode); err != nil {
+			return &ConfigError{Field: "decode", Err: err}
+		}
+	}
+	for i := range c.Columns {
+		// Checking the columns up to each one finds the first that is unknown or repeated
+		if _, err := csvColumnIndices(c.Columns[:i+1]); err != nil {
+			return &ConfigError{Field: "columns[" + strconv.Itoa(i) + "]", Err: err}
+		}
+	}
+
+	switch {
+	case c.PerPage != nil && (*c.PerPage < 1 || *c.PerPage > MaxPerPage):
+		return invalid("per-page", "must be between 1 and %d, got %d", MaxPerPage, *c.PerPage)
+	case c.MaxPages != nil && *c.MaxPages < 0:
+		return invalid("max-pages", "must not be negative, got %d", *c.MaxPages)
+	case c.MaxPackages != nil && *c.MaxPackages < 0:
+		return invalid("max-packages", "must not be negative, got %d", *c.MaxPackages)
+	case c.MinStars != nil && *c.MinStars < 0:
+		return invalid("min-stars", "must not be negative, got %d", *c.MinStars)
+	case c.MinRank != nil && *c.MinRank < 0:
+		return invalid("min-rank", "must not be negative, got %d", *c.MinRank)
+	case c.MaxAttempts != nil && *c.MaxAttempts < 1:
+		return invalid("max-attempts", "must be at least 1, got %d", *c.MaxAttempts)
+	case c.Workers != nil && *c.Workers < 1:
+		return invalid("workers", "must be at least 1, got %d", *c.Workers)
+	case c.CompressionLevel != nil && (*c.CompressionLevel < 0 || *c.CompressionLevel > gzip.BestCompression):
+		return invalid("compression-level", "must be between 1 and %d, got %d", gzip.BestCompression, *c.CompressionLevel)
+	case c.Timeout != nil && *c.Timeout < 0:
+		return invalid("timeout", "must not be negative, got %v", *c.Timeout)
+	case c.CacheTTL != nil && *c.CacheTTL < 0:
+		return invalid("cache-ttl", "must not be negative, got %v", *c.CacheTTL)
+	}
+	return nil
+}
+
+// lineOf returns the line of the value of a top-level key of document, or of an item of it if field has the form
+// key[i]. It returns 0 if the field is not in the document.
+func lineOf(document *yaml.Node, field string) int {
+	key, item := field, -1
+	if open := strings.IndexByte(field, '['); open >= 0 && field[len(field)-1] == ']' {
+		key = field[:open]
+		item, _ = strconv.Atoi(field[open+1 : len(field)-1])
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return 0
+	}
+	mapping := document.Content[0].Content
+	for i := 0; i+1 < len(mapping); i += 2 {
+		if mapping[i].Value != key {
+			continue
+		}
+		value := mapping[i+1]
+		if item >= 0 && item < len(value.Content) {
+			return value.Content[item].Line
+		}
+		return value.Line
+	}
+	return 0
+}
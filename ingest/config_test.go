@@ -0,0 +1,85 @@
+package ingest
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := writeInputFiles(t, map[string]string{
+		"stm.yaml": `platforms: [NPM, pypi]
+api-key: secret
+per-page: 50
+workers: 8
+timeout: 90m
+dependencies: true
+exclude-licenses:
+  - Proprietary
+`,
+		"empty.yaml":    "",
+		"unknown.yaml":  "platforms: [NPM]\nworker: 8\n",
+		"type.yaml":     "per-page: many\n",
+		"platform.yaml": "platforms:\n  - NPM\n  - Hackage\n  - LeftPad\n",
+		"workers.yaml":  "api-key: secret\n\nworkers: 0\n",
+		"columns.yaml":  "columns: [name, platform, name]\n",
+		"source.yaml":   "source: pypi\n",
+		"since.yaml":    "source: goindex\nsince: yesterday\n",
+		"level.yaml":    "compress: true\ncompression-level: 11\n",
+	})
+
+	t.Run("Reads the settings", func(t *testing.T) {
+		config, err := LoadConfig(filepath.Join(dir, "stm.yaml"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(config.Platforms, []string{"NPM", "pypi"}) || *config.APIKey != "secret" || *config.PerPage != 50 {
+			t.Errorf("Expected the platforms, API key and page size of the file, got %+v", config)
+		}
+		if *config.Workers != 8 || *config.Timeout != 90*time.Minute || !*config.Dependencies {
+			t.Errorf("Expected the workers, timeout and dependencies of the file, got %+v", config)
+		}
+		if config.Format != nil || config.MaxPages != nil || config.Versions != nil {
+			t.Errorf("Expected the settings left out to be nil, got %+v", config)
+		}
+	})
+
+	t.Run("Accepts an empty file", func(t *testing.T) {
+		config, err := LoadConfig(filepath.Join(dir, "empty.yaml"))
+		if err != nil || !reflect.DeepEqual(config, IngestConfig{}) {
+			t.Errorf("Expected an empty config, got %+v and %v", config, err)
+		}
+	})
+
+	tests := []struct {
+		file, expected string
+	}{
+		{"unknown.yaml", "line 2: field worker not found"},
+		{"type.yaml", "line 1: cannot unmarshal !!str `many` into int"},
+		{"platform.yaml", "platform.yaml:4: platforms[2]: unknown platform \"LeftPad\""},
+		{"workers.yaml", "workers.yaml:3: workers: must be at least 1, got 0"},
+		{"columns.yaml", "columns.yaml:1: columns[2]: CSV column \"name\" is selected twice"},
+		{"source.yaml", "source.yaml:1: source: must be librariesio, npm, goindex, goproxy, registries or crates, got \"pypi\""},
+		{"since.yaml", "since.yaml:2: since: must be a date such as 2024-01-01 or an RFC 3339 timestamp such as 2019-04-10T19:08:52.997264Z, got \"yesterday\""},
+		{"level.yaml", "level.yaml:2: compression-level: must be between 1 and 9, got 11"},
+	}
+	for _, test := range tests {
+		t.Run("Points at the error in "+test.file, func(t *testing.T) {
+			_, err := LoadConfig(filepath.Join(dir, test.file))
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("Expected an error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+
+	t.Run("Keeps the cause of invalid settings", func(t *testing.T) {
+		_, err := LoadConfig(filepath.Join(dir, "platform.yaml"))
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) || configErr.Line != 4 || !errors.Is(err, ErrUnknownPlatform) {
+			t.Errorf("Expected a ConfigError on line 4 caused by ErrUnknownPlatform, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Convert reads the packages of a file written by Ingest and writes them to outPath in the given format. The format of
+// inPath is taken from its extension and must be csv, ndjson or json, since a database is not read back. Converting
+// from CSV loses what ReadCSV cannot recover, such as the publication dates of versions. It returns the number of
+// packages written. Either file may be gzip-compressed, see IsCompressedPath. Like Ingest, it leaves the previous
+// output untouched if converting fails or ctx is done.
+func Convert(ctx context.Context, inPath, outPath string, format Format) (int, error) {
+	inFormat, ok := FormatForPath(inPath)
+	if !ok || inFormat == FormatSQLite {
+		return 0, fmt.Errorf("cannot convert %s: expected a .csv, .ndjson or .json file", inPath)
+	}
+	if _, err := os.Stat(inPath); err != nil {
+		return 0, fmt.Errorf("reading %s: %w", inPath, err)
+	}
+	n, err := writeProjectsFile(ctx, outPath, format, func(writer projectWriter) (int, error) {
+		switch inFormat {
+		case FormatJSON:
+			return convertJSON(ctx, writer, inPath)
+		case FormatNDJSON:
+			return convertNDJSON(ctx, writer, inPath)
+		}
+		projects, err := ReadCSV(inPath)
+		if err != nil {
+			return 0, err
+		}
+		written := 0
+		for _, project := range projects {
+			if err := ctx.Err(); err != nil {
+				return written, err
+			}
+			if _, err := writer.writeProjects([]Project{project}); err != nil {
+				return written, err
+			}
+			written++
+		}
+		return written, nil
+	})
+	return n, interrupted(ctx, err)
+}
+
+// convertJSON decodes the array of packages in the file at path one package at a time and writes each one to writer,
+// until ctx is done. A conversion keeps every package, duplicates included.
+func convertJSON(ctx context.Context, writer projectWriter, path string) (int, error) {
+	written := 0
+	err := ingestFile(ctx, path, func(project Project) (bool, error) {
+		if _, err := writer.writeProjects([]Project{normalizeProject(project)}); err != nil {
+			return false, err
+		}
+		written++
+		return true, nil
+	})
+	return written, err
+}
+
+// convertNDJSON decodes the file at path one package per line and writes each one to writer, until ctx is done.
+func convertNDJSON(ctx context.Context, writer projectWriter, path string) (int, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	written := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		var project Project
+		start := decoder.InputOffset()
+		err := decoder.Decode(&project)
+		if errors.Is(err, io.EOF) {
+			return written, nil
+		}
+		if err != nil {
+			return written, fmt.Errorf("decoding %s at line %d: %w", path, lineAt(path, errorOffset(err, start, decoder)), err)
+		}
+		if _, err := writer.writeProjects([]Project{project}); err != nil {
+			return written, err
+		}
+		written++
+	}
+}
+
+// ReadProjects reads the packages of a CSV, NDJSON or JSON file written by Ingest into memory, taking the format from
+// the extension of path. Like Convert, reading CSV loses what ReadCSV cannot recover.
+func ReadProjects(path string) ([]Project, error) {
+	format, ok := FormatForPath(path)
+	if !ok || format == FormatSQLite {
+		return nil, fmt.Errorf("cannot read %s: expected a .csv, .ndjson or .json file", path)
+	}
+	if format == FormatCSV {
+		return ReadCSV(path)
+	}
+	read := convertNDJSON
+	if format == FormatJSON {
+		read = convertJSON
+	}
+	var collector projectCollector
+	if _, err := read(context.Background(), &collector, path); err != nil {
+		return nil, err
+	}
+	return collector.projects, nil
+}
+
+// projectCollector is a projectWriter that keeps the projects in memory.
+type projectCollector struct {
+	projects []Project
+}
+
+func (c *projectCollector) writeProjects(projects []Project) (int, error) {
+	c.projects = append(c.projects, projects...)
+	return len(projects), nil
+}
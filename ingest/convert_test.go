@@ -0,0 +1,83 @@
+package ingest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	dir := writeInputFiles(t, map[string]string{
+		"in.ndjson": `{"name": "left-pad", "platform": "NPM", "versions": [{"number": "1.0.0"}]}` + "\n" + `{"name": "tape", "platform": "NPM"}` + "\n",
+		"in.json":   `[{"name": "left-pad", "platform": "NPM", "versions": [{"number": "1.0.0"}]}, {"name": "tape", "platform": "NPM"}]`,
+		"in.csv":    "name,platform,versions\nleft-pad,NPM,1.0.0\ntape,NPM,\n",
+	})
+
+	for _, in := range []string{"in.ndjson", "in.json", "in.csv"} {
+		for _, format := range []Format{FormatCSV, FormatNDJSON, FormatJSON} {
+			t.Run(in+" to "+format.String(), func(t *testing.T) {
+				outPath := filepath.Join(t.TempDir(), "out."+format.String())
+				written, err := Convert(context.Background(), filepath.Join(dir, in), outPath, format)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if written != 2 {
+					t.Errorf("Expected 2 packages, got %d", written)
+				}
+				if names := strings.Join(readPackageNames(t, outPath, format), ","); names != "left-pad,tape" {
+					t.Errorf("Expected left-pad,tape, got %s", names)
+				}
+			})
+		}
+	}
+
+	t.Run("Rejects inputs it cannot read", func(t *testing.T) {
+		for _, in := range []string{"in.sqlite", "in.txt", "missing.csv"} {
+			if _, err := Convert(context.Background(), filepath.Join(dir, in), filepath.Join(t.TempDir(), "out.csv"), FormatCSV); err == nil {
+				t.Errorf("Expected an error for %s", in)
+			}
+		}
+	})
+
+	t.Run("Reports the line of decode errors and removes the output", func(t *testing.T) {
+		dir := writeInputFiles(t, map[string]string{"broken.ndjson": "{\"name\": \"fine\"}\n{\"name\": 42}\n"})
+		outPath := filepath.Join(t.TempDir(), "out.csv")
+		_, err := Convert(context.Background(), filepath.Join(dir, "broken.ndjson"), outPath, FormatCSV)
+		if err == nil || !strings.Contains(err.Error(), "broken.ndjson at line 2") {
+			t.Errorf("Expected an error pointing at line 2 of broken.ndjson, got %v", err)
+		}
+		if _, statErr := os.Stat(outPath); !os.IsNotExist(statErr) {
+			t.Errorf("Expected the partial output to be removed, got %v", statErr)
+		}
+	})
+}
+
+func TestReadProjects(t *testing.T) {
+	dir := writeInputFiles(t, map[string]string{
+		"in.ndjson": `{"name": "left-pad", "platform": "NPM", "stars": 5, "dependencies": [{"name": "tape", "kind": "Development"}]}` + "\n" + `{"name": "tape", "platform": "NPM"}` + "\n",
+		"in.json":   `[{"name": "left-pad", "platform": "NPM", "stars": 5, "dependencies": [{"name": "tape", "kind": "Development"}]}, {"name": "tape", "platform": "NPM"}]`,
+	})
+
+	for _, in := range []string{"in.ndjson", "in.json"} {
+		t.Run(in, func(t *testing.T) {
+			projects, err := ReadProjects(filepath.Join(dir, in))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(projects) != 2 || projects[0].Name != "left-pad" || projects[1].Name != "tape" {
+				t.Fatalf("Expected left-pad and tape, got %+v", projects)
+			}
+			if projects[0].Stars == nil || *projects[0].Stars != 5 || projects[0].Dependencies[0].Kind != "Development" {
+				t.Errorf("Expected the stars and dependency kind to be kept, got %+v", projects[0])
+			}
+		})
+	}
+
+	t.Run("Rejects databases", func(t *testing.T) {
+		if _, err := ReadProjects(filepath.Join(dir, "in.sqlite")); err == nil {
+			t.Error("Expected an error for a database")
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// cratesEndpoint is the crates.io API endpoint for crates. It is a variable so tests can point it at a local server.
+var cratesEndpoint = "https://crates.io/api/v1/crates"
+
+// cratesRequestsPerMinute keeps to the crawler policy of crates.io, which asks for at most one request per second.
+const cratesRequestsPerMinute = 60
+
+// userAgent identifies our requests. crates.io rejects requests without a User-Agent header and asks crawlers to say
+// who they are.
+const userAgent = "SoftwareThatMatters (https://github.com/AJMBrands/SoftwareThatMatters)"
+
+// cratesPage is a single page of crates.io search results.
+type cratesPage struct {
+	Crates []struct {
+		Name string `json:"name"`
+	} `json:"crates"`
+	Meta struct {
+		// NextPage is the query string of the next page, or null on the last one
+		NextPage *string `json:"next_page"`
+	} `json:"meta"`
+}
+
+// crateResponse is the part of the crates.io crate endpoint we use.
+type crateResponse struct {
+	Crate struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Homepage    string   `json:"homepage"`
+		Keywords    []string `json:"keywords"`
+	} `json:"crate"`
+	Versions []crateVersion `json:"versions"`
+}
+
+// crateVersion is a single published version of a crate.
+type crateVersion struct {
+	Num       string `json:"num"`
+	CreatedAt string `json:"created_at"`
+	Yanked    bool   `json:"yanked"`
+	// License is the SPDX expression in the Cargo.toml of the version, e.g. MIT OR Apache-2.0
+	License string `json:"license"`
+}
+
+// IngestCrates searches crates.io for query and writes the matching crates to outPath in the format chosen in opts,
+// with the same fields as Ingest. An empty query matches all crates. Yanked versions are left out. Every crate takes a
+// request of its own on top of the search pages, and requests are limited to one per second, as crates.io asks of
+// crawlers, even if opts.RequestsPerMinute allows more.
+//
+// The search pages hold opts.PerPage crates and stop after opts.MaxPages, and the crates of a page are fetched with
+// opts.Workers concurrent requests. As for IngestNPM, opts.Platform, APIKey and Versions do not apply and responses are
+// not cached. It stops when ctx is done, leaving the previous output untouched.
+func IngestCrates(ctx context.Context, opts Options, query, outPath string) (Stats, error) {
+	opts, err := opts.withDefaultsExceptAPIKey()
+	if err != nil {
+		return Stats{}, err
+	}
+	rate := opts.RequestsPerMinute
+	if rate < 0 || rate > cratesRequestsPerMinute {
+		rate = cratesRequestsPerMinute
+	}
+	f := &fetcher{
+		client:      opts.HTTPClient,
+		limiter:     newRateLimiter(rate, 1),
+		maxAttempts: opts.MaxAttempts,
+		timeout:     opts.RequestTimeout,
+		backoff:     backoff,
+		userAgent:   userAgent,
+	}
+	stats := newStatsCollector()
+	f.stats = stats
+	// Already validated by withDefaultsExceptAPIKey
+	columns, _ := csvColumnIndices(opts.Columns)
+	_, err = writeProjectsFileAt(ctx, outPath, opts.Format, columns, resumePoint{}, opts.CompressionLevel, func(writer projectWriter, _ *outputFile) (int, error) {
+		writer = withProgress(writer, opts.Progress, 0, packagesTotal(opts, 1))
+		written := 0
+		already := packageSet{}
+		for page := 1; opts.MaxPages <= 0 || page <= opts.MaxPages; page++ {
+			results, err := fetchCratesPage(ctx, f, query, page, opts.PerPage)
+			if err != nil {
+				return written, fmt.Errorf("fetching crates.io page %d: %w", page, err)
+			}
+			var names []string
+			for _, result := range results.Crates {
+				// Crates published during the search shift the pages, so a crate can come up twice
+				if !already.add(Project{Platform: "Cargo", Name: result.Name}) {
+					stats.duplicate(1)
+					continue
+				}
+				names = append(names, result.Name)
+			}
+			pageOpts := opts
+			if opts.MaxPackages > 0 {
+				pageOpts.MaxPackages = opts.MaxPackages - written
+			}
+			n, err := ingestNamedPackages(ctx, writer, pageOpts, names, stats, func(ctx context.Context, project *Project) error {
+				return fetchCratePackage(ctx, f, opts, project)
+			})
+			written += n
+			if err != nil || (opts.MaxPackages > 0 && written >= opts.MaxPackages) {
+				return written, err
+			}
+			if results.Meta.NextPage == nil || len(results.Crates) == 0 {
+				return written, nil
+			}
+		}
+		return written, nil
+	})
+	parameters := opts.manifestParameters(nil)
+	parameters.Query = query
+	run := manifestRun{source: SourceCrates, parameters: parameters, format: opts.Format, files: []string{outPath}}
+	return finish(ctx, outPath, run, stats.stats(), err)
+}
+
+func fetchCratesPage(ctx context.Context, f *fetcher, query string, page, perPage int) (cratesPage, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("page", strconv.Itoa(page))
+	params.Set("per_page", strconv.Itoa(perPage))
+	body, err := f.fetchWithRetry(ctx, cratesEndpoint+"?"+params.Encode())
+	if err != nil {
+		return cratesPage{}, err
+	}
+	var results cratesPage
+	if err := json.Unmarshal(body, &results); err != nil {
+		return cratesPage{}, fmt.Errorf("decoding crates.io response: %w", err)
+	}
+	return results, nil
+}
+
+func fetchCrate(ctx context.Context, f *fetcher, name string) (crateResponse, error) {
+	body, err := f.fetchWithRetry(ctx, cratesEndpoint+"/"+url.PathEscape(name))
+	if err != nil {
+		return crateResponse{}, err
+	}
+	var crate crateResponse
+	if err := json.Unmarshal(body, &crate); err != nil {
+		return crateResponse{}, fmt.Errorf("decoding crates.io response: %w", err)
+	}
+	return crate, nil
+}
+
+// toProject converts the crates.io response into the record shape used for libraries.io packages. Yanked versions are
+// left out, and so are prereleases unless includePrerelease is set. The latest release is the most recently published
+// version that is left, and its license expression is the license of the crate, kept whole like the one of PyPI.
+func (c crateResponse) toProject(includePrerelease bool) Project {
+	versions := make([]Version, 0, len(c.Versions))
+	licenses := map[string]string{}
+	for _, version := range c.Versions {
+		if version.Yanked || !includePrerelease && isPrerelease(version.Num) {
+			continue
+		}
+		versions = append(versions, Version{Number: version.Num, PublishedAt: version.CreatedAt})
+		licenses[version.Num] = version.License
+	}
+	// crates.io lists the newest version first, but we write the oldest first like the other registries
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].PublishedAt < versions[j].PublishedAt
+	})
+
+	project := Project{
+		Name:        c.Crate.Name,
+		Platform:    "Cargo",
+		Description: c.Crate.Description,
+		Homepage:    c.Crate.Homepage,
+		Language:    "Rust",
+		Keywords:    c.Crate.Keywords,
+		Versions:    versions,
+	}
+	if len(versions) > 0 {
+		latest := versions[len(versions)-1]
+		project.LatestReleaseNumber = latest.Number
+		project.LatestReleasePublishedAt = latest.PublishedAt
+		project.Licenses = joinLicenses([]string{licenses[latest.Number]})
+	}
+	return project
+}
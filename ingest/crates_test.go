@@ -0,0 +1,183 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// useCratesTestServer points the crates.io endpoint at a local server for the duration of the test.
+func useCratesTestServer(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previous := cratesEndpoint
+	cratesEndpoint = server.URL
+	t.Cleanup(func() {
+		cratesEndpoint = previous
+		server.Close()
+	})
+}
+
+func TestIngestCrates(t *testing.T) {
+	var userAgents []string
+	useCratesTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.Header.Get("User-Agent"))
+		switch r.URL.Path {
+		case "/":
+			if r.URL.Query().Get("q") != "serde" {
+				t.Errorf("Expected query serde, got %s", r.URL.Query().Get("q"))
+			}
+			if r.URL.Query().Get("page") == "1" {
+				fmt.Fprint(w, `{"crates": [{"name": "serde"}], "meta": {"next_page": "?page=2&q=serde"}}`)
+			} else {
+				fmt.Fprint(w, `{"crates": [{"name": "serde_json"}], "meta": {"next_page": null}}`)
+			}
+		case "/serde":
+			fmt.Fprint(w, `{
+				"crate": {"name": "serde", "description": "A serialization framework", "homepage": "https://serde.rs",
+					"keywords": ["serde", "serialization"]},
+				"versions": [
+					{"num": "1.0.2", "created_at": "2017-03-01T00:00:00Z", "yanked": true},
+					{"num": "1.0.1", "created_at": "2017-02-01T00:00:00Z", "yanked": false, "license": "MIT OR Apache-2.0"},
+					{"num": "1.0.0", "created_at": "2017-01-01T00:00:00Z", "yanked": false}
+				]
+			}`)
+		case "/serde_json":
+			fmt.Fprint(w, `{"crate": {"name": "serde_json", "keywords": []}, "versions": []}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	outPath := filepath.Join(t.TempDir(), "crates.csv")
+
+	stats, err := IngestCrates(context.Background(), Options{}, "serde", outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 2 {
+		t.Errorf("Expected 2 crates, got %d", stats.Packages)
+	}
+
+	t.Run("Sends a User-Agent with every request", func(t *testing.T) {
+		if len(userAgents) != 4 {
+			t.Errorf("Expected 4 requests, got %d", len(userAgents))
+		}
+		for _, agent := range userAgents {
+			if agent != userAgent {
+				t.Errorf("Expected User-Agent %s, got %s", userAgent, agent)
+			}
+		}
+	})
+
+	records := readCSV(t, outPath)
+	if len(records) != 3 {
+		t.Fatalf("Expected a header and two rows, got %d rows", len(records))
+	}
+
+	t.Run("Leaves out yanked versions", func(t *testing.T) {
+		row := strings.Join(records[1], "|")
+		expected := "serde|Cargo|A serialization framework|https://serde.rs|Rust|serde;serialization|1.0.1|" +
+			"2017-02-01T00:00:00Z|1.0.0;1.0.1||||||MIT OR Apache-2.0|||pkg:cargo/serde@1.0.1"
+		if row != expected {
+			t.Errorf("Expected row %s, got %s", expected, row)
+		}
+	})
+
+	t.Run("Handles crates without versions", func(t *testing.T) {
+		row := strings.Join(records[2], "|")
+		if expected := "serde_json|Cargo|||Rust|||||||||||||pkg:cargo/serde_json"; row != expected {
+			t.Errorf("Expected row %s, got %s", expected, row)
+		}
+	})
+}
+
+func TestIngestCratesFailure(t *testing.T) {
+	useCratesTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	outPath := filepath.Join(t.TempDir(), "crates.csv")
+
+	if _, err := IngestCrates(context.Background(), Options{}, "", outPath); err == nil {
+		t.Error("Expected an error for a rejected request")
+	}
+}
+
+func TestIngestCratesOptions(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	useCratesTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			if perPage := r.URL.Query().Get("per_page"); perPage != "2" {
+				t.Errorf("Expected 2 crates per page, got %s", perPage)
+			}
+			fmt.Fprint(w, `{"crates": [{"name": "rand"}, {"name": "openssl"}], "meta": {"next_page": "?page=2"}}`)
+		case "/rand":
+			fmt.Fprint(w, `{"crate": {"name": "rand"}, "versions": [{"num": "0.8.5", "license": "MIT OR Apache-2.0"}]}`)
+		case "/openssl":
+			fmt.Fprint(w, `{"crate": {"name": "openssl"}, "versions": [{"num": "0.10.0", "license": "Apache-2.0"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	outPath := filepath.Join(t.TempDir(), "crates.ndjson")
+
+	opts := Options{PerPage: 2, MaxPages: 1, ExcludeLicenses: []string{"Apache-2.0"}, Format: FormatNDJSON}
+	stats, err := IngestCrates(context.Background(), opts, "", outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 1 || stats.Filtered != 1 {
+		t.Errorf("Expected 1 crate written and 1 filtered out, got %+v", stats)
+	}
+	if len(paths) != 3 {
+		t.Errorf("Expected a single search page and two crates, got requests for %v", paths)
+	}
+	projects, err := ReadProjects(outPath)
+	if err != nil || len(projects) != 1 || projects[0].Name != "rand" {
+		t.Errorf("Expected only rand, got %+v and %v", projects, err)
+	}
+	manifest, err := ReadManifest(filepath.Dir(outPath))
+	if err != nil || manifest.Outputs[0].Source != SourceCrates {
+		t.Errorf("Expected a manifest for the crates.io search, got %+v and %v", manifest, err)
+	}
+}
+
+func TestIngestCratesPrereleases(t *testing.T) {
+	useCratesTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `{"crates": [{"name": "tokio"}], "meta": {"next_page": null}}`)
+		case "/tokio":
+			fmt.Fprint(w, `{"crate": {"name": "tokio"}, "versions": [
+				{"num": "2.0.0-alpha.1", "created_at": "2024-02-01T00:00:00Z", "license": "Apache-2.0"},
+				{"num": "1.36.0", "created_at": "2024-01-01T00:00:00Z", "license": "MIT"}
+			]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	tests := map[bool]string{
+		false: "1.36.0|1.36.0|MIT",
+		true:  "2.0.0-alpha.1|1.36.0;2.0.0-alpha.1|Apache-2.0",
+	}
+	for include, expected := range tests {
+		outPath := filepath.Join(t.TempDir(), "crates.csv")
+		opts := Options{IncludePrerelease: include, Columns: []string{"latest_release_number", "versions", "licenses"}}
+		if _, err := IngestCrates(context.Background(), opts, "tokio", outPath); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if row := strings.Join(readCSV(t, outPath)[1], "|"); row != expected {
+			t.Errorf("Expected %s with IncludePrerelease %t, got %s", expected, include, row)
+		}
+	}
+}
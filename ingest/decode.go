@@ -0,0 +1,77 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// DecodeMode decides what happens to a package in a page of search results that cannot be decoded, such as one with
+// a number where a string belongs, which libraries.io sends now and then.
+type DecodeMode int
+
+const (
+	// DecodeStrict fails the ingestion with ErrMalformedPackage and the JSON of the package.
+	DecodeStrict DecodeMode = iota
+	// DecodeLenient logs the name of the package, leaves it out and counts it in Stats.Malformed, so that the rest of
+	// the page is still written.
+	DecodeLenient
+)
+
+// ErrMalformedPackage is returned with DecodeStrict for a package in a page of search results that cannot be decoded.
+var ErrMalformedPackage = errors.New("malformed package")
+
+// String returns the name of the mode as accepted by ParseDecodeMode.
+func (m DecodeMode) String() string {
+	switch m {
+	case DecodeStrict:
+		return "strict"
+	case DecodeLenient:
+		return "lenient"
+	}
+	return fmt.Sprintf("DecodeMode(%d)", int(m))
+}
+
+// ParseDecodeMode returns the decode mode with the given name, strict or lenient, regardless of case.
+func ParseDecodeMode(name string) (DecodeMode, error) {
+	switch strings.ToLower(name) {
+	case "strict":
+		return DecodeStrict, nil
+	case "lenient":
+		return DecodeLenient, nil
+	}
+	return 0, fmt.Errorf("unknown decode mode %q: expected strict or lenient", name)
+}
+
+// decodeProjects decodes a page of search results from libraries.io one package at a time, so that a package that
+// cannot be decoded is handled as the decode mode of the fetcher says instead of failing the whole page. The page
+// itself must be a JSON array, as for decodeLibrariesIOResponse. It also returns the number of results on the page,
+// including those that were left out, which tells whether the page is full.
+func (f *fetcher) decodeProjects(query string, body []byte) ([]Project, int, error) {
+	var objects []json.RawMessage
+	if err := decodeLibrariesIOResponse(query, body, &objects); err != nil {
+		return nil, 0, err
+	}
+	projects := make([]Project, 0, len(objects))
+	for i, object := range objects {
+		var project Project
+		err := json.Unmarshal(object, &project)
+		if err == nil {
+			projects = append(projects, project)
+			continue
+		}
+		if f.decodeMode != DecodeLenient {
+			return nil, 0, fmt.Errorf("%w at position %d: %v in %s", ErrMalformedPackage, i+1, err, object)
+		}
+		// The name often survives what broke the rest of the package
+		var named struct {
+			Name string `json:"name"`
+		}
+		json.Unmarshal(object, &named)
+		slog.Warn("Skipping a package that cannot be decoded", "package", named.Name, "url", withoutAPIKey(query), "error", err)
+		f.stats.malformed()
+	}
+	return projects, len(objects), nil
+}
@@ -0,0 +1,80 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseDecodeMode(t *testing.T) {
+	for name, expected := range map[string]DecodeMode{"strict": DecodeStrict, "Lenient": DecodeLenient} {
+		mode, err := ParseDecodeMode(name)
+		if err != nil || mode != expected {
+			t.Errorf("Expected %s to be %v, got %v and %v", name, expected, mode, err)
+		}
+	}
+	if _, err := ParseDecodeMode("loose"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestIngestMalformedPackage(t *testing.T) {
+	var requests []string
+	client := fixtureServer(t, serveFile(t, "libraries-io-search-malformed.json"), serveStatus(http.StatusNotFound), &requests)
+	opts := Options{Platform: "NPM", APIKey: "secret", MaxPages: 1}
+
+	t.Run("Fails with the package in strict mode", func(t *testing.T) {
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+		_, err := client.IngestContext(context.Background(), opts, outPath)
+		if !errors.Is(err, ErrMalformedPackage) {
+			t.Fatalf("Expected ErrMalformedPackage, got %v", err)
+		}
+		if !strings.Contains(err.Error(), `"name": "broken-stars"`) || !strings.Contains(err.Error(), `"stars": "1.2k"`) {
+			t.Errorf("Expected the JSON of the package in the error, got %v", err)
+		}
+		if _, err := os.Stat(outPath); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected no output, got %v", err)
+		}
+	})
+
+	t.Run("Skips the package in lenient mode", func(t *testing.T) {
+		opts := opts
+		opts.DecodeMode = DecodeLenient
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+		stats, err := client.IngestContext(context.Background(), opts, outPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if names := readPackageNames(t, outPath, FormatCSV); !slices.Equal(names, []string{"left-pad", "tape"}) {
+			t.Errorf("Expected the packages around the malformed one, got %v", names)
+		}
+		if stats.Packages != 2 || stats.Malformed != 1 {
+			t.Errorf("Expected 2 packages and 1 malformed, got %d and %d", stats.Packages, stats.Malformed)
+		}
+	})
+
+	t.Run("Counts skipped packages towards a full page", func(t *testing.T) {
+		var pages []string
+		search := serveFile(t, "libraries-io-search-malformed.json")
+		client := fixtureServer(t, func(w http.ResponseWriter, r *http.Request) {
+			pages = append(pages, r.URL.Query().Get("page"))
+			if r.URL.Query().Get("page") != "1" {
+				w.Write([]byte("[]"))
+				return
+			}
+			search(w, r)
+		}, serveStatus(http.StatusNotFound), &requests)
+		opts := Options{Platform: "NPM", APIKey: "secret", PerPage: 3, Workers: 1, DecodeMode: DecodeLenient}
+		if _, err := client.IngestContext(context.Background(), opts, filepath.Join(t.TempDir(), "result.csv")); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !slices.Equal(pages, []string{"1", "2"}) {
+			t.Errorf("Expected the page after the full first one to be requested, got %v", pages)
+		}
+	})
+}
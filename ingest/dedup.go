@@ -0,0 +1,155 @@
+package ingest
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// packageSet holds the packages written in a run, so that a package that shows up again is written only once. This
+// happens when the results shift between two page requests, e.g. while libraries.io reorders them, or when several
+// inputs overlap. Packages are keyed by platform, which is matched regardless of case like libraries.io does, and
+// name. A nil set stays empty, so that no package counts as a duplicate.
+//
+// The set holds every package of a run in memory. BenchmarkPackageSet measures about 90 bytes per package for keys
+// of the usual length, such as npm/@babel/core, so a run over all 3 million packages libraries.io knows for npm
+// needs about 250 MiB for it.
+type packageSet map[string]struct{}
+
+func packageKey(platform, name string) string {
+	return strings.ToLower(platform) + "/" + name
+}
+
+// add adds project to the set and reports whether it was not in it yet, which is always the case for a nil set.
+func (s packageSet) add(project Project) bool {
+	return s.addKey(packageKey(project.Platform, project.Name))
+}
+
+// addKey is like add for a key of any form.
+func (s packageSet) addKey(key string) bool {
+	if s == nil {
+		return true
+	}
+	if _, ok := s[key]; ok {
+		return false
+	}
+	s[key] = struct{}{}
+	return true
+}
+
+// unique returns the projects that are not in the set yet, in order, and adds them to it. Repeats within projects are
+// dropped as well. The duplicates are logged at debug level and counted.
+func (s packageSet) unique(projects []Project) ([]Project, int) {
+	kept := projects[:0]
+	for _, project := range projects {
+		if !s.add(project) {
+			slog.Debug("Skipping duplicate package", "platform", project.Platform, "package", project.Name)
+			continue
+		}
+		kept = append(kept, project)
+	}
+	return kept, len(projects) - len(kept)
+}
+
+// uniqueVersions drops the versions that a project lists more than once, keeping the first, so that every
+// platform/name@version gets a single version row. It returns the number of versions dropped.
+func uniqueVersions(projects []Project) int {
+	dropped := 0
+	for i := range projects {
+		versions := projects[i].Versions
+		seen := make(map[string]struct{}, len(versions))
+		kept := versions[:0]
+		for _, version := range versions {
+			if _, ok := seen[version.Number]; ok {
+				slog.Debug("Skipping duplicate version", "platform", projects[i].Platform, "package", projects[i].Name,
+					"version", version.Number)
+				continue
+			}
+			seen[version.Number] = struct{}{}
+			kept = append(kept, version)
+		}
+		dropped += len(versions) - len(kept)
+		projects[i].Versions = kept
+	}
+	return dropped
+}
+
+// DedupeCSV copies the CSV file at inPath to outPath, leaving out every row whose key is the same as that of an
+// earlier row, such as when the outputs of several runs were appended. The key depends on the header row: rows of a
+// file of versions, like VersionsFile, are keyed by package id and version number, rows of other files with a name
+// and a platform column, like the output of Ingest and PackagesFile, by platform and name, and any other rows, like
+// those of DependenciesFile, by all of their fields. The rows are streamed, so only the keys are held in memory. Both
+// files may be gzip-compressed, and inPath may be outPath: outPath is only replaced once all rows were copied, so if
+// copying fails or ctx is done, both files are left as they were. It returns the number of rows written and left out,
+// without the header.
+func DedupeCSV(ctx context.Context, inPath, outPath string) (written, duplicates int, err error) {
+	in, err := openInput(inPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer in.Close()
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading the header of %s: %w", inPath, err)
+	}
+	key := rowKey(header)
+
+	seen := packageSet{}
+	written, err = writeCSVFile(ctx, outPath, header, func(writer *csv.Writer) (int, error) {
+		written := 0
+		for {
+			if err := ctx.Err(); err != nil {
+				return written, err
+			}
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				return written, nil
+			}
+			if err != nil {
+				return written, fmt.Errorf("reading %s: %w", inPath, err)
+			}
+			if !seen.addKey(key(record)) {
+				duplicates++
+				continue
+			}
+			if err := writer.Write(record); err != nil {
+				return written, fmt.Errorf("writing CSV row: %w", err)
+			}
+			written++
+		}
+	})
+	return written, duplicates, interrupted(ctx, err)
+}
+
+// rowKey returns the function DedupeCSV keys the rows of a CSV file with the given header by.
+func rowKey(header []string) func(record []string) string {
+	field := func(record []string, column int) string {
+		if column < len(record) {
+			return record[column]
+		}
+		return ""
+	}
+	packageID, number := slices.Index(header, "package_id"), slices.Index(header, "number")
+	name, platform := slices.Index(header, "name"), slices.Index(header, "platform")
+	switch {
+	case packageID >= 0 && number >= 0:
+		return func(record []string) string {
+			return field(record, packageID) + "@" + field(record, number)
+		}
+	case name >= 0 && platform >= 0:
+		return func(record []string) string {
+			return packageKey(field(record, platform), field(record, name))
+		}
+	}
+	return func(record []string) string {
+		// A unit separator cannot be part of a field written by Ingest, so the keys of different rows differ
+		return strings.Join(record, "\x1f")
+	}
+}
@@ -0,0 +1,152 @@
+package ingest
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestPackageSet(t *testing.T) {
+	already := packageSet{}
+	projects := []Project{
+		{Name: "left-pad", Platform: "NPM"},
+		{Name: "left-pad", Platform: "npm"},
+		{Name: "left-pad", Platform: "Pypi"},
+		{Name: "Left-Pad", Platform: "NPM"},
+	}
+	kept, duplicates := already.unique(projects)
+	if len(kept) != 3 || duplicates != 1 {
+		t.Errorf("Expected 3 packages and 1 duplicate, got %v and %d", kept, duplicates)
+	}
+	if already.add(Project{Name: "left-pad", Platform: "NPM"}) {
+		t.Error("Expected a package of an earlier call to be a duplicate")
+	}
+	if !packageSet(nil).add(projects[0]) || !packageSet(nil).add(projects[0]) {
+		t.Error("Expected a nil set to treat every package as new")
+	}
+}
+
+func TestUniqueVersions(t *testing.T) {
+	projects := []Project{
+		{Name: "left-pad", Versions: []Version{{Number: "1.0.0"}, {Number: "1.1.0"}, {Number: "1.0.0"}}},
+		{Name: "right-pad", Versions: []Version{{Number: "1.0.0"}}},
+	}
+	if dropped := uniqueVersions(projects); dropped != 1 {
+		t.Errorf("Expected 1 duplicate version, got %d", dropped)
+	}
+	var numbers []string
+	for _, version := range projects[0].Versions {
+		numbers = append(numbers, version.Number)
+	}
+	if !slices.Equal(numbers, []string{"1.0.0", "1.1.0"}) {
+		t.Errorf("Expected every version once, got %v", numbers)
+	}
+	if len(projects[1].Versions) != 1 {
+		t.Errorf("Expected the versions of another package to be kept, got %v", projects[1].Versions)
+	}
+}
+
+func TestDedupeCSV(t *testing.T) {
+	dir := t.TempDir()
+	for _, test := range []struct {
+		name, csv string
+		expected  [][]string
+	}{{
+		name: "Keys packages by platform and name",
+		csv:  "name,platform,stars\nleft-pad,NPM,1\nleft-pad,Pypi,2\nleft-pad,npm,3\nright-pad,NPM,4\n",
+		expected: [][]string{
+			{"name", "platform", "stars"}, {"left-pad", "NPM", "1"}, {"left-pad", "Pypi", "2"}, {"right-pad", "NPM", "4"},
+		},
+	}, {
+		name:     "Keys versions by package and number",
+		csv:      "package_id,number,published_at\n1,1.0.0,2020\n1,1.0.0,2021\n2,1.0.0,2020\n",
+		expected: [][]string{{"package_id", "number", "published_at"}, {"1", "1.0.0", "2020"}, {"2", "1.0.0", "2020"}},
+	}, {
+		name:     "Keys other rows by all fields",
+		csv:      "version_id,dependency\n1,tape\n1,tape\n1,tap\n",
+		expected: [][]string{{"version_id", "dependency"}, {"1", "tape"}, {"1", "tap"}},
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			inPath := filepath.Join(dir, "in.csv")
+			if err := os.WriteFile(inPath, []byte(test.csv), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			outPath := filepath.Join(dir, "out.csv")
+			written, duplicates, err := DedupeCSV(context.Background(), inPath, outPath)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			records := readCSV(t, outPath)
+			if !slices.EqualFunc(records, test.expected, slices.Equal[[]string]) {
+				t.Errorf("Expected %v, got %v", test.expected, records)
+			}
+			if expected := len(test.expected) - 1; written != expected || written+duplicates != len(readCSV(t, inPath))-1 {
+				t.Errorf("Expected %d rows written and the rest counted as duplicates, got %d and %d", expected, written, duplicates)
+			}
+		})
+	}
+
+	t.Run("Replaces the input", func(t *testing.T) {
+		path := filepath.Join(dir, "result.csv.gz")
+		if _, err := writeCSVFile(context.Background(), path, []string{"name", "platform"}, func(w *csv.Writer) (int, error) {
+			return 3, w.WriteAll([][]string{{"a", "NPM"}, {"b", "NPM"}, {"a", "NPM"}})
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if written, duplicates, err := DedupeCSV(context.Background(), path, path); err != nil || written != 2 || duplicates != 1 {
+			t.Fatalf("Expected 2 rows and 1 duplicate, got %d, %d and %v", written, duplicates, err)
+		}
+		projects, err := ReadProjects(path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(projects) != 2 {
+			t.Errorf("Expected 2 packages, got %v", projects)
+		}
+	})
+
+	t.Run("Keeps the input it replaces when cancelled", func(t *testing.T) {
+		path := filepath.Join(dir, "cancelled.csv")
+		input := "name,platform\na,NPM\nb,NPM\na,NPM\n"
+		if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, _, err := DedupeCSV(ctx, path, path); !errors.Is(err, ErrInterrupted) {
+			t.Fatalf("Expected ErrInterrupted, got %v", err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != input {
+			t.Errorf("Expected the input to be left as it was, got %q", data)
+		}
+	})
+}
+
+// BenchmarkPackageSet reports the memory a packageSet takes per package, for the doc comment of packageSet.
+func BenchmarkPackageSet(b *testing.B) {
+	const packages = 1_000_000
+	keys := make([]Project, packages)
+	for i := range keys {
+		keys[i] = Project{Platform: "NPM", Name: fmt.Sprintf("@scope-%d/package", i)}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		already := packageSet{}
+		for _, project := range keys {
+			already.add(project)
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/packages, "B/package")
+		runtime.KeepAlive(already)
+	}
+}
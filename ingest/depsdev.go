@@ -0,0 +1,112 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// depsDevEndpoint is the base of the deps.dev API. It is a variable so tests can point it at a local server.
+var depsDevEndpoint = "https://api.deps.dev/v3"
+
+// depsDevSystems maps the libraries.io platforms deps.dev resolves dependencies for to the names of their deps.dev
+// systems.
+var depsDevSystems = map[string]string{
+	"cargo":    "CARGO",
+	"go":       "GO",
+	"maven":    "MAVEN",
+	"npm":      "NPM",
+	"nuget":    "NUGET",
+	"pypi":     "PYPI",
+	"rubygems": "RUBYGEMS",
+}
+
+// DepsDevSystem returns the deps.dev system of a libraries.io platform, which is matched regardless of case, e.g.
+// PYPI for Pypi. ok is false if deps.dev does not cover the platform.
+func DepsDevSystem(platform string) (system string, ok bool) {
+	system, ok = depsDevSystems[strings.ToLower(platform)]
+	return system, ok
+}
+
+// ResolvedVersion is a package version in a dependency graph resolved by deps.dev.
+type ResolvedVersion struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// ResolvedDependency is an edge of a dependency graph resolved by deps.dev, from a dependent to the version one of its
+// requirements resolved to.
+type ResolvedDependency struct {
+	From ResolvedVersion `json:"from"`
+	To   ResolvedVersion `json:"to"`
+	// Requirement is the version range the dependent declares, e.g. ^1.1.0
+	Requirement string `json:"requirement"`
+}
+
+// depsDevDependencies is the answer of deps.dev for the dependencies of a version. Edges refer to nodes by their
+// index, and Error describes what could not be resolved, if anything.
+type depsDevDependencies struct {
+	Nodes []struct {
+		VersionKey struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"versionKey"`
+	} `json:"nodes"`
+	Edges []struct {
+		FromNode    int    `json:"fromNode"`
+		ToNode      int    `json:"toNode"`
+		Requirement string `json:"requirement"`
+	} `json:"edges"`
+	Error string `json:"error"`
+}
+
+// FetchResolvedDependencies returns the dependency graph deps.dev resolved for a version of a package on a
+// libraries.io platform, as its edges. Unlike the requirements libraries.io reports, the edges point to the exact
+// versions the requirements resolved to, and the graph includes the indirect dependencies. ErrUnknownPlatform is
+// returned for platforms deps.dev does not cover, see DepsDevSystem, and ErrVersionNotFound if deps.dev does not know
+// the version. The request is aborted when ctx is done.
+func FetchResolvedDependencies(ctx context.Context, platform, name, version string) ([]ResolvedDependency, error) {
+	system, ok := DepsDevSystem(platform)
+	if !ok {
+		return nil, fmt.Errorf("%w: deps.dev does not resolve dependencies for %s", ErrUnknownPlatform, platform)
+	}
+	opts, err := Options{}.withDefaultsExceptAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	query := depsDevEndpoint + "/systems/" + system + "/packages/" + url.PathEscape(name) + "/versions/" +
+		url.PathEscape(version) + ":dependencies"
+	body, err := defaultClient().newFetcher(opts).fetchWithRetry(ctx, query)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying deps.dev for %s %s: %w", name, version, err)
+	}
+
+	var response depsDevDependencies
+	if err := decodeResponse(query, body, &response); err != nil {
+		return nil, fmt.Errorf("decoding deps.dev response: %w", err)
+	}
+	if response.Error != "" {
+		slog.Warn("deps.dev could not resolve every dependency", "name", name, "version", version, "error", response.Error)
+	}
+	dependencies := make([]ResolvedDependency, 0, len(response.Edges))
+	for _, edge := range response.Edges {
+		if edge.FromNode < 0 || edge.FromNode >= len(response.Nodes) || edge.ToNode < 0 || edge.ToNode >= len(response.Nodes) {
+			return nil, fmt.Errorf("deps.dev answered with an edge to node %d of %d", max(edge.FromNode, edge.ToNode), len(response.Nodes))
+		}
+		from, to := response.Nodes[edge.FromNode].VersionKey, response.Nodes[edge.ToNode].VersionKey
+		dependencies = append(dependencies, ResolvedDependency{
+			From:        ResolvedVersion{Name: from.Name, Version: from.Version},
+			To:          ResolvedVersion{Name: to.Name, Version: to.Version},
+			Requirement: edge.Requirement,
+		})
+	}
+	return dependencies, nil
+}
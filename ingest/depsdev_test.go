@@ -0,0 +1,77 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func useDepsDevTestServer(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previous := depsDevEndpoint
+	depsDevEndpoint = server.URL
+	t.Cleanup(func() {
+		depsDevEndpoint = previous
+		server.Close()
+	})
+}
+
+func TestFetchResolvedDependencies(t *testing.T) {
+	var paths []string
+	useDepsDevTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		if r.URL.EscapedPath() != "/systems/NPM/packages/@scope%2Fapp/versions/1.0.0:dependencies" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{
+			"nodes": [
+				{"versionKey": {"system": "NPM", "name": "@scope/app", "version": "1.0.0"}, "relation": "SELF"},
+				{"versionKey": {"system": "NPM", "name": "left-pad", "version": "1.3.0"}, "relation": "DIRECT"},
+				{"versionKey": {"system": "NPM", "name": "tape", "version": "4.0.0"}, "relation": "INDIRECT"}
+			],
+			"edges": [
+				{"fromNode": 0, "toNode": 1, "requirement": "^1.1.0"},
+				{"fromNode": 1, "toNode": 2, "requirement": "*"}
+			],
+			"error": ""
+		}`))
+	})
+
+	dependencies, err := FetchResolvedDependencies(context.Background(), "npm", "@scope/app", "1.0.0")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []ResolvedDependency{
+		{From: ResolvedVersion{"@scope/app", "1.0.0"}, To: ResolvedVersion{"left-pad", "1.3.0"}, Requirement: "^1.1.0"},
+		{From: ResolvedVersion{"left-pad", "1.3.0"}, To: ResolvedVersion{"tape", "4.0.0"}, Requirement: "*"},
+	}
+	if !slices.Equal(dependencies, expected) {
+		t.Errorf("Expected %+v, got %+v (requests %v)", expected, dependencies, paths)
+	}
+
+	t.Run("Reports unknown versions", func(t *testing.T) {
+		if _, err := FetchResolvedDependencies(context.Background(), "NPM", "@scope/app", "9.9.9"); !errors.Is(err, ErrVersionNotFound) {
+			t.Errorf("Expected ErrVersionNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Rejects platforms deps.dev does not cover", func(t *testing.T) {
+		if _, err := FetchResolvedDependencies(context.Background(), "Bower", "jquery", "3.0.0"); !errors.Is(err, ErrUnknownPlatform) {
+			t.Errorf("Expected ErrUnknownPlatform, got %v", err)
+		}
+	})
+}
+
+func TestDepsDevSystem(t *testing.T) {
+	if system, ok := DepsDevSystem("Pypi"); !ok || system != "PYPI" {
+		t.Errorf("Expected PYPI, got %s and %v", system, ok)
+	}
+	if _, ok := DepsDevSystem("CRAN"); ok {
+		t.Errorf("Expected no system for CRAN")
+	}
+}
@@ -0,0 +1,213 @@
+package ingest
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// dumpLogRows is how many rows of a dump file are read between two log lines about the progress.
+const dumpLogRows = 1_000_000
+
+// dumpTimeLayout is the layout of the timestamps in the dump, e.g. 2015-01-29 21:47:58 UTC.
+const dumpTimeLayout = "2006-01-02 15:04:05 MST"
+
+// The columns of the dump files that IngestDump reads. The files have more, which are ignored.
+var (
+	dumpProjectColumns = []string{
+		"ID", "Platform", "Name", "Description", "Keywords", "Homepage URL", "Language", "Latest Release Number",
+		"Latest Release Publish Timestamp",
+	}
+	dumpVersionColumns    = []string{"Platform", "Project Name", "Project ID", "Number", "Published Timestamp"}
+	dumpDependencyColumns = []string{
+		"Platform", "Project Name", "Project ID", "Version Number", "Dependency Name", "Dependency Platform",
+		"Dependency Kind", "Optional Dependency", "Dependency Requirements", "Dependency Project ID",
+	}
+)
+
+// IngestDump converts the projects, versions and dependencies CSV files of a libraries.io open data release into the
+// three files IngestNormalized writes to outDir, for all platforms. See IngestDumpContext.
+func IngestDump(projectsPath, versionsPath, dependenciesPath, outDir string) (Stats, error) {
+	return IngestDumpContext(context.Background(), nil, projectsPath, versionsPath, dependenciesPath, outDir)
+}
+
+// IngestDumpContext is like IngestDump but only keeps the packages of the given platforms, or of all platforms if there
+// are none, and stops when ctx is done, leaving the previous files untouched and returning ErrInterrupted.
+//
+// The files are read one after the other, row by row, so that they may be far larger than memory: only the ID and
+// latest release number of every package that is kept are held on to, to join the versions and dependencies to it.
+// Files that are gzip-compressed are decompressed while they are read. As with IngestNormalized, only the dependencies
+// of the latest release of every package are written. Timestamps are converted to RFC 3339. Progress is logged every
+// million rows.
+func IngestDumpContext(ctx context.Context, platforms []string, projectsPath, versionsPath, dependenciesPath, outDir string) (Stats, error) {
+	kept := make([]string, 0, len(platforms))
+	for _, platform := range platforms {
+		platform, err := normalizePlatform(platform)
+		if err != nil {
+			return Stats{}, err
+		}
+		kept = append(kept, platform)
+	}
+
+	stats := newStatsCollector()
+	_, err := writeTables(ctx, outDir, func(writer tablesProjectWriter) (int, error) {
+		// latest maps the dump ID of every package that is kept to its latest release number
+		latest := make(map[string]string)
+		packages, err := readDumpFile(ctx, projectsPath, dumpProjectColumns, func(row dumpRow) (bool, error) {
+			platform := row.field("Platform")
+			if len(kept) > 0 && !slices.ContainsFunc(kept, func(p string) bool { return strings.EqualFold(p, platform) }) {
+				return false, nil
+			}
+			project := row.project()
+			latest[row.field("ID")] = project.LatestReleaseNumber
+			_, err := writer.writePackage(project)
+			return true, err
+		})
+		if err != nil {
+			return 0, err
+		}
+		if err := writer.flush(); err != nil {
+			return 0, err
+		}
+		stats.page(packages, packages)
+
+		versions, err := readDumpFile(ctx, versionsPath, dumpVersionColumns, func(row dumpRow) (bool, error) {
+			if _, ok := latest[row.field("Project ID")]; !ok {
+				return false, nil
+			}
+			version := Version{Number: row.field("Number"), PublishedAt: dumpTime(row.field("Published Timestamp"))}
+			return true, writer.writeVersion(packageID(row.field("Platform"), row.field("Project Name")), version)
+		})
+		if err != nil {
+			return packages, err
+		}
+		if err := writer.flush(); err != nil {
+			return packages, err
+		}
+		stats.page(0, versions)
+
+		dependencies, err := readDumpFile(ctx, dependenciesPath, dumpDependencyColumns, func(row dumpRow) (bool, error) {
+			number, ok := latest[row.field("Project ID")]
+			if !ok || number == "" || row.field("Version Number") != number {
+				return false, nil
+			}
+			dependency := Dependency{
+				Name:         row.field("Dependency Name"),
+				Platform:     row.field("Dependency Platform"),
+				Requirements: row.field("Dependency Requirements"),
+				Kind:         row.field("Dependency Kind"),
+				Optional:     strings.EqualFold(row.field("Optional Dependency"), "true"),
+				Resolved:     row.field("Dependency Project ID") != "",
+			}
+			return true, writer.writeDependency(packageID(row.field("Platform"), row.field("Project Name")), number, dependency)
+		})
+		if err != nil {
+			return packages, err
+		}
+		if err := writer.flush(); err != nil {
+			return packages, err
+		}
+		stats.page(0, dependencies)
+		return packages, nil
+	})
+	parameters := ManifestParameters{Platforms: kept, Inputs: []string{projectsPath, versionsPath, dependenciesPath}}
+	return finish(ctx, outDir, tablesRun(SourceDump, parameters, outDir), stats.stats(), err)
+}
+
+// dumpRow is a row of a dump file, whose fields are looked up by the name of their column.
+type dumpRow struct {
+	record  []string
+	columns map[string]int
+}
+
+func (r dumpRow) field(column string) string {
+	return strings.TrimSpace(r.record[r.columns[column]])
+}
+
+// project returns the package a row of the projects file describes, without versions and dependencies.
+func (r dumpRow) project() Project {
+	var keywords []string
+	for _, keyword := range strings.Split(r.field("Keywords"), ",") {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+	return Project{
+		Name:                     r.field("Name"),
+		Platform:                 r.field("Platform"),
+		Description:              r.field("Description"),
+		Homepage:                 r.field("Homepage URL"),
+		Language:                 r.field("Language"),
+		Keywords:                 keywords,
+		LatestReleaseNumber:      r.field("Latest Release Number"),
+		LatestReleasePublishedAt: dumpTime(r.field("Latest Release Publish Timestamp")),
+	}
+}
+
+// readDumpFile calls visit for every row of the dump CSV file at path and returns the number of rows visit kept by
+// returning true. The header must name all of the given columns. Quoted fields may span several lines, as the
+// descriptions in the dump often do.
+func readDumpFile(ctx context.Context, path string, columns []string, visit func(row dumpRow) (kept bool, err error)) (int, error) {
+	file, err := openInput(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("reading the header of %s: %w", path, err)
+	}
+	row := dumpRow{columns: make(map[string]int, len(header))}
+	for i, name := range header {
+		row.columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, column := range columns {
+		if _, ok := row.columns[column]; !ok {
+			return 0, fmt.Errorf("%s has no %q column", path, column)
+		}
+	}
+
+	read, matched := 0, 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return matched, err
+		}
+		row.record, err = reader.Read()
+		if errors.Is(err, io.EOF) {
+			slog.Info("Read dump file", "path", path, "rows", read)
+			return matched, nil
+		}
+		if err != nil {
+			return matched, fmt.Errorf("reading %s: %w", path, err)
+		}
+		read++
+		if read%dumpLogRows == 0 {
+			slog.Info("Reading dump file", "path", path, "rows", read)
+		}
+		kept, err := visit(row)
+		if err != nil {
+			return matched, err
+		}
+		if kept {
+			matched++
+		}
+	}
+}
+
+// dumpTime converts a timestamp of the dump to RFC 3339, or returns it as it is if it cannot be parsed.
+func dumpTime(timestamp string) string {
+	parsed, err := time.Parse(dumpTimeLayout, timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return parsed.UTC().Format(time.RFC3339)
+}
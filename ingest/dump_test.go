@@ -0,0 +1,129 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// dumpFiles are excerpts of the libraries.io open data release, with its columns in their order. The description of
+// left-pad spans several lines and contains quotes and commas.
+var dumpFiles = map[string]string{
+	"projects.csv": `ID,Platform,Name,Created Timestamp,Updated Timestamp,Description,Keywords,Homepage URL,Licenses,Repository URL,Versions Count,SourceRank,Latest Release Publish Timestamp,Latest Release Number,Package Manager ID,Dependent Projects Count,Language,Status,Last synced Timestamp,Dependent Repositories Count,Repository ID
+1,NPM,left-pad,2014-03-18 20:01:16 UTC,2020-01-06 20:00:11 UTC,"String left pad.
+Pads with ""spaces"", or anything else",leftpad,https://github.com/stevemao/left-pad,WTFPL,https://github.com/stevemao/left-pad,2,14,2018-04-09 00:43:49 UTC,1.3.0,,100,JavaScript,,2020-01-06 20:00:11 UTC,5,1
+2,Pypi,requests,2011-02-14 00:00:00 UTC,2020-01-06 20:00:11 UTC,HTTP for Humans.,"http,client",https://requests.readthedocs.io,Apache-2.0,,1,20,2019-12-16 00:00:00 UTC,2.22.0,,1,Python,,2020-01-06 20:00:11 UTC,1,2
+3,NPM,unreleased,2020-01-01 00:00:00 UTC,2020-01-01 00:00:00 UTC,,,,,,0,0,,,,0,,,2020-01-01 00:00:00 UTC,0,
+`,
+	"versions.csv": `ID,Platform,Project Name,Project ID,Number,Published Timestamp,Created Timestamp,Updated Timestamp
+10,NPM,left-pad,1,1.2.0,2017-11-02 10:00:00 UTC,2017-11-02 10:00:00 UTC,2017-11-02 10:00:00 UTC
+11,NPM,left-pad,1,1.3.0,2018-04-09 00:43:49 UTC,2018-04-09 00:43:49 UTC,2018-04-09 00:43:49 UTC
+12,Pypi,requests,2,2.22.0,2019-12-16 00:00:00 UTC,2019-12-16 00:00:00 UTC,2019-12-16 00:00:00 UTC
+`,
+	"dependencies.csv": `ID,Platform,Project Name,Project ID,Version Number,Version ID,Dependency Name,Dependency Platform,Dependency Kind,Optional Dependency,Dependency Requirements,Dependency Project ID
+20,NPM,left-pad,1,1.2.0,10,tape,NPM,Development,false,^4.0.0,30
+21,NPM,left-pad,1,1.3.0,11,tape,NPM,Development,false,^4.9.0,30
+22,NPM,left-pad,1,1.3.0,11,fsevents,NPM,runtime,true,^2.0.0,
+23,Pypi,requests,2,2.22.0,12,urllib3,Pypi,runtime,false,">=1.21.1,<1.26",40
+`,
+}
+
+func TestIngestDump(t *testing.T) {
+	dir := writeInputFiles(t, dumpFiles)
+	outDir := t.TempDir()
+
+	stats, err := IngestDump(filepath.Join(dir, "projects.csv"), filepath.Join(dir, "versions.csv"), filepath.Join(dir, "dependencies.csv"), outDir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 3 || stats.Rows != 9 {
+		t.Errorf("Expected 3 packages in 9 rows, got %+v", stats)
+	}
+
+	t.Run("Keeps multi-line descriptions", func(t *testing.T) {
+		packages := readCSV(t, filepath.Join(outDir, PackagesFile))
+		expected := []string{packageID("NPM", "left-pad"), "left-pad", "NPM", "String left pad.\nPads with \"spaces\", or anything else",
+			"https://github.com/stevemao/left-pad", "JavaScript", "leftpad", "1.3.0", "2018-04-09T00:43:49Z"}
+		if len(packages) != 4 || !slices.Equal(packages[1], expected) {
+			t.Errorf("Expected 3 packages, the first %q, got %q", expected, packages)
+		}
+	})
+
+	t.Run("Joins the versions", func(t *testing.T) {
+		versions := readCSV(t, filepath.Join(outDir, VersionsFile))
+		if len(versions) != 4 || !slices.Equal(versions[2], []string{packageID("NPM", "left-pad"), "1.3.0", "2018-04-09T00:43:49Z", "false"}) {
+			t.Errorf("Expected 3 versions with RFC 3339 timestamps, got %q", versions)
+		}
+	})
+
+	t.Run("Keeps the dependencies of the latest release", func(t *testing.T) {
+		var rows []string
+		for _, record := range readCSV(t, filepath.Join(outDir, DependenciesFile))[1:] {
+			rows = append(rows, strings.Join(record[1:], "|"))
+		}
+		expected := []string{
+			"1.3.0|tape|NPM|^4.9.0|Development|false|true|",
+			"1.3.0|fsevents|NPM|^2.0.0|runtime|true|false|",
+			"2.22.0|urllib3|Pypi|>=1.21.1,<1.26|runtime|false|true|",
+		}
+		if !slices.Equal(rows, expected) {
+			t.Errorf("Expected the dependency rows %v, got %v", expected, rows)
+		}
+	})
+}
+
+func TestIngestDumpPlatformsAndGzip(t *testing.T) {
+	dir := writeInputFiles(t, dumpFiles)
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(dumpFiles["versions.csv"]))
+	gz.Close()
+	if err := os.WriteFile(filepath.Join(dir, "versions.csv.gz"), compressed.Bytes(), 0o644); err != nil {
+		t.Fatalf("Could not write the compressed versions: %v", err)
+	}
+	outDir := t.TempDir()
+
+	_, err := IngestDumpContext(context.Background(), []string{"pypi"}, filepath.Join(dir, "projects.csv"),
+		filepath.Join(dir, "versions.csv.gz"), filepath.Join(dir, "dependencies.csv"), outDir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	packages := readCSV(t, filepath.Join(outDir, PackagesFile))
+	versions := readCSV(t, filepath.Join(outDir, VersionsFile))
+	if len(packages) != 2 || packages[1][1] != "requests" || packages[1][6] != "http;client" || len(versions) != 2 {
+		t.Errorf("Expected only requests and its version, got %q and %q", packages, versions)
+	}
+}
+
+func TestIngestDumpErrors(t *testing.T) {
+	dir := writeInputFiles(t, map[string]string{
+		"projects.csv":   "ID,Platform,Name\n1,NPM,left-pad\n",
+		"unbalanced.csv": dumpFiles["projects.csv"][:strings.Index(dumpFiles["projects.csv"], "String left pad.")+20],
+	})
+	tests := map[string]struct {
+		platforms []string
+		projects  string
+		expected  string
+	}{
+		"Unknown platform": {[]string{"Nope"}, "projects.csv", "unknown platform"},
+		"Missing column":   {nil, "projects.csv", `no "Description" column`},
+		"Unbalanced quote": {nil, "unbalanced.csv", "extraneous or missing"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			outDir := t.TempDir()
+			_, err := IngestDumpContext(context.Background(), test.platforms, filepath.Join(dir, test.projects), "", "", outDir)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("Expected an error containing %q, got %v", test.expected, err)
+			}
+			if _, err := os.Stat(filepath.Join(outDir, PackagesFile)); !os.IsNotExist(err) {
+				t.Errorf("Expected no packages file to be left behind, got %v", err)
+			}
+		})
+	}
+}
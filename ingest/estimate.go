@@ -0,0 +1,220 @@
+package ingest
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// totalHeader is the response header in which libraries.io reports the number of search results across all pages.
+const totalHeader = "Total"
+
+// errUnknownTotal signals that libraries.io did not say how many search results there are, so without a limit on
+// pages or packages there is nothing to extrapolate to.
+var errUnknownTotal = errors.New("libraries.io did not report the number of search results, so only runs with a page or package limit can be estimated")
+
+// Estimate is what an ingestion is expected to take, extrapolated from the first page of search results by
+// EstimateIngest.
+type Estimate struct {
+	// Packages is the number of packages that would be written.
+	Packages int `json:"packages"`
+	// Pages is the number of search pages that would be requested.
+	Pages int `json:"pages"`
+	// Requests is the number of requests that would be sent, the search pages and the extra requests opts.Versions,
+	// Dependencies and Vulnerabilities take, but not retries.
+	Requests int `json:"requests"`
+	// Duration is how long sending the requests takes at opts.RequestsPerMinute. It is zero without a rate limit, when
+	// the time depends on the network alone.
+	Duration time.Duration `json:"duration_ns"`
+	// Bytes is the approximate size of the output before compression. A FormatSQLite database is assumed to be as
+	// large as the CSV file.
+	Bytes int64 `json:"bytes"`
+}
+
+// String formats the estimate as a one-line summary.
+func (e Estimate) String() string {
+	duration := "no rate limit"
+	if e.Duration > 0 {
+		duration = "about " + e.Duration.Round(time.Second).String() + " at the rate limit"
+	}
+	return fmt.Sprintf("%d packages from %d pages: %d requests, %s, about %s of output", e.Packages, e.Pages,
+		e.Requests, duration, formatBytes(e.Bytes))
+}
+
+// EstimateIngest sends only the first search request for each platform and estimates, from the number of results
+// libraries.io reports and the packages on the page, what IngestPlatforms with the same options would take. It writes
+// no files, and neither reads nor writes cached responses, which do not keep the number of results. The limits and
+// filters in opts are taken into account, and the share of packages that need extra requests or are left out by the
+// filters is assumed to be the same on every page as on the first. The size of the output is extrapolated from the
+// first page as well, without the versions and dependencies fetched for it, so it tends to be on the low side.
+func EstimateIngest(ctx context.Context, opts Options, platforms []string) (Estimate, error) {
+	return defaultClient().EstimateIngest(ctx, opts, platforms)
+}
+
+// EstimateIngest is like the package-level EstimateIngest but sends all requests through c.
+func (c *Client) EstimateIngest(ctx context.Context, opts Options, platforms []string) (Estimate, error) {
+	opts, platforms, err := prepareIngest(opts, platforms)
+	if err != nil {
+		return Estimate{}, err
+	}
+	f := c.newFetcher(opts)
+	// A cached page has no Total header
+	f.cache = nil
+	var estimate Estimate
+	for _, platform := range platforms {
+		opts.Platform = platform
+		first, total, err := c.fetchFirstPage(ctx, opts, f)
+		if err != nil {
+			return estimate, interrupted(ctx, fmt.Errorf("fetching the first page of %s: %w", platform, err))
+		}
+		platformEstimate, err := estimatePlatform(opts, first, total)
+		if err != nil {
+			return estimate, fmt.Errorf("estimating %s: %w", platform, err)
+		}
+		estimate.Packages += platformEstimate.Packages
+		estimate.Pages += platformEstimate.Pages
+		estimate.Requests += platformEstimate.Requests
+		estimate.Bytes += platformEstimate.Bytes
+	}
+	if opts.RequestsPerMinute > 0 {
+		estimate.Duration = time.Duration(estimate.Requests) * time.Minute / time.Duration(opts.RequestsPerMinute)
+	}
+	estimate.Bytes += headerBytes(opts)
+	return estimate, nil
+}
+
+// fetchFirstPage requests the first page of search results for opts.Platform and returns it along with the number of
+// results across all pages, or -1 if libraries.io did not report it and the page is full.
+func (c *Client) fetchFirstPage(ctx context.Context, opts Options, f *fetcher) ([]Project, int, error) {
+	query := c.discoveryURL(opts.Platform, 1, opts.PerPage, opts.APIKey, opts.Keywords, opts.Languages, opts.searchSort())
+	var body []byte
+	var header http.Header
+	err := f.streamWithRetry(ctx, query, func(r io.Reader) error {
+		var err error
+		header = responseHeader(r)
+		body, err = io.ReadAll(r)
+		return err
+	})
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnprocessableEntity {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	projects, results, err := f.decodeProjects(query, body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("decoding libraries.io response: %w", err)
+	}
+	if results < opts.PerPage {
+		return projects, results, nil
+	}
+	total, err := strconv.Atoi(strings.TrimSpace(header.Get(totalHeader)))
+	if err != nil || total < results {
+		return projects, -1, nil
+	}
+	return projects, total, nil
+}
+
+// estimatePlatform extrapolates from first, the first page of search results for opts.Platform, to all total results,
+// or as many as the limits in opts allow if total is -1 for unknown. opts must have its defaults applied.
+func estimatePlatform(opts Options, first []Project, total int) (Estimate, error) {
+	kept := make([]Project, 0, len(first))
+	for _, project := range first {
+		kept = append(kept, normalizeProject(project))
+	}
+	kept, _ = newPackageFilter(opts).keep(kept)
+	// keptShare is the share of search results that are written
+	keptShare := 1.0
+	if len(first) > 0 {
+		keptShare = float64(len(kept)) / float64(len(first))
+	}
+
+	results := math.Inf(1)
+	if total >= 0 {
+		results = float64(total)
+	}
+	if opts.MaxPages > 0 {
+		results = math.Min(results, float64(opts.MaxPages*opts.PerPage))
+	}
+	packages := results * keptShare
+	if opts.MaxPackages > 0 && packages > float64(opts.MaxPackages) {
+		packages = float64(opts.MaxPackages)
+		// Enough results to keep MaxPackages of them
+		results = math.Min(results, math.Ceil(packages/keptShare))
+	}
+	if math.IsInf(results, 1) || math.IsNaN(results) {
+		return Estimate{}, errUnknownTotal
+	}
+	estimate := Estimate{Packages: int(math.Round(packages)), Pages: int(math.Ceil(results / float64(opts.PerPage)))}
+	// The first request is sent even if there are no results
+	estimate.Pages = max(estimate.Pages, 1)
+	estimate.Requests = estimate.Pages
+	if len(kept) == 0 {
+		return estimate, nil
+	}
+
+	// perPackage is the number of extra requests for every package that is written
+	perPackage := 0.0
+	for _, project := range kept {
+		if opts.Versions && len(project.Versions) == 0 {
+			perPackage++
+		}
+		if !opts.IncludePrerelease {
+			project = withoutPrereleases(project)
+		}
+		if opts.Dependencies && project.LatestReleaseNumber != "" {
+			perPackage++
+		}
+	}
+	perPackage /= float64(len(kept))
+	estimate.Requests += int(math.Round(perPackage * packages))
+	if opts.Vulnerabilities {
+		estimate.Requests += estimate.Pages
+	}
+	estimate.Bytes = int64(math.Round(float64(rowBytes(opts, kept)) / float64(len(kept)) * packages))
+	return estimate, nil
+}
+
+// rowBytes returns the size of projects in the output format of opts, without the CSV header or the brackets of a
+// JSON array.
+func rowBytes(opts Options, projects []Project) int64 {
+	// Already validated by withDefaultsExceptAPIKey
+	columns, _ := csvColumnIndices(opts.Columns)
+	counter := &countingWriter{w: io.Discard}
+	var writer projectWriter
+	switch opts.Format {
+	case FormatNDJSON:
+		writer = ndjsonProjectWriter{json.NewEncoder(counter)}
+	case FormatJSON:
+		// Every row but the first is preceded by a separator, which is close enough for all of them
+		jsonWriter := &jsonProjectWriter{w: counter, count: 1}
+		jsonWriter.encoder = json.NewEncoder(&jsonWriter.buf)
+		writer = jsonWriter
+	default:
+		writer = csvProjectWriter{writer: csv.NewWriter(counter), columns: columns}
+	}
+	writer.writeProjects(projects)
+	return counter.n
+}
+
+// headerBytes returns the size of what the output has besides its rows, the CSV header or the brackets of a JSON
+// array.
+func headerBytes(opts Options) int64 {
+	switch opts.Format {
+	case FormatNDJSON:
+		return 0
+	case FormatJSON:
+		return int64(len("[\n]\n"))
+	}
+	columns, _ := csvColumnIndices(opts.Columns)
+	return int64(len(strings.Join(selectColumns(csvHeader, columns), ",")) + 1)
+}
@@ -0,0 +1,114 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// estimatePage returns a full first page of 20 packages, every other one licensed under GPL-3.0 and without a release.
+func estimatePage() []Project {
+	page := make([]Project, 20)
+	for i := range page {
+		page[i] = Project{Name: fmt.Sprintf("package-%02d", i), Platform: "NPM", Licenses: "MIT", LatestReleaseNumber: "1.0.0",
+			Versions: []Version{{Number: "1.0.0"}}}
+		if i%2 == 1 {
+			page[i].Licenses, page[i].LatestReleaseNumber, page[i].Versions = "GPL-3.0", "", nil
+		}
+	}
+	return page
+}
+
+func TestEstimatePlatform(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		total    int
+		expected Estimate
+	}{
+		{"Needs a page per 20 results", Options{}, 1000, Estimate{Packages: 1000, Pages: 50, Requests: 50}},
+		{"Stops at the package limit", Options{MaxPackages: 30}, 1000, Estimate{Packages: 30, Pages: 2, Requests: 2}},
+		{"Stops at the page limit", Options{MaxPages: 3}, 1000, Estimate{Packages: 60, Pages: 3, Requests: 3}},
+		{"Uses the limit when the total is unknown", Options{MaxPages: 2}, -1, Estimate{Packages: 40, Pages: 2, Requests: 2}},
+		{"Sends the first request without results", Options{}, 0, Estimate{Packages: 0, Pages: 1, Requests: 1}},
+		{"Counts the versions of packages without any", Options{Versions: true}, 1000, Estimate{Packages: 1000, Pages: 50, Requests: 550}},
+		{"Counts the dependencies of packages with a release", Options{Dependencies: true}, 1000, Estimate{Packages: 1000, Pages: 50, Requests: 550}},
+		{"Counts a vulnerability request per page", Options{Vulnerabilities: true}, 1000, Estimate{Packages: 1000, Pages: 50, Requests: 100}},
+		{"Leaves out excluded licenses", Options{ExcludeLicenses: []string{"GPL-3.0"}}, 1000, Estimate{Packages: 500, Pages: 50, Requests: 50}},
+		{"Reads enough pages for the package limit after excluding licenses", Options{ExcludeLicenses: []string{"GPL-3.0"}, MaxPackages: 100},
+			1000, Estimate{Packages: 100, Pages: 10, Requests: 10}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts, err := test.opts.withDefaultsExceptAPIKey()
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			page := estimatePage()
+			if test.total == 0 {
+				page = nil
+			}
+			estimate, err := estimatePlatform(opts, page, test.total)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			estimate.Bytes = 0
+			if estimate != test.expected {
+				t.Errorf("Expected %+v, got %+v", test.expected, estimate)
+			}
+		})
+	}
+
+	t.Run("Needs a limit when the total is unknown", func(t *testing.T) {
+		opts, _ := Options{}.withDefaultsExceptAPIKey()
+		if _, err := estimatePlatform(opts, estimatePage(), -1); !errors.Is(err, errUnknownTotal) {
+			t.Errorf("Expected errUnknownTotal, got %v", err)
+		}
+	})
+
+	t.Run("Extrapolates the size of the rows", func(t *testing.T) {
+		for _, format := range []Format{FormatCSV, FormatNDJSON, FormatJSON} {
+			opts, _ := Options{Format: format}.withDefaultsExceptAPIKey()
+			estimate, _ := estimatePlatform(opts, estimatePage(), 1000)
+			if expected := rowBytes(opts, estimatePage()) * 50; estimate.Bytes != expected {
+				t.Errorf("Expected %d bytes of %s, got %d", expected, format, estimate.Bytes)
+			}
+		}
+	})
+}
+
+func TestEstimateIngest(t *testing.T) {
+	requests := 0
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Total", "95")
+		w.Write([]byte(`[{"name": "left-pad", "platform": "NPM"}, {"name": "right-pad", "platform": "NPM"}]`))
+	})
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+
+	opts := Options{APIKey: "secret", PerPage: 2, RequestsPerMinute: 30, Versions: true, CacheDir: cacheDir}
+	estimate, err := EstimateIngest(context.Background(), opts, []string{"NPM", "Pypi"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected only the first page of each platform to be requested, got %d requests", requests)
+	}
+	// 48 pages and 95 version requests per platform
+	expected := Estimate{Packages: 190, Pages: 96, Requests: 286, Duration: 286 * time.Minute / 30}
+	if bytes := estimate.Bytes; bytes <= 0 {
+		t.Errorf("Expected an output size, got %d", bytes)
+	}
+	estimate.Bytes = 0
+	if estimate != expected {
+		t.Errorf("Expected %+v, got %+v", expected, estimate)
+	}
+	if _, err := os.Stat(cacheDir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no cache to be written, got %v", err)
+	}
+}
@@ -0,0 +1,542 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultMaxAttempts = 5
+	// defaultRequestTimeout bounds a single attempt of a request, from sending it to reading the last byte of the body.
+	defaultRequestTimeout = 30 * time.Second
+	// baseBackoff is the wait before the first retry. It doubles with every following attempt.
+	baseBackoff = time.Second
+	// maxBackoff caps both the exponential backoff and the wait requested through Retry-After.
+	maxBackoff = time.Minute
+	// quotaPause is how long requests are held back when libraries.io reports an exhausted quota without saying for
+	// how long. The quota is counted per minute.
+	quotaPause = time.Minute
+)
+
+// sleep waits for d or until ctx is done, whichever comes first, and returns ctx.Err() in the latter case. Tests
+// replace it so they do not have to wait.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// errPageOutOfRange signals that libraries.io refused a page because it lies beyond the last available one.
+var errPageOutOfRange = errors.New("page out of range")
+
+// fetcher sends requests to package registries such as libraries.io. It retries transient failures and keeps to the
+// rate limit, both the one configured locally and the quota the server reports back. It is safe for concurrent use.
+type fetcher struct {
+	limiter     *rateLimiter
+	maxAttempts int
+	// timeout bounds every attempt of a request. An attempt that takes longer is retried like a reset connection.
+	// Zero or less means attempts are only bounded by the context.
+	timeout time.Duration
+	// backoff returns the wait before the given retry attempt, starting at 1. Tests replace it to make waits
+	// predictable.
+	backoff func(attempt int) time.Duration
+	// userAgent is sent as the User-Agent header when set. Some registries reject requests without one.
+	userAgent string
+	// client sends the requests. Nil uses http.DefaultClient.
+	client Doer
+	// stats counts requests, retries and downloaded bytes. It may be nil.
+	stats *statsCollector
+	// cache holds responses of earlier runs. It may be nil.
+	cache *responseCache
+	// decodeMode decides what happens to packages in a page of search results that cannot be decoded
+	decodeMode DecodeMode
+}
+
+// newFetcher creates a fetcher that sends requests through opts.HTTPClient or else the HTTP client of c, with the rate
+// limit and retry settings in opts, which must have their defaults applied.
+func (c *Client) newFetcher(opts Options) *fetcher {
+	client := c.httpClient
+	if opts.HTTPClient != nil {
+		client = opts.HTTPClient
+	}
+	return &fetcher{
+		client:      client,
+		limiter:     newRateLimiter(opts.RequestsPerMinute, 1),
+		maxAttempts: opts.MaxAttempts,
+		timeout:     opts.RequestTimeout,
+		backoff:     backoff,
+		cache:       newResponseCache(opts),
+		decodeMode:  opts.DecodeMode,
+	}
+}
+
+// fetchProjects requests a single page of search results and decodes them, returning the number of results on the
+// page as well, as decodeProjects does. libraries.io answers with a 422 when asked for a page past its pagination
+// limit, which is reported as errPageOutOfRange.
+func (f *fetcher) fetchProjects(ctx context.Context, query string) ([]Project, int, error) {
+	body, err := f.fetchWithRetry(ctx, query)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnprocessableEntity {
+		return nil, 0, errPageOutOfRange
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	projects, results, err := f.decodeProjects(query, body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("decoding libraries.io response: %w", err)
+	}
+	return projects, results, nil
+}
+
+// fetchDependencies requests the dependencies of a single version of a package from libraries.io. A 404 is reported
+// as ErrVersionNotFound.
+func (f *fetcher) fetchDependencies(ctx context.Context, query string) ([]Dependency, error) {
+	body, err := f.fetchWithRetry(ctx, query)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var version struct {
+		Dependencies []struct {
+			Dependency
+			// Latest is the latest version of the dependency, which is null if libraries.io does not know it
+			Latest *string `json:"latest"`
+		} `json:"dependencies"`
+	}
+	if err := decodeLibrariesIOResponse(query, body, &version); err != nil {
+		return nil, fmt.Errorf("decoding libraries.io response: %w", err)
+	}
+	dependencies := make([]Dependency, 0, len(version.Dependencies))
+	for _, dependency := range version.Dependencies {
+		dependency.Dependency.Resolved = dependency.Latest != nil
+		dependencies = append(dependencies, dependency.Dependency)
+	}
+	return dependencies, nil
+}
+
+// fetchVersions requests a single package from libraries.io and returns its versions. A 404 is reported as
+// errProjectNotFound.
+func (f *fetcher) fetchVersions(ctx context.Context, query string) ([]Version, error) {
+	body, err := f.fetchWithRetry(ctx, query)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return nil, errProjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var project struct {
+		Versions []Version `json:"versions"`
+	}
+	if err := decodeLibrariesIOResponse(query, body, &project); err != nil {
+		return nil, fmt.Errorf("decoding libraries.io response: %w", err)
+	}
+	return project.Versions, nil
+}
+
+// fetchProject requests a single package from libraries.io, with all of its versions. A 404 is reported as
+// errProjectNotFound.
+func (f *fetcher) fetchProject(ctx context.Context, query string) (Project, error) {
+	body, err := f.fetchWithRetry(ctx, query)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return Project{}, errProjectNotFound
+	}
+	if err != nil {
+		return Project{}, err
+	}
+
+	var project Project
+	if err := decodeLibrariesIOResponse(query, body, &project); err != nil {
+		return Project{}, fmt.Errorf("decoding libraries.io response: %w", err)
+	}
+	return project, nil
+}
+
+// statusError is returned when the server answers with a status other than 200 OK.
+type statusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *statusError) Error() string {
+	return "unexpected response status " + e.Status
+}
+
+// isRetryableStatus reports whether a response with the given status code may succeed when sent again later.
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryableError wraps a failure that is worth retrying, together with the wait the server asked for, if any.
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// maxLoggedBody is how much of a response body that cannot be decoded is logged.
+const maxLoggedBody = 200
+
+// ErrUnexpectedResponse is returned when libraries.io answers with a body that does not have the shape of the response
+// that was asked for, such as an error object instead of a page of packages.
+var ErrUnexpectedResponse = errors.New("unexpected response")
+
+// decodeResponse decodes the JSON body of the response to query into v. If that fails, the start of the body is logged
+// at debug level, since it usually shows what the server sent instead, such as an HTML error page.
+func decodeResponse(query string, body []byte, v interface{}) error {
+	err := json.Unmarshal(body, v)
+	if err != nil {
+		slog.Debug("Could not decode response", "url", withoutAPIKey(query), "bytes", len(body),
+			"body", string(bodyStart(body)), "err", err)
+	}
+	return err
+}
+
+// decodeLibrariesIOResponse is like decodeResponse for a response of libraries.io, which must be a JSON array if v
+// points to a slice and a JSON object otherwise. A body of another shape, such as null, and an object with an error
+// field, which libraries.io sends in place of some responses, are reported as ErrUnexpectedResponse instead of being
+// decoded into no packages. Errors include the start of the body.
+func decodeLibrariesIOResponse(query string, body []byte, v interface{}) error {
+	trimmed := bytes.TrimSpace(body)
+	if bytes.HasPrefix(trimmed, []byte("{")) && bytes.Contains(trimmed, []byte(`"error"`)) {
+		var payload struct {
+			Error json.RawMessage `json:"error"`
+		}
+		if json.Unmarshal(trimmed, &payload) == nil && len(payload.Error) > 0 && string(payload.Error) != "null" {
+			message := string(payload.Error)
+			var text string
+			if json.Unmarshal(payload.Error, &text) == nil {
+				message = text
+			}
+			return fmt.Errorf("%w with the error %q", ErrUnexpectedResponse, message)
+		}
+	}
+	shape, start := "object", byte('{')
+	if reflect.TypeOf(v).Elem().Kind() == reflect.Slice {
+		shape, start = "array", '['
+	}
+	if len(trimmed) == 0 || trimmed[0] != start {
+		return fmt.Errorf("%w: expected a JSON %s, got %q", ErrUnexpectedResponse, shape, bodyStart(body))
+	}
+	if err := decodeResponse(query, body, v); err != nil {
+		return fmt.Errorf("%w in %q", err, bodyStart(body))
+	}
+	return nil
+}
+
+// bodyStart returns the first maxLoggedBody bytes of body.
+func bodyStart(body []byte) []byte {
+	if len(body) > maxLoggedBody {
+		return body[:maxLoggedBody]
+	}
+	return body
+}
+
+// fetchWithRetry sends a GET request to query and returns the response body. Rate limiting (429), transient server
+// errors (500, 502, 503, 504) and connection failures are retried up to maxAttempts times in total, waiting with
+// exponential backoff and jitter in between, or as long as the Retry-After header asks for. Any other non-200 status
+// fails immediately. Every attempt waits for the limiter first. Waiting and the request itself are aborted when ctx is
+// done. If the fetcher has a cache, a fresh entry is returned without sending a request at all, and successful
+// responses are stored in it. An entry that expired is revalidated with If-None-Match and If-Modified-Since if its
+// response had an ETag or a Last-Modified header, and used again, without downloading it, if the server answers 304
+// Not Modified.
+func (f *fetcher) fetchWithRetry(ctx context.Context, query string) ([]byte, error) {
+	if body, ok := f.cache.get(query); ok {
+		f.stats.cacheHit()
+		slog.Debug("Using cached response", "url", withoutAPIKey(query))
+		return body, nil
+	}
+	cached, validators, conditional := f.cache.stale(query)
+	var header http.Header
+	if conditional {
+		header = validators.requestHeader()
+	}
+	var body []byte
+	err := f.sendWithRetry(ctx, query, nil, header, func(r io.Reader) error {
+		var err error
+		body, err = io.ReadAll(r)
+		validators = responseValidators(responseHeader(r))
+		return err
+	})
+	var statusErr *statusError
+	if conditional && errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotModified {
+		f.stats.notModified()
+		slog.Debug("Using cached response, which has not changed", "url", withoutAPIKey(query))
+		if err := f.cache.touch(query); err != nil {
+			slog.Warn("Could not refresh cached response", "url", withoutAPIKey(query), "err", err)
+		}
+		return cached, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := f.cache.put(query, body, validators); err != nil {
+		// The response is fine, it just has to be fetched again next time
+		slog.Warn("Could not cache response", "url", withoutAPIKey(query), "err", err)
+	}
+	return body, nil
+}
+
+// streamWithRetry is like fetchWithRetry but hands the body of a successful response to decode while it arrives,
+// instead of reading all of it into memory first, and bypasses the cache. A failure to read the body is retried like a
+// reset connection, in which case decode is called again and has to start over. Any other error returned by decode
+// fails immediately.
+func (f *fetcher) streamWithRetry(ctx context.Context, query string, decode func(body io.Reader) error) error {
+	return f.sendWithRetry(ctx, query, nil, nil, decode)
+}
+
+// sendWithRetry is streamWithRetry for a POST of payload, or a GET if payload is nil, with the fields of header added
+// to the request.
+func (f *fetcher) sendWithRetry(ctx context.Context, query string, payload []byte, header http.Header, decode func(body io.Reader) error) error {
+	var lastErr error
+	for attempt := 0; attempt < f.maxAttempts; attempt++ {
+		if attempt > 0 {
+			wait := f.retryWait(lastErr, attempt)
+			slog.Warn("Request failed, retrying", "url", withoutAPIKey(query), "attempt", attempt, "wait", wait,
+				"err", lastErr)
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
+			f.stats.retry()
+		}
+		if err := f.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		err := f.fetchOnce(ctx, query, payload, header, decode)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		var retryErr *retryableError
+		if !errors.As(err, &retryErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", f.maxAttempts, lastErr)
+}
+
+// postWithRetry sends payload as the JSON body of a POST request to query and returns the response body. It is
+// retried like fetchWithRetry but bypasses the cache.
+func (f *fetcher) postWithRetry(ctx context.Context, query string, payload []byte) ([]byte, error) {
+	var body []byte
+	err := f.sendWithRetry(ctx, query, payload, nil, func(r io.Reader) error {
+		var err error
+		body, err = io.ReadAll(r)
+		return err
+	})
+	return body, err
+}
+
+// fetchOnce sends a single request and passes the body of a successful response to decode, giving up after the
+// timeout of the fetcher. The request is a GET, or a POST of payload as JSON if payload is not nil, and has the fields
+// of header. When the response reports that the quota is used up, the limiter is paused so that the next request does
+// not get rejected.
+func (f *fetcher) fetchOnce(ctx context.Context, query string, payload []byte, header http.Header, decode func(body io.Reader) error) error {
+	// Only the attempt times out, ctx itself stays usable for the next one
+	attemptCtx := ctx
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+	method, content := http.MethodGet, io.Reader(nil)
+	if payload != nil {
+		method, content = http.MethodPost, bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(attemptCtx, method, query, content)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", redactURLError(err))
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+	var client Doer = http.DefaultClient
+	if f.client != nil {
+		client = f.client
+	}
+	f.stats.request()
+	slog.Debug("Sending request", "url", withoutAPIKey(query))
+	resp, err := client.Do(req)
+	if err != nil {
+		// The error contains the full URL, which would leak the API key into logs
+		err = fmt.Errorf("sending request: %w", redactURLError(err))
+		if ctx.Err() != nil {
+			return err
+		}
+		// Connection resets and the like are usually gone by the next attempt
+		return &retryableError{err: err}
+	}
+	defer resp.Body.Close()
+	slog.Debug("Received response", "url", withoutAPIKey(query), "status", resp.StatusCode)
+
+	retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		pause := retryAfter
+		if pause <= 0 {
+			pause = quotaPause
+		}
+		f.limiter.Pause(pause)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		statusErr := &statusError{StatusCode: resp.StatusCode, Status: resp.Status}
+		if isRetryableStatus(resp.StatusCode) {
+			return &retryableError{err: statusErr, retryAfter: retryAfter}
+		}
+		return statusErr
+	}
+
+	body := &bodyReader{r: resp.Body, header: resp.Header}
+	if err := decode(body); err != nil {
+		if body.err == nil {
+			return err
+		}
+		err = fmt.Errorf("reading response: %w", body.err)
+		if ctx.Err() != nil {
+			return err
+		}
+		return &retryableError{err: err}
+	}
+	f.stats.downloaded(body.n)
+	return nil
+}
+
+// bodyReader counts the bytes read from a response body and keeps the error reading it failed with, which tells a
+// broken connection apart from a body that could not be decoded. It also carries the header of the response, see
+// responseHeader.
+type bodyReader struct {
+	r      io.Reader
+	n      int
+	err    error
+	header http.Header
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += n
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// retryWait determines how long to wait before the given attempt. A Retry-After from the previous response takes
+// precedence over the exponential backoff.
+func (f *fetcher) retryWait(lastErr error, attempt int) time.Duration {
+	var retryErr *retryableError
+	if errors.As(lastErr, &retryErr) && retryErr.retryAfter > 0 {
+		if retryErr.retryAfter > maxBackoff {
+			return maxBackoff
+		}
+		return retryErr.retryAfter
+	}
+	return f.backoff(attempt)
+}
+
+// backoff returns the exponential backoff before the given retry attempt (starting at 1), with up to 50% jitter so
+// that concurrent clients do not retry in lockstep.
+func backoff(attempt int) time.Duration {
+	wait := baseBackoff << (attempt - 1)
+	if wait > maxBackoff || wait <= 0 {
+		wait = maxBackoff
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// parseRetryAfter interprets a Retry-After header, which is either a number of seconds or an HTTP date. It returns
+// zero when the header is missing or malformed.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// apiKeyParameter matches the value of the api_key parameter in a query that cannot be parsed as a URL.
+var apiKeyParameter = regexp.MustCompile(`(api_key=)[^&#]*`)
+
+// withoutAPIKey removes the api_key parameter from query, so that it can be logged or used as a key. If query is not a
+// valid URL, the value of the parameter is replaced instead.
+func withoutAPIKey(query string) string {
+	u, err := url.Parse(query)
+	if err != nil {
+		return apiKeyParameter.ReplaceAllString(query, "${1}REDACTED")
+	}
+	values := u.Query()
+	values.Del("api_key")
+	u.RawQuery = values.Encode()
+	return u.String()
+}
+
+// redactURLError strips the request URL (and with it the API key) from errors returned by the http package.
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// responseHeader returns the header of the response whose body the fetcher handed to a decode function, or nil if body
+// did not come from the fetcher.
+func responseHeader(body io.Reader) http.Header {
+	if b, ok := body.(*bodyReader); ok {
+		return b.header
+	}
+	return nil
+}
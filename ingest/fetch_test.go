@@ -0,0 +1,371 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// testFetcher creates a fetcher without a rate limit whose backoff before attempt n is n seconds.
+func testFetcher(maxAttempts int) *fetcher {
+	return &fetcher{
+		limiter:     newRateLimiter(0, 1),
+		maxAttempts: maxAttempts,
+		backoff: func(attempt int) time.Duration {
+			return time.Duration(attempt) * time.Second
+		},
+	}
+}
+
+// recordSleeps replaces sleep for the duration of the test and records the requested waits instead.
+func recordSleeps(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var waits []time.Duration
+	previous := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return ctx.Err()
+	}
+	t.Cleanup(func() {
+		sleep = previous
+	})
+	return &waits
+}
+
+func TestFetchWithRetry(t *testing.T) {
+	t.Run("Retries transient errors until it succeeds", func(t *testing.T) {
+		waits := recordSleeps(t)
+		requests := 0
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("[]"))
+		})
+
+		body, err := testFetcher(5).fetchWithRetry(context.Background(), discoveryEndpoint)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if string(body) != "[]" {
+			t.Errorf("Expected the body of the successful response, got %q", body)
+		}
+		if requests != 3 || len(*waits) != 2 {
+			t.Errorf("Expected 3 requests and 2 waits, got %d and %d", requests, len(*waits))
+		}
+	})
+
+	t.Run("Respects Retry-After", func(t *testing.T) {
+		waits := recordSleeps(t)
+		requests := 0
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 1 {
+				w.Header().Set("Retry-After", "7")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Write([]byte("[]"))
+		})
+
+		if _, err := testFetcher(5).fetchWithRetry(context.Background(), discoveryEndpoint); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(*waits) != 1 || (*waits)[0] != 7*time.Second {
+			t.Errorf("Expected a single wait of 7s, got %v", *waits)
+		}
+	})
+
+	t.Run("Fails fast on non-retryable statuses", func(t *testing.T) {
+		for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound} {
+			recordSleeps(t)
+			requests := 0
+			useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.WriteHeader(status)
+			})
+
+			_, err := testFetcher(5).fetchWithRetry(context.Background(), discoveryEndpoint)
+			var statusErr *statusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != status {
+				t.Errorf("Expected a %d status error, got %v", status, err)
+			}
+			if requests != 1 {
+				t.Errorf("Expected a single request for status %d, got %d", status, requests)
+			}
+		}
+	})
+
+	t.Run("Retries an attempt that exceeds the request timeout", func(t *testing.T) {
+		recordSleeps(t)
+		var requests int32
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) == 1 {
+				<-r.Context().Done()
+				return
+			}
+			w.Write([]byte("[]"))
+		})
+		f := testFetcher(3)
+		f.timeout = 20 * time.Millisecond
+
+		if _, err := f.fetchWithRetry(context.Background(), discoveryEndpoint); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if requests := atomic.LoadInt32(&requests); requests != 2 {
+			t.Errorf("Expected the hung request to be sent again, got %d requests", requests)
+		}
+	})
+
+	t.Run("Gives up after the maximum number of attempts", func(t *testing.T) {
+		recordSleeps(t)
+		requests := 0
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusBadGateway)
+		})
+
+		_, err := testFetcher(4).fetchWithRetry(context.Background(), discoveryEndpoint)
+		var statusErr *statusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadGateway {
+			t.Errorf("Expected the last status error, got %v", err)
+		}
+		if requests != 4 {
+			t.Errorf("Expected 4 requests, got %d", requests)
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 1; attempt <= 10; attempt++ {
+		wait := backoff(attempt)
+		expected := baseBackoff << (attempt - 1)
+		if expected > maxBackoff {
+			expected = maxBackoff
+		}
+		if wait < expected/2 || wait > expected {
+			t.Errorf("Expected the wait before attempt %d to be within [%v, %v], got %v", attempt, expected/2, expected, wait)
+		}
+	}
+}
+
+func TestFetchWithRetryBackoff(t *testing.T) {
+	waits := recordSleeps(t)
+	requests := 0
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	_, err := testFetcher(4).fetchWithRetry(context.Background(), discoveryEndpoint)
+	if err == nil || !strings.Contains(err.Error(), "giving up after 4 attempts") {
+		t.Errorf("Expected a descriptive error after 4 attempts, got %v", err)
+	}
+	expected := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+	if len(*waits) != len(expected) {
+		t.Fatalf("Expected waits %v, got %v", expected, *waits)
+	}
+	for i := range expected {
+		if (*waits)[i] != expected[i] {
+			t.Errorf("Expected waits %v, got %v", expected, *waits)
+			break
+		}
+	}
+}
+
+func TestFetchWithRetryConnectionReset(t *testing.T) {
+	recordSleeps(t)
+	requests := 0
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Fatalf("Could not hijack the connection: %v", err)
+			}
+			conn.Close()
+			return
+		}
+		w.Write([]byte("[]"))
+	})
+
+	if _, err := testFetcher(3).fetchWithRetry(context.Background(), discoveryEndpoint); err != nil {
+		t.Fatalf("Expected the dropped connection to be retried, got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+}
+
+func TestStreamWithRetry(t *testing.T) {
+	recordSleeps(t)
+	t.Run("Retries a body that breaks off", func(t *testing.T) {
+		requests := 0
+		f := testFetcher(3)
+		f.client = stubDoer(func(req *http.Request) (*http.Response, error) {
+			requests++
+			resp := stubResponse(http.StatusOK, `{"name": "a"}`)
+			if requests == 1 {
+				resp.Body = io.NopCloser(io.MultiReader(strings.NewReader(`{"na`), iotest.ErrReader(io.ErrUnexpectedEOF)))
+			}
+			return resp, nil
+		})
+		var decoded struct {
+			Name string `json:"name"`
+		}
+		err := f.streamWithRetry(context.Background(), discoveryEndpoint, func(body io.Reader) error {
+			return json.NewDecoder(body).Decode(&decoded)
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if requests != 2 || decoded.Name != "a" {
+			t.Errorf("Expected the second response to be decoded after 2 requests, got %q after %d", decoded.Name, requests)
+		}
+	})
+
+	t.Run("Does not retry a body that cannot be decoded", func(t *testing.T) {
+		requests := 0
+		f := testFetcher(3)
+		f.client = stubDoer(func(req *http.Request) (*http.Response, error) {
+			requests++
+			return stubResponse(http.StatusOK, "<html>"), nil
+		})
+		err := f.streamWithRetry(context.Background(), discoveryEndpoint, func(body io.Reader) error {
+			return json.NewDecoder(body).Decode(&struct{}{})
+		})
+		if err == nil || requests != 1 {
+			t.Errorf("Expected an error after a single request, got %v after %d", err, requests)
+		}
+	})
+}
+
+func TestFetchPausesOnExhaustedQuota(t *testing.T) {
+	t.Run("Waits for Retry-After once the quota is used up", func(t *testing.T) {
+		clock := fakeClock(t)
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("Retry-After", "20")
+			w.Write([]byte("[]"))
+		})
+		f := testFetcher(1)
+
+		f.fetchWithRetry(context.Background(), discoveryEndpoint)
+		start := *clock
+		f.fetchWithRetry(context.Background(), discoveryEndpoint)
+		if elapsed := clock.Sub(start); elapsed != 20*time.Second {
+			t.Errorf("Expected the second request to wait 20s, waited %v", elapsed)
+		}
+	})
+
+	t.Run("Waits a minute without Retry-After", func(t *testing.T) {
+		clock := fakeClock(t)
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Write([]byte("[]"))
+		})
+		f := testFetcher(1)
+
+		f.fetchWithRetry(context.Background(), discoveryEndpoint)
+		start := *clock
+		f.fetchWithRetry(context.Background(), discoveryEndpoint)
+		if elapsed := clock.Sub(start); elapsed != quotaPause {
+			t.Errorf("Expected the second request to wait %v, waited %v", quotaPause, elapsed)
+		}
+	})
+}
+
+func TestDecodeResponseLogsTheBody(t *testing.T) {
+	var logs strings.Builder
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+	})
+
+	body := []byte("<html>" + strings.Repeat("x", 500) + "</html>")
+	var projects []Project
+	if err := decodeResponse("https://libraries.io/api/search?api_key=secret", body, &projects); err == nil {
+		t.Fatal("Expected a decoding error")
+	}
+	expected := `level=DEBUG msg="Could not decode response" url=https://libraries.io/api/search bytes=513 body=<html>xxx`
+	if !strings.Contains(logs.String(), expected) {
+		t.Errorf("Expected the logs to contain %s, got:\n%s", expected, logs.String())
+	}
+	if strings.Contains(logs.String(), "</html>") {
+		t.Errorf("Expected only the start of the body to be logged, got:\n%s", logs.String())
+	}
+}
+
+func TestDecodeLibrariesIOResponse(t *testing.T) {
+	for _, test := range []struct {
+		name, body string
+		expected   string
+	}{
+		{"Reports an error object", `{"error": "Invalid API key"}`, `with the error "Invalid API key"`},
+		{"Reports an error object that is not a string", `{"error": {"code": 42}}`, `with the error "{\"code\": 42}"`},
+		{"Reports null", "null", `expected a JSON array, got "null"`},
+		{"Reports an object in place of an array", `{"projects": []}`, `expected a JSON array, got "{\"projects\": []}"`},
+		{"Reports an empty body", "", `expected a JSON array, got ""`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var projects []Project
+			err := decodeLibrariesIOResponse(discoveryEndpoint, []byte(test.body), &projects)
+			if !errors.Is(err, ErrUnexpectedResponse) || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("Expected ErrUnexpectedResponse with %s, got %v", test.expected, err)
+			}
+		})
+	}
+
+	t.Run("Reports an array in place of an object", func(t *testing.T) {
+		var project Project
+		err := decodeLibrariesIOResponse(discoveryEndpoint, []byte(`[{"name": "left-pad"}]`), &project)
+		if !errors.Is(err, ErrUnexpectedResponse) || !strings.Contains(err.Error(), "expected a JSON object") {
+			t.Errorf("Expected ErrUnexpectedResponse for an object, got %v", err)
+		}
+	})
+
+	t.Run("Includes the start of a body that cannot be decoded", func(t *testing.T) {
+		var projects []Project
+		err := decodeLibrariesIOResponse(discoveryEndpoint, []byte(`[{"name": 42}]`), &projects)
+		if err == nil || !strings.Contains(err.Error(), `in "[{\"name\": 42}]"`) {
+			t.Errorf("Expected the body in the error, got %v", err)
+		}
+	})
+
+	t.Run("Decodes packages that mention an error", func(t *testing.T) {
+		var project Project
+		body := `{"name": "error", "description": "Throws an \"error\"", "platform": "NPM"}`
+		if err := decodeLibrariesIOResponse(discoveryEndpoint, []byte(body), &project); err != nil || project.Name != "error" {
+			t.Errorf("Expected the package to be decoded, got %+v and %v", project, err)
+		}
+		var projects []Project
+		if err := decodeLibrariesIOResponse(discoveryEndpoint, []byte(" []\n"), &projects); err != nil || len(projects) != 0 {
+			t.Errorf("Expected an empty page, got %v and %v", projects, err)
+		}
+	})
+}
+
+func TestWithoutAPIKey(t *testing.T) {
+	tests := map[string]string{
+		"https://libraries.io/api/search?api_key=secret&page=2": "https://libraries.io/api/search?page=2",
+		"https://libraries.io/api/NPM/left-pad":                 "https://libraries.io/api/NPM/left-pad",
+		// A control character makes it an invalid URL
+		"https://libraries.io/api/search?api_key=secret&q=left\npad": "https://libraries.io/api/search?api_key=REDACTED&q=left\npad",
+	}
+	for query, expected := range tests {
+		if actual := withoutAPIKey(query); actual != expected {
+			t.Errorf("Expected %s to become %s, got %s", query, expected, actual)
+		}
+	}
+}
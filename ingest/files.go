@@ -0,0 +1,211 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IngestFromFiles reads packages from local JSON files in the shape of a libraries.io search response, an array of
+// packages, and writes them to outPath in the format chosen in opts, through the same writers as Ingest. This makes it
+// possible to work on the output and the graph without an API key or network access. Packages are cleaned up like the
+// ones Ingest downloads, so licenses become SPDX identifiers where possible and prereleases are removed unless
+// opts.IncludePrerelease is set, and the filters, columns and opts.MaxPackages apply as they do for Ingest. The
+// options that only shape requests, such as opts.PerPage, do not.
+//
+// Each path is a file, a glob such as data/*.json or a directory, of which all .json and .json.gz files are read.
+// Files that are gzip-compressed are decompressed whatever their name. Files are read in order, each one streamed
+// rather than loaded as a whole, and a package that is in more than one of them is only written the first time. A
+// file that cannot be decoded fails the ingestion with an error naming the file and line. ctx is checked between
+// packages, and when it is done, the previous output is left untouched. Like Ingest, it describes the output in the
+// manifest.json next to it.
+func IngestFromFiles(ctx context.Context, opts Options, paths []string, outPath string) (Stats, error) {
+	opts, err := opts.withDefaultsExceptAPIKey()
+	if err != nil {
+		return Stats{}, err
+	}
+	files, err := expandInputPaths(paths)
+	if err != nil {
+		return Stats{}, err
+	}
+	stats := newStatsCollector()
+	filter := newPackageFilter(opts)
+	// Already validated by withDefaultsExceptAPIKey
+	columns, _ := csvColumnIndices(opts.Columns)
+	_, err = writeProjectsFileAt(ctx, outPath, opts.Format, columns, resumePoint{}, opts.CompressionLevel, func(writer projectWriter, _ *outputFile) (int, error) {
+		writer = withProgress(writer, opts.Progress, 0, packagesTotal(opts, 1))
+		written := 0
+		already := packageSet{}
+		for _, file := range files {
+			// Every file counts as a page in the stats
+			packages, rows := 0, 0
+			err := ingestFile(ctx, file, func(project Project) (bool, error) {
+				if !already.add(project) {
+					stats.duplicate(1)
+					return true, nil
+				}
+				project = withPrereleases(normalizeProject(project), opts.IncludePrerelease)
+				projects, filtered := filter.keep([]Project{project})
+				stats.filteredOut(filtered)
+				if len(projects) == 0 {
+					return true, nil
+				}
+				n, err := writer.writeProjects(projects)
+				if err != nil {
+					return false, err
+				}
+				packages++
+				rows += n
+				return opts.MaxPackages <= 0 || written+packages < opts.MaxPackages, nil
+			})
+			written += packages
+			stats.page(packages, rows)
+			if err != nil || (opts.MaxPackages > 0 && written >= opts.MaxPackages) {
+				return written, err
+			}
+		}
+		return written, nil
+	})
+	parameters := opts.manifestParameters(nil)
+	// No pages are requested
+	parameters.PerPage = 0
+	parameters.Inputs = files
+	run := manifestRun{source: SourceFiles, parameters: parameters, format: opts.Format, files: []string{outPath}}
+	return finish(ctx, outPath, run, stats.stats(), err)
+}
+
+// IngestFile is IngestFromFiles for a single file, such as a saved libraries.io search response or a sample data set,
+// written as CSV, for callers that do not need the stats.
+func IngestFile(ctx context.Context, path, outPath string) error {
+	_, err := IngestFromFiles(ctx, Options{}, []string{path}, outPath)
+	return err
+}
+
+// expandInputPaths turns the paths given to IngestFromFiles into a list of files. Globs are expanded and directories
+// replaced by the .json files in them, compressed or not, both sorted by name. The manifest of earlier outputs in a
+// directory is not a file of packages and is skipped.
+func expandInputPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		if strings.ContainsAny(path, "*?[") {
+			matches, err := filepath.Glob(path)
+			if err != nil {
+				return nil, fmt.Errorf("expanding %s: %w", path, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", path)
+			}
+			files = append(files, matches...)
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading directory %s: %w", path, err)
+		}
+		var matches []string
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.EqualFold(filepath.Ext(TrimCompressedExt(entry.Name())), ".json") && entry.Name() != ManifestName {
+				matches = append(matches, filepath.Join(path, entry.Name()))
+			}
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// ingestFile decodes the array of packages in the file at path one package at a time and calls visit with each one,
+// until visit returns false or an error or ctx is done.
+func ingestFile(ctx context.Context, path string, visit func(project Project) (more bool, err error)) error {
+	f, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	// start is where the value being decoded begins
+	var start int64
+	fail := func(err error) error {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("decoding %s at line %d: %w", path, lineAt(path, errorOffset(err, start, decoder)), err)
+	}
+	if token, err := decoder.Token(); err != nil {
+		return fail(err)
+	} else if token != json.Delim('[') {
+		return fail(errors.New("expected an array of packages"))
+	}
+
+	for decoder.More() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var project Project
+		start = decoder.InputOffset()
+		if err := decoder.Decode(&project); err != nil {
+			return fail(err)
+		}
+		if more, err := visit(project); err != nil || !more {
+			return err
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
+// errorOffset returns the byte offset in the (decompressed) file at which decoding failed, preferring the offset the
+// error reports. Type errors report it relative to the start of the value that was decoded.
+func errorOffset(err error, start int64, decoder *json.Decoder) int64 {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return syntaxErr.Offset
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return start + typeErr.Offset
+	}
+	return decoder.InputOffset()
+}
+
+// lineAt returns the line of the file at path that contains the given byte offset, counting from 1, after
+// decompressing it if it is compressed. It rereads the file, which is fine since it is only needed to report an error.
+func lineAt(path string, offset int64) int {
+	f, err := openInput(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	line := 1
+	buf := make([]byte, outputBufferSize)
+	for offset > 0 {
+		n, err := f.Read(buf)
+		if int64(n) > offset {
+			n = int(offset)
+		}
+		line += bytes.Count(buf[:n], []byte{'\n'})
+		offset -= int64(n)
+		if err != nil {
+			break
+		}
+	}
+	return line
+}
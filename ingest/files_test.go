@@ -0,0 +1,219 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeInputFiles creates the given files with their contents in a new directory and returns it.
+func writeInputFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatalf("Could not create the directory of %s: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Could not write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestIngestFromFiles(t *testing.T) {
+	dir := writeInputFiles(t, map[string]string{
+		"1.json":    `[{"name": "left-pad", "platform": "NPM", "versions": [{"number": "1.0.0"}]}, {"name": "right-pad"}]`,
+		"2.json":    `[{"name": "tape", "platform": "NPM"}]`,
+		"notes.txt": `not JSON`,
+	})
+
+	tests := map[string][]string{
+		"Reads all JSON files of a directory": {dir},
+		"Expands globs":                       {filepath.Join(dir, "*.json")},
+		"Reads single files in order":         {filepath.Join(dir, "1.json"), filepath.Join(dir, "2.json")},
+		"Writes packages read twice once":     {filepath.Join(dir, "1.json"), dir},
+	}
+	for name, paths := range tests {
+		t.Run(name, func(t *testing.T) {
+			outPath := filepath.Join(t.TempDir(), "result.csv")
+			stats, err := IngestFromFiles(context.Background(), Options{}, paths, outPath)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if stats.Packages != 3 {
+				t.Errorf("Expected 3 packages, got %d", stats.Packages)
+			}
+			records := readCSV(t, outPath)
+			var names []string
+			for _, record := range records[1:] {
+				names = append(names, record[0])
+			}
+			if actual := strings.Join(names, ","); actual != "left-pad,right-pad,tape" {
+				t.Errorf("Expected the packages of both files in order, got %s", actual)
+			}
+			if row := strings.Join(records[1], "|"); row != "left-pad|NPM|||||||1.0.0|||||||||pkg:npm/left-pad" {
+				t.Errorf("Expected the row to match the online format, got %s", row)
+			}
+		})
+	}
+
+	t.Run("Reports the file and line of decode errors", func(t *testing.T) {
+		dir := writeInputFiles(t, map[string]string{
+			"broken.json": "[\n  {\"name\": \"fine\"},\n  {\"name\": 42}\n]",
+		})
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+		_, err := IngestFromFiles(context.Background(), Options{}, []string{filepath.Join(dir, "broken.json")}, outPath)
+		if err == nil || !strings.Contains(err.Error(), "broken.json at line 3") {
+			t.Errorf("Expected an error pointing at line 3 of broken.json, got %v", err)
+		}
+		if _, statErr := os.Stat(outPath); !os.IsNotExist(statErr) {
+			t.Errorf("Expected the partial output to be removed, got %v", statErr)
+		}
+	})
+
+	t.Run("Reports the line of syntax errors", func(t *testing.T) {
+		dir := writeInputFiles(t, map[string]string{
+			"syntax.json": "[\n  {\"name\": \"fine\"},\n\n  {\"name\" \"missing colon\"}\n]",
+		})
+		_, err := IngestFromFiles(context.Background(), Options{}, []string{filepath.Join(dir, "syntax.json")}, filepath.Join(t.TempDir(), "result.csv"))
+		if err == nil || !strings.Contains(err.Error(), "syntax.json at line 4") {
+			t.Errorf("Expected an error pointing at line 4 of syntax.json, got %v", err)
+		}
+	})
+
+	t.Run("Rejects files that are not an array", func(t *testing.T) {
+		dir := writeInputFiles(t, map[string]string{"object.json": `{"name": "left-pad"}`})
+		_, err := IngestFromFiles(context.Background(), Options{}, []string{filepath.Join(dir, "object.json")}, filepath.Join(t.TempDir(), "result.csv"))
+		if err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("Expected an error pointing at line 1, got %v", err)
+		}
+	})
+
+	t.Run("Rejects truncated files", func(t *testing.T) {
+		dir := writeInputFiles(t, map[string]string{"truncated.json": "[\n{\"name\": \"left-pad\"},\n"})
+		_, err := IngestFromFiles(context.Background(), Options{}, []string{filepath.Join(dir, "truncated.json")}, filepath.Join(t.TempDir(), "result.csv"))
+		if err == nil || !strings.Contains(err.Error(), "truncated.json") {
+			t.Errorf("Expected an error naming the file, got %v", err)
+		}
+	})
+
+	t.Run("Rejects missing paths and empty globs", func(t *testing.T) {
+		for _, path := range []string{filepath.Join(dir, "missing.json"), filepath.Join(dir, "*.csv")} {
+			if _, err := IngestFromFiles(context.Background(), Options{}, []string{path}, filepath.Join(t.TempDir(), "result.csv")); err == nil {
+				t.Errorf("Expected an error for %s", path)
+			}
+		}
+	})
+}
+
+func TestIngestFromFilesOptions(t *testing.T) {
+	dir := writeInputFiles(t, map[string]string{
+		"1.json": `[{"name": "left-pad", "platform": "NPM", "stars": 5, "licenses": "MIT", "keywords": ["string"]},
+			{"name": "tape", "platform": "NPM", "stars": 50, "licenses": "GPL-3.0", "keywords": ["test"]},
+			{"name": "mocha", "platform": "NPM", "stars": 500, "licenses": "MIT", "keywords": ["test"]},
+			{"name": "jest", "platform": "NPM", "stars": 5000, "licenses": "MIT", "keywords": ["test"]}]`,
+	})
+
+	t.Run("Applies the filters and columns", func(t *testing.T) {
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+		opts := Options{Keywords: []string{"test"}, MinStars: 10, ExcludeLicenses: []string{"GPL-3.0"}, Columns: []string{"name", "stars"}}
+		stats, err := IngestFromFiles(context.Background(), opts, []string{dir}, outPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stats.Packages != 2 || stats.Filtered != 2 {
+			t.Errorf("Expected 2 packages written and 2 filtered out, got %+v", stats)
+		}
+		var rows []string
+		for _, record := range readCSV(t, outPath) {
+			rows = append(rows, strings.Join(record, "|"))
+		}
+		if actual := strings.Join(rows, ","); actual != "name|stars,mocha|500,jest|5000" {
+			t.Errorf("Expected the name and stars of mocha and jest, got %s", actual)
+		}
+	})
+
+	t.Run("Stops after MaxPackages", func(t *testing.T) {
+		outPath := filepath.Join(t.TempDir(), "result.ndjson")
+		stats, err := IngestFromFiles(context.Background(), Options{MaxPackages: 3, Format: FormatNDJSON}, []string{dir}, outPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		projects, err := ReadProjects(outPath)
+		if err != nil || stats.Packages != 3 || len(projects) != 3 || projects[2].Name != "mocha" {
+			t.Errorf("Expected the first 3 packages as NDJSON, got %d, %+v and %v", stats.Packages, projects, err)
+		}
+	})
+
+	t.Run("Removes prereleases unless they are included", func(t *testing.T) {
+		dir := writeInputFiles(t, map[string]string{
+			"next.json": `[{"name": "next", "platform": "NPM", "latest_release_number": "8.0.0-beta.1",
+				"versions": [{"number": "7.0.0"}, {"number": "8.0.0-beta.1"}]}]`,
+		})
+		for include, expected := range map[bool]string{false: "7.0.0|7.0.0", true: "8.0.0-beta.1|7.0.0;8.0.0-beta.1"} {
+			outPath := filepath.Join(t.TempDir(), "result.csv")
+			opts := Options{IncludePrerelease: include, Columns: []string{"latest_release_number", "versions"}}
+			if _, err := IngestFromFiles(context.Background(), opts, []string{dir}, outPath); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if row := strings.Join(readCSV(t, outPath)[1], "|"); row != expected {
+				t.Errorf("Expected %s with IncludePrerelease %t, got %s", expected, include, row)
+			}
+		}
+	})
+
+	t.Run("Rejects invalid options", func(t *testing.T) {
+		_, err := IngestFromFiles(context.Background(), Options{Columns: []string{"nope"}}, []string{dir}, filepath.Join(t.TempDir(), "result.csv"))
+		if err == nil {
+			t.Error("Expected an error for an unknown column")
+		}
+	})
+}
+
+func TestIngestFromFilesCancellation(t *testing.T) {
+	dir := writeInputFiles(t, map[string]string{"1.json": `[{"name": "left-pad"}, {"name": "right-pad"}]`})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+
+	stats, err := IngestFromFiles(ctx, Options{}, []string{dir}, outPath)
+	if !errors.Is(err, ErrInterrupted) {
+		t.Errorf("Expected ErrInterrupted, got %v", err)
+	}
+	if stats.Packages != 0 {
+		t.Errorf("Expected no packages after the cancellation, got %d", stats.Packages)
+	}
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no output, got %v", err)
+	}
+}
+
+func TestIngestFileMatchesOnlineIngest(t *testing.T) {
+	fixture := filepath.Join("testdata", "libraries-io-search.json")
+	data, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatalf("Could not read the fixture: %v", err)
+	}
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	})
+	dir := t.TempDir()
+	onlinePath, offlinePath := filepath.Join(dir, "online.csv"), filepath.Join(dir, "offline.csv")
+
+	if _, err := Ingest(Options{Platform: "NPM", APIKey: "secret"}, onlinePath); err != nil {
+		t.Fatalf("Expected no error from the online ingest, got %v", err)
+	}
+	if err := IngestFile(context.Background(), fixture, offlinePath); err != nil {
+		t.Fatalf("Expected no error from the file, got %v", err)
+	}
+	online, _ := os.ReadFile(onlinePath)
+	offline, _ := os.ReadFile(offlinePath)
+	if string(online) != string(offline) {
+		t.Errorf("Expected the same output as the online ingest, got\n%s\ninstead of\n%s", offline, online)
+	}
+}
@@ -0,0 +1,108 @@
+package ingest
+
+import (
+	"strings"
+	"time"
+)
+
+// packageFilter drops the packages that do not meet all criteria of Options.Keywords, Languages, MinStars, MinRank and
+// Since, or that Options.ExcludeLicenses leaves out. Its zero value keeps every package.
+type packageFilter struct {
+	// keywords and languages are lower case. A package needs one of the keywords, if there are any, and one of the
+	// languages.
+	keywords  map[string]bool
+	languages map[string]bool
+	minStars  int
+	minRank   int
+	licenses  licenseFilter
+	// since and includeUndated are Options.Since and IncludeUndated
+	since          time.Time
+	includeUndated bool
+}
+
+// newPackageFilter creates the filter for the criteria in opts.
+func newPackageFilter(opts Options) packageFilter {
+	return packageFilter{
+		keywords:  lowerSet(opts.Keywords),
+		languages: lowerSet(opts.Languages),
+		minStars:  opts.MinStars,
+		minRank:   opts.MinRank,
+		licenses:  newLicenseFilter(opts.ExcludeLicenses),
+
+		since:          opts.Since,
+		includeUndated: opts.IncludeUndated,
+	}
+}
+
+// lowerSet returns the set of values in lower case with surrounding space trimmed, or nil if there are none.
+func lowerSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[strings.ToLower(strings.TrimSpace(value))] = true
+	}
+	return set
+}
+
+// excludes reports whether project fails any criterion of the filter. Keywords and languages are compared regardless
+// of case. A package without a star count or rank does not meet a minimum, and one without a release time is only
+// kept after a cutoff with includeUndated.
+func (f packageFilter) excludes(project Project) bool {
+	if f.licenses.excludes(project) {
+		return true
+	}
+	if f.keywords != nil && !f.hasKeyword(project) {
+		return true
+	}
+	if f.languages != nil && !f.languages[strings.ToLower(strings.TrimSpace(project.Language))] {
+		return true
+	}
+	if f.minStars > 0 && (project.Stars == nil || *project.Stars < f.minStars) {
+		return true
+	}
+	if !f.since.IsZero() {
+		if published, ok := project.latestReleaseTime(); ok && !published.After(f.since) || !ok && !f.includeUndated {
+			return true
+		}
+	}
+	return f.minRank > 0 && (project.Rank == nil || *project.Rank < f.minRank)
+}
+
+// hasKeyword reports whether project has one of the keywords of the filter.
+func (f packageFilter) hasKeyword(project Project) bool {
+	for _, keyword := range project.Keywords {
+		if f.keywords[strings.ToLower(strings.TrimSpace(keyword))] {
+			return true
+		}
+	}
+	return false
+}
+
+// keep returns the projects the filter does not exclude, reusing the backing array of projects, and the number of
+// projects it left out.
+func (f packageFilter) keep(projects []Project) ([]Project, int) {
+	kept := projects[:0]
+	for _, project := range projects {
+		if !f.excludes(project) {
+			kept = append(kept, project)
+		}
+	}
+	return kept, len(projects) - len(kept)
+}
+
+// latestReleaseTime returns when the latest release of project was published, and whether that is known.
+func (p Project) latestReleaseTime() (time.Time, bool) {
+	return Version{PublishedAt: p.LatestReleasePublishedAt}.PublishedTime()
+}
+
+// releasedAfter reports whether any of projects has a latest release that was published after since.
+func releasedAfter(projects []Project, since time.Time) bool {
+	for _, project := range projects {
+		if published, ok := project.latestReleaseTime(); ok && published.After(since) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package ingest
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestPackageFilter(t *testing.T) {
+	count := func(n int) *int { return &n }
+	filter := newPackageFilter(Options{
+		Keywords:        []string{"crypto", "Hash"},
+		Languages:       []string{"javascript"},
+		MinStars:        100,
+		MinRank:         10,
+		ExcludeLicenses: []string{"GPL-3.0"},
+	})
+	matching := Project{Keywords: []string{"hash"}, Language: "JavaScript", Stars: count(100), Rank: count(12), Licenses: "MIT"}
+	if filter.excludes(matching) {
+		t.Fatalf("Expected %+v to meet every criterion", matching)
+	}
+
+	tests := map[string]func(project *Project){
+		"Without a keyword":      func(project *Project) { project.Keywords = []string{"pad"} },
+		"In another language":    func(project *Project) { project.Language = "TypeScript" },
+		"With too few stars":     func(project *Project) { project.Stars = count(99) },
+		"Without a star count":   func(project *Project) { project.Stars = nil },
+		"With too low a rank":    func(project *Project) { project.Rank = count(9) },
+		"Without a rank":         func(project *Project) { project.Rank = nil },
+		"Under excluded license": func(project *Project) { project.Licenses = "GPL-3.0" },
+	}
+	for name, fail := range tests {
+		t.Run(name, func(t *testing.T) {
+			project := matching
+			fail(&project)
+			if !filter.excludes(project) {
+				t.Errorf("Expected %+v to be excluded", project)
+			}
+		})
+	}
+
+	t.Run("Keeps every package without criteria", func(t *testing.T) {
+		if newPackageFilter(Options{}).excludes(Project{}) {
+			t.Error("Expected the empty filter to keep a package without any fields")
+		}
+	})
+}
+
+func TestIngestFilters(t *testing.T) {
+	var query map[string]string
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		query = map[string]string{"keywords": r.URL.Query().Get("keywords"), "languages": r.URL.Query().Get("languages")}
+		w.Write([]byte(`[
+			{"name": "popular", "platform": "NPM", "keywords": ["crypto"], "language": "JavaScript", "stars": 500},
+			{"name": "obscure", "platform": "NPM", "keywords": ["crypto"], "language": "JavaScript", "stars": 5},
+			{"name": "untagged", "platform": "NPM", "language": "JavaScript", "stars": 500}
+		]`))
+	})
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+
+	opts := Options{Platform: "NPM", APIKey: "secret", Keywords: []string{"crypto"}, Languages: []string{"JavaScript", "TypeScript"}, MinStars: 100}
+	stats, err := IngestContext(context.Background(), opts, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if query["keywords"] != "crypto" || query["languages"] != "JavaScript,TypeScript" {
+		t.Errorf("Expected the keywords and languages in the search, got %v", query)
+	}
+	if names := readPackageNames(t, outPath, FormatCSV); len(names) != 1 || names[0] != "popular" {
+		t.Errorf("Expected only the popular package, got %v", names)
+	}
+	if stats.Packages != 1 || stats.Filtered != 2 {
+		t.Errorf("Expected 1 package and 2 filtered, got %d and %d", stats.Packages, stats.Filtered)
+	}
+}
@@ -0,0 +1,286 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// goIndexEndpoint is the Go module index and goProxyEndpoint the module proxy the .mod files are fetched from. They
+// are variables so tests can point them at a local server.
+var (
+	goIndexEndpoint = "https://index.golang.org/index"
+	goProxyEndpoint = "https://proxy.golang.org"
+)
+
+// goIndexLimit is the largest number of records the index returns for a request.
+const goIndexLimit = 2000
+
+// goIndexRecord is a single line of the index, a module version and the time the proxy first saw it.
+type goIndexRecord struct {
+	Path      string    `json:"Path"`
+	Version   string    `json:"Version"`
+	Timestamp time.Time `json:"Timestamp"`
+}
+
+// IngestGoIndex reads the module versions the Go module index lists from since on, groups them by module and writes
+// the modules to outPath in the format chosen in opts, with the same fields as Ingest. If opts.Dependencies is set, the
+// require directives of the go.mod file of the latest release of every module are fetched from the module proxy as
+// its dependencies, at the cost of one request per module.
+//
+// The index is requested in pages of 2000 versions until it runs out or opts.MaxPages pages have been read, and at most
+// opts.MaxPackages modules are written, each with all of its versions that were read. The modules are held in memory
+// until the index has been read. opts.Platform, APIKey, ExcludeLicenses and Versions do not apply, and responses are
+// not cached.
+//
+// It returns the time to pass as since to the next run, which continues after the last version this run read, without
+// skipping or repeating any. Versions sharing the timestamp at which the run stopped are left to the next run.
+func IngestGoIndex(ctx context.Context, opts Options, since time.Time, outPath string) (Stats, time.Time, error) {
+	opts, err := opts.withDefaultsExceptAPIKey()
+	if err != nil {
+		return Stats{}, since, err
+	}
+	f := &fetcher{
+		client:      opts.HTTPClient,
+		limiter:     newRateLimiter(opts.RequestsPerMinute, 1),
+		maxAttempts: opts.MaxAttempts,
+		timeout:     opts.RequestTimeout,
+		backoff:     backoff,
+		userAgent:   userAgent,
+	}
+	stats := newStatsCollector()
+	f.stats = stats
+	parameters := opts.manifestParameters([]string{"Go"})
+	parameters.Since = formatSince(since)
+	run := manifestRun{source: SourceGoIndex, parameters: parameters, format: opts.Format, files: []string{outPath}}
+
+	var modules []Project
+	positions := make(map[string]int)
+	next, err := readGoIndex(ctx, f, since, opts.MaxPages, func(record goIndexRecord) {
+		i, ok := positions[record.Path]
+		if !ok {
+			if opts.MaxPackages > 0 && len(modules) >= opts.MaxPackages {
+				return
+			}
+			i = len(modules)
+			positions[record.Path] = i
+			modules = append(modules, Project{Name: record.Path, Platform: "Go", Language: "Go"})
+		}
+		modules[i].Versions = append(modules[i].Versions, Version{
+			Number:      record.Version,
+			PublishedAt: record.Timestamp.UTC().Format(time.RFC3339Nano),
+		})
+	})
+	if err != nil {
+		return finishGoIndex(ctx, run, stats, since, err)
+	}
+	for i := range modules {
+		modules[i] = withLatestRelease(modules[i], opts.IncludePrerelease)
+	}
+	if opts.Dependencies {
+		if err := fetchGoModRequires(ctx, opts, modules, f); err != nil {
+			return finishGoIndex(ctx, run, stats, since, err)
+		}
+	}
+
+	// Already validated by withDefaultsExceptAPIKey
+	columns, _ := csvColumnIndices(opts.Columns)
+	_, err = writeProjectsFileAt(ctx, outPath, opts.Format, columns, resumePoint{}, opts.CompressionLevel, func(writer projectWriter, _ *outputFile) (int, error) {
+		writer = withProgress(writer, opts.Progress, 0, len(modules))
+		rows, err := writer.writeProjects(modules)
+		if err != nil {
+			return 0, err
+		}
+		stats.page(len(modules), rows)
+		return len(modules), nil
+	})
+	if err == nil {
+		slog.Debug("Read the Go module index", "since", since, "next_since", next)
+		since = next
+	}
+	return finishGoIndex(ctx, run, stats, since, err)
+}
+
+// finishGoIndex is finish for IngestGoIndex, which also returns the since of the next run.
+func finishGoIndex(ctx context.Context, run manifestRun, stats *statsCollector, next time.Time, err error) (Stats, time.Time, error) {
+	collected, err := finish(ctx, run.files[0], run, stats.stats(), err)
+	return collected, next, err
+}
+
+// readGoIndex requests pages of the index from since on and calls visit for every record, until the index runs out or
+// maxPages pages have been read, if maxPages is positive. It returns the since of the next run.
+//
+// The next page is requested from the timestamp of the last record of the page before, which the index includes, so
+// the records with that timestamp are held back until the next page shows whether more of them follow and which it
+// repeats. If the run stops before the end of the index, the held back records are dropped and their timestamp is
+// returned, so that the next run reads all of them. At the end of the index, all records have been visited and the
+// next run starts right after the last one.
+func readGoIndex(ctx context.Context, f *fetcher, since time.Time, maxPages int, visit func(record goIndexRecord)) (time.Time, error) {
+	// pending are the records at the timestamp since, which have not been visited yet
+	var pending []goIndexRecord
+	seen := make(map[string]bool)
+	for page := 1; maxPages <= 0 || page <= maxPages; page++ {
+		records, err := fetchGoIndexPage(ctx, f, since)
+		if err != nil {
+			return since, fmt.Errorf("fetching the Go module index since %s: %w", since.Format(time.RFC3339Nano), err)
+		}
+		progressed := false
+		for _, record := range records {
+			key := record.Path + "@" + record.Version
+			if !record.Timestamp.After(since) && seen[key] {
+				continue
+			}
+			progressed = true
+			if record.Timestamp.After(since) {
+				for _, held := range pending {
+					visit(held)
+				}
+				pending, seen = pending[:0], make(map[string]bool)
+				since = record.Timestamp
+			}
+			pending = append(pending, record)
+			seen[key] = true
+		}
+		if len(records) < goIndexLimit {
+			for _, held := range pending {
+				visit(held)
+			}
+			if len(pending) == 0 {
+				return since, nil
+			}
+			return since.Add(time.Nanosecond), nil
+		}
+		if !progressed {
+			return since, fmt.Errorf("more than %d module versions share the timestamp %s in the Go module index",
+				goIndexLimit, since.Format(time.RFC3339Nano))
+		}
+	}
+	return since, nil
+}
+
+// fetchGoIndexPage requests the records of the index from since on and decodes them line by line.
+func fetchGoIndexPage(ctx context.Context, f *fetcher, since time.Time) ([]goIndexRecord, error) {
+	params := url.Values{}
+	params.Set("since", since.UTC().Format(time.RFC3339Nano))
+	params.Set("limit", strconv.Itoa(goIndexLimit))
+	var records []goIndexRecord
+	err := f.streamWithRetry(ctx, goIndexEndpoint+"?"+params.Encode(), func(body io.Reader) error {
+		records = records[:0]
+		decoder := json.NewDecoder(body)
+		for {
+			var record goIndexRecord
+			if err := decoder.Decode(&record); errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("decoding the Go module index: %w", err)
+			}
+			records = append(records, record)
+		}
+	})
+	return records, err
+}
+
+// fetchGoModRequires fills in the dependencies of the latest release of each module from its go.mod file, with
+// opts.Workers concurrent requests. Files the proxy does not have, e.g. of retracted versions, are skipped with a
+// warning.
+func fetchGoModRequires(ctx context.Context, opts Options, modules []Project, f *fetcher) error {
+	return forEachProject(ctx, opts.Workers, modules, func(ctx context.Context, module *Project) error {
+		return fetchGoModRequiresOf(ctx, f, module)
+	})
+}
+
+// fetchGoModRequiresOf fills in the dependencies of the latest release of a single module, if it has one, as
+// fetchGoModRequires does.
+func fetchGoModRequiresOf(ctx context.Context, f *fetcher, module *Project) error {
+	if module.LatestReleaseNumber == "" {
+		return nil
+	}
+	query := goProxyEndpoint + "/" + escapeModulePath(module.Name) + "/@v/" +
+		escapeModulePath(module.LatestReleaseNumber) + ".mod"
+	body, err := f.fetchWithRetry(ctx, query)
+	if isGoProxyNotFound(err) {
+		slog.Warn("go.mod not found, skipping its dependencies", "platform", "Go", "package", module.Name,
+			"version", module.LatestReleaseNumber)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fetching go.mod of %s %s: %w", module.Name, module.LatestReleaseNumber, err)
+	}
+	module.Dependencies = parseGoModRequires(body)
+	return nil
+}
+
+// isGoProxyNotFound reports whether err is the answer of the module proxy for a module or version it does not have,
+// which is 404 Not Found or, for modules it refuses to serve, 410 Gone.
+func isGoProxyNotFound(err error) bool {
+	var statusErr *statusError
+	return errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusGone)
+}
+
+// escapeModulePath escapes a module path or version for the module proxy, which replaces every upper-case letter by
+// an exclamation mark and the lower-case letter, so that paths differing in case stay apart on case-insensitive file
+// systems.
+func escapeModulePath(path string) string {
+	var escaped strings.Builder
+	for _, r := range path {
+		if 'A' <= r && r <= 'Z' {
+			escaped.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// parseGoModRequires returns the modules a go.mod file requires, both from single require directives and from
+// require blocks. Requirements marked // indirect get the kind indirect, the others runtime.
+func parseGoModRequires(data []byte) []Dependency {
+	var dependencies []Dependency
+	// block is the directive of the block the line is in, if any
+	block := ""
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		code, comment, _ := strings.Cut(string(line), "//")
+		fields := strings.Fields(code)
+		switch {
+		case len(fields) == 0:
+			continue
+		case block != "":
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			if block != "require" {
+				continue
+			}
+		case len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+			continue
+		case fields[0] == "require":
+			fields = fields[1:]
+		default:
+			continue
+		}
+		if len(fields) != 2 {
+			continue
+		}
+		path := fields[0]
+		if unquoted, err := strconv.Unquote(path); err == nil {
+			path = unquoted
+		}
+		kind := "runtime"
+		if strings.HasPrefix(strings.TrimSpace(comment), "indirect") {
+			kind = "indirect"
+		}
+		dependencies = append(dependencies, Dependency{Name: path, Platform: "Go", Requirements: fields[1], Kind: kind})
+	}
+	return dependencies
+}
@@ -0,0 +1,208 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useGoIndexTestServer points the Go module index and proxy endpoints at a local server for the duration of the test.
+// The index serves records like the real one, from the since parameter on up to the limit, and the proxy serves the
+// files in mods, such as go.mod files and version lists, by their escaped path.
+func useGoIndexTestServer(t *testing.T, records []goIndexRecord, mods map[string]string) *[]string {
+	t.Helper()
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index" {
+			mod, ok := mods[r.URL.EscapedPath()]
+			if !ok {
+				w.WriteHeader(http.StatusGone)
+				return
+			}
+			fmt.Fprint(w, mod)
+			return
+		}
+		queries = append(queries, r.URL.Query().Get("since"))
+		since, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("since"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			if !record.Timestamp.Before(since) && limit > 0 {
+				encoder.Encode(record)
+				limit--
+			}
+		}
+	}))
+	previousIndex, previousProxy := goIndexEndpoint, goProxyEndpoint
+	goIndexEndpoint, goProxyEndpoint = server.URL+"/index", server.URL
+	t.Cleanup(func() {
+		goIndexEndpoint, goProxyEndpoint = previousIndex, previousProxy
+		server.Close()
+	})
+	return &queries
+}
+
+// goIndexStart is the timestamp of the first record of the test indices.
+var goIndexStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// indexWithSharedTimestamp returns an index whose first page ends in the middle of three records sharing a timestamp.
+func indexWithSharedTimestamp() []goIndexRecord {
+	var records []goIndexRecord
+	for i := 0; i < goIndexLimit-1; i++ {
+		records = append(records, goIndexRecord{
+			Path:      fmt.Sprintf("example.com/m%d", i),
+			Version:   "v1.0.0",
+			Timestamp: goIndexStart.Add(time.Duration(i) * time.Second),
+		})
+	}
+	shared := goIndexStart.Add(time.Hour)
+	for _, path := range []string{"example.com/a", "example.com/b", "example.com/c"} {
+		records = append(records, goIndexRecord{Path: path, Version: "v1.0.0", Timestamp: shared})
+	}
+	return records
+}
+
+func TestReadGoIndex(t *testing.T) {
+	recordSleeps(t)
+	records := indexWithSharedTimestamp()
+	shared := records[len(records)-1].Timestamp
+
+	t.Run("Reads records sharing a timestamp across pages once", func(t *testing.T) {
+		queries := useGoIndexTestServer(t, records, nil)
+		var visited []goIndexRecord
+		next, err := readGoIndex(context.Background(), testFetcher(1), goIndexStart, 0, func(record goIndexRecord) {
+			visited = append(visited, record)
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !slices.Equal(visited, records) {
+			t.Errorf("Expected all %d records once, got %d", len(records), len(visited))
+		}
+		if expected := shared.Add(time.Nanosecond); !next.Equal(expected) {
+			t.Errorf("Expected the next run to start at %v, got %v", expected, next)
+		}
+		if expected := []string{goIndexStart.Format(time.RFC3339Nano), shared.Format(time.RFC3339Nano)}; !slices.Equal(*queries, expected) {
+			t.Errorf("Expected the queries %v, got %v", expected, *queries)
+		}
+	})
+
+	t.Run("Leaves the records at the last timestamp to the next run", func(t *testing.T) {
+		useGoIndexTestServer(t, records, nil)
+		var visited []goIndexRecord
+		visit := func(record goIndexRecord) {
+			visited = append(visited, record)
+		}
+		next, err := readGoIndex(context.Background(), testFetcher(1), goIndexStart, 1, visit)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(visited) != goIndexLimit-1 || !next.Equal(shared) {
+			t.Errorf("Expected %d records and the next run to start at %v, got %d and %v", goIndexLimit-1, shared, len(visited), next)
+		}
+		if _, err := readGoIndex(context.Background(), testFetcher(1), next, 0, visit); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !slices.Equal(visited, records) {
+			t.Errorf("Expected all %d records once over both runs, got %d", len(records), len(visited))
+		}
+	})
+
+	t.Run("Fails when a page holds only a single timestamp", func(t *testing.T) {
+		crowded := make([]goIndexRecord, goIndexLimit+1)
+		for i := range crowded {
+			crowded[i] = goIndexRecord{Path: fmt.Sprintf("example.com/m%d", i), Version: "v1.0.0", Timestamp: goIndexStart}
+		}
+		useGoIndexTestServer(t, crowded, nil)
+		_, err := readGoIndex(context.Background(), testFetcher(1), goIndexStart, 0, func(goIndexRecord) {})
+		if err == nil || !strings.Contains(err.Error(), "share the timestamp") {
+			t.Errorf("Expected an error about the shared timestamp, got %v", err)
+		}
+	})
+}
+
+func TestIngestGoIndex(t *testing.T) {
+	recordSleeps(t)
+	at := func(minutes int) time.Time {
+		return goIndexStart.Add(time.Duration(minutes) * time.Minute)
+	}
+	records := []goIndexRecord{
+		{Path: "github.com/Foo/bar", Version: "v1.0.0", Timestamp: at(0)},
+		{Path: "example.com/gone", Version: "v0.1.0", Timestamp: at(1)},
+		{Path: "github.com/Foo/bar", Version: "v1.1.0", Timestamp: at(2)},
+		{Path: "github.com/Foo/bar", Version: "v2.0.0-rc.1", Timestamp: at(3)},
+	}
+	mods := map[string]string{
+		"/github.com/!foo/bar/@v/v1.1.0.mod": "module github.com/Foo/bar\n\ngo 1.21\n\n" +
+			"require example.com/single v1.2.3\n\n" +
+			"require (\n\texample.com/direct v0.1.0\n\t\"example.com/quoted\" v1.0.0 // indirect\n)\n\n" +
+			"replace (\n\texample.com/direct => ../direct\n)\n",
+	}
+	useGoIndexTestServer(t, records, mods)
+	outPath := filepath.Join(t.TempDir(), "go.csv")
+
+	opts := Options{Dependencies: true, Workers: 1}
+	stats, next, err := IngestGoIndex(context.Background(), opts, goIndexStart, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 2 {
+		t.Errorf("Expected 2 packages, got %+v", stats)
+	}
+	if expected := at(3).Add(time.Nanosecond); !next.Equal(expected) {
+		t.Errorf("Expected the next run to start at %v, got %v", expected, next)
+	}
+
+	rows := readCSV(t, outPath)
+	if len(rows) != 3 {
+		t.Fatalf("Expected a header and two rows, got %d rows", len(rows))
+	}
+
+	t.Run("Groups versions by module and reads the dependencies from go.mod", func(t *testing.T) {
+		row := strings.Join(rows[1], "|")
+		expected := "github.com/Foo/bar|Go|||Go||v1.1.0|2020-01-01T00:02:00Z|v1.0.0;v1.1.0|" +
+			"example.com/single@v1.2.3;example.com/direct@v0.1.0;example.com/quoted@v1.0.0||||||||pkg:golang/github.com/Foo/bar@v1.1.0"
+		if row != expected {
+			t.Errorf("Expected row %s, got %s", expected, row)
+		}
+	})
+
+	t.Run("Skips the dependencies of modules without a go.mod", func(t *testing.T) {
+		row := strings.Join(rows[2], "|")
+		expected := "example.com/gone|Go|||Go||v0.1.0|2020-01-01T00:01:00Z|v0.1.0|||||||||pkg:golang/example.com/gone@v0.1.0"
+		if row != expected {
+			t.Errorf("Expected row %s, got %s", expected, row)
+		}
+	})
+}
+
+func TestParseGoModRequires(t *testing.T) {
+	mod := "module example.com/m\n\nrequire (\n\texample.com/a v1.0.0\n\texample.com/b v0.2.0 // indirect\n)\n" +
+		"exclude example.com/a v0.9.0\nrequire example.com/c v1.0.0 // a comment\n"
+	expected := []Dependency{
+		{Name: "example.com/a", Platform: "Go", Requirements: "v1.0.0", Kind: "runtime"},
+		{Name: "example.com/b", Platform: "Go", Requirements: "v0.2.0", Kind: "indirect"},
+		{Name: "example.com/c", Platform: "Go", Requirements: "v1.0.0", Kind: "runtime"},
+	}
+	if dependencies := parseGoModRequires([]byte(mod)); !slices.Equal(dependencies, expected) {
+		t.Errorf("Expected %v, got %v", expected, dependencies)
+	}
+}
+
+func TestEscapeModulePath(t *testing.T) {
+	if escaped := escapeModulePath("github.com/BurntSushi/toml"); escaped != "github.com/!burnt!sushi/toml" {
+		t.Errorf("Expected github.com/!burnt!sushi/toml, got %s", escaped)
+	}
+}
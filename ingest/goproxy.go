@@ -0,0 +1,99 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// goProxyLatest is the answer of the module proxy for the latest version of a module.
+type goProxyLatest struct {
+	Version string    `json:"Version"`
+	Time    time.Time `json:"Time"`
+}
+
+// IngestGoModules downloads the given modules from the Go module proxy and writes them to outPath in the format chosen
+// in opts, with the same fields as Ingest. The versions of a module are the ones the proxy lists for it, and the
+// require directives of the go.mod file of its latest release are always written as its dependencies, which takes two
+// requests per module. The proxy lists tagged versions only, and without the time they were published. A module without
+// any gets the latest version the proxy reports instead, with its time, which is usually a pseudo-version such as
+// v0.0.0-20200101000000-abcdefabcdef and so, like other prereleases, only kept with opts.IncludePrerelease. Modules the
+// proxy does not know are skipped with a warning.
+//
+// Module paths are given as in go.mod, e.g. github.com/BurntSushi/toml, and escaped for the proxy, which stands for
+// every upper-case letter with an exclamation mark and the lower-case letter. Like IngestNPM, opts.Platform, APIKey,
+// MaxPages and Versions do not apply, responses are not cached, and the modules are fetched in batches of opts.PerPage
+// with opts.Workers concurrent requests.
+func IngestGoModules(ctx context.Context, opts Options, modulePaths []string, outPath string) (Stats, error) {
+	opts, err := opts.withDefaultsExceptAPIKey()
+	if err != nil {
+		return Stats{}, err
+	}
+	f := &fetcher{
+		client:      opts.HTTPClient,
+		limiter:     newRateLimiter(opts.RequestsPerMinute, 1),
+		maxAttempts: opts.MaxAttempts,
+		timeout:     opts.RequestTimeout,
+		backoff:     backoff,
+		userAgent:   userAgent,
+	}
+	stats := newStatsCollector()
+	f.stats = stats
+	// Already validated by withDefaultsExceptAPIKey
+	columns, _ := csvColumnIndices(opts.Columns)
+	_, err = writeProjectsFileAt(ctx, outPath, opts.Format, columns, resumePoint{}, opts.CompressionLevel, func(writer projectWriter, _ *outputFile) (int, error) {
+		total := len(modulePaths)
+		if opts.MaxPackages > 0 {
+			total = min(total, opts.MaxPackages)
+		}
+		return ingestNamedPackages(ctx, withProgress(writer, opts.Progress, 0, total), opts, modulePaths, stats, func(ctx context.Context, module *Project) error {
+			return fetchGoModulePackage(ctx, f, opts, module)
+		})
+	})
+	parameters := opts.manifestParameters([]string{"Go"})
+	parameters.Packages = modulePaths
+	run := manifestRun{source: SourceGoProxy, parameters: parameters, format: opts.Format, files: []string{outPath}}
+	return finish(ctx, outPath, run, stats.stats(), err)
+}
+
+// fetchGoModule requests the versions of a module from the module proxy, falling back to its latest version if it has
+// no tagged ones. The module is returned without a platform if the proxy does not know it.
+func fetchGoModule(ctx context.Context, f *fetcher, path string, includePrerelease bool) (Project, error) {
+	base := goProxyEndpoint + "/" + escapeModulePath(path)
+	body, err := f.fetchWithRetry(ctx, base+"/@v/list")
+	if isGoProxyNotFound(err) {
+		slog.Warn("Go module not found, skipping it", "platform", "Go", "package", path)
+		return Project{}, nil
+	}
+	if err != nil {
+		return Project{}, fmt.Errorf("fetching the versions of Go module %s: %w", path, err)
+	}
+	module := Project{Name: path, Platform: "Go", Language: "Go"}
+	for _, number := range strings.Fields(string(body)) {
+		module.Versions = append(module.Versions, Version{Number: number})
+	}
+
+	if len(module.Versions) == 0 {
+		body, err := f.fetchWithRetry(ctx, base+"/@latest")
+		if isGoProxyNotFound(err) {
+			slog.Warn("Go module not found, skipping it", "platform", "Go", "package", path)
+			return Project{}, nil
+		}
+		if err != nil {
+			return Project{}, fmt.Errorf("fetching the latest version of Go module %s: %w", path, err)
+		}
+		var latest goProxyLatest
+		if err := json.Unmarshal(body, &latest); err != nil {
+			return Project{}, fmt.Errorf("decoding the latest version of Go module %s: %w", path, err)
+		}
+		version := Version{Number: latest.Version}
+		if !latest.Time.IsZero() {
+			version.PublishedAt = latest.Time.UTC().Format(time.RFC3339Nano)
+		}
+		module.Versions = []Version{version}
+	}
+	return withLatestRelease(module, includePrerelease), nil
+}
@@ -0,0 +1,70 @@
+package ingest
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIngestGoModules(t *testing.T) {
+	recordSleeps(t)
+	files := map[string]string{
+		"/github.com/!foo/bar/@v/list": "v1.0.0\nv1.1.0\nv2.0.0-rc.1\n",
+		"/github.com/!foo/bar/@v/v1.1.0.mod": "module github.com/Foo/bar\n\ngo 1.21\n\n" +
+			"require (\n\texample.com/direct v0.1.0\n\texample.com/other v1.0.0 // indirect\n)\n",
+		"/github.com/!foo/bar/@v/v2.0.0-rc.1.mod": "module github.com/Foo/bar\n",
+		"/example.com/untagged/@v/list":           "",
+		"/example.com/untagged/@latest":           `{"Version": "v0.0.0-20200101000000-abcdefabcdef", "Time": "2020-01-01T00:00:00Z"}`,
+	}
+	useGoIndexTestServer(t, nil, files)
+	modules := []string{"github.com/Foo/bar", "example.com/missing", "example.com/untagged", "github.com/Foo/bar"}
+
+	t.Run("Reads the versions from the list and the dependencies from go.mod", func(t *testing.T) {
+		outPath := filepath.Join(t.TempDir(), "go.csv")
+		stats, err := IngestGoModules(context.Background(), Options{Workers: 1}, modules, outPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stats.Packages != 2 {
+			t.Errorf("Expected the missing and the repeated module to be skipped, got %+v", stats)
+		}
+		rows := readCSV(t, outPath)
+		if len(rows) != 3 {
+			t.Fatalf("Expected a header and two rows, got %d rows", len(rows))
+		}
+		expected := "github.com/Foo/bar|Go|||Go||v1.1.0||v1.0.0;v1.1.0|example.com/direct@v0.1.0;example.com/other@v1.0.0" +
+			"||||||||pkg:golang/github.com/Foo/bar@v1.1.0"
+		if row := strings.Join(rows[1], "|"); row != expected {
+			t.Errorf("Expected row %s, got %s", expected, row)
+		}
+		if row := strings.Join(rows[2], "|"); !strings.HasPrefix(row, "example.com/untagged|Go|||Go|||||") {
+			t.Errorf("Expected the pseudo-version of the untagged module to be left out, got %s", row)
+		}
+	})
+
+	t.Run("Falls back to the latest pseudo-version of untagged modules", func(t *testing.T) {
+		outPath := filepath.Join(t.TempDir(), "go.csv")
+		opts := Options{Workers: 1, IncludePrerelease: true}
+		if _, err := IngestGoModules(context.Background(), opts, []string{"example.com/untagged"}, outPath); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		rows := readCSV(t, outPath)
+		expected := "example.com/untagged|Go|||Go||v0.0.0-20200101000000-abcdefabcdef|2020-01-01T00:00:00Z|v0.0.0-20200101000000-abcdefabcdef"
+		if row := strings.Join(rows[1], "|"); !strings.HasPrefix(row, expected) {
+			t.Errorf("Expected row %s, got %s", expected, row)
+		}
+	})
+}
+
+func TestIngestGoModulesFailure(t *testing.T) {
+	useGoIndexTestServer(t, nil, map[string]string{
+		"/example.com/broken/@v/list": "",
+		"/example.com/broken/@latest": `{"Version": "v0.0.0-`,
+	})
+	outPath := filepath.Join(t.TempDir(), "go.csv")
+
+	if _, err := IngestGoModules(context.Background(), Options{}, []string{"example.com/broken"}, outPath); err == nil {
+		t.Error("Expected an error for a truncated answer")
+	}
+}
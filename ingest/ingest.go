@@ -1 +1,674 @@
+// Package ingest collects package metadata, from the libraries.io API or local dumps of its responses, from registries
+// such as PyPI and crates.io and from Maven metadata files, so that it can later be turned into a dependency graph.
 package ingest
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIKeyEnvVar is the environment variable Ingest reads the libraries.io API key from when none is passed explicitly.
+const APIKeyEnvVar = "LIBRARIESIO_API_KEY"
+
+// LegacyAPIKeyEnvVar is the name APIKeyEnvVar had before. It is still read when APIKeyEnvVar is not set.
+//
+// Deprecated: set APIKeyEnvVar instead.
+const LegacyAPIKeyEnvVar = "LIBRARIES_IO_API_KEY"
+
+// APIKeyFromEnv returns the libraries.io API key from APIKeyEnvVar, or from LegacyAPIKeyEnvVar with a warning if only
+// that one is set.
+func APIKeyFromEnv() string {
+	if key := os.Getenv(APIKeyEnvVar); key != "" {
+		return key
+	}
+	key := os.Getenv(LegacyAPIKeyEnvVar)
+	if key != "" {
+		slog.Warn("The API key environment variable was renamed, please set the new one", "old", LegacyAPIKeyEnvVar, "new", APIKeyEnvVar)
+	}
+	return key
+}
+
+const defaultPerPage = 20
+
+// progressInterval is the number of packages of a platform after which progress is logged.
+const progressInterval = 1000
+
+// discoveryEndpoint is the libraries.io search endpoint the package-level functions use. It is a variable so tests can
+// point it at a local server.
+var discoveryEndpoint = DefaultBaseURL + "/search"
+
+// projectEndpoint is the base URL of the libraries.io project endpoints, such as the dependencies of a version, that
+// the package-level functions use. It is a variable so tests can point it at a local server.
+var projectEndpoint = DefaultBaseURL
+
+// ErrUnknownPlatform is returned when the requested platform is not one libraries.io supports.
+var ErrUnknownPlatform = errors.New("unknown platform")
+
+// platforms are the package managers libraries.io supports, spelled the way it does.
+var platforms = []string{
+	"Alcatraz", "Bower", "Cargo", "Carthage", "Clojars", "CocoaPods", "CPAN", "CRAN", "Dub", "Elm", "Go", "Hackage",
+	"Haxelib", "Hex", "Homebrew", "Inqlude", "Julia", "Maven", "Meteor", "Nimble", "NPM", "NuGet", "Packagist",
+	"PlatformIO", "Pub", "Puppet", "PureScript", "Pypi", "Racket", "Rubygems", "SwiftPM",
+}
+
+// normalizePlatform returns the libraries.io spelling of platform, which is matched regardless of case, or
+// ErrUnknownPlatform if libraries.io does not support it.
+func normalizePlatform(platform string) (string, error) {
+	for _, known := range platforms {
+		if strings.EqualFold(platform, known) {
+			return known, nil
+		}
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownPlatform, platform)
+}
+
+// ErrVersionNotFound is returned when libraries.io does not know the requested version of a package.
+var ErrVersionNotFound = errors.New("version not found")
+
+// errProjectNotFound is returned when libraries.io does not know a package that its search returned, which happens
+// when it was removed in between.
+var errProjectNotFound = errors.New("project not found")
+
+// ErrMissingAPIKey is returned when no API key was given and none could be found in the environment. libraries.io
+// rejects unauthenticated requests with a 401, so we fail before sending anything.
+var ErrMissingAPIKey = errors.New("no libraries.io API key provided: pass one explicitly or set " + APIKeyEnvVar)
+
+// ErrInterrupted is returned when an ingestion stops because its context is done, e.g. after a Ctrl-C. The error also
+// matches the context's error, context.Canceled or context.DeadlineExceeded.
+var ErrInterrupted = errors.New("ingestion interrupted")
+
+// interruptedError is an ErrInterrupted caused by the error of a context.
+type interruptedError struct {
+	cause error
+}
+
+func (e interruptedError) Error() string {
+	return ErrInterrupted.Error() + ": " + e.cause.Error()
+}
+
+func (e interruptedError) Is(target error) bool {
+	return target == ErrInterrupted
+}
+
+func (e interruptedError) Unwrap() error {
+	return e.cause
+}
+
+// interrupted turns err into an ErrInterrupted if it is caused by ctx being done.
+func interrupted(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return interruptedError{cause: err}
+	}
+	return err
+}
+
+// Project is a single package as returned by the libraries.io search endpoint. Only the fields we use are decoded.
+type Project struct {
+	Name                     string    `json:"name"`
+	Platform                 string    `json:"platform"`
+	Description              string    `json:"description"`
+	Homepage                 string    `json:"homepage"`
+	Language                 string    `json:"language"`
+	Keywords                 []string  `json:"keywords"`
+	LatestReleaseNumber      string    `json:"latest_release_number"`
+	LatestReleasePublishedAt string    `json:"latest_release_published_at"`
+	Versions                 []Version `json:"versions"`
+	// Rank is the SourceRank libraries.io computes from signals such as the number of dependents. Like the counts
+	// below, it is nil when libraries.io leaves it out, which is not the same as zero.
+	Rank  *int `json:"rank,omitempty"`
+	Stars *int `json:"stars,omitempty"`
+	Forks *int `json:"forks,omitempty"`
+	// DependentReposCount is the number of repositories that depend on the package.
+	DependentReposCount *int `json:"dependent_repos_count,omitempty"`
+	// Licenses is a comma-separated list of the licenses of the package. Ingest normalizes them to SPDX identifiers
+	// where it recognizes them, e.g. MIT,Apache-2.0.
+	Licenses string `json:"licenses"`
+	// NormalizedLicenses are the licenses libraries.io has mapped to SPDX identifiers itself, which normalizeProject
+	// moves into Licenses. Licenses it could not map are left out, so Licenses is kept when there are none.
+	NormalizedLicenses []string `json:"normalized_licenses,omitempty"`
+	RepositoryURL      string   `json:"repository_url"`
+	// Dependencies are the dependencies of the latest release. They are only fetched when asked for.
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+	// Vulnerabilities is the number of advisories OSV has for the latest release. It is only looked up when asked for,
+	// and stays nil for platforms OSV does not cover.
+	Vulnerabilities *int `json:"vulnerabilities,omitempty"`
+}
+
+// Version is a single published version of a Project.
+type Version struct {
+	Number      string `json:"number"`
+	PublishedAt string `json:"published_at"`
+}
+
+// PublishedTime parses PublishedAt. ok is false if the version has no timestamp, if it cannot be parsed, or if it is a
+// zero time such as the Unix epoch, which registries put in place of a missing one.
+func (v Version) PublishedTime() (published time.Time, ok bool) {
+	published, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(v.PublishedAt))
+	if err != nil || published.IsZero() || published.Unix() == 0 {
+		return time.Time{}, false
+	}
+	return published.UTC(), true
+}
+
+// publishedAtField formats the publication time of a version as RFC 3339 in UTC for a version row, and reports whether
+// it is missing, in which case the field is empty.
+func publishedAtField(version Version) (field string, missing bool) {
+	published, ok := version.PublishedTime()
+	if !ok {
+		return "", true
+	}
+	return published.Format(time.RFC3339), false
+}
+
+// Dependency is a dependency of a single version of a Project, as listed by libraries.io.
+type Dependency struct {
+	Name     string `json:"name"`
+	Platform string `json:"platform"`
+	// Requirements is the version range the dependency is declared with, e.g. ^1.2.0.
+	Requirements string `json:"requirements"`
+	// Kind is the kind of dependency, such as runtime or development. Its values depend on the platform.
+	Kind     string `json:"kind"`
+	Optional bool   `json:"optional"`
+	// Resolved is set when libraries.io knows the package the dependency refers to. Dependencies on private or
+	// misspelled packages are not resolved.
+	Resolved bool `json:"resolved"`
+	// Local is set for dependencies on a path rather than a published package, such as file:../shared or
+	// link:../shared in a package.json. They are never resolved.
+	Local bool `json:"local,omitempty"`
+	// Markers is the environment marker of a Python dependency, e.g. python_version < "3.8", which it only applies
+	// under. Other platforms have none.
+	Markers string `json:"markers,omitempty"`
+}
+
+// csvHeader is the header row of the CSV output with all columns, which Options.Columns selects from. The order must
+// match Project.csvRecord.
+var csvHeader = []string{
+	"name",
+	"platform",
+	"description",
+	"homepage",
+	"language",
+	"keywords",
+	"latest_release_number",
+	"latest_release_published_at",
+	"versions",
+	"dependencies",
+	"rank",
+	"stars",
+	"forks",
+	"dependent_repos_count",
+	"licenses",
+	"repository_url",
+	"vulnerabilities",
+	"purl",
+}
+
+// ErrUnknownColumn is returned when Options.Columns names a column the CSV output does not have.
+var ErrUnknownColumn = errors.New("unknown CSV column")
+
+// csvColumnIndices returns the positions in csvHeader of the given columns, in the order given. No columns select all
+// of them, which is nil.
+func csvColumnIndices(columns []string) ([]int, error) {
+	if len(columns) == 0 {
+		return nil, nil
+	}
+	positions := make(map[string]int, len(csvHeader))
+	for i, name := range csvHeader {
+		positions[name] = i
+	}
+	indices := make([]int, 0, len(columns))
+	seen := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		i, ok := positions[column]
+		if !ok {
+			return nil, fmt.Errorf("%w %q: expected one of %s", ErrUnknownColumn, column, strings.Join(csvHeader, ", "))
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("CSV column %q is selected twice", column)
+		}
+		seen[column] = true
+		indices = append(indices, i)
+	}
+	return indices, nil
+}
+
+// selectColumns returns the fields of record at the given indices, or record itself if indices is nil.
+func selectColumns(record []string, indices []int) []string {
+	if indices == nil {
+		return record
+	}
+	selected := make([]string, len(indices))
+	for i, index := range indices {
+		selected[i] = record[index]
+	}
+	return selected
+}
+
+// csvRecord converts the project into a CSV row. List fields are joined with semicolons, dependencies are written as
+// name@requirements, and missing counts are left empty. A semicolon in requirements, which only a URL can have, is
+// percent-encoded so that it does not split the list.
+func (p Project) csvRecord() []string {
+	versions := make([]string, 0, len(p.Versions))
+	for _, v := range p.Versions {
+		versions = append(versions, v.Number)
+	}
+	dependencies := make([]string, 0, len(p.Dependencies))
+	for _, d := range p.Dependencies {
+		dependencies = append(dependencies, d.Name+"@"+strings.ReplaceAll(d.Requirements, ";", "%3B"))
+	}
+	return []string{
+		p.Name,
+		p.Platform,
+		p.Description,
+		p.Homepage,
+		p.Language,
+		strings.Join(p.Keywords, ";"),
+		p.LatestReleaseNumber,
+		p.LatestReleasePublishedAt,
+		strings.Join(versions, ";"),
+		strings.Join(dependencies, ";"),
+		formatCount(p.Rank),
+		formatCount(p.Stars),
+		formatCount(p.Forks),
+		formatCount(p.DependentReposCount),
+		strings.Join(splitLicenses(p.Licenses), ";"),
+		p.RepositoryURL,
+		formatCount(p.Vulnerabilities),
+		p.purl(),
+	}
+}
+
+// formatCount formats an optional count for a CSV field, which is empty if the count is missing.
+func formatCount(count *int) string {
+	if count == nil {
+		return ""
+	}
+	return strconv.Itoa(*count)
+}
+
+// FetchDependencies returns the dependencies of a single version of a package on the given libraries.io platform,
+// using the API key from the LIBRARIESIO_API_KEY environment variable. ErrVersionNotFound is returned when
+// libraries.io does not know the version, which is common for deleted releases. The request is aborted when ctx is
+// done.
+func FetchDependencies(ctx context.Context, platform, name, version string) ([]Dependency, error) {
+	return defaultClient().FetchDependencies(ctx, platform, name, version)
+}
+
+// FetchDependencies is like the package-level FetchDependencies but sends the request through c.
+func (c *Client) FetchDependencies(ctx context.Context, platform, name, version string) ([]Dependency, error) {
+	opts, err := Options{}.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	platform, err = normalizePlatform(platform)
+	if err != nil {
+		return nil, err
+	}
+	return c.newFetcher(opts).fetchDependencies(ctx, c.dependenciesURL(platform, name, version, opts.APIKey))
+}
+
+// Options configures a call to Ingest.
+type Options struct {
+	// Platform is the libraries.io platform to ingest, e.g. NPM. It is matched regardless of case, and
+	// ErrUnknownPlatform is returned for platforms libraries.io does not support.
+	Platform string
+	// PerPage is the number of packages requested per page. Zero or less uses the libraries.io default of 20.
+	PerPage int
+	// APIKey is the libraries.io API key. If empty, it is read from the LIBRARIESIO_API_KEY environment variable.
+	APIKey string
+	// MaxPages caps the number of pages requested. Zero or less means there is no limit.
+	MaxPages int
+	// MaxPackages caps the number of packages written. Zero or less means there is no limit.
+	MaxPackages int
+	// RequestsPerMinute limits how many requests are sent to libraries.io, including retries. Zero uses the free tier
+	// limit of 60 requests per minute, a negative value disables the limit.
+	RequestsPerMinute int
+	// MaxAttempts is how often a request is sent before giving up on a transient failure such as a 429, a 5xx or a
+	// reset connection. Zero or less uses 5 attempts.
+	MaxAttempts int
+	// Format is the format of the output file. The zero value writes CSV.
+	Format Format
+	// Columns selects the columns of FormatCSV output and their order, e.g. name, platform and
+	// latest_release_number. ErrUnknownColumn is returned for a name that is not a column of the full output, which
+	// is written when Columns is empty. Other formats always contain every field.
+	Columns []string
+	// Workers is the number of pages fetched concurrently, and of the versions and dependencies fetched concurrently
+	// for the packages of each page. Zero or less uses 4 workers. All requests share the rate limit of
+	// RequestsPerMinute, and the output is written in page order by a single writer regardless of the number of
+	// workers.
+	Workers int
+	// IncludePrerelease keeps versions with a prerelease tag, such as 2.0.0-beta.1 or 2.0.0rc1. By default they are left
+	// out, and a package whose latest release is a prerelease gets its latest stable release as the latest one.
+	IncludePrerelease bool
+	// ExcludeLicenses drops packages licensed only under the given licenses before they are written, e.g. to leave
+	// out proprietary packages. Licenses are compared as SPDX identifiers regardless of case, so mit excludes MIT.
+	// Packages under several licenses are kept if any of them is not excluded, and packages without a license are
+	// always kept.
+	ExcludeLicenses []string
+	// Keywords keeps only packages tagged with at least one of the given keywords, and Languages only packages written
+	// in one of the given languages, both compared regardless of case. libraries.io is asked for such packages only,
+	// and the packages on every page are checked again before they are written.
+	Keywords  []string
+	Languages []string
+	// MinStars keeps only packages with at least this many stars, and MinRank only packages with at least this
+	// SourceRank. libraries.io cannot search by either, so packages below them are dropped after the page arrived,
+	// along with packages that have no count at all. Zero or less keeps every package. All filters apply together, so
+	// a package has to meet every one of them, and the packages they drop are counted in Stats.Filtered.
+	MinStars int
+	MinRank  int
+	// Since keeps only packages whose latest release was published after it, for an incremental ingestion whose output
+	// is then combined with an earlier one by Merge. libraries.io is asked for the packages newest release first, and
+	// no pages are requested after the first one that has no package released after Since. Packages whose release
+	// time is not known are dropped unless IncludeUndated is set; libraries.io sorts them after all others, so only
+	// those on the pages before that one are kept. The packages left out are counted in Stats.Filtered. The zero time
+	// keeps every package.
+	Since          time.Time
+	IncludeUndated bool
+	// Versions makes Ingest fetch the versions of packages whose search result lists none, at the cost of one request
+	// per such package. Without it, those packages are written without versions.
+	Versions bool
+	// Dependencies makes Ingest fetch the dependencies of the latest release of every package as well, at the cost of
+	// one request per package.
+	Dependencies bool
+	// Vulnerabilities makes Ingest count the known vulnerabilities of the latest release of every package in the OSV
+	// database, with a single request per page that counts against RequestsPerMinute as well.
+	Vulnerabilities bool
+	// CacheDir is a directory in which responses are kept, so that running the same ingestion again sends no requests.
+	// Empty disables the cache.
+	CacheDir string
+	// CacheTTL is how long a cached response is used. Zero or less means cached responses do not expire. Once a
+	// response that came with an ETag or Last-Modified header expired, it is revalidated with a conditional request
+	// and used again if the server answers 304 Not Modified, which saves downloading it for a weekly refresh. The
+	// validators are stored with every response as it arrives, so an interrupted run keeps them.
+	CacheTTL time.Duration
+	// RefreshCache ignores the cached responses and overwrites them with fresh ones.
+	RefreshCache bool
+	// Restart ignores the checkpoint of an earlier, interrupted run and starts from the first page.
+	Restart bool
+	// Update keeps an existing output fresh without fetching all of it again. The search pages are still requested,
+	// since libraries.io cannot be asked for changed packages only, but packages whose LastUpdated is the same as when
+	// an earlier run wrote them get their versions and dependencies from its output instead of extra requests. When
+	// the packages last changed is recorded in a state file next to the output (outPath plus ".state.json"), which every
+	// run with Update that finishes writes. Only IngestContext and IngestPlatforms update, and not into FormatSQLite.
+	Update bool
+	// HTTPClient sends the requests instead of the HTTP client of the Client, e.g. a stub in tests. Nil uses the
+	// client of the Client, which is http.DefaultClient for the package-level functions.
+	HTTPClient Doer
+	// RequestTimeout bounds every attempt of a request, so that a hung connection is retried instead of stalling the
+	// ingestion. Zero uses 30 seconds, a negative value disables the timeout. A deadline for the whole ingestion is
+	// set on the context instead.
+	RequestTimeout time.Duration
+	// CompressionLevel is the gzip level of output files whose path ends in CompressedExt, from 1 for the fastest to 9
+	// for the smallest. Zero uses the default level of compress/gzip.
+	CompressionLevel int
+	// DecodeMode decides what happens to a package in a page of search results that cannot be decoded. The zero value
+	// is DecodeStrict, which fails the ingestion.
+	DecodeMode DecodeMode
+	// Progress is called after every page that is written, with the number of packages written so far, including
+	// those a resumed run wrote before, and the number MaxPackages allows for all platforms together. The total is -1
+	// when it is not known, because pages are requested until libraries.io runs out of results. Calls come from a
+	// single goroutine, one at a time. Nil reports nothing.
+	Progress func(fetched, total int)
+}
+
+// Ingest downloads packages from libraries.io and writes them to outPath in the format chosen in opts. Pages are
+// requested until libraries.io runs out of results or one of the limits in opts is reached. ErrMissingAPIKey is
+// returned when no API key is configured.
+//
+// The output is written to a temporary file next to outPath and renamed into place once it is complete. If the
+// ingestion fails midway, the temporary file is removed and whatever was at outPath before is left untouched, so a
+// partial output cannot be mistaken for a complete data set. The returned stats cover the work done before the failure.
+func Ingest(opts Options, outPath string) (Stats, error) {
+	return IngestContext(context.Background(), opts, outPath)
+}
+
+// IngestContext is like Ingest but stops as soon as ctx is done, aborting any request in flight, and returns
+// ErrInterrupted. As for other failures, whatever was at outPath before is left untouched, but the complete pages are
+// kept in the temporary file for the checkpoint described at IngestPlatforms, so that the next run continues after
+// them.
+func IngestContext(ctx context.Context, opts Options, outPath string) (Stats, error) {
+	return defaultClient().IngestContext(ctx, opts, outPath)
+}
+
+// IngestContext is like the package-level IngestContext but sends all requests through c.
+func (c *Client) IngestContext(ctx context.Context, opts Options, outPath string) (Stats, error) {
+	return c.IngestPlatforms(ctx, opts, []string{opts.Platform}, outPath)
+}
+
+// IngestPlatforms is like IngestContext but ingests each of the given platforms in turn, ignoring opts.Platform, and
+// writes them all to the same file. The limits in opts apply to each platform separately. All platforms are validated
+// before the first request is sent.
+//
+// Unless the format is FormatSQLite or the output is compressed, a checkpoint is written next to the output file, at
+// outPath plus ".checkpoint.json", after every page. If a run is cancelled or the process dies, the next run with the
+// same platforms, page size and format continues the temporary file of that run after the last page that was written
+// completely, unless opts.Restart is set. It cuts off whatever was written after that page first. The checkpoint is
+// removed once the run ends in any other way.
+func IngestPlatforms(ctx context.Context, opts Options, platforms []string, outPath string) (Stats, error) {
+	return defaultClient().IngestPlatforms(ctx, opts, platforms, outPath)
+}
+
+// IngestPlatforms is like the package-level IngestPlatforms but sends all requests through c.
+func (c *Client) IngestPlatforms(ctx context.Context, opts Options, platforms []string, outPath string) (Stats, error) {
+	opts, platforms, err := prepareIngest(opts, platforms)
+	if err != nil {
+		return Stats{}, err
+	}
+	var update *incrementalUpdate
+	if opts.Update {
+		if opts.Format == FormatSQLite {
+			return Stats{}, errUpdateSQLite
+		}
+		update = loadIncrementalUpdate(opts, outPath)
+	}
+	var progress *checkpointer
+	var resume resumePoint
+	already := packageSet{}
+	// A database is not appended to byte by byte and a gzip stream cannot be cut at an arbitrary byte, so neither can
+	// be cut back to a checkpoint
+	if opts.Format != FormatSQLite && !IsCompressedPath(outPath) {
+		progress = &checkpointer{
+			outPath: outPath,
+			checkpoint: checkpoint{
+				Platforms: platforms,
+				PerPage:   opts.PerPage,
+				Format:    opts.Format.String(),
+				Columns:   opts.Columns,
+				Keywords:  opts.Keywords,
+				Languages: opts.Languages,
+				Since:     formatSince(opts.Since),
+			},
+		}
+		if !opts.Restart {
+			progress.checkpoint, already = loadCheckpoint(outPath, progress.checkpoint)
+			if progress.checkpoint.Offset > 0 {
+				slog.Info("Resuming interrupted ingestion", "out", outPath,
+					"platform", platforms[progress.checkpoint.Platform], "page", progress.checkpoint.Page)
+			}
+		}
+		resume = resumePoint{from: outPath, offset: progress.checkpoint.Offset, packages: progress.checkpoint.Packages}
+		if progress.checkpoint.Temp != "" {
+			resume.from = progress.checkpoint.Temp
+		}
+	}
+
+	// Already validated by prepareIngest
+	columns, _ := csvColumnIndices(opts.Columns)
+	stats := newStatsCollector()
+	_, err = writeProjectsFileAt(ctx, outPath, opts.Format, columns, resume, opts.CompressionLevel, func(writer projectWriter, out *outputFile) (int, error) {
+		if err := progress.attach(out); err != nil {
+			return 0, err
+		}
+		writer = withProgress(writer, opts.Progress, resume.packages, packagesTotal(opts, len(platforms)))
+		return c.ingestPlatforms(ctx, writer, opts, platforms, already, stats, progress, update)
+	})
+	// A cancelled run keeps its temporary file and with it the checkpoint, any other one either finished or removed it
+	if ctx.Err() == nil {
+		os.Remove(checkpointPath(outPath))
+	}
+	if err == nil {
+		err = update.save(outPath)
+	}
+	run := manifestRun{source: SourceLibrariesIO, parameters: opts.manifestParameters(platforms), format: opts.Format, files: []string{outPath}}
+	return finish(ctx, outPath, run, stats.stats(), err)
+}
+
+// finish logs the outcome of an ingestion into out and returns its stats and error, turning a cancellation into
+// ErrInterrupted and recording the run in the manifest with recordRun.
+func finish(ctx context.Context, out string, run manifestRun, stats Stats, err error) (Stats, error) {
+	err = recordRun(ctx, run, stats, err)
+	switch {
+	case err == nil:
+		slog.Info("Ingestion finished", "out", out, "stats", stats)
+	case errors.Is(err, ErrInterrupted):
+		slog.Info("Ingestion interrupted, left the previous output untouched", "out", out, "stats", stats)
+	}
+	return stats, err
+}
+
+// prepareIngest applies the defaults to opts and normalizes the platforms, failing if any of them is unknown.
+func prepareIngest(opts Options, platforms []string) (Options, []string, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return opts, nil, err
+	}
+	normalized := make([]string, 0, len(platforms))
+	for _, platform := range platforms {
+		platform, err := normalizePlatform(platform)
+		if err != nil {
+			return opts, nil, err
+		}
+		normalized = append(normalized, platform)
+	}
+	return opts, normalized, nil
+}
+
+// ingestPlatforms runs ingestPages for each platform in turn and returns the total number of packages written. With
+// a checkpointer, it starts where the checkpoint says and keeps it up to date. progress and update may be nil.
+// Packages in already are not written again, and every package written is added to it.
+func (c *Client) ingestPlatforms(ctx context.Context, writer projectWriter, opts Options, platforms []string, already packageSet, stats *statsCollector, progress *checkpointer, update *incrementalUpdate) (int, error) {
+	written := 0
+	for i := progress.firstPlatform(); i < len(platforms); i++ {
+		opts.Platform = platforms[i]
+		n, err := c.ingestPages(ctx, writer, opts, already, stats, progress, i, update)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// withDefaults returns a copy of opts with the defaults filled in, or an error if opts cannot be used.
+func (opts Options) withDefaults() (Options, error) {
+	if opts.APIKey == "" {
+		opts.APIKey = APIKeyFromEnv()
+	}
+	if opts.APIKey == "" {
+		return opts, ErrMissingAPIKey
+	}
+	return opts.withDefaultsExceptAPIKey()
+}
+
+// withDefaultsExceptAPIKey is like withDefaults but leaves the API key alone, for registries that do not need one.
+func (opts Options) withDefaultsExceptAPIKey() (Options, error) {
+	if opts.PerPage <= 0 {
+		opts.PerPage = defaultPerPage
+	}
+	if opts.RequestsPerMinute == 0 {
+		opts.RequestsPerMinute = defaultRequestsPerMinute
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = defaultWorkers
+	}
+	if opts.RequestTimeout == 0 {
+		opts.RequestTimeout = defaultRequestTimeout
+	}
+	if opts.Format != FormatCSV && opts.Format != FormatNDJSON && opts.Format != FormatJSON && opts.Format != FormatSQLite {
+		return opts, fmt.Errorf("unknown output format %d", opts.Format)
+	}
+	if _, err := csvColumnIndices(opts.Columns); err != nil {
+		return opts, err
+	}
+	if opts.CompressionLevel < 0 || opts.CompressionLevel > gzip.BestCompression {
+		return opts, fmt.Errorf("compression level must be between 1 and %d, got %d", gzip.BestCompression, opts.CompressionLevel)
+	}
+	return opts, nil
+}
+
+// ingestPages requests pages of packages and writes them to writer until there are no more results or one of the
+// limits in opts is reached. It returns the number of packages written. Pages are fetched concurrently but written in
+// page order, each one as soon as it and all pages before it have arrived, so memory use does not grow with the number
+// of packages ingested. Packages in already are left out and the ones written are added to it. Progress is counted in
+// stats and, for the platform with the given index, recorded by progress, which may be nil. update, which may be nil
+// as well, reuses the unchanged packages of an earlier run and records the ones written.
+func (c *Client) ingestPages(ctx context.Context, writer projectWriter, opts Options, already packageSet, stats *statsCollector, progress *checkpointer, platform int, update *incrementalUpdate) (int, error) {
+	firstPage, written := progress.start(platform)
+	if opts.MaxPackages > 0 && written >= opts.MaxPackages {
+		return 0, nil
+	}
+	// Stopping early, for example after a failed page, cancels the fetches that are still running
+	ctx, cancel := context.WithCancel(ctx)
+	f := c.newFetcher(opts)
+	f.stats = stats
+	results, done, wait := fetchPages(ctx, opts, firstPage, func(ctx context.Context, page int) pageResult {
+		return c.fetchPage(ctx, opts, page, f, update)
+	})
+	defer func() {
+		cancel()
+		wait()
+	}()
+
+	previouslyWritten := written
+	for result := range results {
+		if result.err != nil {
+			return written - previouslyWritten, fmt.Errorf("fetching page %d: %w", result.page, result.err)
+		}
+		projects := result.projects
+		for i := range projects {
+			// Keep rows of different platforms apart even if libraries.io leaves the field out
+			if projects[i].Platform == "" {
+				projects[i].Platform = opts.Platform
+			}
+		}
+		projects, duplicates := already.unique(projects)
+		stats.duplicate(duplicates)
+		stats.duplicateVersion(uniqueVersions(projects))
+		stats.filteredOut(result.filtered)
+		stats.updatedPackages(result.counts)
+		if opts.MaxPackages > 0 && written+len(projects) > opts.MaxPackages {
+			projects = projects[:opts.MaxPackages-written]
+		}
+		rows, err := writer.writeProjects(projects)
+		if err != nil {
+			return written - previouslyWritten, err
+		}
+		update.record(projects, result.updated)
+		slog.Debug("Wrote page", "platform", opts.Platform, "page", result.page, "packages", len(projects))
+		if written/progressInterval != (written+len(projects))/progressInterval {
+			slog.Info("Ingesting", "platform", opts.Platform, "page", result.page, "packages", written+len(projects))
+		}
+		written += len(projects)
+		stats.page(len(projects), rows)
+		if err := progress.pageWritten(platform, result.page, len(projects), written); err != nil {
+			return written - previouslyWritten, err
+		}
+		if opts.MaxPackages > 0 && written >= opts.MaxPackages {
+			// Cancelled before the page is done, so that the workers do not request the pages after it
+			cancel()
+			return written - previouslyWritten, nil
+		}
+		done()
+	}
+	return written - previouslyWritten, ctx.Err()
+}
@@ -0,0 +1,1094 @@
+package ingest
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testProjectsPage = `[
+  {
+    "name": "left-pad",
+    "platform": "NPM",
+    "description": "String left pad",
+    "homepage": "https://github.com/stevemao/left-pad",
+    "language": "JavaScript",
+    "keywords": ["leftpad", "pad"],
+    "latest_release_number": "1.3.0",
+    "latest_release_published_at": "2018-04-09T01:52:29.000Z",
+    "versions": [
+      {"number": "1.2.0", "published_at": "2017-11-20T10:12:00.000Z"},
+      {"number": "1.3.0", "published_at": "2018-04-09T01:52:29.000Z"}
+    ]
+  }
+]`
+
+func TestMain(m *testing.M) {
+	// Neither the rate limiter nor the retries should slow the tests down
+	sleep = func(ctx context.Context, d time.Duration) error {
+		return ctx.Err()
+	}
+	os.Exit(m.Run())
+}
+
+// useTestServer points the libraries.io endpoints at a local server for the duration of the test. Search requests
+// go to the root path.
+func useTestServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previousDiscovery, previousProject := discoveryEndpoint, projectEndpoint
+	discoveryEndpoint, projectEndpoint = server.URL, server.URL
+	t.Cleanup(func() {
+		discoveryEndpoint, projectEndpoint = previousDiscovery, previousProject
+		server.Close()
+	})
+	return server
+}
+
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Could not open output: %v", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Output was not valid CSV: %v", err)
+	}
+	return records
+}
+
+func TestIngestAPIKey(t *testing.T) {
+	t.Run("Returns ErrMissingAPIKey without sending a request", func(t *testing.T) {
+		t.Setenv(APIKeyEnvVar, "")
+		t.Setenv(LegacyAPIKeyEnvVar, "")
+		requests := 0
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			requests++
+		})
+
+		_, err := Ingest(Options{Platform: "NPM", Workers: 1}, filepath.Join(t.TempDir(), "result.csv"))
+		if !errors.Is(err, ErrMissingAPIKey) {
+			t.Errorf("Expected ErrMissingAPIKey, got %v", err)
+		}
+		if requests != 0 {
+			t.Errorf("Expected no requests, got %d", requests)
+		}
+	})
+
+	t.Run("Falls back to the environment variable", func(t *testing.T) {
+		t.Setenv(APIKeyEnvVar, "from-env")
+		var key string
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			key = r.URL.Query().Get("api_key")
+			w.Write([]byte("[]"))
+		})
+
+		if _, err := Ingest(Options{Platform: "NPM", Workers: 1}, filepath.Join(t.TempDir(), "result.csv")); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if key != "from-env" {
+			t.Errorf("Expected the key from the environment, got %q", key)
+		}
+	})
+
+	t.Run("Falls back to the old name of the environment variable", func(t *testing.T) {
+		t.Setenv(APIKeyEnvVar, "")
+		t.Setenv(LegacyAPIKeyEnvVar, "from-old-env")
+		if key := APIKeyFromEnv(); key != "from-old-env" {
+			t.Errorf("Expected the key from the old variable, got %q", key)
+		}
+		t.Setenv(APIKeyEnvVar, "from-env")
+		if key := APIKeyFromEnv(); key != "from-env" {
+			t.Errorf("Expected the new variable to take precedence, got %q", key)
+		}
+	})
+}
+
+func TestIngestWritesCSV(t *testing.T) {
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testProjectsPage))
+	})
+	outPath := filepath.Join(t.TempDir(), "out", "result.csv")
+
+	if _, err := Ingest(Options{Platform: "NPM", APIKey: "secret"}, outPath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	records := readCSV(t, outPath)
+	if len(records) != 2 {
+		t.Fatalf("Expected a header and one row, got %d rows", len(records))
+	}
+	if strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+		t.Errorf("Unexpected header %v", records[0])
+	}
+	row := strings.Join(records[1], "|")
+	expected := "left-pad|NPM|String left pad|https://github.com/stevemao/left-pad|JavaScript|leftpad;pad|1.3.0|" +
+		"2018-04-09T01:52:29.000Z|1.2.0;1.3.0|||||||||pkg:npm/left-pad@1.3.0"
+	if row != expected {
+		t.Errorf("Expected row %s, got %s", expected, row)
+	}
+}
+
+func TestIngestColumns(t *testing.T) {
+	requests := 0
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(testProjectsPage))
+	})
+
+	t.Run("Writes the selected columns in order", func(t *testing.T) {
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+		opts := Options{Platform: "NPM", APIKey: "secret", Columns: []string{"latest_release_number", "name"}}
+		if _, err := Ingest(opts, outPath); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		records := readCSV(t, outPath)
+		if header := strings.Join(records[0], ","); header != "latest_release_number,name" {
+			t.Errorf("Expected header latest_release_number,name, got %s", header)
+		}
+		if row := strings.Join(records[1], ","); row != "1.3.0,left-pad" {
+			t.Errorf("Expected row 1.3.0,left-pad, got %s", row)
+		}
+	})
+
+	t.Run("Rejects unknown and repeated columns before sending requests", func(t *testing.T) {
+		requests = 0
+		for _, columns := range [][]string{{"name", "license"}, {"name", "name"}} {
+			_, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Columns: columns}, filepath.Join(t.TempDir(), "result.csv"))
+			if err == nil {
+				t.Errorf("Expected an error for columns %v", columns)
+			}
+		}
+		_, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Columns: []string{"license"}}, filepath.Join(t.TempDir(), "result.csv"))
+		if !errors.Is(err, ErrUnknownColumn) || !strings.Contains(err.Error(), `"license"`) {
+			t.Errorf("Expected ErrUnknownColumn naming the column, got %v", err)
+		}
+		if requests != 0 {
+			t.Errorf("Expected no requests, got %d", requests)
+		}
+	})
+}
+
+func TestIngestDoesNotLeakAPIKey(t *testing.T) {
+	server := useTestServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	server.Close()
+
+	_, err := Ingest(Options{Platform: "NPM", APIKey: "secret"}, filepath.Join(t.TempDir(), "result.csv"))
+	if err == nil {
+		t.Fatal("Expected an error when the server is unreachable")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("Error leaked the API key: %v", err)
+	}
+}
+
+// pagedServer serves total packages split into pages of perPage, and a 422 for any page past the last one.
+func pagedServer(t *testing.T, total int, requestedPages *[]int) {
+	t.Helper()
+	useTestServer(t, pagedHandler(total, requestedPages))
+}
+
+// pagedHandler serves total packages named package-0, package-1 and so on in pages, recording the page numbers that
+// were requested.
+func pagedHandler(total int, requestedPages *[]int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		*requestedPages = append(*requestedPages, page)
+		start := (page - 1) * perPage
+		if start > total {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		end := start + perPage
+		if end > total {
+			end = total
+		}
+		projects := make([]Project, 0, perPage)
+		for i := start; i < end; i++ {
+			projects = append(projects, Project{Name: fmt.Sprintf("package-%d", i), Platform: "NPM"})
+		}
+		json.NewEncoder(w).Encode(projects)
+	}
+}
+
+// pageOfProjects returns n packages named after the page that r requests, so that no two pages have a package in
+// common.
+func pageOfProjects(r *http.Request, n int) []Project {
+	projects := make([]Project, n)
+	for i := range projects {
+		projects[i].Name = fmt.Sprintf("package-%s-%d", r.URL.Query().Get("page"), i)
+	}
+	return projects
+}
+
+func TestIngestPagination(t *testing.T) {
+	t.Run("Stops after a short last page", func(t *testing.T) {
+		var pages []int
+		pagedServer(t, 2*defaultPerPage+5, &pages)
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+
+		stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Workers: 1}, outPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stats.Packages != 2*defaultPerPage+5 {
+			t.Errorf("Expected %d packages, got %d", 2*defaultPerPage+5, stats.Packages)
+		}
+		if len(pages) != 3 {
+			t.Errorf("Expected 3 requests, got %v", pages)
+		}
+		if rows := len(readCSV(t, outPath)); rows != stats.Packages+1 {
+			t.Errorf("Expected %d rows including the header, got %d", stats.Packages+1, rows)
+		}
+	})
+
+	t.Run("Stops at an empty page", func(t *testing.T) {
+		var pages []int
+		pagedServer(t, 2*defaultPerPage, &pages)
+
+		stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Workers: 1}, filepath.Join(t.TempDir(), "result.csv"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stats.Packages != 2*defaultPerPage || len(pages) != 3 {
+			t.Errorf("Expected %d packages over 3 requests, got %d over %v", 2*defaultPerPage, stats.Packages, pages)
+		}
+	})
+
+	t.Run("Treats a 422 as the end of the results", func(t *testing.T) {
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("page") != "1" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+			json.NewEncoder(w).Encode(pageOfProjects(r, defaultPerPage))
+		})
+
+		stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Workers: 1}, filepath.Join(t.TempDir(), "result.csv"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stats.Packages != defaultPerPage {
+			t.Errorf("Expected %d packages, got %d", defaultPerPage, stats.Packages)
+		}
+	})
+
+	t.Run("Respects the maximum package count", func(t *testing.T) {
+		var pages []int
+		pagedServer(t, 10*defaultPerPage, &pages)
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+
+		stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Workers: 1, MaxPackages: defaultPerPage + 3}, outPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stats.Packages != defaultPerPage+3 {
+			t.Errorf("Expected %d packages, got %d", defaultPerPage+3, stats.Packages)
+		}
+		if len(pages) != 2 {
+			t.Errorf("Expected 2 requests, got %v", pages)
+		}
+		if rows := len(readCSV(t, outPath)); rows != stats.Packages+1 {
+			t.Errorf("Expected %d rows including the header, got %d", stats.Packages+1, rows)
+		}
+	})
+}
+
+func TestIngestSkipsDuplicates(t *testing.T) {
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		// package-1 moves from the first page to the second between the requests
+		switch r.URL.Query().Get("page") {
+		case "1":
+			json.NewEncoder(w).Encode([]Project{{Name: "package-0"}, {Name: "package-1"}})
+		case "2":
+			json.NewEncoder(w).Encode([]Project{{Name: "package-1"}, {Name: "package-2", Platform: "npm"}, {Name: "package-2"}})
+		default:
+			w.Write([]byte("[]"))
+		}
+	})
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+
+	stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", PerPage: 2, Workers: 1}, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if names := readPackageNames(t, outPath, FormatCSV); !slices.Equal(names, []string{"package-0", "package-1", "package-2"}) {
+		t.Errorf("Expected every package once, got %v", names)
+	}
+	if stats.Packages != 3 || stats.Duplicates != 2 {
+		t.Errorf("Expected 3 packages and 2 duplicates, got %d and %d", stats.Packages, stats.Duplicates)
+	}
+}
+
+func TestIngestMaxPackagesWithDuplicates(t *testing.T) {
+	var pages []string
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		pages = append(pages, r.URL.Query().Get("page"))
+		// package-1 moves from the first page to the second between the requests
+		switch r.URL.Query().Get("page") {
+		case "1":
+			json.NewEncoder(w).Encode([]Project{{Name: "package-0"}, {Name: "package-1"}})
+		case "2":
+			json.NewEncoder(w).Encode([]Project{{Name: "package-1"}, {Name: "package-2"}})
+		case "3":
+			json.NewEncoder(w).Encode([]Project{{Name: "package-3"}, {Name: "package-4"}})
+		default:
+			w.Write([]byte("[]"))
+		}
+	})
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+
+	stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", PerPage: 2, Workers: 1, MaxPackages: 4}, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []string{"package-0", "package-1", "package-2", "package-3"}
+	if names := readPackageNames(t, outPath, FormatCSV); !slices.Equal(names, expected) {
+		t.Errorf("Expected %v despite the duplicate, got %v", expected, names)
+	}
+	if stats.Packages != 4 || !slices.Equal(pages, []string{"1", "2", "3"}) {
+		t.Errorf("Expected 4 packages over pages 1,2,3, got %d over %v", stats.Packages, pages)
+	}
+}
+
+func TestIngestMaxPages(t *testing.T) {
+	var pages []int
+	pagedServer(t, 10*defaultPerPage, &pages)
+
+	stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Workers: 1, MaxPages: 3}, filepath.Join(t.TempDir(), "result.csv"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 3*defaultPerPage || len(pages) != 3 {
+		t.Errorf("Expected %d packages over 3 requests, got %d over %v", 3*defaultPerPage, stats.Packages, pages)
+	}
+}
+
+func TestIngestPerPage(t *testing.T) {
+	var pages []int
+	pagedServer(t, 25, &pages)
+
+	stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Workers: 1, PerPage: 10}, filepath.Join(t.TempDir(), "result.csv"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 25 || len(pages) != 3 {
+		t.Errorf("Expected 25 packages over 3 requests, got %d over %v", stats.Packages, pages)
+	}
+}
+
+func TestIngestProgress(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxPackages int
+		expected    [][2]int
+	}{
+		{"Passes -1 without a limit", 0, [][2]int{{10, -1}, {20, -1}, {25, -1}}},
+		{"Passes the limit as the total", 15, [][2]int{{10, 15}, {15, 15}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var pages []int
+			pagedServer(t, 25, &pages)
+			var calls [][2]int
+			opts := Options{Platform: "NPM", APIKey: "secret", PerPage: 10, MaxPackages: test.maxPackages,
+				Progress: func(fetched, total int) {
+					calls = append(calls, [2]int{fetched, total})
+				}}
+
+			if _, err := Ingest(opts, filepath.Join(t.TempDir(), "result.csv")); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !slices.Equal(calls, test.expected) {
+				t.Errorf("Expected the calls %v, got %v", test.expected, calls)
+			}
+		})
+	}
+}
+
+func TestIngestFailure(t *testing.T) {
+	recordSleeps(t)
+	requests := 0
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Query().Get("page") == "1" {
+			json.NewEncoder(w).Encode(pageOfProjects(r, defaultPerPage))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+
+	stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Workers: 1}, outPath)
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected a 500 status error, got %v", err)
+	}
+	if stats.Packages != defaultPerPage {
+		t.Errorf("Expected %d packages to be reported before the failure, got %d", defaultPerPage, stats.Packages)
+	}
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial output to be removed, got %v", err)
+	}
+}
+
+func TestIngestErrorResponse(t *testing.T) {
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error": "Invalid API key"}`))
+	})
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+
+	_, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Workers: 1}, outPath)
+	if !errors.Is(err, ErrUnexpectedResponse) || !strings.Contains(err.Error(), "Invalid API key") {
+		t.Errorf("Expected ErrUnexpectedResponse with the message, got %v", err)
+	}
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no output, got %v", err)
+	}
+}
+
+func TestIngestStats(t *testing.T) {
+	failed := false
+	var mu sync.Mutex
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !failed {
+			failed = true
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page > 2 {
+			w.Write([]byte("[]"))
+			return
+		}
+		json.NewEncoder(w).Encode(pageOfProjects(r, defaultPerPage))
+	})
+
+	stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Workers: 2}, filepath.Join(t.TempDir(), "result.csv"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 2*defaultPerPage || stats.Rows != 2*defaultPerPage {
+		t.Errorf("Expected %d packages and rows, got %d and %d", 2*defaultPerPage, stats.Packages, stats.Rows)
+	}
+	// The empty third page is fetched but has nothing to write
+	if stats.Pages < 2 {
+		t.Errorf("Expected at least 2 pages, got %d", stats.Pages)
+	}
+	if stats.Retries != 1 || stats.Requests < 4 {
+		t.Errorf("Expected 1 retry in at least 4 requests, got %d in %d", stats.Retries, stats.Requests)
+	}
+	if stats.Bytes == 0 || stats.PeakHeapBytes == 0 || stats.Duration <= 0 {
+		t.Errorf("Expected bytes, peak heap and duration to be recorded, got %+v", stats)
+	}
+	if summary := stats.String(); !strings.Contains(summary, fmt.Sprintf("%d packages", 2*defaultPerPage)) {
+		t.Errorf("Expected the summary to mention the packages, got %s", summary)
+	}
+}
+
+func TestIngestRateLimit(t *testing.T) {
+	clock := fakeClock(t)
+	start := *clock
+	var pages []int
+	pagedServer(t, 3*defaultPerPage-1, &pages)
+
+	_, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Workers: 1, RequestsPerMinute: 30}, filepath.Join(t.TempDir(), "result.csv"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if elapsed := clock.Sub(start); elapsed != 4*time.Second {
+		t.Errorf("Expected 3 requests at 30/min to take 4s, took %v", elapsed)
+	}
+}
+
+// peakLiveHeap ingests the given number of full pages and returns the largest live heap observed between requests.
+func peakLiveHeap(t *testing.T, format Format, pages int) uint64 {
+	t.Helper()
+	description := strings.Repeat("x", 1024)
+	var peak uint64
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var stats runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&stats)
+		if stats.HeapAlloc > peak {
+			peak = stats.HeapAlloc
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page > pages {
+			w.Write([]byte("[]"))
+			return
+		}
+		projects := make([]Project, defaultPerPage)
+		for i := range projects {
+			projects[i] = Project{Name: fmt.Sprintf("package-%d-%d", page, i), Description: description}
+		}
+		json.NewEncoder(w).Encode(projects)
+	})
+
+	opts := Options{Platform: "NPM", APIKey: "secret", Workers: 1, Format: format}
+	if _, err := Ingest(opts, filepath.Join(t.TempDir(), "result")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return peak
+}
+
+func TestIngestMemoryStaysFlat(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping the memory test in short mode")
+	}
+	for _, format := range []Format{FormatCSV, FormatNDJSON} {
+		t.Run(format.String(), func(t *testing.T) {
+			small := peakLiveHeap(t, format, 10)
+			large := peakLiveHeap(t, format, 200)
+
+			// Holding on to the extra 190 pages would take about 190 * 20 * 1KiB, so anything below a tenth of that
+			// means the pages are not accumulated
+			const threshold = 190 * defaultPerPage * 1024 / 10
+			if large > small && large-small > threshold {
+				t.Errorf("Expected the peak heap to stay flat, grew from %d to %d bytes", small, large)
+			}
+		})
+	}
+}
+
+func TestIngestContextCancellation(t *testing.T) {
+	t.Run("Keeps the previous output and the pages written before the cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("page") == "3" {
+				cancel()
+				<-r.Context().Done()
+				return
+			}
+			json.NewEncoder(w).Encode(pageOfProjects(r, defaultPerPage))
+		})
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+		if err := os.WriteFile(outPath, []byte("previous\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		stats, err := IngestContext(ctx, Options{Platform: "NPM", APIKey: "secret", Workers: 1}, outPath)
+		if !errors.Is(err, ErrInterrupted) || !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected ErrInterrupted caused by context.Canceled, got %v", err)
+		}
+		if stats.Packages != 2*defaultPerPage {
+			t.Errorf("Expected %d packages before the cancellation, got %d", 2*defaultPerPage, stats.Packages)
+		}
+		if data, _ := os.ReadFile(outPath); string(data) != "previous\n" {
+			t.Errorf("Expected the previous output, got %q", data)
+		}
+		// The next run continues the temporary file the checkpoint refers to
+		if rows := len(readCSV(t, readCheckpoint(t, outPath).Temp)); rows != stats.Packages+1 {
+			t.Errorf("Expected %d rows including the header, got %d", stats.Packages+1, rows)
+		}
+	})
+
+	t.Run("Leaves valid CSV when cancelled while pages are in flight", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(20 * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+			projects := make([]Project, defaultPerPage)
+			for i := range projects {
+				projects[i] = Project{Name: "package", Description: "spans\nlines, with \"quotes\""}
+			}
+			json.NewEncoder(w).Encode(projects)
+		})
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+
+		stats, err := IngestContext(ctx, Options{Platform: "NPM", APIKey: "secret", Workers: 4, RequestsPerMinute: -1}, outPath)
+		if !errors.Is(err, ErrInterrupted) {
+			t.Errorf("Expected ErrInterrupted, got %v", err)
+		}
+		if stats.Packages == 0 {
+			t.Fatalf("Expected pages to be written before the deadline")
+		}
+		if rows := len(readCSV(t, readCheckpoint(t, outPath).Temp)); rows != stats.Packages+1 {
+			t.Errorf("Expected %d rows including the header, got %d", stats.Packages+1, rows)
+		}
+	})
+
+	t.Run("Aborts a hanging request when the deadline passes", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})
+
+		_, err := IngestContext(ctx, Options{Platform: "NPM", APIKey: "secret", Workers: 1}, filepath.Join(t.TempDir(), "result.csv"))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+	})
+}
+
+func TestIngestConcurrentWorkers(t *testing.T) {
+	const pages = 50
+	// slowServer serves pages full pages, taking a little while for each so that workers overlap
+	slowServer := func(t *testing.T) {
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			time.Sleep(time.Duration(5+page%3*5) * time.Millisecond)
+			if page > pages {
+				w.Write([]byte("[]"))
+				return
+			}
+			projects := make([]Project, defaultPerPage)
+			for i := range projects {
+				projects[i] = Project{Name: fmt.Sprintf("package-%03d-%02d", page, i)}
+			}
+			json.NewEncoder(w).Encode(projects)
+		})
+	}
+	ingestWith := func(t *testing.T, workers int) ([][]string, time.Duration) {
+		slowServer(t)
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+		start := time.Now()
+		_, err := Ingest(Options{Platform: "NPM", APIKey: "secret", RequestsPerMinute: -1, Workers: workers}, outPath)
+		elapsed := time.Since(start)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return readCSV(t, outPath), elapsed
+	}
+
+	serial, serialTime := ingestWith(t, 1)
+	concurrent, concurrentTime := ingestWith(t, 8)
+
+	t.Run("Writes the pages in order", func(t *testing.T) {
+		if len(concurrent) != pages*defaultPerPage+1 {
+			t.Fatalf("Expected %d rows including the header, got %d", pages*defaultPerPage+1, len(concurrent))
+		}
+		for i := range serial {
+			if concurrent[i][0] != serial[i][0] {
+				t.Fatalf("Expected row %d to be %s, got %s", i, serial[i][0], concurrent[i][0])
+			}
+		}
+	})
+
+	t.Run("Is faster than fetching serially", func(t *testing.T) {
+		if concurrentTime > serialTime/2 {
+			t.Errorf("Expected 8 workers to take less than half of the serial %v, took %v", serialTime, concurrentTime)
+		}
+	})
+}
+
+func TestIngestConcurrentFailure(t *testing.T) {
+	var requests int64
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if r.URL.Query().Get("page") == "3" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(pageOfProjects(r, defaultPerPage))
+	})
+
+	stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", RequestsPerMinute: -1, Workers: 4}, filepath.Join(t.TempDir(), "result.csv"))
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 status error, got %v", err)
+	}
+	if stats.Packages != 2*defaultPerPage {
+		t.Errorf("Expected the %d packages before the failed page to be stats.Packages, got %d", 2*defaultPerPage, stats.Packages)
+	}
+	// Without the cancellation the workers would keep fetching forever, as every other page is full
+	if n := atomic.LoadInt64(&requests); n > 10 {
+		t.Errorf("Expected the remaining fetches to be cancelled, got %d requests", n)
+	}
+}
+
+func TestIngestConcurrentDependencies(t *testing.T) {
+	const packages = 12
+	var inFlight, maxInFlight int64
+	failing := ""
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			if r.URL.Query().Get("page") != "1" {
+				w.Write([]byte("[]"))
+				return
+			}
+			projects := make([]Project, packages)
+			for i := range projects {
+				projects[i] = Project{Name: fmt.Sprintf("package-%02d", i), Platform: "NPM", LatestReleaseNumber: "1.0.0"}
+			}
+			json.NewEncoder(w).Encode(projects)
+			return
+		}
+		n := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+		for {
+			highest := atomic.LoadInt64(&maxInFlight)
+			if n <= highest || atomic.CompareAndSwapInt64(&maxInFlight, highest, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if r.URL.Path == failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		name := strings.Split(r.URL.Path, "/")[2]
+		fmt.Fprintf(w, `{"dependencies": [{"name": "dependency-of-%s", "requirements": "*"}]}`, name)
+	})
+	opts := Options{Platform: "NPM", APIKey: "secret", PerPage: packages, RequestsPerMinute: -1, Workers: 4, Dependencies: true}
+
+	t.Run("Fetches at most Workers dependencies at once and keeps the order", func(t *testing.T) {
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+		if _, err := Ingest(opts, outPath); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if n := atomic.LoadInt64(&maxInFlight); n < 2 || n > 4 {
+			t.Errorf("Expected between 2 and 4 concurrent dependency requests, got %d", n)
+		}
+		records := readCSV(t, outPath)
+		if len(records) != packages+1 {
+			t.Fatalf("Expected %d rows including the header, got %d", packages+1, len(records))
+		}
+		dependencies := slices.Index(csvHeader, "dependencies")
+		for i, record := range records[1:] {
+			if expected := fmt.Sprintf("dependency-of-package-%02d@*", i); record[dependencies] != expected {
+				t.Errorf("Expected the dependencies %s in row %d, got %s", expected, i+1, record[dependencies])
+			}
+		}
+	})
+
+	t.Run("Returns the error of a failed fetch", func(t *testing.T) {
+		failing = "/NPM/package-07/1.0.0/dependencies"
+		opts := opts
+		opts.MaxAttempts = 1
+		_, err := Ingest(opts, filepath.Join(t.TempDir(), "result.csv"))
+		var statusErr *statusError
+		if !errors.As(err, &statusErr) || !strings.Contains(err.Error(), "package-07") {
+			t.Errorf("Expected the status error of package-07, got %v", err)
+		}
+	})
+}
+
+// failingWriter accepts limit bytes and fails every write after that.
+type failingWriter struct {
+	limit int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, errors.New("disk full")
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+func TestIngestPagesWriteErrors(t *testing.T) {
+	var pages []int
+	pagedServer(t, 5*defaultPerPage, &pages)
+	opts := Options{Platform: "NPM", APIKey: "secret", PerPage: defaultPerPage, MaxAttempts: 1, Workers: 1}
+
+	_, err := defaultClient().ingestPages(context.Background(), csvProjectWriter{writer: csv.NewWriter(&failingWriter{limit: 100})}, opts, packageSet{}, nil, nil, 0, nil)
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("Expected the write error to be returned, got %v", err)
+	}
+	// The next page may already be on its way while the first one is flushed, but no further
+	if len(pages) > 2 {
+		t.Errorf("Expected ingestion to stop at the first failed flush, got requests for pages %v", pages)
+	}
+}
+
+func TestIngestWritesHeaderOnce(t *testing.T) {
+	var pages []int
+	pagedServer(t, 3*defaultPerPage, &pages)
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+
+	if _, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Workers: 1}, outPath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	headers := 0
+	for _, record := range readCSV(t, outPath) {
+		if record[0] == csvHeader[0] {
+			headers++
+		}
+	}
+	if headers != 1 {
+		t.Errorf("Expected exactly one header row, got %d", headers)
+	}
+}
+
+func TestIngestPlatforms(t *testing.T) {
+	t.Run("Rejects unknown platforms before sending a request", func(t *testing.T) {
+		requests := 0
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			requests++
+		})
+
+		_, err := IngestPlatforms(context.Background(), Options{APIKey: "secret"}, []string{"NPM", "Nope"},
+			filepath.Join(t.TempDir(), "result.csv"))
+		if !errors.Is(err, ErrUnknownPlatform) {
+			t.Errorf("Expected ErrUnknownPlatform, got %v", err)
+		}
+		if requests != 0 {
+			t.Errorf("Expected no requests, got %d", requests)
+		}
+	})
+
+	t.Run("Writes all platforms to one file", func(t *testing.T) {
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			platform := r.URL.Query().Get("platforms")
+			json.NewEncoder(w).Encode([]Project{{Name: "package-" + platform}})
+		})
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+
+		stats, err := IngestPlatforms(context.Background(), Options{APIKey: "secret", Workers: 1},
+			[]string{"npm", "Cargo"}, outPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stats.Packages != 2 {
+			t.Errorf("Expected 2 packages, got %d", stats.Packages)
+		}
+		records := readCSV(t, outPath)
+		if len(records) != 3 {
+			t.Fatalf("Expected a header and two rows, got %d rows", len(records))
+		}
+		for i, expected := range []string{"NPM", "Cargo"} {
+			if name, platform := records[i+1][0], records[i+1][1]; name != "package-"+expected || platform != expected {
+				t.Errorf("Expected package-%s on %s, got %s on %s", expected, expected, name, platform)
+			}
+		}
+	})
+}
+
+func TestFetchDependencies(t *testing.T) {
+	t.Setenv(APIKeyEnvVar, "secret")
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/NPM/left-pad/1.3.0/dependencies" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"dependencies": [
+			{"name": "tape", "platform": "NPM", "requirements": "^4.0.0", "kind": "Development", "latest": "5.5.3"},
+			{"name": "internal-pad", "platform": "NPM", "requirements": "*", "kind": "runtime", "optional": true, "latest": null}
+		]}`))
+	})
+
+	t.Run("Decodes the dependencies", func(t *testing.T) {
+		dependencies, err := FetchDependencies(context.Background(), "npm", "left-pad", "1.3.0")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expected := []Dependency{
+			{Name: "tape", Platform: "NPM", Requirements: "^4.0.0", Kind: "Development", Resolved: true},
+			{Name: "internal-pad", Platform: "NPM", Requirements: "*", Kind: "runtime", Optional: true},
+		}
+		if len(dependencies) != len(expected) {
+			t.Fatalf("Expected %d dependencies, got %v", len(expected), dependencies)
+		}
+		for i, dependency := range dependencies {
+			if dependency != expected[i] {
+				t.Errorf("Expected %+v, got %+v", expected[i], dependency)
+			}
+		}
+	})
+
+	t.Run("Reports unknown versions", func(t *testing.T) {
+		if _, err := FetchDependencies(context.Background(), "NPM", "left-pad", "0.0.1"); !errors.Is(err, ErrVersionNotFound) {
+			t.Errorf("Expected ErrVersionNotFound, got %v", err)
+		}
+	})
+}
+
+func TestIngestDependencies(t *testing.T) {
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`[
+				{"name": "left-pad", "platform": "NPM", "latest_release_number": "1.3.0"},
+				{"name": "deleted", "platform": "NPM", "latest_release_number": "0.1.0"}
+			]`))
+		case "/NPM/left-pad/1.3.0/dependencies":
+			w.Write([]byte(`{"dependencies": [{"name": "tape", "requirements": "^4.0.0"}, {"name": "nyc", "requirements": "*"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+
+	stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Workers: 1, Dependencies: true}, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 2 {
+		t.Errorf("Expected the package with a deleted release to be written as well, got %d packages", stats.Packages)
+	}
+	records := readCSV(t, outPath)
+	dependencies := slices.Index(csvHeader, "dependencies")
+	if actual := records[1][dependencies]; actual != "tape@^4.0.0;nyc@*" {
+		t.Errorf("Expected the dependencies tape@^4.0.0;nyc@*, got %s", actual)
+	}
+	if actual := records[2][dependencies]; actual != "" {
+		t.Errorf("Expected no dependencies for the deleted release, got %s", actual)
+	}
+}
+
+func TestIngestPrereleases(t *testing.T) {
+	var dependencyRequests []string
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			dependencyRequests = append(dependencyRequests, r.URL.Path)
+			w.Write([]byte(`{"dependencies": []}`))
+			return
+		}
+		w.Write([]byte(`[{"name": "left-pad", "platform": "NPM", "latest_release_number": "2.0.0-rc.1",
+			"versions": [{"number": "1.3.0"}, {"number": "2.0.0-beta.1"}, {"number": "2.0.0-rc.1"}]}]`))
+	})
+	tests := []struct {
+		name              string
+		includePrerelease bool
+		versions          string
+		latest            string
+	}{
+		{"Left out by default", false, "1.3.0", "1.3.0"},
+		{"Kept when asked for", true, "1.3.0;2.0.0-beta.1;2.0.0-rc.1", "2.0.0-rc.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dependencyRequests = nil
+			outPath := filepath.Join(t.TempDir(), "result.csv")
+			opts := Options{Platform: "NPM", APIKey: "secret", Workers: 1, Dependencies: true, IncludePrerelease: test.includePrerelease}
+			if _, err := Ingest(opts, outPath); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			records := readCSV(t, outPath)
+			if len(records) != 2 {
+				t.Fatalf("Expected a header and one row, got %d rows", len(records))
+			}
+			if versions := records[1][8]; versions != test.versions {
+				t.Errorf("Expected versions %s, got %s", test.versions, versions)
+			}
+			if latest := records[1][6]; latest != test.latest {
+				t.Errorf("Expected latest release %s, got %s", test.latest, latest)
+			}
+			expected := "/NPM/left-pad/" + test.latest + "/dependencies"
+			if len(dependencyRequests) != 1 || dependencyRequests[0] != expected {
+				t.Errorf("Expected the dependencies of the latest release to be requested, got %v", dependencyRequests)
+			}
+		})
+	}
+}
+
+func TestIngestLogging(t *testing.T) {
+	var logs strings.Builder
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+	})
+	var pages []int
+	pagedServer(t, progressInterval+5, &pages)
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+
+	if _, err := Ingest(Options{Platform: "NPM", APIKey: "secret", PerPage: 100, Workers: 1}, outPath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, expected := range []string{
+		`level=DEBUG msg="Sending request" url="http://127.0.0.1`,
+		`level=DEBUG msg="Received response" url="http://127.0.0.1`,
+		` status=200`,
+		`level=DEBUG msg="Wrote page" platform=NPM page=3 packages=100`,
+		`level=INFO msg=Ingesting platform=NPM page=10 packages=1000`,
+		`level=INFO msg="Ingestion finished" out=` + outPath + ` stats.packages=1005`,
+	} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("Expected the logs to contain %s, got:\n%s", expected, logs.String())
+		}
+	}
+	if strings.Contains(logs.String(), "secret") {
+		t.Error("Expected the API key to be kept out of the logs")
+	}
+}
+
+func TestVersionPublishedTime(t *testing.T) {
+	tests := []struct {
+		publishedAt string
+		expected    string
+	}{
+		{"2018-04-09T01:52:29.000Z", "2018-04-09T01:52:29Z"},
+		{"2022-06-09T16:44:38.741917+02:00", "2022-06-09T14:44:38Z"},
+		{"", ""},
+		{"1970-01-01T00:00:00Z", ""},
+		{"0001-01-01T00:00:00Z", ""},
+		{"last tuesday", ""},
+	}
+	for _, test := range tests {
+		field, missing := publishedAtField(Version{PublishedAt: test.publishedAt})
+		if field != test.expected || missing != (test.expected == "") {
+			t.Errorf("Expected %q for %q, got %q with missing %v", test.expected, test.publishedAt, field, missing)
+		}
+	}
+}
+
+func TestIngestVersions(t *testing.T) {
+	var projectRequests []string
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `[
+				{"name": "left-pad", "platform": "NPM", "versions": [{"number": "1.3.0"}]},
+				{"name": "tape", "platform": "NPM"},
+				{"name": "removed", "platform": "NPM"}
+			]`)
+		case "/NPM/tape":
+			projectRequests = append(projectRequests, r.URL.Path)
+			fmt.Fprint(w, `{"name": "tape", "versions": [{"number": "5.5.3", "published_at": "2022-04-08T05:42:35.000Z"}]}`)
+		default:
+			projectRequests = append(projectRequests, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	for _, fetch := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Versions %v", fetch), func(t *testing.T) {
+			projectRequests = nil
+			outPath := filepath.Join(t.TempDir(), "result.csv")
+			if _, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Workers: 1, Versions: fetch}, outPath); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			expectedRequests, expectedVersions := "/NPM/tape,/NPM/removed", "5.5.3"
+			if !fetch {
+				expectedRequests, expectedVersions = "", ""
+			}
+			if actual := strings.Join(projectRequests, ","); actual != expectedRequests {
+				t.Errorf("Expected requests for %q, got %q", expectedRequests, actual)
+			}
+			versions := slices.Index(csvHeader, "versions")
+			if actual := readCSV(t, outPath)[2][versions]; actual != expectedVersions {
+				t.Errorf("Expected the versions of tape to be %q, got %q", expectedVersions, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package ingest
+
+import (
+	"slices"
+	"strings"
+)
+
+// spdxLicenses are the SPDX identifiers of the licenses that are common on the platforms libraries.io covers. They are
+// matched regardless of case, and licenses that are not listed are kept as they are.
+var spdxLicenses = []string{
+	"0BSD",
+	"AFL-3.0",
+	"AGPL-3.0",
+	"AGPL-3.0-only",
+	"AGPL-3.0-or-later",
+	"Apache-1.1",
+	"Apache-2.0",
+	"Artistic-2.0",
+	"BlueOak-1.0.0",
+	"BSD-1-Clause",
+	"BSD-2-Clause",
+	"BSD-3-Clause",
+	"BSL-1.0",
+	"CC-BY-3.0",
+	"CC-BY-4.0",
+	"CC-BY-SA-4.0",
+	"CC0-1.0",
+	"CDDL-1.0",
+	"CDDL-1.1",
+	"EPL-1.0",
+	"EPL-2.0",
+	"EUPL-1.2",
+	"GPL-2.0",
+	"GPL-2.0-only",
+	"GPL-2.0-or-later",
+	"GPL-3.0",
+	"GPL-3.0-only",
+	"GPL-3.0-or-later",
+	"ISC",
+	"LGPL-2.1",
+	"LGPL-2.1-only",
+	"LGPL-2.1-or-later",
+	"LGPL-3.0",
+	"LGPL-3.0-only",
+	"LGPL-3.0-or-later",
+	"MIT",
+	"MIT-0",
+	"MPL-1.1",
+	"MPL-2.0",
+	"MS-PL",
+	"OFL-1.1",
+	"PostgreSQL",
+	"PSF-2.0",
+	"Python-2.0",
+	"Ruby",
+	"Unlicense",
+	"UPL-1.0",
+	"WTFPL",
+	"Zlib",
+}
+
+// licenseAliases maps names that are often used instead of an SPDX identifier, in lower case, to the identifier. Besides
+// short forms, they include the names Maven POMs and the license classifiers of PyPI use, without the classifier
+// prefix.
+var licenseAliases = map[string]string{
+	"apache 2.0":                               "Apache-2.0",
+	"apache-2":                                 "Apache-2.0",
+	"apache2":                                  "Apache-2.0",
+	"apache license 2.0":                       "Apache-2.0",
+	"apache license, version 2.0":              "Apache-2.0",
+	"apache software license":                  "Apache-2.0",
+	"the apache license, version 2.0":          "Apache-2.0",
+	"the apache software license, version 2.0": "Apache-2.0",
+	"bsd":                                                 "BSD-3-Clause",
+	"bsd license":                                         "BSD-3-Clause",
+	"new bsd license":                                     "BSD-3-Clause",
+	"the bsd license":                                     "BSD-3-Clause",
+	"eclipse public license - v 1.0":                      "EPL-1.0",
+	"eclipse public license 1.0":                          "EPL-1.0",
+	"eclipse public license - v 2.0":                      "EPL-2.0",
+	"eclipse public license 2.0 (epl-2.0)":                "EPL-2.0",
+	"gnu affero general public license v3":                "AGPL-3.0",
+	"gnu general public license v2 (gplv2)":               "GPL-2.0",
+	"gnu general public license v3 (gplv3)":               "GPL-3.0",
+	"gnu lesser general public license v2 (lgplv2)":       "LGPL-2.1",
+	"gnu lesser general public license v3 (lgplv3)":       "LGPL-3.0",
+	"gnu library or lesser general public license (lgpl)": "LGPL-2.1",
+	"gplv2":                                "GPL-2.0",
+	"gplv3":                                "GPL-3.0",
+	"isc license (iscl)":                   "ISC",
+	"lgplv3":                               "LGPL-3.0",
+	"mit license":                          "MIT",
+	"the mit license":                      "MIT",
+	"mozilla public license 2.0 (mpl 2.0)": "MPL-2.0",
+	"mpl 2.0":                              "MPL-2.0",
+	"public domain":                        "Unlicense",
+	"python software foundation license":   "PSF-2.0",
+	"the unlicense (unlicense)":            "Unlicense",
+	"zlib/libpng license":                  "Zlib",
+}
+
+// spdxByLowerCase maps the lower case form of spdxLicenses and licenseAliases to the SPDX identifier.
+var spdxByLowerCase = func() map[string]string {
+	identifiers := make(map[string]string, len(spdxLicenses)+len(licenseAliases))
+	for _, identifier := range spdxLicenses {
+		identifiers[strings.ToLower(identifier)] = identifier
+	}
+	for alias, identifier := range licenseAliases {
+		identifiers[alias] = identifier
+	}
+	return identifiers
+}()
+
+// normalizeLicense returns the SPDX identifier of a single license, such as MIT for mit or Apache-2.0 for apache2, in
+// the capitalization SPDX defines. Licenses it does not recognize are returned trimmed but otherwise verbatim.
+func normalizeLicense(license string) string {
+	license = strings.TrimSpace(license)
+	if identifier, ok := spdxByLowerCase[strings.ToLower(license)]; ok {
+		return identifier
+	}
+	return license
+}
+
+// joinLicenses normalizes each of the licenses of a package, for the sources that list them one by one, and joins them
+// into the comma-separated form of libraries.io, leaving out empty and repeated ones. Commas in licenses that are not
+// recognized are replaced by spaces, so that they are not split apart later.
+func joinLicenses(licenses []string) string {
+	var joined []string
+	for _, license := range licenses {
+		license = strings.Join(strings.Fields(strings.ReplaceAll(normalizeLicense(license), ",", " ")), " ")
+		if license != "" && !slices.Contains(joined, license) {
+			joined = append(joined, license)
+		}
+	}
+	return strings.Join(joined, ",")
+}
+
+// splitLicenses splits the comma-separated licenses field of libraries.io and normalizes each license. It returns nil
+// if there are none.
+func splitLicenses(licenses string) []string {
+	var normalized []string
+	for _, license := range strings.Split(licenses, ",") {
+		if license = normalizeLicense(license); license != "" {
+			normalized = append(normalized, license)
+		}
+	}
+	return normalized
+}
+
+// normalizeProject cleans up the fields libraries.io fills in inconsistently: the licenses become a comma-separated
+// list of SPDX identifiers, taken from the normalized licenses of libraries.io where it has them, and a repository
+// URL of "null" becomes empty.
+func normalizeProject(project Project) Project {
+	if len(project.NormalizedLicenses) > 0 {
+		project.Licenses, project.NormalizedLicenses = joinLicenses(project.NormalizedLicenses), nil
+	}
+	project.Licenses = strings.Join(splitLicenses(project.Licenses), ",")
+	if strings.EqualFold(strings.TrimSpace(project.RepositoryURL), "null") {
+		project.RepositoryURL = ""
+	}
+	return project
+}
+
+// licenseFilter drops packages whose licenses are all on an exclusion list.
+type licenseFilter map[string]bool
+
+// newLicenseFilter creates a filter for the given licenses, which are normalized like the licenses of packages. It
+// returns nil, which keeps every package, if there are none.
+func newLicenseFilter(excluded []string) licenseFilter {
+	if len(excluded) == 0 {
+		return nil
+	}
+	filter := make(licenseFilter, len(excluded))
+	for _, license := range excluded {
+		filter[strings.ToLower(normalizeLicense(license))] = true
+	}
+	return filter
+}
+
+// excludes reports whether every license of project is excluded. A package with several licenses may be used under
+// any of them, so it is kept as long as one is acceptable. Packages without a license are kept.
+func (f licenseFilter) excludes(project Project) bool {
+	licenses := splitLicenses(project.Licenses)
+	if len(f) == 0 || len(licenses) == 0 {
+		return false
+	}
+	for _, license := range licenses {
+		if !f[strings.ToLower(license)] {
+			return false
+		}
+	}
+	return true
+}
+
+// keep returns the projects the filter does not exclude, reusing the backing array of projects.
+func (f licenseFilter) keep(projects []Project) []Project {
+	if len(f) == 0 {
+		return projects
+	}
+	kept := projects[:0]
+	for _, project := range projects {
+		if !f.excludes(project) {
+			kept = append(kept, project)
+		}
+	}
+	return kept
+}
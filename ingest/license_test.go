@@ -0,0 +1,112 @@
+package ingest
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeProject(t *testing.T) {
+	tests := []struct {
+		licenses, repositoryURL       string
+		expectedLicenses, expectedURL string
+	}{
+		{"mit", "https://github.com/stevemao/left-pad", "MIT", "https://github.com/stevemao/left-pad"},
+		{"MIT, apache-2.0", "", "MIT,Apache-2.0", ""},
+		{"Apache 2.0,bsd-3-clause", "null", "Apache-2.0,BSD-3-Clause", ""},
+		{" Custom License ,,ISC", "NULL", "Custom License,ISC", ""},
+		{"", "", "", ""},
+	}
+	for _, test := range tests {
+		project := normalizeProject(Project{Licenses: test.licenses, RepositoryURL: test.repositoryURL})
+		if project.Licenses != test.expectedLicenses {
+			t.Errorf("Expected licenses %q for %q, got %q", test.expectedLicenses, test.licenses, project.Licenses)
+		}
+		if project.RepositoryURL != test.expectedURL {
+			t.Errorf("Expected repository URL %q for %q, got %q", test.expectedURL, test.repositoryURL, project.RepositoryURL)
+		}
+	}
+
+	t.Run("Prefers the normalized licenses", func(t *testing.T) {
+		project := normalizeProject(Project{Licenses: "Apache License, Version 2.0", NormalizedLicenses: []string{"Apache-2.0", "mit"}})
+		if project.Licenses != "Apache-2.0,MIT" || project.NormalizedLicenses != nil {
+			t.Errorf("Expected the licenses Apache-2.0,MIT, got %+v", project)
+		}
+	})
+}
+
+func TestJoinLicenses(t *testing.T) {
+	tests := []struct {
+		licenses []string
+		expected string
+	}{
+		{[]string{"The Apache Software License, Version 2.0", "MIT License"}, "Apache-2.0,MIT"},
+		{[]string{"Python Software Foundation License", "PSF-2.0", " "}, "PSF-2.0"},
+		{[]string{"Custom, Non-Commercial  License"}, "Custom Non-Commercial License"},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		if actual := joinLicenses(test.licenses); actual != test.expected {
+			t.Errorf("Expected %q for %q, got %q", test.expected, test.licenses, actual)
+		}
+	}
+}
+
+func TestLicenseFilter(t *testing.T) {
+	filter := newLicenseFilter([]string{"gpl-3.0", "Proprietary"})
+	tests := []struct {
+		licenses string
+		excluded bool
+	}{
+		{"GPL-3.0", true},
+		{"proprietary", true},
+		{"GPL-3.0,Proprietary", true},
+		{"MIT,GPL-3.0", false},
+		{"MIT", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if actual := filter.excludes(Project{Licenses: test.licenses}); actual != test.excluded {
+			t.Errorf("Expected excludes to be %v for %q, got %v", test.excluded, test.licenses, actual)
+		}
+	}
+	if newLicenseFilter(nil).excludes(Project{Licenses: "GPL-3.0"}) {
+		t.Error("Expected an empty exclusion list to keep every package")
+	}
+}
+
+func TestIngestExcludeLicenses(t *testing.T) {
+	pages := map[string]string{
+		"1": `[{"name": "left-pad", "licenses": "WTFPL"}, {"name": "closed", "licenses": "Proprietary"}]`,
+		"2": `[{"name": "tape", "licenses": "mit"}]`,
+	}
+	requests := 0
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		page, ok := pages[r.URL.Query().Get("page")]
+		if !ok {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		w.Write([]byte(page))
+	})
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+	opts := Options{Platform: "NPM", APIKey: "secret", PerPage: 2, Workers: 1, ExcludeLicenses: []string{"proprietary"}}
+
+	stats, err := Ingest(opts, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// The first page is only short after the excluded package is dropped, which must not end the ingestion
+	if requests != 2 {
+		t.Errorf("Expected both pages to be requested, got %d requests", requests)
+	}
+	if stats.Packages != 2 {
+		t.Errorf("Expected 2 packages, got %d", stats.Packages)
+	}
+	names := strings.Join(readPackageNames(t, outPath, FormatCSV), ",")
+	if names != "left-pad,tape" {
+		t.Errorf("Expected left-pad,tape, got %s", names)
+	}
+}
@@ -0,0 +1,124 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// ReadNameList reads a file with one package name per line, such as a list of the most depended upon packages taken
+// from elsewhere. Blank lines are skipped, and a # starts a comment that runs to the end of the line, so that lists
+// can be annotated. Surrounding space is trimmed from every name. A gzip-compressed file is decompressed while it is
+// read.
+func ReadNameList(path string) ([]string, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if name := strings.TrimSpace(line); name != "" {
+			names = append(names, name)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return names, nil
+}
+
+// IngestList downloads the packages of a platform named in namesFile, which is read by ReadNameList, from libraries.io
+// and writes them to outPath in FormatCSV, with the same fields as Ingest. Each package takes a request for its
+// details, which include all versions, and one for the dependencies of its latest release, instead of the pages of a
+// search. Packages libraries.io does not know or that have no releases left are skipped and listed in
+// SkippedPackagesReport in the directory of outPath. The API key is read from LIBRARIESIO_API_KEY.
+func IngestList(ctx context.Context, platform, namesFile, outPath string) (Stats, error) {
+	return defaultClient().IngestList(ctx, Options{}, platform, namesFile, outPath)
+}
+
+// IngestList is like the package-level IngestList but sends all requests through c and takes its settings from opts.
+// The packages are fetched in batches of opts.PerPage with opts.Workers concurrent requests at opts.RequestsPerMinute,
+// and the limits and filters of opts apply as they do for Ingest. opts.Platform, MaxPages, Versions, Dependencies
+// and Vulnerabilities do not apply, since the versions come with the details and the dependencies are always fetched.
+func (c *Client) IngestList(ctx context.Context, opts Options, platform, namesFile, outPath string) (Stats, error) {
+	opts, platforms, err := prepareIngest(opts, []string{platform})
+	if err != nil {
+		return Stats{}, err
+	}
+	opts.Platform = platforms[0]
+	names, err := ReadNameList(namesFile)
+	if err != nil {
+		return Stats{}, err
+	}
+	f := c.newFetcher(opts)
+	stats := newStatsCollector()
+	f.stats = stats
+
+	skipped := newSkippedPackages()
+	// Already validated by prepareIngest
+	columns, _ := csvColumnIndices(opts.Columns)
+	_, err = writeProjectsFileAt(ctx, outPath, opts.Format, columns, resumePoint{}, opts.CompressionLevel, func(writer projectWriter, _ *outputFile) (int, error) {
+		total := len(names)
+		if opts.MaxPackages > 0 {
+			total = min(total, opts.MaxPackages)
+		}
+		return ingestNamedPackages(ctx, withProgress(writer, opts.Progress, 0, total), opts, names, stats, func(ctx context.Context, project *Project) error {
+			name := project.Name
+			found, err := c.fetchListedProject(ctx, opts, name, f)
+			switch {
+			case errors.Is(err, errProjectNotFound):
+				slog.Warn("Package not found, skipping it", "platform", opts.Platform, "package", name)
+			case err != nil:
+				return err
+			default:
+				*project = found
+			}
+			skipped.check(name, opts.Platform, project)
+			return nil
+		})
+	})
+	if err == nil {
+		err = skipped.write(ctx, outPath, names)
+	}
+	parameters := opts.manifestParameters(platforms)
+	parameters.Inputs = []string{namesFile}
+	run := manifestRun{source: SourceLibrariesIO, parameters: parameters, format: opts.Format, files: []string{outPath}}
+	return finish(ctx, outPath, run, stats.stats(), err)
+}
+
+// fetchListedProject requests the details of a package and the dependencies of its latest release, after removing
+// prereleases unless opts includes them. A release libraries.io has no dependencies for is written without them.
+func (c *Client) fetchListedProject(ctx context.Context, opts Options, name string, f *fetcher) (Project, error) {
+	project, err := f.fetchProject(ctx, c.projectURLFor(opts.Platform, name, opts.APIKey))
+	if err != nil {
+		if errors.Is(err, errProjectNotFound) {
+			return Project{}, err
+		}
+		return Project{}, fmt.Errorf("fetching %s: %w", name, err)
+	}
+	if project.Platform == "" {
+		project.Platform = opts.Platform
+	}
+	project = withPrereleases(normalizeProject(project), opts.IncludePrerelease)
+	if project.LatestReleaseNumber == "" {
+		return project, nil
+	}
+	query := c.dependenciesURL(opts.Platform, name, project.LatestReleaseNumber, opts.APIKey)
+	dependencies, err := f.fetchDependencies(ctx, query)
+	if errors.Is(err, ErrVersionNotFound) {
+		slog.Warn("No dependencies found, skipping them", "platform", opts.Platform, "package", name,
+			"version", project.LatestReleaseNumber)
+		return project, nil
+	}
+	if err != nil {
+		return Project{}, fmt.Errorf("fetching dependencies of %s %s: %w", name, project.LatestReleaseNumber, err)
+	}
+	project.Dependencies = dependencies
+	return project, nil
+}
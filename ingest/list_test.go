@@ -0,0 +1,74 @@
+package ingest
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadNameList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "names.txt")
+	if err := os.WriteFile(path, []byte("# Top packages\nreact\n\n  @babel/core  # scoped\n#lodash\nleft-pad\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	names, err := ReadNameList(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if expected := []string{"react", "@babel/core", "left-pad"}; !slices.Equal(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+}
+
+func TestIngestList(t *testing.T) {
+	var paths []string
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		switch r.URL.EscapedPath() {
+		case "/NPM/@babel%2Fcore":
+			w.Write([]byte(`{"name": "@babel/core", "platform": "NPM", "latest_release_number": "7.0.0",
+				"versions": [{"number": "7.0.0"}, {"number": "8.0.0-alpha.1"}]}`))
+		case "/NPM/@babel%2Fcore/7.0.0/dependencies":
+			w.Write([]byte(`{"dependencies": [{"name": "debug", "requirements": "^4.1.0", "latest": "4.3.4"}]}`))
+		case "/NPM/left-pad":
+			w.Write([]byte(`{"name": "left-pad", "platform": "NPM"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	dir := t.TempDir()
+	namesFile := filepath.Join(dir, "names.txt")
+	if err := os.WriteFile(namesFile, []byte("@babel/core\nmissing # gone\nleft-pad\nmissing\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(dir, "out", "result.csv")
+
+	stats, err := defaultClient().IngestList(context.Background(), Options{APIKey: "secret", Workers: 2}, "npm", namesFile, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 1 {
+		t.Errorf("Expected 1 package, got %d", stats.Packages)
+	}
+	records := readCSV(t, outPath)
+	if len(records) != 2 || records[1][0] != "@babel/core" {
+		t.Fatalf("Expected only @babel/core, got %v", records)
+	}
+	if actual := records[1][slices.Index(csvHeader, "versions")]; actual != "7.0.0" {
+		t.Errorf("Expected the prerelease to be removed, got %s", actual)
+	}
+	if actual := records[1][slices.Index(csvHeader, "dependencies")]; actual != "debug@^4.1.0" {
+		t.Errorf("Expected the dependencies of the latest release, got %s", actual)
+	}
+	if slices.Contains(paths, "/NPM/left-pad//dependencies") {
+		t.Error("Expected no dependency request for a package without a release")
+	}
+
+	expected := [][]string{{"platform", "name", "reason"}, {"NPM", "missing", "not found"}, {"NPM", "left-pad", "no releases"}}
+	if report := readCSV(t, filepath.Join(dir, "out", SkippedPackagesReport)); !slices.EqualFunc(report, expected, slices.Equal[[]string]) {
+		t.Errorf("Expected the report %v, got %v", expected, report)
+	}
+}
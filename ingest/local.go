@@ -0,0 +1,366 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The npm files IngestLocal reads. npm-shrinkwrap.json is a package-lock.json that is published with a package.
+const (
+	npmManifestFile   = "package.json"
+	npmLockFile       = "package-lock.json"
+	npmShrinkwrapFile = "npm-shrinkwrap.json"
+)
+
+// npmManifest is a package.json, or an entry of the packages of a package-lock.json, which has the same fields.
+type npmManifest struct {
+	npmVersion
+	Name                 string            `json:"name"`
+	Version              string            `json:"version"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+}
+
+// npmLockfile is a package-lock.json. Lockfile version 1 nests the installed packages in Dependencies, versions 2 and
+// 3 list them in Packages by their path in node_modules. Version 2 has both, of which Packages is used.
+type npmLockfile struct {
+	LockfileVersion int                          `json:"lockfileVersion"`
+	Packages        map[string]npmLockPackage    `json:"packages"`
+	Dependencies    map[string]npmLockDependency `json:"dependencies"`
+}
+
+// npmLockPackage is an entry of the packages of a lockfile of version 2 or 3.
+type npmLockPackage struct {
+	npmManifest
+	// Link is set for a symbolic link to a local directory, e.g. a workspace, which has an entry of its own.
+	Link bool `json:"link"`
+}
+
+// npmLockDependency is an installed package in a lockfile of version 1, with the packages installed below it.
+type npmLockDependency struct {
+	Version      string                       `json:"version"`
+	Requires     map[string]string            `json:"requires"`
+	Dependencies map[string]npmLockDependency `json:"dependencies"`
+}
+
+// IngestLocal reads the package.json and package-lock.json files, as well as npm-shrinkwrap.json files, in the
+// directory tree at dir, e.g. a corpus of checked-out repositories, and writes the packages they describe to outPath
+// in the format chosen in opts, with the same fields as Ingest. node_modules and hidden directories are not searched.
+//
+// Every package.json is a package with its own version and the dependencies, devDependencies, optionalDependencies
+// and peerDependencies it declares, and every lockfile adds the packages installed from the registry with the
+// dependencies they were installed with. Both lockfileVersion 1 and the flat packages map of versions 2 and 3 are
+// read. The versions of a package found in several places are merged into one record, whose dependencies are those
+// of its latest version, and a package.json takes precedence over lockfiles for the version it declares. Dependencies
+// on local paths, such as file:../shared, are kept with Local set, and packages linked into node_modules from a local
+// path are only read from their own package.json.
+//
+// Files that cannot be decoded, and package.json files without a name, are skipped with a warning. Only opts.Format,
+// Columns, IncludePrerelease, ExcludeLicenses, MaxPackages and Progress apply.
+func IngestLocal(ctx context.Context, opts Options, dir, outPath string) (Stats, error) {
+	projects, err := readLocalProjects(ctx, opts, dir)
+	if err != nil {
+		return Stats{}, err
+	}
+	// Already validated by readLocalProjects
+	columns, _ := csvColumnIndices(opts.Columns)
+	stats := newStatsCollector()
+	_, err = writeProjectsFileAt(ctx, outPath, opts.Format, columns, resumePoint{}, opts.CompressionLevel, func(writer projectWriter, _ *outputFile) (int, error) {
+		return writeLocalProjects(withProgress(writer, opts.Progress, 0, len(projects)), projects, stats)
+	})
+	run := manifestRun{source: SourceLocal, parameters: localParameters(opts, dir), format: opts.Format, files: []string{outPath}}
+	return finish(ctx, outPath, run, stats.stats(), err)
+}
+
+// IngestLocalNormalized is like IngestLocal but writes the three files of IngestNormalized to outDir instead of a
+// single file. opts.Format and Columns are ignored.
+func IngestLocalNormalized(ctx context.Context, opts Options, dir, outDir string) (Stats, error) {
+	opts.Format, opts.Columns = FormatCSV, nil
+	projects, err := readLocalProjects(ctx, opts, dir)
+	if err != nil {
+		return Stats{}, err
+	}
+	stats := newStatsCollector()
+	_, err = writeTablesFiles(ctx, outDir, func(writer projectWriter) (int, error) {
+		return writeLocalProjects(withProgress(writer, opts.Progress, 0, len(projects)), projects, stats)
+	})
+	return finish(ctx, outDir, tablesRun(SourceLocal, localParameters(opts, dir), outDir), stats.stats(), err)
+}
+
+// localParameters returns the parameters of IngestLocal for the manifest, which are only those of opts that apply.
+func localParameters(opts Options, dir string) ManifestParameters {
+	return ManifestParameters{
+		MaxPackages:       opts.MaxPackages,
+		Format:            opts.Format.String(),
+		Columns:           opts.Columns,
+		IncludePrerelease: opts.IncludePrerelease,
+		ExcludeLicenses:   opts.ExcludeLicenses,
+		Inputs:            []string{dir},
+	}
+}
+
+// readLocalProjects reads the packages in the npm files under dir, applying the filters and limits of opts.
+func readLocalProjects(ctx context.Context, opts Options, dir string) ([]Project, error) {
+	opts, err := opts.withDefaultsExceptAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	corpus := newLocalCorpus()
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != dir && (entry.Name() == "node_modules" || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch entry.Name() {
+		case npmManifestFile:
+			return corpus.readManifest(path)
+		case npmLockFile, npmShrinkwrapFile:
+			return corpus.readLockfile(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", dir, interrupted(ctx, err))
+	}
+	projects := newLicenseFilter(opts.ExcludeLicenses).keep(corpus.projects(opts.IncludePrerelease))
+	if opts.MaxPackages > 0 && len(projects) > opts.MaxPackages {
+		projects = projects[:opts.MaxPackages]
+	}
+	return projects, nil
+}
+
+// writeLocalProjects writes the projects to writer and counts them in stats.
+func writeLocalProjects(writer projectWriter, projects []Project, stats *statsCollector) (int, error) {
+	rows, err := writer.writeProjects(projects)
+	if err != nil {
+		return 0, err
+	}
+	stats.page(len(projects), rows)
+	return len(projects), nil
+}
+
+// localCorpus collects the packages of the npm files in a directory tree, merging the versions of a package that is
+// found in several of them.
+type localCorpus struct {
+	// found holds the packages in the order they were first found, without their latest release and dependencies
+	found     []Project
+	positions map[string]int
+	// dependencies holds the dependencies of every version by name@version
+	dependencies map[string][]Dependency
+	// described holds the names of packages whose metadata comes from a package.json, and declared the
+	// name@version of every package.json
+	described map[string]bool
+	declared  map[string]bool
+}
+
+func newLocalCorpus() *localCorpus {
+	return &localCorpus{
+		positions:    make(map[string]int),
+		dependencies: make(map[string][]Dependency),
+		described:    make(map[string]bool),
+		declared:     make(map[string]bool),
+	}
+}
+
+// add records a version of a package with its dependencies. metadata holds the fields of the package other than its
+// versions and dependencies, which a package.json has and a lockfile entry does not. An empty version, as private
+// applications often have, is only kept for its dependencies.
+func (c *localCorpus) add(metadata Project, version string, dependencies []Dependency, fromManifest bool) {
+	i, ok := c.positions[metadata.Name]
+	if !ok {
+		i = len(c.found)
+		c.positions[metadata.Name] = i
+		c.found = append(c.found, Project{Name: metadata.Name, Platform: "NPM", Language: "JavaScript"})
+	}
+	if fromManifest && !c.described[metadata.Name] {
+		versions := c.found[i].Versions
+		c.found[i] = metadata
+		c.found[i].Versions = versions
+		c.described[metadata.Name] = true
+	}
+	key := metadata.Name + "@" + version
+	if _, ok := c.dependencies[key]; !ok && version != "" {
+		c.found[i].Versions = append(c.found[i].Versions, Version{Number: version})
+	}
+	if _, ok := c.dependencies[key]; !ok || fromManifest && !c.declared[key] {
+		c.dependencies[key] = dependencies
+	}
+	if fromManifest {
+		c.declared[key] = true
+	}
+}
+
+// projects returns the packages found, each with its versions ordered by semver precedence and the dependencies of its
+// latest release, or of the package.json without a version if it has no versions.
+func (c *localCorpus) projects(includePrerelease bool) []Project {
+	projects := make([]Project, 0, len(c.found))
+	for _, project := range c.found {
+		numbers := make([]string, 0, len(project.Versions))
+		for _, version := range project.Versions {
+			numbers = append(numbers, version.Number)
+		}
+		project.Versions = project.Versions[:0]
+		for _, number := range SortVersions(numbers) {
+			project.Versions = append(project.Versions, Version{Number: number})
+		}
+		project = withLatestRelease(normalizeProject(project), includePrerelease)
+		project.Dependencies = c.dependencies[project.Name+"@"+project.LatestReleaseNumber]
+		projects = append(projects, project)
+	}
+	return projects
+}
+
+// readManifest adds the package a package.json describes.
+func (c *localCorpus) readManifest(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	var manifest npmManifest
+	if err := json.Unmarshal(data, &fields); err != nil {
+		slog.Warn("Could not decode package.json, skipping it", "path", path, "err", err)
+		return nil
+	}
+	if err := unmarshalTolerant(data, &manifest); err != nil {
+		slog.Warn("Could not decode package.json, skipping it", "path", path, "err", err)
+		return nil
+	}
+	if manifest.Name == "" {
+		slog.Warn("package.json without a name, skipping it", "path", path)
+		return nil
+	}
+	var document npmDocument
+	for key, raw := range fields {
+		document.set(key, raw)
+	}
+	metadata := Project{
+		Name:          manifest.Name,
+		Platform:      "NPM",
+		Description:   document.Description,
+		Homepage:      document.Homepage,
+		Language:      "JavaScript",
+		Keywords:      document.Keywords,
+		Licenses:      document.Licenses,
+		RepositoryURL: document.RepositoryURL,
+	}
+	c.add(metadata, manifest.Version, manifest.dependencies(), true)
+	return nil
+}
+
+// readLockfile adds the packages a package-lock.json installs from the registry. The root package is left to its
+// package.json.
+func (c *localCorpus) readLockfile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var lockfile npmLockfile
+	if err := unmarshalTolerant(data, &lockfile); err != nil {
+		slog.Warn("Could not decode lockfile, skipping it", "path", path, "err", err)
+		return nil
+	}
+	if lockfile.Packages != nil {
+		c.addLockPackages(lockfile.Packages)
+	} else {
+		c.addLockDependencies(lockfile.Dependencies)
+	}
+	return nil
+}
+
+// addLockPackages adds the packages of a lockfile of version 2 or 3, in the order of their paths. Entries outside
+// node_modules are the root and workspaces, which have a package.json of their own.
+func (c *localCorpus) addLockPackages(packages map[string]npmLockPackage) {
+	paths := make([]string, 0, len(packages))
+	for path := range packages {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		entry := packages[path]
+		at := strings.LastIndex(path, "node_modules/")
+		if at < 0 || entry.Link || isLocalSpecifier(entry.Version) {
+			continue
+		}
+		// An aliased package, installed as "alias": "npm:name@1.0.0", names the real package
+		name := entry.Name
+		if name == "" {
+			name = path[at+len("node_modules/"):]
+		}
+		c.add(Project{Name: name}, entry.Version, entry.dependencies(), false)
+	}
+}
+
+// addLockDependencies adds the packages of a lockfile of version 1 and, depth first, the ones nested below them. Their
+// requires are all runtime dependencies, since a lockfile does not install the development dependencies of
+// installed packages.
+func (c *localCorpus) addLockDependencies(dependencies map[string]npmLockDependency) {
+	names := make([]string, 0, len(dependencies))
+	for name := range dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		entry := dependencies[name]
+		if !isLocalSpecifier(entry.Version) {
+			c.add(Project{Name: name}, entry.Version, withLocalFlags(npmVersion{Dependencies: entry.Requires}.dependencies()), false)
+		}
+		c.addLockDependencies(entry.Dependencies)
+	}
+}
+
+// dependencies lists the dependencies of the manifest like npmVersion.dependencies does, with its optional
+// dependencies as optional runtime dependencies, and flags the ones on local paths.
+func (m npmManifest) dependencies() []Dependency {
+	dependencies := m.npmVersion.dependencies()
+	optional := npmVersion{Dependencies: m.OptionalDependencies}.dependencies()
+	for i := range optional {
+		optional[i].Optional = true
+	}
+	// npm lists an optional dependency in both places when it is published, and treats it as optional
+	kept := dependencies[:0]
+	for _, dependency := range dependencies {
+		if _, ok := m.OptionalDependencies[dependency.Name]; !ok || dependency.Kind != "runtime" {
+			kept = append(kept, dependency)
+		}
+	}
+	return withLocalFlags(append(kept, optional...))
+}
+
+// withLocalFlags sets Local on the dependencies whose requirements are local paths.
+func withLocalFlags(dependencies []Dependency) []Dependency {
+	for i := range dependencies {
+		dependencies[i].Local = isLocalSpecifier(dependencies[i].Requirements)
+	}
+	return dependencies
+}
+
+// isLocalSpecifier reports whether an npm version specifier refers to a local path rather than the registry.
+func isLocalSpecifier(specifier string) bool {
+	return strings.HasPrefix(specifier, "file:") || strings.HasPrefix(specifier, "link:")
+}
+
+// unmarshalTolerant decodes data into v like json.Unmarshal, but ignores values of the wrong type, which are left
+// empty, e.g. the dependencies of a hand-written package.json that lists them as an array.
+func unmarshalTolerant(data []byte, v interface{}) error {
+	var typeErr *json.UnmarshalTypeError
+	if err := json.Unmarshal(data, v); err != nil && !errors.As(err, &typeErr) {
+		return err
+	}
+	return nil
+}
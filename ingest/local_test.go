@@ -0,0 +1,137 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// localCorpusFiles is a corpus of two checked-out repositories, one locked with a lockfile of version 3 and one of
+// version 1, and a local package the first one links to.
+var localCorpusFiles = map[string]string{
+	"app/package.json": `{
+		"name": "app",
+		"private": true,
+		"dependencies": {"left-pad": "^1.3.0", "shared": "file:../shared"},
+		"devDependencies": {"tape": "^5.0.0"},
+		"peerDependencies": {"react": ">=17"}
+	}`,
+	"app/package-lock.json": `{
+		"name": "app",
+		"lockfileVersion": 3,
+		"packages": {
+			"": {"name": "app", "dependencies": {"left-pad": "^1.3.0"}},
+			"../shared": {"name": "shared", "version": "0.1.0"},
+			"node_modules/@scope/util": {
+				"version": "2.0.0",
+				"dependencies": {"left-pad": "^1.0.0", "fsevents": "^2.0.0"},
+				"optionalDependencies": {"fsevents": "^2.0.0"}
+			},
+			"node_modules/left-pad": {"version": "1.3.0", "resolved": "https://registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz"},
+			"node_modules/shared": {"resolved": "../shared", "link": true}
+		}
+	}`,
+	"app/node_modules/left-pad/package.json": `{"name": "installed-copy", "version": "1.3.0"}`,
+	"broken/package.json":                    `{"name": `,
+	"legacy/package-lock.json": `{
+		"lockfileVersion": 1,
+		"dependencies": {
+			"left-pad": {"version": "1.2.0"},
+			"@scope/util": {
+				"version": "1.0.0",
+				"requires": {"tape": "^4.0.0"},
+				"dependencies": {"tape": {"version": "4.0.0"}}
+			}
+		}
+	}`,
+	"shared/package.json": `{"name": "shared", "version": "0.1.0", "license": "MIT", "repository": "git+https://github.com/x/shared.git"}`,
+}
+
+func TestIngestLocal(t *testing.T) {
+	dir := writeInputFiles(t, localCorpusFiles)
+	outPath := filepath.Join(t.TempDir(), "local.json")
+
+	stats, err := IngestLocal(context.Background(), Options{Format: FormatJSON}, dir, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 5 || stats.Requests != 0 {
+		t.Errorf("Expected 5 packages without requests, got %+v", stats)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("Could not read the output: %v", err)
+	}
+	var projects []Project
+	if err := json.Unmarshal(data, &projects); err != nil {
+		t.Fatalf("Could not decode the output: %v", err)
+	}
+	byName := make(map[string]Project)
+	var names []string
+	for _, project := range projects {
+		byName[project.Name] = project
+		names = append(names, project.Name)
+	}
+
+	t.Run("Skips node_modules and files that cannot be decoded", func(t *testing.T) {
+		if expected := []string{"@scope/util", "left-pad", "app", "tape", "shared"}; !slices.Equal(names, expected) {
+			t.Errorf("Expected the packages %v, got %v", expected, names)
+		}
+	})
+
+	t.Run("Merges the versions of both lockfile formats", func(t *testing.T) {
+		util := byName["@scope/util"]
+		if util.LatestReleaseNumber != "2.0.0" || len(util.Versions) != 2 || util.Versions[0].Number != "1.0.0" {
+			t.Errorf("Expected versions 1.0.0 and 2.0.0 with 2.0.0 the latest, got %+v", util)
+		}
+		expected := []Dependency{
+			{Name: "left-pad", Platform: "NPM", Requirements: "^1.0.0", Kind: "runtime"},
+			{Name: "fsevents", Platform: "NPM", Requirements: "^2.0.0", Kind: "runtime", Optional: true},
+		}
+		if !slices.Equal(util.Dependencies, expected) {
+			t.Errorf("Expected the dependencies %v, got %v", expected, util.Dependencies)
+		}
+	})
+
+	t.Run("Records the kind of every declared dependency and flags local ones", func(t *testing.T) {
+		expected := []Dependency{
+			{Name: "left-pad", Platform: "NPM", Requirements: "^1.3.0", Kind: "runtime"},
+			{Name: "shared", Platform: "NPM", Requirements: "file:../shared", Kind: "runtime", Local: true},
+			{Name: "tape", Platform: "NPM", Requirements: "^5.0.0", Kind: "Development"},
+			{Name: "react", Platform: "NPM", Requirements: ">=17", Kind: "peer"},
+		}
+		if app := byName["app"]; len(app.Versions) != 0 || !slices.Equal(app.Dependencies, expected) {
+			t.Errorf("Expected no versions and the dependencies %v, got %+v", expected, app)
+		}
+	})
+
+	t.Run("Reads the metadata of a package.json", func(t *testing.T) {
+		shared := byName["shared"]
+		if shared.Licenses != "MIT" || shared.RepositoryURL != "https://github.com/x/shared" || shared.LatestReleaseNumber != "0.1.0" {
+			t.Errorf("Expected the license, repository and version of shared, got %+v", shared)
+		}
+	})
+}
+
+func TestIngestLocalNormalized(t *testing.T) {
+	dir := writeInputFiles(t, localCorpusFiles)
+	outDir := t.TempDir()
+
+	if _, err := IngestLocalNormalized(context.Background(), Options{}, dir, outDir); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	dependencies := readCSV(t, filepath.Join(outDir, DependenciesFile))
+	var rows []string
+	for _, record := range dependencies[1:] {
+		rows = append(rows, strings.Join(record[2:6], "|"))
+	}
+	expected := []string{"left-pad|NPM|^1.0.0|runtime", "fsevents|NPM|^2.0.0|runtime", "left-pad|NPM|^1.3.0|runtime",
+		"shared|NPM|file:../shared|runtime", "tape|NPM|^5.0.0|Development", "react|NPM|>=17|peer"}
+	if !slices.Equal(rows, expected) {
+		t.Errorf("Expected the dependency rows %v, got %v", expected, rows)
+	}
+}
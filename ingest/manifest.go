@@ -0,0 +1,361 @@
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"time"
+)
+
+// ManifestName is the name of the manifest an ingestion writes next to its output, e.g. data/out/manifest.json for
+// data/out/result.csv.
+const ManifestName = "manifest.json"
+
+// The sources a manifest names besides SourceLibrariesIO, SourceNPM, SourceGoIndex, SourceGoProxy, SourceRegistries
+// and SourceCrates: the PyPI JSON API, read by IngestPyPI, saved libraries.io responses, read by IngestFromFiles, npm
+// manifests and lockfiles on disk, read by IngestLocal, the libraries.io open data dump, read by IngestDump, and earlier
+// outputs, combined by Merge.
+const (
+	SourcePyPI  = "pypi"
+	SourceFiles = "files"
+	SourceLocal = "local"
+	SourceDump  = "dump"
+	SourceMerge = "merge"
+)
+
+// ErrChecksumMismatch is reported by VerifyManifest for a file that changed since its manifest was written.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Manifest records how the datasets in a directory were produced, so that they can be reproduced and checked with
+// VerifyManifest. Every ingestion that finishes adds an output for its files to the manifest in their directory,
+// replacing the output of an earlier run that wrote any of them.
+type Manifest struct {
+	Outputs []ManifestOutput `json:"outputs"`
+}
+
+// ManifestOutput describes the files a single ingestion wrote.
+type ManifestOutput struct {
+	// Source is where the packages came from, one of SourceLibrariesIO, SourceNPM, SourceGoIndex, SourceGoProxy,
+	// SourceRegistries, SourceCrates, SourcePyPI, SourceFiles, SourceLocal, SourceDump or SourceMerge.
+	Source     string             `json:"source"`
+	Parameters ManifestParameters `json:"parameters"`
+	Tool       ManifestTool       `json:"tool"`
+	StartedAt  time.Time          `json:"started_at"`
+	FinishedAt time.Time          `json:"finished_at"`
+	Files      []ManifestFile     `json:"files"`
+}
+
+// ManifestParameters are the settings of an ingestion that determine what it wrote. The API key is never recorded.
+type ManifestParameters struct {
+	Platforms         []string `json:"platforms,omitempty"`
+	PerPage           int      `json:"per_page,omitempty"`
+	MaxPages          int      `json:"max_pages,omitempty"`
+	MaxPackages       int      `json:"max_packages,omitempty"`
+	Format            string   `json:"format"`
+	Columns           []string `json:"columns,omitempty"`
+	IncludePrerelease bool     `json:"include_prerelease,omitempty"`
+	ExcludeLicenses   []string `json:"exclude_licenses,omitempty"`
+	Keywords          []string `json:"keywords,omitempty"`
+	Languages         []string `json:"languages,omitempty"`
+	MinStars          int      `json:"min_stars,omitempty"`
+	MinRank           int      `json:"min_rank,omitempty"`
+	Versions          bool     `json:"versions,omitempty"`
+	Dependencies      bool     `json:"dependencies,omitempty"`
+	Vulnerabilities   bool     `json:"vulnerabilities,omitempty"`
+	// Lenient is set for Options.DecodeMode DecodeLenient, which leaves out the packages that cannot be decoded
+	Lenient bool `json:"lenient,omitempty"`
+	// Packages are the names IngestNPM or IngestPyPI, the module paths IngestGoModules or the platform:name packages
+	// IngestRegistries was given
+	Packages []string `json:"packages,omitempty"`
+	// Query is the search IngestCrates ran, which is empty for all crates
+	Query string `json:"query,omitempty"`
+	// Since is where IngestGoIndex started reading the index, or the cutoff of an ingestion with Options.Since, and
+	// IncludeUndated is Options.IncludeUndated
+	Since          string `json:"since,omitempty"`
+	IncludeUndated bool   `json:"include_undated,omitempty"`
+	// Inputs are the files IngestFromFiles read, the directory IngestLocal read, the files of the dump IngestDump
+	// converted, or the outputs Merge combined
+	Inputs []string `json:"inputs,omitempty"`
+}
+
+// ManifestTool identifies the build of the tool that wrote an output.
+type ManifestTool struct {
+	Name string `json:"name"`
+	// Version is the module version, which is (devel) for a build from a checkout
+	Version string `json:"version,omitempty"`
+	// Commit is the VCS revision the tool was built from, and Modified is set if the checkout had local changes
+	Commit   string `json:"commit,omitempty"`
+	Modified bool   `json:"modified,omitempty"`
+}
+
+// ManifestFile is a file of an output.
+type ManifestFile struct {
+	// Path is relative to the directory of the manifest
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Bytes  int64  `json:"bytes"`
+	// Rows is the number of packages in the file, or of rows without the header in the files of IngestNormalized
+	Rows int `json:"rows"`
+}
+
+// manifestRun is what finish needs to know about an ingestion to describe it in the manifest.
+type manifestRun struct {
+	source     string
+	parameters ManifestParameters
+	format     Format
+	// files are the output files, which are all in the same directory
+	files []string
+}
+
+// manifestParameters returns the parameters of opts for the manifest, as an ingestion of platforms.
+func (o Options) manifestParameters(platforms []string) ManifestParameters {
+	return ManifestParameters{
+		Platforms:         platforms,
+		PerPage:           o.PerPage,
+		MaxPages:          o.MaxPages,
+		MaxPackages:       o.MaxPackages,
+		Format:            o.Format.String(),
+		Columns:           o.Columns,
+		IncludePrerelease: o.IncludePrerelease,
+		ExcludeLicenses:   o.ExcludeLicenses,
+		Keywords:          o.Keywords,
+		Languages:         o.Languages,
+		MinStars:          o.MinStars,
+		MinRank:           o.MinRank,
+		Versions:          o.Versions,
+		Dependencies:      o.Dependencies,
+		Vulnerabilities:   o.Vulnerabilities,
+		Since:             formatSince(o.Since),
+		IncludeUndated:    o.IncludeUndated,
+		Lenient:           o.DecodeMode == DecodeLenient,
+	}
+}
+
+// tablesRun returns the manifestRun of an ingestion that writes the files of IngestNormalized to outDir.
+func tablesRun(source string, parameters ManifestParameters, outDir string) manifestRun {
+	parameters.Format = FormatCSV.String()
+	return manifestRun{source: source, parameters: parameters, format: FormatCSV, files: []string{
+		filepath.Join(outDir, PackagesFile), filepath.Join(outDir, VersionsFile), filepath.Join(outDir, DependenciesFile),
+	}}
+}
+
+// toolInfo returns the build of the running binary.
+func toolInfo() ManifestTool {
+	tool := ManifestTool{Name: "SoftwareThatMatters"}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return tool
+	}
+	tool.Version = info.Main.Version
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			tool.Commit = setting.Value
+		case "vcs.modified":
+			tool.Modified = setting.Value == "true"
+		}
+	}
+	return tool
+}
+
+// ReadManifest reads the manifest at path, or the one in path if it is a directory.
+func ReadManifest(path string) (Manifest, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, ManifestName)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("reading manifest: %w", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return Manifest{}, fmt.Errorf("decoding manifest %s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// recordRun turns a cancellation of run into ErrInterrupted, like interrupted, and returns err. Once the run succeeded,
+// and all its files are in place, it describes them in the manifest of their directory. A run that failed or was
+// cancelled left the files as they were, so the manifest still describes them.
+func recordRun(ctx context.Context, run manifestRun, stats Stats, err error) error {
+	err = interrupted(ctx, err)
+	if err == nil {
+		return writeManifest(run, stats)
+	}
+	return err
+}
+
+// writeManifest describes the files of run, which finished with stats, in the manifest of their directory. It is only
+// called once all files have been renamed into place.
+func writeManifest(run manifestRun, stats Stats) error {
+	finished := time.Now().UTC()
+	output := ManifestOutput{
+		Source:     run.source,
+		Parameters: run.parameters,
+		Tool:       toolInfo(),
+		StartedAt:  finished.Add(-stats.Duration),
+		FinishedAt: finished,
+	}
+	for _, path := range run.files {
+		sum, size, err := hashFile(path)
+		if err != nil {
+			return fmt.Errorf("writing manifest: %w", err)
+		}
+		rows, err := countRows(path, run.format)
+		if err != nil {
+			return fmt.Errorf("writing manifest: counting the rows of %s: %w", path, err)
+		}
+		output.Files = append(output.Files, ManifestFile{Path: filepath.Base(path), SHA256: sum, Bytes: size, Rows: rows})
+	}
+	return updateManifest(filepath.Dir(run.files[0]), run.files, output)
+}
+
+// updateManifest replaces the outputs that include any of files in the manifest in dir with output. A manifest that
+// cannot be read is replaced.
+func updateManifest(dir string, files []string, output ManifestOutput) error {
+	path := filepath.Join(dir, ManifestName)
+	manifest, err := ReadManifest(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Replacing a manifest that cannot be read", "path", path, "error", err)
+	}
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, filepath.Base(file))
+	}
+	manifest.Outputs = slices.DeleteFunc(manifest.Outputs, func(existing ManifestOutput) bool {
+		return slices.ContainsFunc(existing.Files, func(file ManifestFile) bool { return slices.Contains(names, file.Path) })
+	})
+	manifest.Outputs = append(manifest.Outputs, output)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	f, err := CreateAtomic(path)
+	if err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Abort()
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	return f.Commit()
+}
+
+// hashFile returns the hex-encoded SHA-256 of the file at path, as it is on disk, and its size.
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("hashing %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// countRows returns the number of packages in an output file of the given format, or of rows without the header for
+// CSV. Compressed files are decompressed while they are counted.
+func countRows(path string, format Format) (int, error) {
+	if format == FormatSQLite {
+		db, err := sql.Open("sqlite", path)
+		if err != nil {
+			return 0, err
+		}
+		defer db.Close()
+		var rows int
+		err = db.QueryRow("SELECT COUNT(*) FROM packages").Scan(&rows)
+		return rows, err
+	}
+	f, err := openInput(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	rows := 0
+	switch format {
+	case FormatNDJSON:
+		for decoder := json.NewDecoder(f); ; rows++ {
+			var project json.RawMessage
+			if err := decoder.Decode(&project); err == io.EOF {
+				return rows, nil
+			} else if err != nil {
+				return 0, err
+			}
+		}
+	case FormatJSON:
+		decoder := json.NewDecoder(f)
+		if _, err := decoder.Token(); err != nil {
+			return 0, err
+		}
+		for ; decoder.More(); rows++ {
+			var project json.RawMessage
+			if err := decoder.Decode(&project); err != nil {
+				return 0, err
+			}
+		}
+		return rows, nil
+	}
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord, reader.ReuseRecord = -1, true
+	for ; ; rows++ {
+		if _, err := reader.Read(); err == io.EOF {
+			// The header is not a row
+			return max(rows-1, 0), nil
+		} else if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// FileCheck is the result of checking a file of a manifest.
+type FileCheck struct {
+	// Path is the path of the file, joined to the directory of the manifest
+	Path string
+	// Err is nil if the file is unchanged. It wraps os.ErrNotExist if the file is missing, and ErrChecksumMismatch if
+	// its content changed.
+	Err error
+}
+
+// VerifyManifest hashes the files of every output in the manifest at path, or in path if it is a directory, again and
+// reports for each of them whether it still matches the manifest.
+func VerifyManifest(path string) ([]FileCheck, error) {
+	manifest, err := ReadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := path
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	var checks []FileCheck
+	for _, output := range manifest.Outputs {
+		for _, file := range output.Files {
+			check := FileCheck{Path: filepath.Join(dir, file.Path)}
+			sum, size, err := hashFile(check.Path)
+			switch {
+			case err != nil:
+				check.Err = err
+			case sum != file.SHA256 || size != file.Bytes:
+				check.Err = fmt.Errorf("%w: %s has SHA-256 %s, expected %s", ErrChecksumMismatch, check.Path, sum, file.SHA256)
+			}
+			checks = append(checks, check)
+		}
+	}
+	return checks, nil
+}
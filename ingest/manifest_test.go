@@ -0,0 +1,131 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIngestWritesManifest(t *testing.T) {
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testProjectsPage))
+	})
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "result.csv")
+
+	stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", ExcludeLicenses: []string{"GPL-3.0"}}, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		t.Fatalf("Expected a manifest, got %v", err)
+	}
+	if bytes.Contains(data, []byte("secret")) {
+		t.Errorf("Expected the API key to be left out of the manifest, got\n%s", data)
+	}
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(manifest.Outputs) != 1 || len(manifest.Outputs[0].Files) != 1 {
+		t.Fatalf("Expected a single output with a single file, got %+v", manifest)
+	}
+	output := manifest.Outputs[0]
+	if output.Source != SourceLibrariesIO || output.Parameters.Platforms[0] != "NPM" || output.Parameters.PerPage != defaultPerPage ||
+		output.Parameters.ExcludeLicenses[0] != "GPL-3.0" || output.Tool.Name != "SoftwareThatMatters" {
+		t.Errorf("Expected the source, parameters and tool of the run, got %+v", output)
+	}
+	if output.FinishedAt.Before(output.StartedAt) || output.StartedAt.IsZero() {
+		t.Errorf("Expected the run to start before it finished, got %s and %s", output.StartedAt, output.FinishedAt)
+	}
+	info, _ := os.Stat(outPath)
+	if file := output.Files[0]; file.Path != "result.csv" || file.Rows != stats.Packages || file.Bytes != info.Size() || len(file.SHA256) != 64 {
+		t.Errorf("Expected result.csv with %d rows and %d bytes, got %+v", stats.Packages, info.Size(), file)
+	}
+
+	t.Run("Keeps the outputs of other files", func(t *testing.T) {
+		for _, name := range []string{"other.ndjson", "result.csv"} {
+			if _, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Format: FormatNDJSON}, filepath.Join(dir, name)); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		manifest, err := ReadManifest(filepath.Join(dir, ManifestName))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(manifest.Outputs) != 2 || manifest.Outputs[0].Files[0].Path != "other.ndjson" ||
+			manifest.Outputs[1].Files[0].Path != "result.csv" || manifest.Outputs[1].Parameters.Format != "ndjson" {
+			t.Errorf("Expected the latest output of each file, got %+v", manifest.Outputs)
+		}
+		if rows := manifest.Outputs[0].Files[0].Rows; rows != stats.Packages {
+			t.Errorf("Expected %d rows of NDJSON, got %d", stats.Packages, rows)
+		}
+	})
+
+	t.Run("Verifies the files", func(t *testing.T) {
+		checks, err := VerifyManifest(dir)
+		if err != nil || len(checks) != 2 || checks[0].Err != nil || checks[1].Err != nil {
+			t.Fatalf("Expected both files to match, got %+v and %v", checks, err)
+		}
+		appendFile(t, outPath, "tampered")
+		os.Remove(filepath.Join(dir, "other.ndjson"))
+		checks, err = VerifyManifest(filepath.Join(dir, ManifestName))
+		if err != nil || len(checks) != 2 {
+			t.Fatalf("Expected two checks, got %+v and %v", checks, err)
+		}
+		if !errors.Is(checks[0].Err, os.ErrNotExist) || !errors.Is(checks[1].Err, ErrChecksumMismatch) {
+			t.Errorf("Expected a missing and a changed file, got %v and %v", checks[0].Err, checks[1].Err)
+		}
+	})
+}
+
+func TestIngestNormalizedWritesManifest(t *testing.T) {
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(testProjectsPage))
+			return
+		}
+		w.Write([]byte(`{"dependencies": [{"name": "tape", "platform": "NPM", "requirements": "*", "latest": "4.0.0"}]}`))
+	})
+	outDir := t.TempDir()
+	if _, err := IngestNormalized(context.Background(), Options{Platform: "NPM", APIKey: "secret"}, []string{"NPM"}, outDir); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	manifest, err := ReadManifest(outDir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(manifest.Outputs) != 1 || len(manifest.Outputs[0].Files) != 3 || manifest.Outputs[0].Files[0].Path != PackagesFile {
+		t.Fatalf("Expected the three files in a single output, got %+v", manifest)
+	}
+	for _, file := range manifest.Outputs[0].Files {
+		records := readCSV(t, filepath.Join(outDir, file.Path))
+		if file.Rows != len(records)-1 {
+			t.Errorf("Expected %d rows in %s, got %d", len(records)-1, file.Path, file.Rows)
+		}
+	}
+}
+
+func TestIngestFromFilesWritesManifest(t *testing.T) {
+	dir := writeInputFiles(t, map[string]string{"1.json": `[{"name": "left-pad"}, {"name": "right-pad"}]`})
+	outPath := filepath.Join(dir, "result.csv")
+	for run := 0; run < 2; run++ {
+		// The second run reads the directory with the manifest of the first in it.
+		if stats, err := IngestFromFiles(context.Background(), Options{}, []string{dir}, outPath); err != nil || stats.Packages != 2 {
+			t.Fatalf("Expected 2 packages, got %d and %v", stats.Packages, err)
+		}
+	}
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(manifest.Outputs) != 1 || manifest.Outputs[0].Source != SourceFiles || manifest.Outputs[0].Files[0].Rows != 2 ||
+		len(manifest.Outputs[0].Parameters.Inputs) != 1 {
+		t.Errorf("Expected the output read from 1.json, got %+v", manifest.Outputs)
+	}
+}
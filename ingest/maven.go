@@ -0,0 +1,296 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata is the content of a maven-metadata.xml file, which lists the published versions of a Maven artifact.
+type Metadata struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	// Version is only set in the metadata of a snapshot version, which lists the builds deployed for it.
+	Version    string     `xml:"version"`
+	Versioning Versioning `xml:"versioning"`
+}
+
+// mavenTimestampLayout is the yyyyMMddHHmmss layout Maven uses for lastUpdated, always in UTC.
+const mavenTimestampLayout = "20060102150405"
+
+// Versioning is the versioning section of a maven-metadata.xml file.
+type Versioning struct {
+	// Latest is the most recently deployed version, including snapshots. Older metadata may not have it.
+	Latest string `xml:"latest"`
+	// Release is the most recently deployed non-snapshot version.
+	Release  string   `xml:"release"`
+	Versions []string `xml:"versions>version"`
+	// LastUpdatedRaw is lastUpdated as it appears in the file, which is kept so the metadata can be written back.
+	LastUpdatedRaw string `xml:"lastUpdated"`
+	// LastUpdated is LastUpdatedRaw parsed by ParseMavenMetadata. It is the zero time when the file has none.
+	LastUpdated time.Time `xml:"-"`
+	// Snapshot describes the latest build of a snapshot version. It is nil outside snapshot metadata.
+	Snapshot *Snapshot `xml:"snapshot"`
+	// SnapshotVersions are the files deployed with the latest build of a snapshot version.
+	SnapshotVersions []SnapshotVersion `xml:"snapshotVersions>snapshotVersion"`
+}
+
+// Snapshot identifies the latest build of a snapshot version, which is deployed as e.g. 1.0-20220601.123456-3.
+type Snapshot struct {
+	Timestamp   string `xml:"timestamp"`
+	BuildNumber int    `xml:"buildNumber"`
+	// LocalCopy is set when the snapshot was installed locally and has no timestamped builds.
+	LocalCopy bool `xml:"localCopy"`
+}
+
+// SnapshotVersion is a single file deployed with a snapshot build.
+type SnapshotVersion struct {
+	Classifier string `xml:"classifier"`
+	Extension  string `xml:"extension"`
+	// Value is the timestamped version of the file, e.g. 1.0-20220601.123456-3.
+	Value   string `xml:"value"`
+	Updated string `xml:"updated"`
+}
+
+// ResolveSnapshot returns the concrete version the main artifact of version was deployed as. Versions that are not
+// snapshots are returned as they are. For a snapshot, the snapshot versions are consulted first, preferring the jar
+// over the pom, and the snapshot timestamp and build number otherwise. ok is false when the metadata does not
+// describe a deployed build.
+func (v Versioning) ResolveSnapshot(version string) (resolved string, ok bool) {
+	if !strings.HasSuffix(version, "-SNAPSHOT") {
+		return version, true
+	}
+	for _, extension := range []string{"jar", "pom", ""} {
+		for _, snapshotVersion := range v.SnapshotVersions {
+			if snapshotVersion.Classifier == "" && (extension == "" || snapshotVersion.Extension == extension) {
+				return snapshotVersion.Value, true
+			}
+		}
+	}
+	if v.Snapshot == nil || v.Snapshot.LocalCopy || v.Snapshot.Timestamp == "" {
+		return "", false
+	}
+	return strings.TrimSuffix(version, "SNAPSHOT") + v.Snapshot.Timestamp + "-" + strconv.Itoa(v.Snapshot.BuildNumber), true
+}
+
+// ErrNoLastUpdated is returned by Versioning.LastUpdatedTime when the metadata has no lastUpdated timestamp.
+var ErrNoLastUpdated = errors.New("no lastUpdated timestamp")
+
+// LastUpdatedTime parses LastUpdatedRaw, which is in the yyyyMMddHHmmss format, as a time in UTC. Unlike LastUpdated,
+// it also works on a Versioning that was not decoded by ParseMavenMetadata. ErrNoLastUpdated is returned when there is
+// no timestamp.
+func (v Versioning) LastUpdatedTime() (time.Time, error) {
+	if v.LastUpdatedRaw == "" {
+		return time.Time{}, ErrNoLastUpdated
+	}
+	lastUpdated, err := time.Parse(mavenTimestampLayout, v.LastUpdatedRaw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing lastUpdated %q: %w", v.LastUpdatedRaw, err)
+	}
+	return lastUpdated, nil
+}
+
+// IsStale reports whether the artifact was last updated more than threshold ago, e.g. 2 years for a dependency that
+// looks abandoned. An artifact without a valid lastUpdated timestamp is not considered stale, since its age is
+// unknown; use LastUpdatedTime to tell the two apart.
+func (v Versioning) IsStale(threshold time.Duration) bool {
+	lastUpdated := v.LastUpdated
+	if lastUpdated.IsZero() {
+		var err error
+		if lastUpdated, err = v.LastUpdatedTime(); err != nil {
+			return false
+		}
+	}
+	return now().Sub(lastUpdated) > threshold
+}
+
+// LatestVersion returns the latest version, falling back to the last listed version when the metadata does not name
+// one. Maven lists versions in the order they were deployed. It returns an empty string if there are no versions.
+func (v Versioning) LatestVersion() string {
+	if v.Latest != "" {
+		return v.Latest
+	}
+	if len(v.Versions) > 0 {
+		return v.Versions[len(v.Versions)-1]
+	}
+	return ""
+}
+
+// ParseMavenMetadata decodes a maven-metadata.xml document from r.
+func ParseMavenMetadata(r io.Reader) (Metadata, error) {
+	var metadata Metadata
+	if err := xml.NewDecoder(r).Decode(&metadata); err != nil {
+		return Metadata{}, fmt.Errorf("decoding Maven metadata: %w", err)
+	}
+	if metadata.Versioning.LastUpdatedRaw != "" {
+		lastUpdated, err := metadata.Versioning.LastUpdatedTime()
+		if err != nil {
+			return Metadata{}, err
+		}
+		metadata.Versioning.LastUpdated = lastUpdated
+	}
+	return metadata, nil
+}
+
+// ParseMavenMetadataFile decodes the maven-metadata.xml file at path.
+func ParseMavenMetadataFile(path string) (Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("opening metadata file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	metadata, err := ParseMavenMetadata(f)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return metadata, nil
+}
+
+// MavenCentralURL is the base URL of the Maven Central repository, used by FetchMavenMetadata when no other
+// repository is given.
+const MavenCentralURL = "https://repo.maven.apache.org/maven2"
+
+// mavenFetchTimeout bounds how long fetching a single metadata file may take, retries included.
+const mavenFetchTimeout = 30 * time.Second
+
+// ErrArtifactNotFound is returned when a repository has no metadata for the requested artifact.
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+// mavenCSVHeader is the header row of the CSV output of IngestMaven, which has one row per version.
+var mavenCSVHeader = []string{
+	"group_id",
+	"artifact_id",
+	"version",
+	"latest",
+	"release",
+	"last_updated",
+}
+
+// mavenMetadataURL returns the location of the maven-metadata.xml file of an artifact in the repository at
+// repoBaseURL. The dots in the group ID become directories, so org.junit:junit lives at org/junit/junit.
+func mavenMetadataURL(repoBaseURL, groupID, artifactID string) string {
+	return strings.TrimSuffix(repoBaseURL, "/") + "/" + strings.ReplaceAll(groupID, ".", "/") + "/" + artifactID +
+		"/maven-metadata.xml"
+}
+
+// FetchMavenMetadata downloads and decodes the maven-metadata.xml file of an artifact from the Maven repository at
+// repoBaseURL, which may be Maven Central, a mirror or a private repository such as Nexus. An empty repoBaseURL uses
+// Maven Central. ErrArtifactNotFound is returned when the repository does not know the artifact. The request is
+// aborted when ctx is done.
+func FetchMavenMetadata(ctx context.Context, repoBaseURL, groupID, artifactID string) (Metadata, error) {
+	f := &fetcher{limiter: newRateLimiter(0, 1), maxAttempts: defaultMaxAttempts, timeout: defaultRequestTimeout, backoff: backoff}
+	return fetchMavenMetadata(ctx, f, repoBaseURL, groupID, artifactID)
+}
+
+func fetchMavenMetadata(ctx context.Context, f *fetcher, repoBaseURL, groupID, artifactID string) (Metadata, error) {
+	if groupID == "" || artifactID == "" {
+		return Metadata{}, fmt.Errorf("invalid Maven coordinates %q:%q", groupID, artifactID)
+	}
+	if repoBaseURL == "" {
+		repoBaseURL = MavenCentralURL
+	}
+	ctx, cancel := context.WithTimeout(ctx, mavenFetchTimeout)
+	defer cancel()
+
+	body, err := f.fetchWithRetry(ctx, mavenMetadataURL(repoBaseURL, groupID, artifactID))
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return Metadata{}, fmt.Errorf("%w: %s:%s", ErrArtifactNotFound, groupID, artifactID)
+	}
+	if err != nil {
+		return Metadata{}, fmt.Errorf("fetching metadata of %s:%s: %w", groupID, artifactID, err)
+	}
+	return ParseMavenMetadata(bytes.NewReader(body))
+}
+
+// IngestMaven fetches the metadata of the given group:artifact coordinates from the Maven repository at repoBaseURL
+// and writes one CSV row per version to outPath. An empty repoBaseURL uses Maven Central. Artifacts the repository
+// does not know are skipped with a warning. It returns the number of artifacts written. It stops when ctx is done,
+// leaving the previous output untouched.
+func IngestMaven(ctx context.Context, repoBaseURL string, coordinates []string, outPath string) (int, error) {
+	f := &fetcher{limiter: newRateLimiter(0, 1), maxAttempts: defaultMaxAttempts, timeout: defaultRequestTimeout, backoff: backoff}
+	n, err := writeCSVFile(ctx, outPath, mavenCSVHeader, func(writer *csv.Writer) (int, error) {
+		written := 0
+		for _, coordinate := range coordinates {
+			groupID, artifactID, ok := strings.Cut(coordinate, ":")
+			if !ok {
+				return written, fmt.Errorf("invalid Maven coordinate %q: expected group:artifact", coordinate)
+			}
+			metadata, err := fetchMavenMetadata(ctx, f, repoBaseURL, groupID, artifactID)
+			if errors.Is(err, ErrArtifactNotFound) {
+				slog.Warn("Maven artifact not found, skipping it", "platform", "Maven", "package", coordinate)
+				continue
+			}
+			if err != nil {
+				return written, err
+			}
+			if err := writeMavenVersions(writer, metadata); err != nil {
+				return written, err
+			}
+			written++
+		}
+		return written, nil
+	})
+	return n, interrupted(ctx, err)
+}
+
+// writeMavenVersions writes one row per version of the artifact and flushes them to the underlying writer.
+func writeMavenVersions(writer *csv.Writer, metadata Metadata) error {
+	versioning := metadata.Versioning
+	lastUpdated := ""
+	if !versioning.LastUpdated.IsZero() {
+		lastUpdated = versioning.LastUpdated.Format(time.RFC3339)
+	}
+	for _, version := range versioning.Versions {
+		record := []string{
+			metadata.GroupID,
+			metadata.ArtifactID,
+			version,
+			versioning.LatestVersion(),
+			versioning.Release,
+			lastUpdated,
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("writing CSV row: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("writing CSV: %w", err)
+	}
+	return nil
+}
+
+// IngestMavenFiles is like IngestMaven but reads the metadata of each artifact from a local maven-metadata.xml file
+// instead of a repository, such as one downloaded earlier or taken from a local ~/.m2 repository.
+func IngestMavenFiles(ctx context.Context, paths []string, outPath string) (int, error) {
+	n, err := writeCSVFile(ctx, outPath, mavenCSVHeader, func(writer *csv.Writer) (int, error) {
+		written := 0
+		for _, path := range paths {
+			if err := ctx.Err(); err != nil {
+				return written, err
+			}
+			metadata, err := ParseMavenMetadataFile(path)
+			if err != nil {
+				return written, err
+			}
+			if err := writeMavenVersions(writer, metadata); err != nil {
+				return written, err
+			}
+			written++
+		}
+		return written, nil
+	})
+	return n, interrupted(ctx, err)
+}
@@ -0,0 +1,310 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files in testdata")
+
+func TestParseMavenMetadataFile(t *testing.T) {
+	metadata, err := ParseMavenMetadataFile(filepath.Join("testdata", "junit-maven-metadata.xml"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	t.Run("Decodes the coordinates", func(t *testing.T) {
+		if metadata.GroupID != "junit" || metadata.ArtifactID != "junit" {
+			t.Errorf("Expected junit:junit, got %s:%s", metadata.GroupID, metadata.ArtifactID)
+		}
+	})
+
+	t.Run("Decodes the versioning", func(t *testing.T) {
+		versioning := metadata.Versioning
+		if versioning.Latest != "4.13.2" || versioning.Release != "4.13.2" {
+			t.Errorf("Expected latest and release 4.13.2, got %s and %s", versioning.Latest, versioning.Release)
+		}
+		if versioning.LastUpdatedRaw != "20210213164433" {
+			t.Errorf("Expected lastUpdated 20210213164433, got %s", versioning.LastUpdatedRaw)
+		}
+		if expected := time.Date(2021, 2, 13, 16, 44, 33, 0, time.UTC); !versioning.LastUpdated.Equal(expected) {
+			t.Errorf("Expected lastUpdated to be parsed as %v, got %v", expected, versioning.LastUpdated)
+		}
+	})
+
+	t.Run("Captures every nested version", func(t *testing.T) {
+		versions := metadata.Versioning.Versions
+		if len(versions) != 32 {
+			t.Fatalf("Expected 32 versions, got %d: %v", len(versions), versions)
+		}
+		if versions[0] != "3.7" || versions[len(versions)-1] != "4.13.2" {
+			t.Errorf("Expected the versions to run from 3.7 to 4.13.2, got %s to %s", versions[0], versions[len(versions)-1])
+		}
+	})
+}
+
+func TestParseMavenMetadataErrors(t *testing.T) {
+	t.Run("Reports a missing file", func(t *testing.T) {
+		_, err := ParseMavenMetadataFile(filepath.Join(t.TempDir(), "maven-metadata.xml"))
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Expected a not-exist error, got %v", err)
+		}
+	})
+
+	t.Run("Reports malformed XML", func(t *testing.T) {
+		_, err := ParseMavenMetadata(strings.NewReader("<metadata><groupId>junit</metadata>"))
+		if err == nil {
+			t.Error("Expected an error for malformed XML")
+		}
+	})
+
+	t.Run("Reports a malformed lastUpdated", func(t *testing.T) {
+		_, err := ParseMavenMetadata(strings.NewReader("<metadata><versioning><lastUpdated>yesterday</lastUpdated></versioning></metadata>"))
+		if err == nil {
+			t.Error("Expected an error for a malformed lastUpdated")
+		}
+	})
+}
+
+func TestParseMavenMetadataGolden(t *testing.T) {
+	for _, name := range []string{"junit", "servlet-api", "snapshot"} {
+		t.Run(name, func(t *testing.T) {
+			metadata, err := ParseMavenMetadataFile(filepath.Join("testdata", name+"-maven-metadata.xml"))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			actual, err := json.MarshalIndent(metadata, "", "  ")
+			if err != nil {
+				t.Fatalf("Could not encode the metadata: %v", err)
+			}
+
+			goldenPath := filepath.Join("testdata", name+"-maven-metadata.golden.json")
+			if *update {
+				if err := os.WriteFile(goldenPath, append(actual, '\n'), 0o644); err != nil {
+					t.Fatalf("Could not update the golden file: %v", err)
+				}
+			}
+			expected, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("Could not read the golden file: %v", err)
+			}
+			if !bytes.Equal(bytes.TrimSpace(expected), actual) {
+				t.Errorf("Decoded metadata does not match %s:\n%s", goldenPath, actual)
+			}
+		})
+	}
+}
+
+func TestVersioningLatestVersion(t *testing.T) {
+	tests := []struct {
+		versioning Versioning
+		expected   string
+	}{
+		{Versioning{Latest: "2.0", Versions: []string{"1.0", "2.0", "3.0"}}, "2.0"},
+		{Versioning{Versions: []string{"1.0", "2.0", "3.0"}}, "3.0"},
+		{Versioning{}, ""},
+	}
+	for _, test := range tests {
+		if actual := test.versioning.LatestVersion(); actual != test.expected {
+			t.Errorf("Expected latest version %q for %+v, got %q", test.expected, test.versioning, actual)
+		}
+	}
+}
+
+func TestVersioningLastUpdatedTime(t *testing.T) {
+	lastUpdated, err := Versioning{LastUpdatedRaw: "20220315093000"}.LastUpdatedTime()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if expected := time.Date(2022, 3, 15, 9, 30, 0, 0, time.UTC); !lastUpdated.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, lastUpdated)
+	}
+	if _, err := (Versioning{}).LastUpdatedTime(); !errors.Is(err, ErrNoLastUpdated) {
+		t.Errorf("Expected ErrNoLastUpdated, got %v", err)
+	}
+	if _, err := (Versioning{LastUpdatedRaw: "2022-03-15"}).LastUpdatedTime(); err == nil {
+		t.Error("Expected an error for a timestamp in another format")
+	}
+}
+
+func TestVersioningIsStale(t *testing.T) {
+	fakeClock(t)
+	twoYears := 2 * 365 * 24 * time.Hour
+	tests := []struct {
+		name       string
+		versioning Versioning
+		expected   bool
+	}{
+		{"Updated three years ago", Versioning{LastUpdatedRaw: "20190601120000"}, true},
+		{"Updated last month", Versioning{LastUpdatedRaw: "20220501120000"}, false},
+		{"Parsed timestamp", Versioning{LastUpdated: time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)}, true},
+		{"No timestamp", Versioning{}, false},
+		{"Invalid timestamp", Versioning{LastUpdatedRaw: "yesterday"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := test.versioning.IsStale(twoYears); actual != test.expected {
+				t.Errorf("Expected IsStale to be %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFetchMavenMetadata(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "junit-maven-metadata.xml"))
+	if err != nil {
+		t.Fatalf("Could not read the fixture: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/maven2/junit/junit/maven-metadata.xml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(fixture)
+	}))
+	defer server.Close()
+
+	t.Run("Fetches the metadata from the canonical path", func(t *testing.T) {
+		metadata, err := FetchMavenMetadata(context.Background(), server.URL+"/maven2/", "junit", "junit")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if metadata.Versioning.Release != "4.13.2" || len(metadata.Versioning.Versions) != 32 {
+			t.Errorf("Expected the junit metadata, got %+v", metadata)
+		}
+	})
+
+	t.Run("Reports unknown artifacts", func(t *testing.T) {
+		_, err := FetchMavenMetadata(context.Background(), server.URL+"/maven2", "org.example", "missing")
+		if !errors.Is(err, ErrArtifactNotFound) {
+			t.Errorf("Expected ErrArtifactNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Tells network errors apart from unknown artifacts", func(t *testing.T) {
+		unreachable := httptest.NewServer(http.NotFoundHandler())
+		unreachable.Close()
+
+		_, err := FetchMavenMetadata(context.Background(), unreachable.URL, "junit", "junit")
+		if err == nil || errors.Is(err, ErrArtifactNotFound) {
+			t.Errorf("Expected a network error, got %v", err)
+		}
+	})
+}
+
+func TestMavenMetadataURL(t *testing.T) {
+	actual := mavenMetadataURL(MavenCentralURL, "org.apache.commons", "commons-lang3")
+	expected := "https://repo.maven.apache.org/maven2/org/apache/commons/commons-lang3/maven-metadata.xml"
+	if actual != expected {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+}
+
+func TestIngestMaven(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "servlet-api-maven-metadata.xml"))
+	if err != nil {
+		t.Fatalf("Could not read the fixture: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/javax/servlet/servlet-api/maven-metadata.xml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(fixture)
+	}))
+	defer server.Close()
+	outPath := filepath.Join(t.TempDir(), "maven.csv")
+
+	written, err := IngestMaven(context.Background(), server.URL, []string{"javax.servlet:servlet-api", "org.example:missing"}, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if written != 1 {
+		t.Errorf("Expected 1 artifact, got %d", written)
+	}
+
+	records := readCSV(t, outPath)
+	if len(records) != 6 {
+		t.Fatalf("Expected a header and five rows, got %d rows", len(records))
+	}
+	row := strings.Join(records[1], "|")
+	if expected := "javax.servlet|servlet-api|2.2|3.0-alpha-1|2.5|2009-01-20T00:26:21Z"; row != expected {
+		t.Errorf("Expected row %s, got %s", expected, row)
+	}
+
+	t.Run("Rejects malformed coordinates", func(t *testing.T) {
+		if _, err := IngestMaven(context.Background(), server.URL, []string{"servlet-api"}, outPath); err == nil {
+			t.Error("Expected an error for a coordinate without a group")
+		}
+	})
+}
+
+func TestIngestMavenFiles(t *testing.T) {
+	outPath := filepath.Join(t.TempDir(), "maven.csv")
+	paths := []string{
+		filepath.Join("testdata", "servlet-api-maven-metadata.xml"),
+		filepath.Join("testdata", "junit-maven-metadata.xml"),
+	}
+
+	written, err := IngestMavenFiles(context.Background(), paths, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if written != 2 {
+		t.Errorf("Expected 2 artifacts, got %d", written)
+	}
+	records := readCSV(t, outPath)
+	if row := strings.Join(records[1], "|"); row != "javax.servlet|servlet-api|2.2|3.0-alpha-1|2.5|2009-01-20T00:26:21Z" {
+		t.Errorf("Expected the versions of the first file first, got %s", row)
+	}
+	if last := records[len(records)-1]; last[0] != "junit" {
+		t.Errorf("Expected the versions of the second file last, got %v", last)
+	}
+
+	t.Run("Names the file that cannot be read", func(t *testing.T) {
+		missing := filepath.Join("testdata", "missing-maven-metadata.xml")
+		if _, err := IngestMavenFiles(context.Background(), []string{missing}, outPath); err == nil || !strings.Contains(err.Error(), missing) {
+			t.Errorf("Expected an error naming %s, got %v", missing, err)
+		}
+	})
+}
+
+func TestVersioningResolveSnapshot(t *testing.T) {
+	metadata, err := ParseMavenMetadataFile(filepath.Join("testdata", "snapshot-maven-metadata.xml"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	tests := []struct {
+		name       string
+		versioning Versioning
+		version    string
+		expected   string
+		ok         bool
+	}{
+		{"Keeps releases", metadata.Versioning, "1.0", "1.0", true},
+		{"Uses the snapshot versions", metadata.Versioning, "1.0-SNAPSHOT", "1.0-20220601.123456-3", true},
+		{"Falls back to the snapshot", Versioning{Snapshot: &Snapshot{Timestamp: "20220101.000000", BuildNumber: 7}},
+			"2.0-SNAPSHOT", "2.0-20220101.000000-7", true},
+		{"Gives up on local copies", Versioning{Snapshot: &Snapshot{LocalCopy: true}}, "2.0-SNAPSHOT", "", false},
+		{"Gives up without a snapshot", Versioning{}, "2.0-SNAPSHOT", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolved, ok := test.versioning.ResolveSnapshot(test.version)
+			if resolved != test.expected || ok != test.ok {
+				t.Errorf("Expected %q, %t, got %q, %t", test.expected, test.ok, resolved, ok)
+			}
+		})
+	}
+}
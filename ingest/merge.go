@@ -0,0 +1,237 @@
+package ingest
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MergeConflictsReport is the name of the CSV file Merge writes next to its output, with the packages that more than
+// one input has with different data.
+const MergeConflictsReport = "merge_conflicts.csv"
+
+// ErrColumnMismatch is returned by Merge when its inputs do not have the same header row, such as outputs of runs with
+// different Options.Columns or of different versions of the tool.
+var ErrColumnMismatch = errors.New("the inputs do not have the same columns")
+
+// mergeEntry is what Merge knows about a package key after reading the rows with it so far.
+type mergeEntry struct {
+	// input and row are where the row that is kept is, counting rows after the header from zero
+	input, row int
+	published  time.Time
+	// hash is the hash of the first row with the key, and differs is set once another row with it does not match it
+	hash    uint64
+	differs bool
+	// inputs are the inputs that have the key, in order and each once
+	inputs []int
+}
+
+// Merge combines CSV files written by Ingest, such as the outputs of runs per platform or per week, into a single CSV
+// file at outPath. All inputs must have the same header row, or ErrColumnMismatch is returned, and a name and a
+// platform column. A package that is in more than one row, by platform and name as for deduplication, is written once,
+// with the row whose latest_release_published_at is the latest; if that is the same or unknown, the row of the later
+// input wins, so inputs are best given from the oldest run to the newest. The rows are written in the order of the
+// inputs.
+//
+// The inputs are read twice, once to choose the rows and once to copy them, so only the package keys are held in
+// memory. Any of the files may be gzip-compressed, and outPath may be one of the inputs, which is only replaced once the
+// merge is complete, so that a failed or cancelled merge leaves it as it was. The packages that more than one input
+// has with different data are listed in MergeConflictsReport in the directory of outPath, which is written even if
+// there are none, and the output is recorded in the manifest of its directory like that of Ingest.
+func Merge(ctx context.Context, inputs []string, outPath string) (Stats, error) {
+	if len(inputs) == 0 {
+		return Stats{}, errors.New("nothing to merge: no inputs given")
+	}
+	for _, path := range append([]string{outPath}, inputs...) {
+		if format, ok := FormatForPath(path); !ok || format != FormatCSV {
+			return Stats{}, fmt.Errorf("cannot merge %s: expected a .csv file", path)
+		}
+	}
+	stats := newStatsCollector()
+	header, entries, read, err := readMergeInputs(ctx, inputs)
+	if err != nil {
+		return Stats{}, interrupted(ctx, err)
+	}
+
+	var conflicts []mergeConflict
+	var platforms []string
+	written, err := writeCSVFile(ctx, outPath, header, func(writer *csv.Writer) (int, error) {
+		written := 0
+		platform, name := slices.Index(header, "platform"), slices.Index(header, "name")
+		for i, path := range inputs {
+			err := readMergeInput(ctx, path, func(row int, record []string) error {
+				entry := entries[packageKey(record[platform], record[name])]
+				if entry.input != i || entry.row != row {
+					return nil
+				}
+				if entry.differs && len(entry.inputs) > 1 {
+					conflicts = append(conflicts, mergeConflict{platform: record[platform], name: record[name], entry: entry})
+				}
+				if !slices.Contains(platforms, record[platform]) {
+					platforms = append(platforms, record[platform])
+				}
+				if err := writer.Write(record); err != nil {
+					return fmt.Errorf("writing CSV row: %w", err)
+				}
+				written++
+				return nil
+			})
+			if err != nil {
+				return written, err
+			}
+		}
+		return written, nil
+	})
+	if err == nil {
+		err = writeMergeConflicts(ctx, filepath.Join(filepath.Dir(outPath), MergeConflictsReport), inputs, conflicts)
+	}
+	stats.duplicate(read - written)
+	collected := stats.stats()
+	collected.Packages, collected.Rows = written, written
+
+	slices.Sort(platforms)
+	parameters := ManifestParameters{Platforms: platforms, Format: FormatCSV.String(), Inputs: inputs}
+	run := manifestRun{source: SourceMerge, parameters: parameters, format: FormatCSV, files: []string{outPath}}
+	return finish(ctx, outPath, run, collected, err)
+}
+
+// readMergeInputs reads the inputs of Merge and returns their header row, the entries of their package keys and the
+// number of rows they have.
+func readMergeInputs(ctx context.Context, inputs []string) ([]string, map[string]mergeEntry, int, error) {
+	var header []string
+	entries := make(map[string]mergeEntry)
+	rows := 0
+	for i, path := range inputs {
+		columns, err := readMergeHeader(path)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if header == nil {
+			header = columns
+			if !slices.Contains(header, "name") || !slices.Contains(header, "platform") {
+				return nil, nil, 0, fmt.Errorf("cannot merge %s: expected a name and a platform column", path)
+			}
+		} else if !slices.Equal(columns, header) {
+			return nil, nil, 0, fmt.Errorf("%w: %s has %s, but %s has %s", ErrColumnMismatch, path,
+				strings.Join(columns, ","), inputs[0], strings.Join(header, ","))
+		}
+
+		platform, name := slices.Index(header, "platform"), slices.Index(header, "name")
+		published := slices.Index(header, "latest_release_published_at")
+		err = readMergeInput(ctx, path, func(row int, record []string) error {
+			rows++
+			key := packageKey(record[platform], record[name])
+			var publishedAt time.Time
+			if published >= 0 {
+				publishedAt, _ = Version{PublishedAt: record[published]}.PublishedTime()
+			}
+			hash := fnv.New64a()
+			for _, field := range record {
+				hash.Write([]byte(field))
+				hash.Write([]byte{0})
+			}
+
+			entry, ok := entries[key]
+			if !ok {
+				entries[key] = mergeEntry{input: i, row: row, published: publishedAt, hash: hash.Sum64(), inputs: []int{i}}
+				return nil
+			}
+			entry.differs = entry.differs || entry.hash != hash.Sum64()
+			if entry.inputs[len(entry.inputs)-1] != i {
+				entry.inputs = append(entry.inputs, i)
+			}
+			if !entry.published.After(publishedAt) {
+				entry.input, entry.row, entry.published = i, row, publishedAt
+			}
+			entries[key] = entry
+			return nil
+		})
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	return header, entries, rows, nil
+}
+
+// readMergeHeader returns the header row of the CSV file at path.
+func readMergeHeader(path string) ([]string, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	header, err := csv.NewReader(f).Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading the header of %s: %w", path, err)
+	}
+	return header, nil
+}
+
+// readMergeInput calls visit with every row of the CSV file at path after the header, and its position, until ctx is
+// done. Rows must have as many fields as the header. The record is reused for the next row.
+func readMergeInput(ctx context.Context, path string, visit func(row int, record []string) error) error {
+	f, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader := csv.NewReader(f)
+	reader.ReuseRecord = true
+	if _, err := reader.Read(); err != nil {
+		return fmt.Errorf("reading the header of %s: %w", path, err)
+	}
+	for row := 0; ; row++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		if err := visit(row, record); err != nil {
+			return err
+		}
+	}
+}
+
+// mergeConflict is a package that more than one input of Merge has with different data.
+type mergeConflict struct {
+	platform, name string
+	entry          mergeEntry
+}
+
+// writeMergeConflicts writes conflicts to path, sorted by platform and name, along with the inputs that have each
+// package and the one whose row was kept.
+func writeMergeConflicts(ctx context.Context, path string, inputs []string, conflicts []mergeConflict) error {
+	slices.SortFunc(conflicts, func(a, b mergeConflict) int {
+		return strings.Compare(packageKey(a.platform, a.name), packageKey(b.platform, b.name))
+	})
+	if len(conflicts) > 0 {
+		slog.Warn("Packages differ between the inputs", "packages", len(conflicts), "report", path)
+	}
+	_, err := writeCSVFile(ctx, path, []string{"platform", "name", "inputs", "kept"}, func(writer *csv.Writer) (int, error) {
+		for _, conflict := range conflicts {
+			paths := make([]string, len(conflict.entry.inputs))
+			for i, input := range conflict.entry.inputs {
+				paths[i] = inputs[input]
+			}
+			record := []string{conflict.platform, conflict.name, strings.Join(paths, ";"), inputs[conflict.entry.input]}
+			if err := writer.Write(record); err != nil {
+				return 0, fmt.Errorf("writing CSV row: %w", err)
+			}
+		}
+		return len(conflicts), nil
+	})
+	return err
+}
@@ -0,0 +1,140 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// cancelWhileWriting is a context that is cancelled once the temporary file temp exists, that is once the output it
+// belongs to is being written.
+type cancelWhileWriting struct {
+	context.Context
+	temp      string
+	cancelled bool
+}
+
+func (c *cancelWhileWriting) Err() error {
+	if _, err := os.Stat(c.temp); err == nil {
+		c.cancelled = true
+	}
+	if c.cancelled {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	week1 := write("week1.csv", "name,platform,latest_release_published_at,stars\n"+
+		"left-pad,NPM,2021-01-01T00:00:00Z,10\n"+
+		"right-pad,NPM,2021-01-01T00:00:00Z,5\n"+
+		"requests,Pypi,,100\n")
+	week2 := write("week2.csv", "name,platform,latest_release_published_at,stars\n"+
+		"left-pad,NPM,2022-01-01T00:00:00Z,12\n"+
+		"right-pad,NPM,2020-06-01T00:00:00Z,5\n"+
+		"requests,Pypi,,101\n"+
+		"tape,NPM,2020-01-01T00:00:00Z,3\n")
+	outPath := filepath.Join(dir, "out", "merged.csv")
+	os.Mkdir(filepath.Dir(outPath), 0o755)
+
+	stats, err := Merge(context.Background(), []string{week1, week2}, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := [][]string{
+		{"name", "platform", "latest_release_published_at", "stars"},
+		{"right-pad", "NPM", "2021-01-01T00:00:00Z", "5"},
+		{"left-pad", "NPM", "2022-01-01T00:00:00Z", "12"},
+		{"requests", "Pypi", "", "101"},
+		{"tape", "NPM", "2020-01-01T00:00:00Z", "3"},
+	}
+	records := readCSV(t, outPath)
+	if !slices.EqualFunc(records, expected, slices.Equal[[]string]) {
+		t.Errorf("Expected %v, got %v", expected, records)
+	}
+	if stats.Packages != 4 || stats.Duplicates != 3 {
+		t.Errorf("Expected 4 packages and 3 duplicates, got %d and %d", stats.Packages, stats.Duplicates)
+	}
+
+	t.Run("Reports the packages that differ between inputs", func(t *testing.T) {
+		// right-pad was published later in the earlier run
+		expected := [][]string{
+			{"platform", "name", "inputs", "kept"},
+			{"NPM", "left-pad", week1 + ";" + week2, week2},
+			{"NPM", "right-pad", week1 + ";" + week2, week1},
+			{"Pypi", "requests", week1 + ";" + week2, week2},
+		}
+		records := readCSV(t, filepath.Join(filepath.Dir(outPath), MergeConflictsReport))
+		if !slices.EqualFunc(records, expected, slices.Equal[[]string]) {
+			t.Errorf("Expected %v, got %v", expected, records)
+		}
+	})
+
+	t.Run("Records the output in the manifest", func(t *testing.T) {
+		manifest, err := ReadManifest(filepath.Dir(outPath))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(manifest.Outputs) != 1 || manifest.Outputs[0].Source != SourceMerge || manifest.Outputs[0].Files[0].Rows != 4 {
+			t.Fatalf("Expected the merged file in the manifest, got %+v", manifest.Outputs)
+		}
+		if parameters := manifest.Outputs[0].Parameters; !slices.Equal(parameters.Inputs, []string{week1, week2}) ||
+			!slices.Equal(parameters.Platforms, []string{"NPM", "Pypi"}) {
+			t.Errorf("Expected the inputs and platforms, got %+v", parameters)
+		}
+	})
+
+	t.Run("Rejects inputs with other columns", func(t *testing.T) {
+		other := write("other.csv", "name,platform\nleft-pad,NPM\n")
+		_, err := Merge(context.Background(), []string{week1, other}, filepath.Join(dir, "rejected.csv"))
+		if !errors.Is(err, ErrColumnMismatch) {
+			t.Errorf("Expected ErrColumnMismatch, got %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "rejected.csv")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected no output, got %v", err)
+		}
+	})
+
+	t.Run("Keeps the input it replaces when cancelled", func(t *testing.T) {
+		input := "name,platform,latest_release_published_at,stars\nleft-pad,NPM,2020-01-01T00:00:00Z,1\n"
+		path := write("replaced.csv", input)
+		// Cancelled while the output is written, after the inputs were read once
+		ctx := &cancelWhileWriting{Context: context.Background(), temp: tempPath(path)}
+		if _, err := Merge(ctx, []string{path, week2}, path); !errors.Is(err, ErrInterrupted) {
+			t.Fatalf("Expected ErrInterrupted, got %v", err)
+		}
+		if !ctx.cancelled {
+			t.Fatalf("Expected the merge to be cancelled while writing")
+		}
+		if data, _ := os.ReadFile(path); string(data) != input {
+			t.Errorf("Expected the input to be left as it was, got %q", data)
+		}
+	})
+
+	t.Run("Reads and writes compressed files", func(t *testing.T) {
+		compressed := filepath.Join(dir, "merged.csv.gz")
+		if _, err := Merge(context.Background(), []string{outPath, week1}, compressed); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		again := filepath.Join(dir, "again.csv")
+		stats, err := Merge(context.Background(), []string{compressed}, again)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stats.Packages != 4 || stats.Duplicates != 0 {
+			t.Errorf("Expected 4 packages and no duplicates, got %d and %d", stats.Packages, stats.Duplicates)
+		}
+	})
+}
@@ -0,0 +1,354 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// npmEndpoint is the base URL of the npm registry. It is a variable so tests can point it at a local server.
+var npmEndpoint = "https://registry.npmjs.org"
+
+// npmDocument is the part of a package document of the npm registry we use.
+type npmDocument struct {
+	Name          string
+	Description   string
+	Homepage      string
+	Keywords      []string
+	Licenses      string
+	RepositoryURL string
+	// Latest is the version the latest dist-tag points to.
+	Latest   string
+	Versions []npmVersion
+	// Times maps version numbers to the time they were published. It also holds the created and modified times of the
+	// package.
+	Times map[string]string
+}
+
+// npmVersion is a single version of an npm package with its dependencies, each of which maps a package name to a
+// version range.
+type npmVersion struct {
+	Number           string            `json:"-"`
+	Dependencies     map[string]string `json:"dependencies"`
+	DevDependencies  map[string]string `json:"devDependencies"`
+	PeerDependencies map[string]string `json:"peerDependencies"`
+}
+
+// IngestNPM downloads the given packages from the npm registry instead of libraries.io and writes them to outPath in
+// the format chosen in opts, with the same fields as Ingest, so that the output does not tell which source it came
+// from. Every package takes a single request, whose response includes all versions, so unlike Ingest the dependencies
+// of the latest release are always written. Packages the registry does not know are skipped with a warning.
+//
+// opts.Platform, APIKey, MaxPages and Versions do not apply, and responses are not cached. The packages are fetched in
+// batches of opts.PerPage, with opts.Workers concurrent requests, and the limits and filters of opts apply as they do
+// for Ingest. opts.Progress gets the number of names, or MaxPackages if it is lower, as the total, although packages
+// that are not found or are left out by license are not written. If the ingestion fails midway or is cancelled, the
+// previous output is left untouched.
+func IngestNPM(ctx context.Context, opts Options, names []string, outPath string) (Stats, error) {
+	opts, err := opts.withDefaultsExceptAPIKey()
+	if err != nil {
+		return Stats{}, err
+	}
+	f := &fetcher{
+		client:      opts.HTTPClient,
+		limiter:     newRateLimiter(opts.RequestsPerMinute, 1),
+		maxAttempts: opts.MaxAttempts,
+		timeout:     opts.RequestTimeout,
+		backoff:     backoff,
+		userAgent:   userAgent,
+	}
+	stats := newStatsCollector()
+	f.stats = stats
+	// Already validated by withDefaultsExceptAPIKey
+	columns, _ := csvColumnIndices(opts.Columns)
+	_, err = writeProjectsFileAt(ctx, outPath, opts.Format, columns, resumePoint{}, opts.CompressionLevel, func(writer projectWriter, _ *outputFile) (int, error) {
+		total := len(names)
+		if opts.MaxPackages > 0 {
+			total = min(total, opts.MaxPackages)
+		}
+		return ingestNamedPackages(ctx, withProgress(writer, opts.Progress, 0, total), opts, names, stats, func(ctx context.Context, project *Project) error {
+			return fetchNPMPackage(ctx, f, opts, project)
+		})
+	})
+	parameters := opts.manifestParameters(nil)
+	parameters.Packages = names
+	run := manifestRun{source: SourceNPM, parameters: parameters, format: opts.Format, files: []string{outPath}}
+	return finish(ctx, outPath, run, stats.stats(), err)
+}
+
+// ingestNamedPackages fetches the packages in batches of opts.PerPage, with opts.Workers concurrent calls of fetch, and
+// writes each batch to writer, until all are written or opts.MaxPackages is reached. fetch fills in the project it is
+// given, which only has its name, and leaves its platform empty if the package was not found, so that it is skipped. A
+// package that is named twice is written once. It returns the number of packages written.
+func ingestNamedPackages(ctx context.Context, writer projectWriter, opts Options, names []string, stats *statsCollector,
+	fetch func(ctx context.Context, project *Project) error) (int, error) {
+	written := 0
+	already := packageSet{}
+	for start := 0; start < len(names); start += opts.PerPage {
+		batch := names[start:min(start+opts.PerPage, len(names))]
+		projects := make([]Project, len(batch))
+		for i, name := range batch {
+			projects[i].Name = name
+		}
+		if err := forEachProject(ctx, opts.Workers, projects, fetch); err != nil {
+			return written, err
+		}
+
+		found := projects[:0]
+		for _, project := range projects {
+			if project.Platform != "" {
+				found = append(found, project)
+			}
+		}
+		found, duplicates := already.unique(found)
+		stats.duplicate(duplicates)
+		stats.duplicateVersion(uniqueVersions(found))
+		projects, filtered := newPackageFilter(opts).keep(found)
+		stats.filteredOut(filtered)
+		if opts.MaxPackages > 0 && written+len(projects) > opts.MaxPackages {
+			projects = projects[:opts.MaxPackages-written]
+		}
+		rows, err := writer.writeProjects(projects)
+		if err != nil {
+			return written, err
+		}
+		written += len(projects)
+		stats.page(len(projects), rows)
+		slog.Debug("Wrote packages", "packages", written, "of", len(names))
+		if opts.MaxPackages > 0 && written >= opts.MaxPackages {
+			break
+		}
+	}
+	return written, ctx.Err()
+}
+
+// fetchNPMDocument requests the document of a package from the npm registry. The documents of popular packages run
+// into megabytes, so they are decoded while they arrive.
+func fetchNPMDocument(ctx context.Context, f *fetcher, name string) (npmDocument, error) {
+	var document npmDocument
+	err := f.streamWithRetry(ctx, npmEndpoint+"/"+url.PathEscape(name), func(body io.Reader) error {
+		var err error
+		document, err = decodeNPMDocument(body)
+		return err
+	})
+	return document, err
+}
+
+// decodeNPMDocument decodes a package document token by token, so that only one version is held in memory besides
+// the result, and fields we do not use, such as the readme, are skipped.
+func decodeNPMDocument(r io.Reader) (npmDocument, error) {
+	var document npmDocument
+	decoder := json.NewDecoder(r)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return document, fmt.Errorf("decoding npm document: %w", err)
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return document, fmt.Errorf("decoding npm document: %w", err)
+		}
+		var raw json.RawMessage
+		switch key, _ := token.(string); key {
+		case "versions":
+			document.Versions, err = decodeNPMVersions(decoder)
+		case "dist-tags":
+			var tags struct {
+				Latest string `json:"latest"`
+			}
+			err = decoder.Decode(&raw)
+			json.Unmarshal(raw, &tags)
+			document.Latest = tags.Latest
+		case "time":
+			err = decoder.Decode(&raw)
+			document.Times = npmTimes(raw)
+		default:
+			err = decoder.Decode(&raw)
+			document.set(key, raw)
+		}
+		if err != nil {
+			return document, fmt.Errorf("decoding npm document: %w", err)
+		}
+	}
+	if err := expectDelim(decoder, '}'); err != nil {
+		return document, fmt.Errorf("decoding npm document: %w", err)
+	}
+	return document, nil
+}
+
+// decodeNPMVersions decodes the versions object of a package document one version at a time. Versions whose
+// dependencies are malformed, which happens in old packages, are kept without the malformed ones.
+func decodeNPMVersions(decoder *json.Decoder) ([]npmVersion, error) {
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
+	var versions []npmVersion
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		var version npmVersion
+		// A type error is only reported once the whole value has been read, so decoding can go on after it
+		var typeErr *json.UnmarshalTypeError
+		if err := decoder.Decode(&version); errors.As(err, &typeErr) {
+			slog.Debug("Malformed npm version", "version", token, "err", err)
+		} else if err != nil {
+			return nil, err
+		}
+		version.Number, _ = token.(string)
+		versions = append(versions, version)
+	}
+	return versions, expectDelim(decoder, '}')
+}
+
+// expectDelim reads the next token and fails unless it is the given delimiter.
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v, got %v", delim, token)
+	}
+	return nil
+}
+
+// set assigns a top-level field of a package document. Fields are left empty if they do not have the expected type,
+// and the license and repository are accepted in every shape the registry has used over time.
+func (d *npmDocument) set(key string, raw json.RawMessage) {
+	switch key {
+	case "name":
+		json.Unmarshal(raw, &d.Name)
+	case "description":
+		json.Unmarshal(raw, &d.Description)
+	case "homepage":
+		json.Unmarshal(raw, &d.Homepage)
+	case "keywords":
+		var keywords string
+		if json.Unmarshal(raw, &d.Keywords) != nil && json.Unmarshal(raw, &keywords) == nil {
+			d.Keywords = strings.FieldsFunc(keywords, func(r rune) bool {
+				return r == ',' || r == ' '
+			})
+		}
+	case "license", "licenses":
+		// A string, an object with a type or, in old packages, a list of such objects
+		var license struct {
+			Type string `json:"type"`
+		}
+		var licenses []struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(raw, &d.Licenses) != nil && json.Unmarshal(raw, &license) == nil {
+			d.Licenses = license.Type
+		} else if json.Unmarshal(raw, &licenses) == nil {
+			types := make([]string, 0, len(licenses))
+			for _, license := range licenses {
+				types = append(types, license.Type)
+			}
+			d.Licenses = strings.Join(types, ",")
+		}
+	case "repository":
+		var repository struct {
+			URL string `json:"url"`
+		}
+		if json.Unmarshal(raw, &d.RepositoryURL) != nil && json.Unmarshal(raw, &repository) == nil {
+			d.RepositoryURL = repository.URL
+		}
+		d.RepositoryURL = strings.TrimSuffix(strings.TrimPrefix(d.RepositoryURL, "git+"), ".git")
+	}
+}
+
+// npmTimes decodes the time field of a package document. Entries that are not times are left out, such as the
+// details of an unpublished package.
+func npmTimes(raw json.RawMessage) map[string]string {
+	var entries map[string]json.RawMessage
+	json.Unmarshal(raw, &entries)
+	times := make(map[string]string, len(entries))
+	for number, entry := range entries {
+		var published string
+		if json.Unmarshal(entry, &published) == nil {
+			times[number] = published
+		}
+	}
+	return times
+}
+
+// toProject converts the package document into the record shape used for libraries.io packages. Versions are ordered
+// by publication and prereleases are removed unless includePrerelease is set. The dependencies are those of the latest
+// release that is left, the one the latest dist-tag points to unless that is a removed prerelease.
+func (d npmDocument) toProject(includePrerelease bool) Project {
+	versions := make([]Version, 0, len(d.Versions))
+	for _, version := range d.Versions {
+		versions = append(versions, Version{Number: version.Number, PublishedAt: d.Times[version.Number]})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		if versions[i].PublishedAt != versions[j].PublishedAt {
+			return versions[i].PublishedAt < versions[j].PublishedAt
+		}
+		return versions[i].Number < versions[j].Number
+	})
+
+	project := Project{
+		Name:          d.Name,
+		Platform:      "NPM",
+		Description:   d.Description,
+		Homepage:      d.Homepage,
+		Language:      "JavaScript",
+		Keywords:      d.Keywords,
+		Licenses:      d.Licenses,
+		RepositoryURL: d.RepositoryURL,
+		Versions:      versions,
+	}
+	for _, version := range versions {
+		if version.Number == d.Latest {
+			project.LatestReleaseNumber = version.Number
+			project.LatestReleasePublishedAt = version.PublishedAt
+		}
+	}
+	project = normalizeProject(project)
+	if !includePrerelease {
+		project = withoutPrereleases(project)
+	}
+	for _, version := range d.Versions {
+		if version.Number == project.LatestReleaseNumber {
+			project.Dependencies = version.dependencies()
+		}
+	}
+	return project
+}
+
+// dependencies lists the dependencies of the version, first the runtime, then the development and then the peer
+// dependencies, each sorted by name. Their kinds are named like libraries.io names them.
+func (v npmVersion) dependencies() []Dependency {
+	kinds := []struct {
+		kind         string
+		requirements map[string]string
+	}{
+		{"runtime", v.Dependencies},
+		{"Development", v.DevDependencies},
+		{"peer", v.PeerDependencies},
+	}
+	var dependencies []Dependency
+	for _, kind := range kinds {
+		names := make([]string, 0, len(kind.requirements))
+		for name := range kind.requirements {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			dependencies = append(dependencies, Dependency{
+				Name:         name,
+				Platform:     "NPM",
+				Requirements: kind.requirements[name],
+				Kind:         kind.kind,
+			})
+		}
+	}
+	return dependencies
+}
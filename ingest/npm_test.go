@@ -0,0 +1,154 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// useNPMTestServer points the npm registry endpoint at a local server for the duration of the test.
+func useNPMTestServer(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previous := npmEndpoint
+	npmEndpoint = server.URL
+	t.Cleanup(func() {
+		npmEndpoint = previous
+		server.Close()
+	})
+}
+
+// npmFixture is the document of a scoped package whose latest dist-tag points to a prerelease.
+const npmFixture = `{
+	"_id": "@scope/pkg",
+	"name": "@scope/pkg",
+	"description": "A package",
+	"dist-tags": {"latest": "2.0.0-beta.1", "next": "2.0.0-beta.1"},
+	"versions": {
+		"1.0.0": {"dependencies": {"b": "^1.0.0"}, "readme": "old"},
+		"1.1.0": {
+			"dependencies": {"b": "^1.1.0", "a": "~2.0.0"},
+			"devDependencies": {"jest": "^29.0.0"},
+			"peerDependencies": {"react": ">=17"}
+		},
+		"2.0.0-beta.1": {"dependencies": {"c": "*"}}
+	},
+	"time": {
+		"created": "2019-12-01T00:00:00.000Z",
+		"modified": "2021-01-01T00:00:00.000Z",
+		"1.0.0": "2020-01-01T00:00:00.000Z",
+		"1.1.0": "2020-06-01T00:00:00.000Z",
+		"2.0.0-beta.1": "2021-01-01T00:00:00.000Z"
+	},
+	"homepage": "https://example.com",
+	"keywords": ["x", "y"],
+	"repository": {"type": "git", "url": "git+https://github.com/scope/pkg.git"},
+	"license": {"type": "MIT"},
+	"readme": "A very long readme"
+}`
+
+func TestIngestNPM(t *testing.T) {
+	var paths []string
+	useNPMTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		switch r.URL.Path {
+		case "/@scope/pkg":
+			fmt.Fprint(w, npmFixture)
+		case "/empty":
+			fmt.Fprint(w, `{"name": "empty", "time": {"unpublished": {"time": "2020-01-01T00:00:00.000Z"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	outPath := filepath.Join(t.TempDir(), "npm.csv")
+
+	stats, err := IngestNPM(context.Background(), Options{Workers: 1}, []string{"@scope/pkg", "missing", "empty"}, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 2 || stats.Requests != 3 {
+		t.Errorf("Expected 2 packages from 3 requests, got %+v", stats)
+	}
+
+	t.Run("Escapes the slash of scoped packages", func(t *testing.T) {
+		if paths[0] != "/@scope%2Fpkg" {
+			t.Errorf("Expected the path /@scope%%2Fpkg, got %s", paths[0])
+		}
+	})
+
+	records := readCSV(t, outPath)
+	if len(records) != 3 {
+		t.Fatalf("Expected a header and two rows, got %d rows", len(records))
+	}
+
+	t.Run("Writes the columns of libraries.io", func(t *testing.T) {
+		if !reflect.DeepEqual(records[0], csvHeader) {
+			t.Errorf("Expected the header %v, got %v", csvHeader, records[0])
+		}
+	})
+
+	t.Run("Maps the document into the common record", func(t *testing.T) {
+		row := strings.Join(records[1], "|")
+		expected := "@scope/pkg|NPM|A package|https://example.com|JavaScript|x;y|1.1.0|2020-06-01T00:00:00.000Z|" +
+			"1.0.0;1.1.0|a@~2.0.0;b@^1.1.0;jest@^29.0.0;react@>=17|||||MIT|https://github.com/scope/pkg||pkg:npm/%40scope/pkg@1.1.0"
+		if row != expected {
+			t.Errorf("Expected row %s, got %s", expected, row)
+		}
+	})
+
+	t.Run("Handles unpublished packages", func(t *testing.T) {
+		row := strings.Join(records[2], "|")
+		if expected := "empty|NPM|||JavaScript|||||||||||||pkg:npm/empty"; row != expected {
+			t.Errorf("Expected row %s, got %s", expected, row)
+		}
+	})
+}
+
+func TestIngestNPMFailure(t *testing.T) {
+	useNPMTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name": "broken", "versions": {"1.0.0": `)
+	})
+	outPath := filepath.Join(t.TempDir(), "npm.csv")
+
+	if _, err := IngestNPM(context.Background(), Options{}, []string{"broken"}, outPath); err == nil {
+		t.Error("Expected an error for a truncated document")
+	}
+}
+
+func TestDecodeNPMDocument(t *testing.T) {
+	t.Run("Reads the body in small pieces", func(t *testing.T) {
+		document, err := decodeNPMDocument(iotest.OneByteReader(strings.NewReader(npmFixture)))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(document.Versions) != 3 || document.Latest != "2.0.0-beta.1" {
+			t.Errorf("Expected 3 versions and the latest dist-tag, got %+v", document)
+		}
+	})
+
+	t.Run("Keeps versions with malformed dependencies", func(t *testing.T) {
+		document, err := decodeNPMDocument(strings.NewReader(`{"versions": {"0.1.0": {"dependencies": ["a"]}}}`))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(document.Versions) != 1 || document.Versions[0].Number != "0.1.0" {
+			t.Errorf("Expected version 0.1.0, got %+v", document.Versions)
+		}
+	})
+
+	t.Run("Accepts the old shapes of licenses and keywords", func(t *testing.T) {
+		document, err := decodeNPMDocument(strings.NewReader(`{"licenses": [{"type": "MIT"}, {"type": "GPL-2.0"}], "keywords": "a, b"}`))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if document.Licenses != "MIT,GPL-2.0" || !reflect.DeepEqual(document.Keywords, []string{"a", "b"}) {
+			t.Errorf("Expected licenses MIT,GPL-2.0 and keywords [a b], got %q and %v", document.Licenses, document.Keywords)
+		}
+	})
+}
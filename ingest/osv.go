@@ -0,0 +1,193 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// osvEndpoint is the OSV endpoint for the vulnerabilities of a single package version, and osvBatchEndpoint the one
+// for many versions at once. They are variables so tests can point them at a local server.
+var (
+	osvEndpoint      = "https://api.osv.dev/v1/query"
+	osvBatchEndpoint = "https://api.osv.dev/v1/querybatch"
+)
+
+// maxOSVBatch is the largest number of queries OSV accepts in a single batch.
+const maxOSVBatch = 1000
+
+// osvEcosystems maps the libraries.io platforms OSV has advisories for to the names of their OSV ecosystems.
+var osvEcosystems = map[string]string{
+	"cargo":     "crates.io",
+	"cran":      "CRAN",
+	"go":        "Go",
+	"hackage":   "Hackage",
+	"hex":       "Hex",
+	"maven":     "Maven",
+	"npm":       "npm",
+	"nuget":     "NuGet",
+	"packagist": "Packagist",
+	"pub":       "Pub",
+	"pypi":      "PyPI",
+	"rubygems":  "RubyGems",
+	"swiftpm":   "SwiftURL",
+}
+
+// OSVEcosystem returns the OSV ecosystem of a libraries.io platform, which is matched regardless of case, e.g. PyPI
+// for Pypi. ok is false if OSV has no advisories for the platform.
+func OSVEcosystem(platform string) (ecosystem string, ok bool) {
+	ecosystem, ok = osvEcosystems[strings.ToLower(platform)]
+	return ecosystem, ok
+}
+
+// Vulnerability is an advisory OSV has for a package version.
+type Vulnerability struct {
+	// ID is the identifier of the advisory, e.g. GHSA-jfh8-c2jp-5v3q or PYSEC-2021-66.
+	ID string `json:"id"`
+	// Severity is the severity the advisory database rates it with, such as HIGH, or else its CVSS vector, e.g.
+	// CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H. It is empty if the advisory has neither.
+	Severity string `json:"severity"`
+}
+
+// osvQuery is a query for the vulnerabilities of a single package version, on its own or as part of a batch.
+type osvQuery struct {
+	Package struct {
+		Name      string `json:"name"`
+		Ecosystem string `json:"ecosystem"`
+	} `json:"package"`
+	Version   string `json:"version"`
+	PageToken string `json:"page_token,omitempty"`
+}
+
+func newOSVQuery(ecosystem, name, version string) osvQuery {
+	query := osvQuery{Version: version}
+	query.Package.Name, query.Package.Ecosystem = name, ecosystem
+	return query
+}
+
+// osvResult is the answer to a query. OSV leaves out vulns when there are none, and sets NextPageToken when there are
+// more than fit into a single answer.
+type osvResult struct {
+	Vulns []struct {
+		ID       string `json:"id"`
+		Severity []struct {
+			Type  string `json:"type"`
+			Score string `json:"score"`
+		} `json:"severity"`
+		DatabaseSpecific struct {
+			Severity string `json:"severity"`
+		} `json:"database_specific"`
+	} `json:"vulns"`
+	NextPageToken string `json:"next_page_token"`
+}
+
+// QueryOSV returns the advisories the OSV database has for version of the package name in the given OSV ecosystem,
+// e.g. PyPI, or none if it has no known vulnerabilities. OSVEcosystem translates libraries.io platforms.
+func QueryOSV(ecosystem, name, version string) ([]Vulnerability, error) {
+	return QueryOSVContext(context.Background(), ecosystem, name, version)
+}
+
+// QueryOSVContext is like QueryOSV but aborts the request when ctx is done.
+func QueryOSVContext(ctx context.Context, ecosystem, name, version string) ([]Vulnerability, error) {
+	opts, err := Options{}.withDefaultsExceptAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	f := defaultClient().newFetcher(opts)
+	query := newOSVQuery(ecosystem, name, version)
+	vulnerabilities := []Vulnerability{}
+	for {
+		payload, err := json.Marshal(query)
+		if err != nil {
+			return nil, fmt.Errorf("encoding OSV query: %w", err)
+		}
+		body, err := f.postWithRetry(ctx, osvEndpoint, payload)
+		if err != nil {
+			return nil, fmt.Errorf("querying OSV for %s %s: %w", name, version, err)
+		}
+		var result osvResult
+		if err := decodeResponse(osvEndpoint, body, &result); err != nil {
+			return nil, fmt.Errorf("decoding OSV response: %w", err)
+		}
+		for _, vuln := range result.Vulns {
+			vulnerability := Vulnerability{ID: vuln.ID, Severity: vuln.DatabaseSpecific.Severity}
+			if vulnerability.Severity == "" && len(vuln.Severity) > 0 {
+				vulnerability.Severity = vuln.Severity[0].Score
+			}
+			vulnerabilities = append(vulnerabilities, vulnerability)
+		}
+		if result.NextPageToken == "" {
+			return vulnerabilities, nil
+		}
+		query.PageToken = result.NextPageToken
+	}
+}
+
+// fetchVulnerabilityCounts sets the number of vulnerabilities OSV knows for the latest release of each project, with
+// batches of up to 1000 projects. Projects without a latest release or on a platform OSV has no advisories for keep
+// a nil count. platform is used for projects that do not name their own.
+func fetchVulnerabilityCounts(ctx context.Context, projects []Project, platform string, f *fetcher) error {
+	var queries []osvQuery
+	// queried holds the index in projects of every query
+	var queried []int
+	for i, project := range projects {
+		projectPlatform := project.Platform
+		if projectPlatform == "" {
+			projectPlatform = platform
+		}
+		ecosystem, ok := OSVEcosystem(projectPlatform)
+		if !ok || project.LatestReleaseNumber == "" {
+			continue
+		}
+		queries = append(queries, newOSVQuery(ecosystem, project.Name, project.LatestReleaseNumber))
+		queried = append(queried, i)
+		projects[i].Vulnerabilities = new(int)
+	}
+
+	for len(queries) > 0 {
+		batch := queries[:min(len(queries), maxOSVBatch)]
+		results, err := fetchOSVBatch(ctx, f, batch)
+		if err != nil {
+			return err
+		}
+		// Queries with more results than OSV answers at once are asked again for the next page
+		var more []osvQuery
+		var moreQueried []int
+		for i, result := range results {
+			*projects[queried[i]].Vulnerabilities += len(result.Vulns)
+			if result.NextPageToken != "" {
+				batch[i].PageToken = result.NextPageToken
+				more = append(more, batch[i])
+				moreQueried = append(moreQueried, queried[i])
+			}
+		}
+		queries = append(more, queries[len(batch):]...)
+		queried = append(moreQueried, queried[len(batch):]...)
+	}
+	return nil
+}
+
+// fetchOSVBatch sends queries to OSV in a single request and returns their results, in the same order.
+func fetchOSVBatch(ctx context.Context, f *fetcher, queries []osvQuery) ([]osvResult, error) {
+	payload, err := json.Marshal(struct {
+		Queries []osvQuery `json:"queries"`
+	}{queries})
+	if err != nil {
+		return nil, fmt.Errorf("encoding OSV queries: %w", err)
+	}
+	body, err := f.postWithRetry(ctx, osvBatchEndpoint, payload)
+	if err != nil {
+		return nil, fmt.Errorf("querying OSV: %w", err)
+	}
+	var response struct {
+		Results []osvResult `json:"results"`
+	}
+	if err := decodeResponse(osvBatchEndpoint, body, &response); err != nil {
+		return nil, fmt.Errorf("decoding OSV response: %w", err)
+	}
+	if len(response.Results) != len(queries) {
+		return nil, fmt.Errorf("OSV answered %d queries with %d results", len(queries), len(response.Results))
+	}
+	return response.Results, nil
+}
@@ -0,0 +1,139 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// useOSVTestServer points both OSV endpoints at a local server for the duration of the test.
+func useOSVTestServer(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previousQuery, previousBatch := osvEndpoint, osvBatchEndpoint
+	osvEndpoint, osvBatchEndpoint = server.URL+"/v1/query", server.URL+"/v1/querybatch"
+	t.Cleanup(func() {
+		osvEndpoint, osvBatchEndpoint = previousQuery, previousBatch
+		server.Close()
+	})
+}
+
+func TestQueryOSV(t *testing.T) {
+	t.Run("Returns the advisories with their severities", func(t *testing.T) {
+		var queries []osvQuery
+		useOSVTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			var query osvQuery
+			if err := json.NewDecoder(r.Body).Decode(&query); err != nil || r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			queries = append(queries, query)
+			if query.PageToken == "" {
+				io.WriteString(w, `{"vulns": [{"id": "GHSA-1", "database_specific": {"severity": "HIGH"},
+					"severity": [{"type": "CVSS_V3", "score": "CVSS:3.1/AV:N"}]}], "next_page_token": "2"}`)
+				return
+			}
+			io.WriteString(w, `{"vulns": [{"id": "PYSEC-2", "severity": [{"type": "CVSS_V3", "score": "CVSS:3.1/AV:L"}]}, {"id": "OSV-3"}]}`)
+		})
+
+		vulnerabilities, err := QueryOSV("PyPI", "jinja2", "2.4.1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expected := []Vulnerability{{"GHSA-1", "HIGH"}, {"PYSEC-2", "CVSS:3.1/AV:L"}, {"OSV-3", ""}}
+		if !slices.Equal(vulnerabilities, expected) {
+			t.Errorf("Expected %v, got %v", expected, vulnerabilities)
+		}
+		if len(queries) != 2 || queries[0].Package.Ecosystem != "PyPI" || queries[0].Version != "2.4.1" || queries[1].PageToken != "2" {
+			t.Errorf("Expected a query for jinja2 2.4.1 and one for its second page, got %+v", queries)
+		}
+	})
+
+	t.Run("Returns no advisories for a version without known vulnerabilities", func(t *testing.T) {
+		useOSVTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, `{}`)
+		})
+
+		vulnerabilities, err := QueryOSV("npm", "left-pad", "1.3.0")
+		if err != nil || vulnerabilities == nil || len(vulnerabilities) != 0 {
+			t.Errorf("Expected an empty list and no error, got %v and %v", vulnerabilities, err)
+		}
+	})
+}
+
+func TestFetchVulnerabilityCounts(t *testing.T) {
+	var batches [][]osvQuery
+	useOSVTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var batch struct {
+			Queries []osvQuery `json:"queries"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil || r.URL.Path != "/v1/querybatch" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		batches = append(batches, batch.Queries)
+		results := make([]string, len(batch.Queries))
+		for i, query := range batch.Queries {
+			switch {
+			case query.Package.Name == "a" && query.PageToken == "":
+				results[i] = `{"vulns": [{"id": "GHSA-1"}, {"id": "GHSA-2"}], "next_page_token": "next"}`
+			case query.Package.Name == "a":
+				results[i] = `{"vulns": [{"id": "GHSA-3"}]}`
+			default:
+				results[i] = `{}`
+			}
+		}
+		io.WriteString(w, `{"results": [`+strings.Join(results, ",")+`]}`)
+	})
+	projects := []Project{
+		{Name: "a", LatestReleaseNumber: "1.0.0"},
+		{Name: "b", Platform: "Pypi", LatestReleaseNumber: "2.0"},
+		{Name: "c", Platform: "Bower", LatestReleaseNumber: "1.0.0"},
+		{Name: "d"},
+	}
+
+	if err := fetchVulnerabilityCounts(context.Background(), projects, "NPM", testFetcher(1)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	counts := make([]string, len(projects))
+	for i, project := range projects {
+		counts[i] = formatCount(project.Vulnerabilities)
+	}
+	if expected := []string{"3", "0", "", ""}; !slices.Equal(counts, expected) {
+		t.Errorf("Expected the counts %v, got %v", expected, counts)
+	}
+
+	t.Run("Batches the queries", func(t *testing.T) {
+		if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+			t.Fatalf("Expected a batch of 2 queries and one for the next page, got %+v", batches)
+		}
+		if batches[0][1].Package.Ecosystem != "PyPI" || batches[1][0].PageToken != "next" {
+			t.Errorf("Expected the ecosystem PyPI and the page token next, got %+v", batches)
+		}
+	})
+}
+
+func TestIngestVulnerabilities(t *testing.T) {
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testProjectsPage))
+	})
+	useOSVTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"results": [{"vulns": [{"id": "GHSA-1"}]}]}`)
+	})
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+
+	if _, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Vulnerabilities: true}, outPath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	records := readCSV(t, outPath)
+	column := slices.Index(csvHeader, "vulnerabilities")
+	if len(records) != 2 || records[1][column] != "1" {
+		t.Errorf("Expected a single row with 1 vulnerability, got %v", records)
+	}
+}
@@ -0,0 +1,489 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Format is the file format packages are written in.
+type Format int
+
+const (
+	// FormatCSV writes one row per package, joining list fields with semicolons.
+	FormatCSV Format = iota
+	// FormatNDJSON writes one JSON object per line and package, keeping list fields as JSON arrays.
+	FormatNDJSON
+	// FormatJSON writes a single JSON array with one object per package, like FormatNDJSON but readable by tools that
+	// expect a plain JSON document. It is written one package at a time as well.
+	FormatJSON
+	// FormatSQLite writes a SQLite database with the packages, versions and dependencies tables that IngestNormalized
+	// writes as CSV files, so the results can be queried with SQL.
+	FormatSQLite
+)
+
+// String returns the name of the format as accepted by ParseFormat.
+func (f Format) String() string {
+	switch f {
+	case FormatCSV:
+		return "csv"
+	case FormatNDJSON:
+		return "ndjson"
+	case FormatJSON:
+		return "json"
+	case FormatSQLite:
+		return "sqlite"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// ParseFormat returns the format with the given name, which is csv, ndjson, json or sqlite.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "csv":
+		return FormatCSV, nil
+	case "ndjson":
+		return FormatNDJSON, nil
+	case "json":
+		return FormatJSON, nil
+	case "sqlite":
+		return FormatSQLite, nil
+	}
+	return 0, fmt.Errorf("unknown output format %q: expected csv, ndjson, json or sqlite", name)
+}
+
+// FormatForPath returns the format matching the extension of path, .csv, .ndjson, .json or .sqlite (or .db), and
+// whether there is one. A trailing CompressedExt is skipped, so result.csv.gz is a CSV file.
+func FormatForPath(path string) (Format, bool) {
+	ext := strings.TrimPrefix(filepath.Ext(TrimCompressedExt(path)), ".")
+	if ext == "" {
+		return 0, false
+	}
+	if strings.EqualFold(ext, "db") {
+		return FormatSQLite, true
+	}
+	format, err := ParseFormat(ext)
+	return format, err == nil
+}
+
+// outputBufferSize is the size of the buffer between the encoder and the output file.
+const outputBufferSize = 64 * 1024
+
+// outputFile is the buffered output handed to the write function of writeFileAt. Besides writing to the buffer, it
+// can flush everything written so far and report the size of the file after that, which is what a checkpoint records.
+type outputFile struct {
+	*bufio.Writer
+	counter *countingWriter
+	// gz compresses the output between the buffer and the file if it is compressed, and is nil otherwise
+	gz *gzip.Writer
+	// temp is the temporary file the output is written to until it is complete
+	temp string
+	// checkpointed is set once a checkpoint continues temp, which is then kept instead of removed if the write is
+	// cancelled
+	checkpointed bool
+}
+
+// sync flushes the buffer to the file and returns the size of the file.
+func (o *outputFile) sync() (int64, error) {
+	if err := o.Flush(); err != nil {
+		return 0, err
+	}
+	if o.gz != nil {
+		if err := o.gz.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return o.counter.n, nil
+}
+
+// close flushes the buffer and, for compressed output, writes the end of the gzip stream. It is called before the
+// file is committed, or kept for a checkpoint after a cancellation.
+func (o *outputFile) close() error {
+	err := o.Flush()
+	if o.gz != nil {
+		if closeErr := o.gz.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// countingWriter passes writes on to w and keeps count of the bytes written, starting at n.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// resumePoint says where writing into an existing output file continues. The zero value starts a new file.
+type resumePoint struct {
+	// from is the file whose start is continued, either the output file itself or the temporary file of a run that
+	// crashed while writing it
+	from string
+	// offset is the size the file is truncated to before writing continues
+	offset int64
+	// packages is the number of packages already in the file
+	packages int
+}
+
+// writeFile creates outPath and its directory and lets write fill it through a buffer. write returns the number of
+// packages it wrote. If outPath ends in CompressedExt, the file is gzip-compressed at the default level.
+//
+// The output is written to a temporary file next to outPath, named after the id of the process, and only renamed to
+// outPath once it is complete, so a crash, a failed write or a cancellation leaves the previous output untouched and
+// cannot be mistaken for a complete data set. Temporary files that crashed runs left behind are removed. If ctx is
+// done, the temporary file is removed as well and ctx.Err() is returned.
+func writeFile(ctx context.Context, outPath string, write func(w io.Writer) (int, error)) (int, error) {
+	return writeFileAt(ctx, outPath, resumePoint{}, 0, func(out *outputFile) (int, error) {
+		return write(out)
+	})
+}
+
+// writeFileAt is like writeFile, but if resume.offset is positive, the output continues the first resume.offset bytes
+// of resume.from instead of starting anew. Compressed output is written at the given gzip level, where zero is the
+// default level, and cannot be continued. If ctx is done once a checkpoint continues the temporary file, the file is
+// left where it is for the next run to resume, rather than removed.
+func writeFileAt(ctx context.Context, outPath string, resume resumePoint, level int, write func(out *outputFile) (int, error)) (int, error) {
+	compressed := IsCompressedPath(outPath)
+	if compressed && resume.offset > 0 {
+		return 0, fmt.Errorf("cannot continue the compressed output %s", outPath)
+	}
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	f, err := createAtomicAt(outPath, resume)
+	if err != nil {
+		return 0, err
+	}
+
+	out := &outputFile{counter: &countingWriter{w: f, n: resume.offset}, temp: f.Name()}
+	var w io.Writer = out.counter
+	if compressed {
+		if out.gz, err = gzip.NewWriterLevel(out.counter, level); err != nil {
+			f.Abort()
+			return 0, fmt.Errorf("compressing %s: %w", outPath, err)
+		}
+		w = out.gz
+	}
+	out.Writer = bufio.NewWriterSize(w, outputBufferSize)
+	written, err := write(out)
+	if flushErr := out.close(); err == nil && flushErr != nil {
+		err = fmt.Errorf("writing %s: %w", outPath, flushErr)
+	}
+	switch {
+	case ctx.Err() != nil && out.checkpointed:
+		f.Close()
+		return written, ctx.Err()
+	case ctx.Err() != nil:
+		f.Abort()
+		return written, ctx.Err()
+	case err != nil:
+		f.Abort()
+		return written, err
+	}
+	if commitErr := f.Commit(); commitErr != nil {
+		return written, commitErr
+	}
+	return written, nil
+}
+
+// writeCSVFile is like writeFile but writes CSV, starting with the header row.
+func writeCSVFile(ctx context.Context, outPath string, header []string, write func(writer *csv.Writer) (int, error)) (int, error) {
+	return writeFile(ctx, outPath, func(w io.Writer) (int, error) {
+		return writeCSV(w, outPath, header, true, write)
+	})
+}
+
+// writeCSV writes CSV to w, starting with the header row if withHeader is set.
+func writeCSV(w io.Writer, outPath string, header []string, withHeader bool, write func(writer *csv.Writer) (int, error)) (int, error) {
+	writer := csv.NewWriter(w)
+	if withHeader {
+		if err := writer.Write(header); err != nil {
+			return 0, fmt.Errorf("writing CSV header: %w", err)
+		}
+	}
+	written, err := write(writer)
+	writer.Flush()
+	if err == nil && writer.Error() != nil {
+		err = fmt.Errorf("writing %s: %w", outPath, writer.Error())
+	}
+	return written, err
+}
+
+// writeProjectsFile is like writeFile but hands write a projectWriter for the given format.
+func writeProjectsFile(ctx context.Context, outPath string, format Format, write func(writer projectWriter) (int, error)) (int, error) {
+	return writeProjectsFileAt(ctx, outPath, format, nil, resumePoint{}, 0, func(writer projectWriter, out *outputFile) (int, error) {
+		return write(writer)
+	})
+}
+
+// writeProjectsFileAt is like writeProjectsFile but continues the file at resume, and also hands write the output file
+// so that it can be synced for a checkpoint. CSV output only has the columns of csvHeader at the given indices, or all
+// of them if columns is nil. Continuing a file leaves out what was written at its start already, such as the CSV
+// header. A FormatSQLite database cannot be continued and has no output file, so resume must be the zero value and out
+// is nil. A database cannot be compressed either. level is the gzip level of compressed output, as for writeFileAt.
+func writeProjectsFileAt(ctx context.Context, outPath string, format Format, columns []int, resume resumePoint, level int, write func(writer projectWriter, out *outputFile) (int, error)) (int, error) {
+	if format == FormatSQLite && IsCompressedPath(outPath) {
+		return 0, fmt.Errorf("cannot compress the SQLite database %s", outPath)
+	}
+	if format == FormatSQLite {
+		return writeSQLiteFile(ctx, outPath, func(writer projectWriter) (int, error) {
+			return write(writer, nil)
+		})
+	}
+	return writeFileAt(ctx, outPath, resume, level, func(out *outputFile) (int, error) {
+		switch format {
+		case FormatNDJSON:
+			return write(ndjsonProjectWriter{json.NewEncoder(out)}, out)
+		case FormatJSON:
+			if resume.offset <= 0 {
+				if _, err := io.WriteString(out, "["); err != nil {
+					return 0, fmt.Errorf("writing JSON: %w", err)
+				}
+			}
+			writer := &jsonProjectWriter{w: out, count: resume.packages}
+			writer.encoder = json.NewEncoder(&writer.buf)
+			written, err := write(writer, out)
+			// A resumed run truncates the closing bracket away again
+			closing := "\n]\n"
+			if writer.count == 0 {
+				closing = "]\n"
+			}
+			if _, closeErr := io.WriteString(out, closing); err == nil && closeErr != nil {
+				err = fmt.Errorf("writing JSON: %w", closeErr)
+			}
+			return written, err
+		}
+		return writeCSV(out, outPath, selectColumns(csvHeader, columns), resume.offset <= 0, func(writer *csv.Writer) (int, error) {
+			return write(csvProjectWriter{writer: writer, columns: columns}, out)
+		})
+	})
+}
+
+// ReadCSV reads a file written by Ingest in FormatCSV back into projects. Columns are matched by the header row, so
+// files from before a column was added can still be read. Only the version numbers can be recovered from the versions
+// column, and dependencies are assumed to be on the platform of the project that declares them. A gzip-compressed file
+// is decompressed while it is read.
+func ReadCSV(path string) ([]Project, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header of %s: %w", path, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("%s has no name column", path)
+	}
+
+	var projects []Project
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return projects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		project := Project{
+			Name:                     field("name"),
+			Platform:                 field("platform"),
+			Description:              field("description"),
+			Homepage:                 field("homepage"),
+			Language:                 field("language"),
+			Keywords:                 splitList(field("keywords")),
+			LatestReleaseNumber:      field("latest_release_number"),
+			LatestReleasePublishedAt: field("latest_release_published_at"),
+			Licenses:                 strings.Join(splitList(field("licenses")), ","),
+			RepositoryURL:            field("repository_url"),
+		}
+		counts := []struct {
+			column string
+			count  **int
+		}{
+			{"rank", &project.Rank},
+			{"stars", &project.Stars},
+			{"forks", &project.Forks},
+			{"dependent_repos_count", &project.DependentReposCount},
+			{"vulnerabilities", &project.Vulnerabilities},
+		}
+		for _, c := range counts {
+			if *c.count, err = parseCount(field(c.column)); err != nil {
+				return nil, fmt.Errorf("reading %s of %s in %s: %w", c.column, project.Name, path, err)
+			}
+		}
+		for _, number := range splitList(field("versions")) {
+			project.Versions = append(project.Versions, Version{Number: number})
+		}
+		for _, dependency := range splitList(field("dependencies")) {
+			name, requirements := splitDependency(dependency)
+			project.Dependencies = append(project.Dependencies, Dependency{
+				Name:         name,
+				Platform:     project.Platform,
+				Requirements: requirements,
+			})
+		}
+		projects = append(projects, project)
+	}
+}
+
+// splitDependency splits a dependency written by csvRecord as name@requirements. Scoped NPM package names start with an
+// @, and requirements can contain one, such as the URL of a Python direct reference or an npm: alias, so the name ends
+// at the first @ after its first character.
+func splitDependency(dependency string) (name, requirements string) {
+	if dependency == "" {
+		return "", ""
+	}
+	name, requirements, _ = strings.Cut(dependency[1:], "@")
+	return dependency[:1] + name, requirements
+}
+
+// parseCount parses a count written by formatCount, returning nil for an empty field.
+func parseCount(field string) (*int, error) {
+	if field == "" {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(field)
+	if err != nil {
+		return nil, err
+	}
+	return &count, nil
+}
+
+// splitList splits a semicolon separated CSV field, returning nil for an empty one.
+func splitList(field string) []string {
+	if field == "" {
+		return nil
+	}
+	return strings.Split(field, ";")
+}
+
+// projectWriter encodes projects in one of the output formats.
+type projectWriter interface {
+	// writeProjects encodes the projects and passes them on to the underlying writer. It returns the number of rows
+	// written, which can be more than one per project.
+	writeProjects(projects []Project) (int, error)
+}
+
+// csvProjectWriter writes one CSV row per project, with the columns of csvHeader at the given indices or all of them
+// if columns is nil.
+type csvProjectWriter struct {
+	writer  *csv.Writer
+	columns []int
+}
+
+func (w csvProjectWriter) writeProjects(projects []Project) (int, error) {
+	for i, project := range projects {
+		if err := w.writer.Write(sanitizeRecord(selectColumns(project.csvRecord(), w.columns))); err != nil {
+			return i, fmt.Errorf("writing CSV row: %w", err)
+		}
+	}
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		return 0, fmt.Errorf("writing CSV: %w", err)
+	}
+	return len(projects), nil
+}
+
+// jsonProjectWriter writes the elements of a JSON array, one per line and project. The brackets around them are
+// written by writeProjectsFile.
+type jsonProjectWriter struct {
+	w       io.Writer
+	encoder *json.Encoder
+	// buf holds the encoding of one project, so that the separator can go before it
+	buf   bytes.Buffer
+	count int
+}
+
+func (w *jsonProjectWriter) writeProjects(projects []Project) (int, error) {
+	for i, project := range projects {
+		w.buf.Reset()
+		separator := ",\n"
+		if w.count == 0 {
+			separator = "\n"
+		}
+		w.buf.WriteString(separator)
+		if err := w.encoder.Encode(project); err != nil {
+			return i, fmt.Errorf("writing JSON: %w", err)
+		}
+		// Drop the newline the encoder ends every value with
+		if _, err := w.w.Write(bytes.TrimSuffix(w.buf.Bytes(), []byte("\n"))); err != nil {
+			return i, fmt.Errorf("writing JSON: %w", err)
+		}
+		w.count++
+	}
+	return len(projects), nil
+}
+
+// sanitizeRecord cleans up the fields of a CSV row in place. Line breaks are normalized to \n, other control
+// characters such as NUL, which some packages have in their metadata, are removed. Tabs are kept. encoding/csv takes
+// care of quoting the rest.
+func sanitizeRecord(record []string) []string {
+	for i, field := range record {
+		record[i] = sanitizeField(field)
+	}
+	return record
+}
+
+func sanitizeField(field string) string {
+	clean := strings.IndexFunc(field, func(r rune) bool {
+		return unicode.IsControl(r) && r != '\n' && r != '\t'
+	}) < 0
+	if clean {
+		return field
+	}
+	field = strings.ReplaceAll(field, "\r\n", "\n")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\r':
+			return '\n'
+		case r == '\n' || r == '\t':
+			return r
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, field)
+}
+
+// ndjsonProjectWriter writes one line of JSON per project.
+type ndjsonProjectWriter struct {
+	encoder *json.Encoder
+}
+
+func (w ndjsonProjectWriter) writeProjects(projects []Project) (int, error) {
+	for i, project := range projects {
+		if err := w.encoder.Encode(project); err != nil {
+			return i, fmt.Errorf("writing JSON line: %w", err)
+		}
+	}
+	return len(projects), nil
+}
@@ -0,0 +1,261 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	for _, format := range []Format{FormatCSV, FormatNDJSON, FormatJSON, FormatSQLite} {
+		parsed, err := ParseFormat(format.String())
+		if err != nil || parsed != format {
+			t.Errorf("Expected %s to parse as itself, got %s and %v", format, parsed, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestFormatForPath(t *testing.T) {
+	tests := map[string]Format{
+		"out.csv":       FormatCSV,
+		"out.ndjson":    FormatNDJSON,
+		"data/out.JSON": FormatJSON,
+		"out.sqlite":    FormatSQLite,
+		"out.db":        FormatSQLite,
+		"out.csv.gz":    FormatCSV,
+		"out.JSON.GZ":   FormatJSON,
+	}
+	for path, expected := range tests {
+		if format, ok := FormatForPath(path); !ok || format != expected {
+			t.Errorf("Expected %s to be written as %s, got %s", path, expected, format)
+		}
+	}
+	for _, path := range []string{"out", "out.xml", "out.gz"} {
+		if _, ok := FormatForPath(path); ok {
+			t.Errorf("Expected no format for %s", path)
+		}
+	}
+}
+
+func TestIngestJSON(t *testing.T) {
+	pages := 0
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		pages++
+		if pages > 2 {
+			w.Write([]byte("[]"))
+			return
+		}
+		// The second page has the same package under another name
+		w.Write([]byte(strings.Replace(testProjectsPage, `"left-pad"`, fmt.Sprintf(`"left-pad-%d"`, pages), 1)))
+	})
+	outPath := filepath.Join(t.TempDir(), "result.json")
+
+	stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Workers: 1, PerPage: 1, Format: FormatJSON}, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 2 {
+		t.Errorf("Expected 2 packages, got %d", stats.Packages)
+	}
+
+	var page []Project
+	if err := json.Unmarshal([]byte(testProjectsPage), &page); err != nil {
+		t.Fatalf("Could not decode the test page: %v", err)
+	}
+	page[0].Name = "left-pad-1"
+	second := slices.Clone(page)
+	second[0].Name = "left-pad-2"
+	expected := append(page, second...)
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("Could not read output: %v", err)
+	}
+	var actual []Project
+	if err := json.Unmarshal(data, &actual); err != nil {
+		t.Fatalf("Expected a JSON array, got %v:\n%s", err, data)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected the output to decode into %+v, got %+v", expected, actual)
+	}
+
+	t.Run("Writes an empty array without packages", func(t *testing.T) {
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("[]"))
+		})
+		outPath := filepath.Join(t.TempDir(), "result.json")
+		if _, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Format: FormatJSON}, outPath); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if data, _ := os.ReadFile(outPath); string(data) != "[]\n" {
+			t.Errorf("Expected an empty array, got %q", data)
+		}
+	})
+}
+
+func TestIngestNDJSON(t *testing.T) {
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testProjectsPage))
+	})
+	outPath := filepath.Join(t.TempDir(), "result.ndjson")
+
+	stats, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Format: FormatNDJSON}, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 1 {
+		t.Errorf("Expected 1 package, got %d", stats.Packages)
+	}
+
+	var expected []Project
+	if err := json.Unmarshal([]byte(testProjectsPage), &expected); err != nil {
+		t.Fatalf("Could not decode the test page: %v", err)
+	}
+	f, err := os.Open(outPath)
+	if err != nil {
+		t.Fatalf("Could not open output: %v", err)
+	}
+	defer f.Close()
+	var actual []Project
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var project Project
+		if err := json.Unmarshal(scanner.Bytes(), &project); err != nil {
+			t.Fatalf("Expected every line to be a JSON object, got %q: %v", scanner.Text(), err)
+		}
+		actual = append(actual, project)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected the output to decode into %+v, got %+v", expected, actual)
+	}
+}
+
+func TestIngestUnknownFormat(t *testing.T) {
+	if _, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Format: Format(42)}, filepath.Join(t.TempDir(), "result")); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(testProjectsPage))
+		default:
+			w.Write([]byte(`{"dependencies": [{"name": "@scope/tape", "requirements": "^4.0.0"}]}`))
+		}
+	})
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+	if _, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Dependencies: true}, outPath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	projects, err := ReadCSV(outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(projects) != 1 {
+		t.Fatalf("Expected 1 project, got %d", len(projects))
+	}
+	project := projects[0]
+	if project.Name != "left-pad" || project.LatestReleaseNumber != "1.3.0" || len(project.Keywords) != 2 {
+		t.Errorf("Expected the left-pad project, got %+v", project)
+	}
+	if len(project.Versions) != 2 || project.Versions[1].Number != "1.3.0" {
+		t.Errorf("Expected versions 1.2.0 and 1.3.0, got %v", project.Versions)
+	}
+	expected := Dependency{Name: "@scope/tape", Platform: "NPM", Requirements: "^4.0.0"}
+	if len(project.Dependencies) != 1 || project.Dependencies[0] != expected {
+		t.Errorf("Expected dependency %+v, got %v", expected, project.Dependencies)
+	}
+}
+
+func TestReadCSVRequirementsWithAt(t *testing.T) {
+	dependencies := []Dependency{
+		{Name: "pkg", Platform: "Pypi", Requirements: "git+https://github.com/o/r@v1.0"},
+		{Name: "@scope/tape", Platform: "Pypi", Requirements: "^4.0.0"},
+		{Name: "string-width-cjs", Platform: "Pypi", Requirements: "npm:string-width@^4.2.0"},
+		{Name: "archive", Platform: "Pypi", Requirements: "https://example.com/a;b.zip"},
+		{Name: "any", Platform: "Pypi"},
+	}
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+	_, err := writeProjectsFile(context.Background(), outPath, FormatCSV, func(writer projectWriter) (int, error) {
+		return writer.writeProjects([]Project{{Name: "app", Platform: "Pypi", Dependencies: dependencies}})
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	projects, err := ReadCSV(outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// The semicolon comes back percent-encoded, which is the same URL
+	dependencies[3].Requirements = "https://example.com/a%3Bb.zip"
+	if len(projects) != 1 || !reflect.DeepEqual(projects[0].Dependencies, dependencies) {
+		t.Errorf("Expected the dependencies %+v, got %+v", dependencies, projects)
+	}
+}
+
+func TestIngestCSVRoundTrip(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "npm-messy-description.json"))
+	if err != nil {
+		t.Fatalf("Could not read the fixture: %v", err)
+	}
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(fixture)
+	})
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+	if _, err := Ingest(Options{Platform: "NPM", APIKey: "secret"}, outPath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	records := readCSV(t, outPath)
+	if len(records) != 2 {
+		t.Fatalf("Expected a header and one row, got %d rows", len(records))
+	}
+	if !reflect.DeepEqual(records[0], csvHeader) {
+		t.Errorf("Expected header %v, got %v", csvHeader, records[0])
+	}
+	expected := "Says \"hi\", then\nleaves with a bell\tand a tab\nand an old Mac line break"
+	if description := records[1][2]; description != expected {
+		t.Errorf("Expected description %q, got %q", expected, description)
+	}
+	if keywords := records[1][5]; keywords != `comma, separated;"quoted"` {
+		t.Errorf("Expected keywords to keep their commas and quotes, got %q", keywords)
+	}
+
+	projects, err := ReadCSV(outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(projects) != 1 || projects[0].Description != expected {
+		t.Errorf("Expected ReadCSV to recover the description, got %+v", projects)
+	}
+}
+
+func TestSanitizeField(t *testing.T) {
+	tests := map[string]string{
+		"plain":        "plain",
+		"a\r\nb\rc\nd": "a\nb\nc\nd",
+		"nul\x00byte":  "nulbyte",
+		"tab\tkept":    "tab\tkept",
+		"esc\x1b[0m":   "esc[0m",
+		"c1\u0085":     "c1",
+	}
+	for input, expected := range tests {
+		if actual := sanitizeField(input); actual != expected {
+			t.Errorf("Expected %q to become %q, got %q", input, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package ingest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pep508Requirement is a dependency specification of a Python package as PEP 508 describes it, such as
+// requests[socks] (>=2.0,<3) ; python_version < "3.8".
+type pep508Requirement struct {
+	Name   string
+	Extras []string
+	// Specifier is the version specifier without spaces, e.g. >=2.0,<3, or the URL of a direct reference such as
+	// pip @ https://github.com/pypa/pip/archive/1.3.1.zip. It is empty if any version will do.
+	Specifier string
+	// Markers is the environment marker the requirement only applies under, e.g. extra == "socks", as written.
+	Markers string
+}
+
+// pep508Name matches the name a requirement starts with, which PEP 508 limits to letters, digits and . _ -.
+var pep508Name = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9._-]*[A-Za-z0-9])?`)
+
+// pep508URLMarker matches the start of the marker of a direct reference, which needs space before the semicolon since
+// the URL can contain one.
+var pep508URLMarker = regexp.MustCompile(`\s;`)
+
+// pep508Extra matches a marker that makes a requirement part of an extra, which is only installed on request.
+var pep508Extra = regexp.MustCompile(`\bextra\s*==`)
+
+// parsePEP508 splits a requirement such as the entries of requires_dist in the PyPI JSON API into its parts. It covers
+// what PyPI serves rather than all of PEP 508: the marker is kept as written instead of being parsed.
+func parsePEP508(requirement string) (pep508Requirement, error) {
+	spec := strings.TrimSpace(requirement)
+	name := pep508Name.FindString(spec)
+	if name == "" {
+		return pep508Requirement{}, fmt.Errorf("invalid requirement %q: expected a package name", requirement)
+	}
+	parsed := pep508Requirement{Name: name}
+
+	rest := strings.TrimSpace(spec[len(name):])
+	if strings.HasPrefix(rest, "[") {
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return pep508Requirement{}, fmt.Errorf("invalid requirement %q: unterminated extras", requirement)
+		}
+		for _, extra := range strings.Split(rest[1:end], ",") {
+			if extra = strings.TrimSpace(extra); extra != "" {
+				parsed.Extras = append(parsed.Extras, extra)
+			}
+		}
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+	var markers string
+	if strings.HasPrefix(rest, "@") {
+		if marker := pep508URLMarker.FindStringIndex(rest); marker != nil {
+			rest, markers = rest[:marker[0]], rest[marker[1]:]
+		}
+	} else {
+		rest, markers, _ = strings.Cut(rest, ";")
+		rest = strings.TrimSpace(rest)
+	}
+	parsed.Markers = strings.TrimSpace(markers)
+	switch {
+	case strings.HasPrefix(rest, "@"):
+		parsed.Specifier = strings.TrimSpace(rest[1:])
+	case strings.HasPrefix(rest, "("):
+		if !strings.HasSuffix(rest, ")") {
+			return pep508Requirement{}, fmt.Errorf("invalid requirement %q: unterminated version specifier", requirement)
+		}
+		parsed.Specifier = strings.Join(strings.Fields(rest[1:len(rest)-1]), "")
+	default:
+		parsed.Specifier = strings.Join(strings.Fields(rest), "")
+	}
+	return parsed, nil
+}
+
+// dependency converts the requirement into a dependency of a PyPI package. A requirement that only applies to an
+// extra is optional.
+func (r pep508Requirement) dependency() Dependency {
+	return Dependency{
+		Name:         r.Name,
+		Platform:     "Pypi",
+		Requirements: r.Specifier,
+		Kind:         "runtime",
+		Optional:     pep508Extra.MatchString(r.Markers),
+		Markers:      r.Markers,
+	}
+}
@@ -0,0 +1,202 @@
+package ingest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Pom is the part of a Maven pom.xml file that describes the dependencies of an artifact.
+type Pom struct {
+	GroupID    string
+	ArtifactID string
+	Version    string
+	// Parent is the parent POM the project inherits from, if any. Its own pom.xml is not read, so properties and
+	// managed versions declared there are not known.
+	Parent *PomParent
+	// Properties are the values declared in the properties block, by name.
+	Properties map[string]string
+	// Dependencies are the declared dependencies, with placeholders resolved and versions filled in from the
+	// dependency management section where they were left out.
+	Dependencies []PomDependency
+	// ManagedDependencies are the entries of the dependency management section, with placeholders resolved.
+	ManagedDependencies []PomDependency
+	// Licenses are the names of the licenses the project declares, as SPDX identifiers where they are recognized and
+	// as declared otherwise.
+	Licenses []string
+}
+
+// PomParent identifies the parent POM of a project.
+type PomParent struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Version    string `xml:"version"`
+}
+
+// PomDependency is a single dependency declared in a pom.xml file.
+type PomDependency struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Version    string `xml:"version"`
+	// Scope is the Maven scope, such as compile or test. Maven treats an empty scope as compile.
+	Scope    string `xml:"scope"`
+	Optional bool   `xml:"optional"`
+}
+
+// pomXML mirrors the layout of a pom.xml file for decoding.
+type pomXML struct {
+	GroupID    string     `xml:"groupId"`
+	ArtifactID string     `xml:"artifactId"`
+	Version    string     `xml:"version"`
+	Parent     *PomParent `xml:"parent"`
+	Properties struct {
+		// Properties are arbitrary elements, so they are decoded one by one
+		Entries []struct {
+			XMLName xml.Name
+			Value   string `xml:",chardata"`
+		} `xml:",any"`
+	} `xml:"properties"`
+	Dependencies        []PomDependency `xml:"dependencies>dependency"`
+	ManagedDependencies []PomDependency `xml:"dependencyManagement>dependencies>dependency"`
+	Licenses            []string        `xml:"licenses>license>name"`
+}
+
+// maxPropertyDepth bounds how many properties may refer to each other in a chain, which stops cycles.
+const maxPropertyDepth = 10
+
+// ParsePom decodes a pom.xml document from r. ${...} placeholders are resolved from the properties block and the
+// project coordinates, and dependencies without a version take the one from the dependency management section.
+// Placeholders that cannot be resolved are left as they are.
+func ParsePom(r io.Reader) (Pom, error) {
+	var raw pomXML
+	if err := xml.NewDecoder(r).Decode(&raw); err != nil {
+		return Pom{}, fmt.Errorf("decoding pom.xml: %w", err)
+	}
+
+	pom := Pom{
+		GroupID:    raw.GroupID,
+		ArtifactID: raw.ArtifactID,
+		Version:    raw.Version,
+		Parent:     raw.Parent,
+		Properties: make(map[string]string, len(raw.Properties.Entries)),
+	}
+	// The group and version are inherited from the parent when the project does not declare them
+	if pom.Parent != nil {
+		if pom.GroupID == "" {
+			pom.GroupID = pom.Parent.GroupID
+		}
+		if pom.Version == "" {
+			pom.Version = pom.Parent.Version
+		}
+	}
+	for _, entry := range raw.Properties.Entries {
+		pom.Properties[entry.XMLName.Local] = strings.TrimSpace(entry.Value)
+	}
+
+	pom.ManagedDependencies = make([]PomDependency, 0, len(raw.ManagedDependencies))
+	managed := make(map[string]PomDependency, len(raw.ManagedDependencies))
+	for _, dependency := range raw.ManagedDependencies {
+		dependency = pom.resolveDependency(dependency)
+		pom.ManagedDependencies = append(pom.ManagedDependencies, dependency)
+		managed[dependency.GroupID+":"+dependency.ArtifactID] = dependency
+	}
+
+	pom.Dependencies = make([]PomDependency, 0, len(raw.Dependencies))
+	for _, dependency := range raw.Dependencies {
+		dependency = pom.resolveDependency(dependency)
+		if managedDependency, ok := managed[dependency.GroupID+":"+dependency.ArtifactID]; ok {
+			if dependency.Version == "" {
+				dependency.Version = managedDependency.Version
+			}
+			if dependency.Scope == "" {
+				dependency.Scope = managedDependency.Scope
+			}
+		}
+		pom.Dependencies = append(pom.Dependencies, dependency)
+	}
+	for i, license := range raw.Licenses {
+		raw.Licenses[i] = pom.resolve(strings.TrimSpace(license), 0)
+	}
+	if licenses := joinLicenses(raw.Licenses); licenses != "" {
+		pom.Licenses = strings.Split(licenses, ",")
+	}
+	return pom, nil
+}
+
+// ParsePomFile decodes the pom.xml file at path.
+func ParsePomFile(path string) (Pom, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Pom{}, fmt.Errorf("opening pom file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	pom, err := ParsePom(f)
+	if err != nil {
+		return Pom{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return pom, nil
+}
+
+func (p Pom) resolveDependency(dependency PomDependency) PomDependency {
+	dependency.GroupID = p.resolve(strings.TrimSpace(dependency.GroupID), 0)
+	dependency.ArtifactID = p.resolve(strings.TrimSpace(dependency.ArtifactID), 0)
+	dependency.Version = p.resolve(strings.TrimSpace(dependency.Version), 0)
+	dependency.Scope = p.resolve(strings.TrimSpace(dependency.Scope), 0)
+	return dependency
+}
+
+// resolve replaces the ${...} placeholders in value. depth is the number of properties already expanded on the way
+// to value.
+func (p Pom) resolve(value string, depth int) string {
+	if depth >= maxPropertyDepth {
+		return value
+	}
+	var result strings.Builder
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(value[start:], "}")
+		if end < 0 {
+			break
+		}
+		end += start
+		result.WriteString(value[:start])
+		if replacement, ok := p.property(value[start+2 : end]); ok {
+			result.WriteString(p.resolve(replacement, depth+1))
+		} else {
+			result.WriteString(value[start : end+1])
+		}
+		value = value[end+1:]
+	}
+	result.WriteString(value)
+	return result.String()
+}
+
+// property looks up a placeholder name, which is either a declared property or one of the project coordinates.
+func (p Pom) property(name string) (string, bool) {
+	if value, ok := p.Properties[name]; ok {
+		return value, true
+	}
+	switch name {
+	case "project.groupId", "pom.groupId":
+		return p.GroupID, p.GroupID != ""
+	case "project.artifactId", "pom.artifactId":
+		return p.ArtifactID, p.ArtifactID != ""
+	case "project.version", "pom.version":
+		return p.Version, p.Version != ""
+	}
+	if p.Parent != nil {
+		switch name {
+		case "project.parent.groupId":
+			return p.Parent.GroupID, true
+		case "project.parent.version":
+			return p.Parent.Version, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,63 @@
+package ingest
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePomFile(t *testing.T) {
+	pom, err := ParsePomFile(filepath.Join("testdata", "example-pom.xml"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	t.Run("Inherits the coordinates from the parent", func(t *testing.T) {
+		if pom.GroupID != "org.example" || pom.ArtifactID != "example-app" || pom.Version != "2.1.0" {
+			t.Errorf("Expected org.example:example-app:2.1.0, got %s:%s:%s", pom.GroupID, pom.ArtifactID, pom.Version)
+		}
+	})
+
+	t.Run("Resolves the dependencies", func(t *testing.T) {
+		expected := []PomDependency{
+			{GroupID: "com.fasterxml.jackson.core", ArtifactID: "jackson-databind", Version: "2.13.3"},
+			{GroupID: "org.slf4j", ArtifactID: "slf4j-api", Version: "1.7.36"},
+			{GroupID: "org.example", ArtifactID: "example-core", Version: "2.1.0", Optional: true},
+			{GroupID: "junit", ArtifactID: "junit", Version: "4.13.2", Scope: "test"},
+			{GroupID: "org.example", ArtifactID: "unresolved", Version: "${missing.version}"},
+		}
+		if len(pom.Dependencies) != len(expected) {
+			t.Fatalf("Expected %d dependencies, got %d", len(expected), len(pom.Dependencies))
+		}
+		for i, dependency := range pom.Dependencies {
+			if dependency != expected[i] {
+				t.Errorf("Expected dependency %+v, got %+v", expected[i], dependency)
+			}
+		}
+	})
+
+	t.Run("Keeps the managed dependencies", func(t *testing.T) {
+		if len(pom.ManagedDependencies) != 2 || pom.ManagedDependencies[1].Version != "4.13.2" {
+			t.Errorf("Expected two resolved managed dependencies, got %+v", pom.ManagedDependencies)
+		}
+	})
+
+	t.Run("Normalizes the licenses", func(t *testing.T) {
+		if licenses := strings.Join(pom.Licenses, ","); licenses != "Apache-2.0,Example Commercial License" {
+			t.Errorf("Expected the licenses Apache-2.0 and Example Commercial License, got %v", pom.Licenses)
+		}
+	})
+}
+
+func TestParsePomCyclicProperties(t *testing.T) {
+	pom, err := ParsePom(strings.NewReader(`<project>
+		<properties><a>${b}</a><b>${a}</b></properties>
+		<dependencies><dependency><groupId>g</groupId><artifactId>a</artifactId><version>${a}</version></dependency></dependencies>
+	</project>`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if version := pom.Dependencies[0].Version; !strings.Contains(version, "${") {
+		t.Errorf("Expected the cycle to stay unresolved, got %s", version)
+	}
+}
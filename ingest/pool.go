@@ -0,0 +1,308 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// defaultWorkers is the number of pages fetched concurrently when Options.Workers is not set.
+const defaultWorkers = 4
+
+// pageResult is a fetched page of search results, or the error that prevented fetching it.
+type pageResult struct {
+	page     int
+	projects []Project
+	// filtered is the number of packages on the page the filters of Options left out
+	filtered int
+	// counts compares the packages on the page to those of an earlier run, and updated maps the packageKey of every
+	// package on the page to its LastUpdated, both only for Options.Update
+	counts  updateCounts
+	updated map[string]time.Time
+	// last is set when no results follow this page
+	last bool
+	err  error
+}
+
+// fetchPages fetches pages of search results with fetch, starting at firstPage, with opts.Workers concurrent workers
+// and delivers them on the returned channel in page order. The channel is closed after the last page, after
+// opts.MaxPages pages, after the first error or once ctx is done. fetch is called concurrently, so the workers share
+// whatever it uses, such as the fetcher and with it the rate limit. The caller calls done once it is finished with a
+// page and wants the next one. wait waits for all goroutines started by fetchPages to exit. Callers that stop reading
+// early must cancel ctx before calling it.
+//
+// Workers never get more than opts.Workers pages ahead of the page the caller is finished with, so at most that many
+// pages are held in memory at once. A caller that has all it needs, such as enough packages for Options.MaxPackages,
+// cancels ctx instead of calling done, so that no page after it is requested.
+func fetchPages(ctx context.Context, opts Options, firstPage int, fetch func(ctx context.Context, page int) pageResult) (results <-chan pageResult, done func(), wait func()) {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	pages := make(chan int)
+	fetched := make(chan pageResult)
+	ordered := make(chan pageResult)
+	// Buffered so that done does not block after the last page, which no one waits on
+	finished := make(chan struct{}, 1)
+	// Every page takes a slot when it is dispatched and gives it back once the caller is finished with it
+	window := make(chan struct{}, workers)
+	lastPage := newLastPage()
+	var all sync.WaitGroup
+
+	all.Add(1)
+	go func() {
+		defer all.Done()
+		defer close(pages)
+		for page := firstPage; opts.MaxPages <= 0 || page <= opts.MaxPages; page++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			if lastPage.before(page) {
+				return
+			}
+			select {
+			case pages <- page:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range pages {
+				result := fetch(ctx, page)
+				if result.last {
+					lastPage.set(page)
+				}
+				select {
+				case fetched <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	all.Add(1)
+	go func() {
+		defer all.Done()
+		wg.Wait()
+		close(fetched)
+	}()
+
+	all.Add(1)
+	go func() {
+		defer all.Done()
+		defer close(ordered)
+		pending := make(map[int]pageResult, workers)
+		next := firstPage
+		for result := range fetched {
+			pending[result.page] = result
+			for {
+				result, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				select {
+				case ordered <- result:
+				case <-ctx.Done():
+					return
+				}
+				if result.last || result.err != nil {
+					return
+				}
+				// The slot of the page is only given back once the caller is finished with it
+				select {
+				case <-finished:
+				case <-ctx.Done():
+					return
+				}
+				<-window
+				next++
+			}
+		}
+	}()
+
+	return ordered, func() { finished <- struct{}{} }, all.Wait
+}
+
+// fetchPage fetches a single page and determines whether it is the last one. Packages the filters of opts leave out
+// are dropped and counted in the result, so that only the pages that get written count in the stats. With opts.Since,
+// the page is also the last one if none of its packages was released after it. Prereleases are removed unless opts
+// includes them. If opts asks for dependencies or vulnerabilities, they are fetched for every package on the page as
+// well, for the latest release that is left. update, which may be nil, fills in the packages that have not changed
+// since an earlier run instead.
+func (c *Client) fetchPage(ctx context.Context, opts Options, page int, f *fetcher, update *incrementalUpdate) pageResult {
+	query := c.discoveryURL(opts.Platform, page, opts.PerPage, opts.APIKey, opts.Keywords, opts.Languages, opts.searchSort())
+	projects, results, err := f.fetchProjects(ctx, query)
+	if errors.Is(err, errPageOutOfRange) {
+		return pageResult{page: page, last: true}
+	}
+	// A short page is the last one, so there is no need to ask for an empty page after it. Whether it is short is
+	// decided before packages are dropped, counting those that could not be decoded.
+	last := err == nil && results < opts.PerPage
+	// Sorted newest release first, the pages after one without any package released after Since hold older ones only
+	if err == nil && !opts.Since.IsZero() && !releasedAfter(projects, opts.Since) {
+		last = true
+	}
+	for i := range projects {
+		projects[i] = normalizeProject(projects[i])
+	}
+	projects, filtered := newPackageFilter(opts).keep(projects)
+	updated, counts := update.reuse(projects, opts.Platform)
+	if err == nil && opts.Versions {
+		err = c.fetchProjectVersions(ctx, opts, projects, f)
+	}
+	if !opts.IncludePrerelease {
+		for i := range projects {
+			projects[i] = withoutPrereleases(projects[i])
+		}
+	}
+	if err == nil && opts.Dependencies {
+		err = c.fetchProjectDependencies(ctx, opts, projects, f)
+	}
+	if err == nil && opts.Vulnerabilities {
+		err = fetchVulnerabilityCounts(ctx, projects, opts.Platform, f)
+	}
+	return pageResult{page: page, projects: projects, filtered: filtered, counts: counts, updated: updated, last: last, err: err}
+}
+
+// fetchProjectVersions fills in the versions of the projects whose search result has none, with opts.Workers
+// concurrent requests. Packages libraries.io no longer knows are skipped with a warning.
+func (c *Client) fetchProjectVersions(ctx context.Context, opts Options, projects []Project, f *fetcher) error {
+	return forEachProject(ctx, opts.Workers, projects, func(ctx context.Context, project *Project) error {
+		if len(project.Versions) > 0 {
+			return nil
+		}
+		platform := project.Platform
+		if platform == "" {
+			platform = opts.Platform
+		}
+		versions, err := f.fetchVersions(ctx, c.projectURLFor(platform, project.Name, opts.APIKey))
+		if errors.Is(err, errProjectNotFound) {
+			slog.Warn("Package not found, skipping its versions", "platform", platform, "package", project.Name)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("fetching versions of %s: %w", project.Name, err)
+		}
+		project.Versions = versions
+		return nil
+	})
+}
+
+// fetchProjectDependencies fills in the dependencies of the latest release of each project whose dependencies are not
+// known yet, with opts.Workers concurrent requests. Versions libraries.io does not know, which happens for deleted
+// releases, are skipped with a warning.
+func (c *Client) fetchProjectDependencies(ctx context.Context, opts Options, projects []Project, f *fetcher) error {
+	return forEachProject(ctx, opts.Workers, projects, func(ctx context.Context, project *Project) error {
+		if project.LatestReleaseNumber == "" || project.Dependencies != nil {
+			return nil
+		}
+		platform := project.Platform
+		if platform == "" {
+			platform = opts.Platform
+		}
+		query := c.dependenciesURL(platform, project.Name, project.LatestReleaseNumber, opts.APIKey)
+		dependencies, err := f.fetchDependencies(ctx, query)
+		if errors.Is(err, ErrVersionNotFound) {
+			slog.Warn("No dependencies found, skipping them", "platform", platform, "package", project.Name,
+				"version", project.LatestReleaseNumber)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("fetching dependencies of %s %s: %w", project.Name, project.LatestReleaseNumber, err)
+		}
+		project.Dependencies = dependencies
+		return nil
+	})
+}
+
+// forEachProject calls fn for every project with up to workers concurrent calls. Each call gets its own element of
+// projects, so fn may modify it without locking, but anything else fn uses, such as the fetcher and with it the rate
+// limit, is shared. After the first error no more calls are started and the context of the calls in flight is
+// cancelled. It returns that first error, or the error of ctx if ctx is done before every project was handed out.
+func forEachProject(ctx context.Context, workers int, projects []Project, fn func(ctx context.Context, project *Project) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(projects) {
+		workers = len(projects)
+	}
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var firstErr error
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				if err := fn(callCtx, &projects[i]); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					cancel()
+				}
+			}
+		}()
+	}
+
+	dispatched := 0
+dispatch:
+	for i := range projects {
+		select {
+		case indices <- i:
+			dispatched++
+		case <-callCtx.Done():
+			break dispatch
+		}
+	}
+	close(indices)
+	wg.Wait()
+
+	if firstErr == nil && dispatched < len(projects) {
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+// lastPage tracks the lowest page known to be the last one, so that no pages past it are dispatched.
+type lastPage struct {
+	mu   sync.Mutex
+	page int
+}
+
+func newLastPage() *lastPage {
+	return &lastPage{}
+}
+
+func (l *lastPage) set(page int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.page == 0 || page < l.page {
+		l.page = page
+	}
+}
+
+// before reports whether page lies past the last page.
+func (l *lastPage) before(page int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.page != 0 && page > l.page
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package ingest
+
+import "os"
+
+// processAlive reports whether a process with the id pid is running. Outside of Unix, finding a process opens it,
+// which fails once it has exited.
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package ingest
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive reports whether a process with the id pid is running. Signal 0 only checks that it could be sent, which
+// fails with EPERM for a process of another user that is still running.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
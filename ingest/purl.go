@@ -0,0 +1,101 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoPURLType is returned by ToPURL for platforms whose ecosystem has no package URL type.
+var ErrNoPURLType = errors.New("no package URL type")
+
+// purlTypes maps lowercase libraries.io platforms to the package URL type of their ecosystem.
+var purlTypes = map[string]string{
+	"cargo":     "cargo",
+	"cocoapods": "cocoapods",
+	"cran":      "cran",
+	"go":        "golang",
+	"hackage":   "hackage",
+	"hex":       "hex",
+	"maven":     "maven",
+	"npm":       "npm",
+	"nuget":     "nuget",
+	"packagist": "composer",
+	"pub":       "pub",
+	"pypi":      "pypi",
+	"rubygems":  "gem",
+	"swiftpm":   "swift",
+}
+
+// ToPURL returns the package URL of a version of a package on a libraries.io platform, following the purl
+// specification of its ecosystem, e.g. pkg:pypi/django-rest@3.0 for Django_Rest on Pypi. The version is left out if it
+// is empty. ErrNoPURLType is returned for platforms without a purl type, such as Bower.
+//
+// Scoped npm packages, Maven group:artifact names, Go module paths and other names with a prefix are split into the
+// namespace and name of the purl. Every part is percent-encoded, so @angular/core becomes pkg:npm/%40angular/core.
+func ToPURL(platform, name, version string) (string, error) {
+	purlType, ok := purlTypes[strings.ToLower(platform)]
+	if !ok {
+		return "", fmt.Errorf("%w for platform %q", ErrNoPURLType, platform)
+	}
+	if name == "" {
+		return "", fmt.Errorf("no package name for a %s package URL", purlType)
+	}
+	var namespace string
+	switch purlType {
+	case "maven":
+		namespace, name, _ = strings.Cut(name, ":")
+		if name == "" {
+			namespace, name = "", namespace
+		}
+	case "npm", "composer", "golang", "swift":
+		if slash := strings.LastIndex(name, "/"); slash >= 0 {
+			namespace, name = name[:slash], name[slash+1:]
+		}
+	}
+	// These ecosystems treat names case-insensitively, and the specification asks for lowercase
+	switch purlType {
+	case "npm", "composer", "hex", "pub", "pypi":
+		namespace, name = strings.ToLower(namespace), strings.ToLower(name)
+	}
+	if purlType == "pypi" {
+		name = strings.ReplaceAll(name, "_", "-")
+	}
+
+	var purl strings.Builder
+	purl.WriteString("pkg:" + purlType + "/")
+	if namespace != "" {
+		for _, segment := range strings.Split(namespace, "/") {
+			purl.WriteString(escapePURL(segment) + "/")
+		}
+	}
+	purl.WriteString(escapePURL(name))
+	if version != "" {
+		purl.WriteString("@" + escapePURL(version))
+	}
+	return purl.String(), nil
+}
+
+// purl returns the package URL of the latest release of p, or of p itself if it has none, and "" if its platform has
+// no purl type.
+func (p Project) purl() string {
+	purl, err := ToPURL(p.Platform, p.Name, p.LatestReleaseNumber)
+	if err != nil {
+		return ""
+	}
+	return purl
+}
+
+// escapePURL percent-encodes every byte of s except the unreserved characters of RFC 3986.
+func escapePURL(s string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+			escaped.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&escaped, "%%%02X", c)
+	}
+	return escaped.String()
+}
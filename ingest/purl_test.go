@@ -0,0 +1,44 @@
+package ingest
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestToPURL(t *testing.T) {
+	tests := []struct {
+		platform, name, version string
+		expected                string
+	}{
+		{"NPM", "left-pad", "1.3.0", "pkg:npm/left-pad@1.3.0"},
+		{"NPM", "@angular/core", "17.0.0-rc.1", "pkg:npm/%40angular/core@17.0.0-rc.1"},
+		{"Maven", "org.slf4j:slf4j-api", "1.7.36", "pkg:maven/org.slf4j/slf4j-api@1.7.36"},
+		{"Maven", "junit", "4.13", "pkg:maven/junit@4.13"},
+		{"Pypi", "Django_Rest", "3.0", "pkg:pypi/django-rest@3.0"},
+		{"Cargo", "serde", "", "pkg:cargo/serde"},
+		{"Go", "github.com/gorilla/mux", "v1.8.0", "pkg:golang/github.com/gorilla/mux@v1.8.0"},
+		{"Rubygems", "Rails", "7.0.0", "pkg:gem/Rails@7.0.0"},
+		{"Packagist", "Laravel/Framework", "10.0.0", "pkg:composer/laravel/framework@10.0.0"},
+		{"NuGet", "Newtonsoft.Json", "13.0.1+build", "pkg:nuget/Newtonsoft.Json@13.0.1%2Bbuild"},
+	}
+	for _, test := range tests {
+		actual, err := ToPURL(test.platform, test.name, test.version)
+		if err != nil || actual != test.expected {
+			t.Errorf("Expected %s for %s %s@%s, got %s and %v", test.expected, test.platform, test.name, test.version, actual, err)
+		}
+	}
+
+	t.Run("Rejects platforms without a purl type", func(t *testing.T) {
+		for _, platform := range []string{"Bower", ""} {
+			if _, err := ToPURL(platform, "jquery", "3.0.0"); !errors.Is(err, ErrNoPURLType) {
+				t.Errorf("Expected ErrNoPURLType for %q, got %v", platform, err)
+			}
+		}
+	})
+
+	t.Run("Rejects an empty name", func(t *testing.T) {
+		if _, err := ToPURL("NPM", "", "1.0.0"); err == nil {
+			t.Errorf("Expected an error for an empty name")
+		}
+	})
+}
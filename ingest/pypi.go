@@ -0,0 +1,213 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// pypiEndpoint is the base URL of the PyPI JSON API. It is a variable so tests can point it at a local server.
+var pypiEndpoint = "https://pypi.org/pypi"
+
+// pypiProject is the part of the PyPI JSON API response we use.
+type pypiProject struct {
+	Info struct {
+		Name     string `json:"name"`
+		Summary  string `json:"summary"`
+		HomePage string `json:"home_page"`
+		Keywords string `json:"keywords"`
+		Version  string `json:"version"`
+		// LicenseExpression is the SPDX expression of PEP 639, which only recent releases have.
+		LicenseExpression string   `json:"license_expression"`
+		License           string   `json:"license"`
+		Classifiers       []string `json:"classifiers"`
+		// RequiresDist are the PEP 508 requirements of the latest release, which is null if it declares none.
+		RequiresDist []string `json:"requires_dist"`
+	} `json:"info"`
+	// Releases maps version numbers to the files uploaded for them
+	Releases map[string][]pypiFile `json:"releases"`
+}
+
+// pypiFile is a single distribution file of a release.
+type pypiFile struct {
+	UploadTime string `json:"upload_time_iso_8601"`
+	Yanked     bool   `json:"yanked"`
+}
+
+// IngestPyPI downloads the given projects from the PyPI JSON API and writes them to outPath in the format chosen in
+// opts, with the same fields as Ingest and the requires_dist entries of the latest release as its dependencies. Their
+// environment markers and extras are kept in the formats that have a place for them. Yanked releases are left out.
+// Projects that do not exist on PyPI or have no releases left are skipped with a warning and listed in
+// SkippedPackagesReport in the directory of outPath, which is written once all projects were.
+//
+// As for IngestNPM, opts.Platform, APIKey, MaxPages and Versions do not apply, responses are not cached, and the
+// projects are fetched in batches of opts.PerPage with opts.Workers concurrent requests. Differently spelled names of
+// the same project, which PyPI answers with its own spelling, are written once.
+func IngestPyPI(ctx context.Context, opts Options, names []string, outPath string) (Stats, error) {
+	opts, err := opts.withDefaultsExceptAPIKey()
+	if err != nil {
+		return Stats{}, err
+	}
+	f := &fetcher{
+		client:      opts.HTTPClient,
+		limiter:     newRateLimiter(opts.RequestsPerMinute, 1),
+		maxAttempts: opts.MaxAttempts,
+		timeout:     opts.RequestTimeout,
+		backoff:     backoff,
+		userAgent:   userAgent,
+	}
+	stats := newStatsCollector()
+	f.stats = stats
+	skipped := newSkippedPackages()
+	// Already validated by withDefaultsExceptAPIKey
+	columns, _ := csvColumnIndices(opts.Columns)
+	_, err = writeProjectsFileAt(ctx, outPath, opts.Format, columns, resumePoint{}, opts.CompressionLevel, func(writer projectWriter, _ *outputFile) (int, error) {
+		total := len(names)
+		if opts.MaxPackages > 0 {
+			total = min(total, opts.MaxPackages)
+		}
+		return ingestNamedPackages(ctx, withProgress(writer, opts.Progress, 0, total), opts, names, stats, func(ctx context.Context, project *Project) error {
+			name := project.Name
+			if err := fetchPyPIPackage(ctx, f, opts, project); err != nil {
+				return err
+			}
+			skipped.check(name, "Pypi", project)
+			return nil
+		})
+	})
+	if err == nil {
+		err = skipped.write(ctx, outPath, names)
+	}
+	parameters := opts.manifestParameters(nil)
+	parameters.Packages = names
+	run := manifestRun{source: SourcePyPI, parameters: parameters, format: opts.Format, files: []string{outPath}}
+	return finish(ctx, outPath, run, stats.stats(), err)
+}
+
+func fetchPyPIProject(ctx context.Context, f *fetcher, name string) (pypiProject, error) {
+	body, err := f.fetchWithRetry(ctx, pypiEndpoint+"/"+url.PathEscape(name)+"/json")
+	if err != nil {
+		return pypiProject{}, err
+	}
+	var project pypiProject
+	if err := json.Unmarshal(body, &project); err != nil {
+		return pypiProject{}, fmt.Errorf("decoding PyPI response: %w", err)
+	}
+	return project, nil
+}
+
+// toProject converts the PyPI response into the record shape used for libraries.io packages. A release is published
+// at the time of its first upload and counts as yanked only if all of its files are yanked. Releases without any
+// files have never been installable and are left out as well.
+func (p pypiProject) toProject() Project {
+	versions := make([]Version, 0, len(p.Releases))
+	for number, files := range p.Releases {
+		publishedAt := ""
+		yanked := true
+		for _, file := range files {
+			yanked = yanked && file.Yanked
+			if publishedAt == "" || file.UploadTime < publishedAt {
+				publishedAt = file.UploadTime
+			}
+		}
+		if len(files) == 0 || yanked {
+			continue
+		}
+		versions = append(versions, Version{Number: number, PublishedAt: publishedAt})
+	}
+	// The releases come as a map, so order them by publication to get a stable output
+	sort.Slice(versions, func(i, j int) bool {
+		if versions[i].PublishedAt != versions[j].PublishedAt {
+			return versions[i].PublishedAt < versions[j].PublishedAt
+		}
+		return versions[i].Number < versions[j].Number
+	})
+
+	project := Project{
+		Name:        p.Info.Name,
+		Platform:    "Pypi",
+		Description: p.Info.Summary,
+		Homepage:    p.Info.HomePage,
+		Language:    "Python",
+		Keywords:    splitPyPIKeywords(p.Info.Keywords),
+		Licenses:    p.licenses(),
+		Versions:    versions,
+	}
+	for _, version := range versions {
+		if version.Number == p.Info.Version {
+			project.LatestReleaseNumber = version.Number
+			project.LatestReleasePublishedAt = version.PublishedAt
+			project.Dependencies = p.dependencies()
+		}
+	}
+	return project
+}
+
+// dependencies returns the requires_dist entries of the latest release as dependencies, in their order. Entries that
+// cannot be parsed are skipped with a warning.
+func (p pypiProject) dependencies() []Dependency {
+	dependencies := make([]Dependency, 0, len(p.Info.RequiresDist))
+	for _, requirement := range p.Info.RequiresDist {
+		parsed, err := parsePEP508(requirement)
+		if err != nil {
+			slog.Warn("Skipping a dependency that cannot be parsed", "platform", "Pypi", "package", p.Info.Name, "error", err)
+			continue
+		}
+		dependencies = append(dependencies, parsed.dependency())
+	}
+	return dependencies
+}
+
+// pypiLicensePrefix starts the trove classifiers that name a license, e.g. License :: OSI Approved :: MIT License.
+const pypiLicensePrefix = "License ::"
+
+// licenses returns the licenses of the project in the comma-separated form of libraries.io. The SPDX expression of
+// PEP 639 comes first, then the license classifiers and then the free-form license field, which is only used if it
+// is a single line, since many projects paste the whole license text into it.
+func (p pypiProject) licenses() string {
+	if expression := strings.TrimSpace(p.Info.LicenseExpression); expression != "" {
+		return joinLicenses([]string{expression})
+	}
+	var classified []string
+	for _, classifier := range p.Info.Classifiers {
+		if !strings.HasPrefix(classifier, pypiLicensePrefix) {
+			continue
+		}
+		// The last part is the license, e.g. MIT License in License :: OSI Approved :: MIT License
+		parts := strings.Split(classifier, "::")
+		if license := strings.TrimSpace(parts[len(parts)-1]); license != "OSI Approved" && license != "Other/Proprietary License" {
+			classified = append(classified, license)
+		}
+	}
+	if len(classified) > 0 {
+		return joinLicenses(classified)
+	}
+	if license := strings.TrimSpace(p.Info.License); license != "" && !strings.Contains(license, "\n") && !strings.EqualFold(license, "UNKNOWN") {
+		return joinLicenses([]string{license})
+	}
+	return ""
+}
+
+// splitPyPIKeywords splits the free-form keywords field, which projects fill with either comma or space separated
+// words.
+func splitPyPIKeywords(keywords string) []string {
+	separator := func(r rune) bool {
+		return r == ','
+	}
+	if !strings.Contains(keywords, ",") {
+		separator = func(r rune) bool {
+			return r == ' '
+		}
+	}
+	var result []string
+	for _, keyword := range strings.FieldsFunc(keywords, separator) {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			result = append(result, keyword)
+		}
+	}
+	return result
+}
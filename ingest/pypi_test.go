@@ -0,0 +1,183 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// usePyPITestServer points the PyPI endpoint at a local server for the duration of the test.
+func usePyPITestServer(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previous := pypiEndpoint
+	pypiEndpoint = server.URL
+	t.Cleanup(func() {
+		pypiEndpoint = previous
+		server.Close()
+	})
+}
+
+func TestIngestPyPI(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "pypi-requests.json"))
+	if err != nil {
+		t.Fatalf("Could not read the fixture: %v", err)
+	}
+	usePyPITestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/requests/json", "/Requests/json":
+			w.Write(fixture)
+		case "/empty/json":
+			w.Write([]byte(`{"info": {"name": "empty", "version": "0.1"}, "releases": {}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	outPath := filepath.Join(t.TempDir(), "pypi.csv")
+
+	names := []string{"requests", "does-not-exist", "empty", "Requests"}
+	stats, err := IngestPyPI(context.Background(), Options{Workers: 1}, names, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 1 {
+		t.Errorf("Expected 1 project, got %d", stats.Packages)
+	}
+
+	records := readCSV(t, outPath)
+	if len(records) != 2 {
+		t.Fatalf("Expected a header and one row, got %d rows", len(records))
+	}
+
+	t.Run("Maps info and releases into the common record", func(t *testing.T) {
+		row := strings.Join(records[1], "|")
+		expected := "requests|Pypi|Python HTTP for Humans.|https://requests.readthedocs.io|Python|http;client|2.28.0|" +
+			"2022-06-09T14:44:38.741917Z|2.27.1;2.28.0|charset-normalizer@~=2.0.0;idna@<4,>=2.5;PySocks@!=1.5.7,>=1.5.6||||||||pkg:pypi/requests@2.28.0"
+		if row != expected {
+			t.Errorf("Expected row %s, got %s", expected, row)
+		}
+	})
+
+	t.Run("Reports the projects it skipped", func(t *testing.T) {
+		expected := [][]string{{"platform", "name", "reason"}, {"Pypi", "does-not-exist", "not found"}, {"Pypi", "empty", "no releases"}}
+		records := readCSV(t, filepath.Join(filepath.Dir(outPath), SkippedPackagesReport))
+		if !slices.EqualFunc(records, expected, slices.Equal[[]string]) {
+			t.Errorf("Expected %v, got %v", expected, records)
+		}
+	})
+
+	t.Run("Keeps the markers of the dependencies in NDJSON", func(t *testing.T) {
+		outPath := filepath.Join(t.TempDir(), "pypi.ndjson")
+		if _, err := IngestPyPI(context.Background(), Options{Workers: 1, Format: FormatNDJSON}, names[:1], outPath); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		body, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var project Project
+		if err := json.Unmarshal(body, &project); err != nil {
+			t.Fatalf("Expected a single project, got %v", err)
+		}
+		expected := Dependency{Name: "PySocks", Platform: "Pypi", Requirements: "!=1.5.7,>=1.5.6", Kind: "runtime", Optional: true,
+			Markers: `extra == "socks"`}
+		if len(project.Dependencies) != 3 || project.Dependencies[2] != expected {
+			t.Errorf("Expected %+v last, got %+v", expected, project.Dependencies)
+		}
+	})
+}
+
+func TestPyPIProjectToProject(t *testing.T) {
+	project := pypiProject{Releases: map[string][]pypiFile{
+		"1.0": {{UploadTime: "2020-01-02T00:00:00Z"}, {UploadTime: "2020-01-01T00:00:00Z", Yanked: true}},
+	}}
+	versions := project.toProject().Versions
+	if len(versions) != 1 || versions[0].PublishedAt != "2020-01-01T00:00:00Z" {
+		t.Errorf("Expected a partially yanked release to stay, published at its first upload, got %v", versions)
+	}
+}
+
+func TestPyPIProjectLicenses(t *testing.T) {
+	classifiers := []string{
+		"Development Status :: 5 - Production/Stable",
+		"License :: OSI Approved",
+		"License :: OSI Approved :: BSD License",
+		"License :: OSI Approved :: MIT License",
+	}
+	tests := []struct {
+		expression, license string
+		classifiers         []string
+		expected            string
+	}{
+		{"Apache-2.0 OR MIT", "BSD", classifiers, "Apache-2.0 OR MIT"},
+		{"", "BSD", classifiers, "BSD-3-Clause,MIT"},
+		{"", "apache license 2.0", nil, "Apache-2.0"},
+		{"", "Copyright (c) 2020\nPermission is hereby granted", nil, ""},
+		{"", "UNKNOWN", []string{"License :: Other/Proprietary License"}, ""},
+	}
+	for _, test := range tests {
+		var project pypiProject
+		project.Info.LicenseExpression, project.Info.License, project.Info.Classifiers = test.expression, test.license, test.classifiers
+		if actual := project.toProject().Licenses; actual != test.expected {
+			t.Errorf("Expected the licenses %q, got %q", test.expected, actual)
+		}
+	}
+}
+
+func TestSplitPyPIKeywords(t *testing.T) {
+	tests := map[string]string{
+		"http, client":  "http;client",
+		"http client":   "http;client",
+		"":              "",
+		"web,, ,server": "web;server",
+	}
+	for input, expected := range tests {
+		if actual := strings.Join(splitPyPIKeywords(input), ";"); actual != expected {
+			t.Errorf("Expected %q to split into %s, got %s", input, expected, actual)
+		}
+	}
+}
+
+func TestParsePEP508(t *testing.T) {
+	tests := map[string]pep508Requirement{
+		"idna<4,>=2.5":                                        {Name: "idna", Specifier: "<4,>=2.5"},
+		"charset-normalizer (>=2, <3)":                        {Name: "charset-normalizer", Specifier: ">=2,<3"},
+		"requests[socks, security] >= 2.0":                    {Name: "requests", Extras: []string{"socks", "security"}, Specifier: ">=2.0"},
+		`PySocks!=1.5.7,>=1.5.6; extra == "socks"`:            {Name: "PySocks", Specifier: "!=1.5.7,>=1.5.6", Markers: `extra == "socks"`},
+		`importlib-metadata ; python_version < "3.8"`:         {Name: "importlib-metadata", Markers: `python_version < "3.8"`},
+		"pip @ https://github.com/pypa/pip/archive/1.3.1.zip": {Name: "pip", Specifier: "https://github.com/pypa/pip/archive/1.3.1.zip"},
+		"pkg @ git+https://github.com/o/r@v1.0":               {Name: "pkg", Specifier: "git+https://github.com/o/r@v1.0"},
+		`pkg @ https://example.com/a;b.zip ; python_version < "3.8"`: {Name: "pkg", Specifier: "https://example.com/a;b.zip",
+			Markers: `python_version < "3.8"`},
+	}
+	for requirement, expected := range tests {
+		actual, err := parsePEP508(requirement)
+		if err != nil {
+			t.Errorf("Expected %s to parse, got %v", requirement, err)
+			continue
+		}
+		if actual.Name != expected.Name || !slices.Equal(actual.Extras, expected.Extras) ||
+			actual.Specifier != expected.Specifier || actual.Markers != expected.Markers {
+			t.Errorf("Expected %s to be %+v, got %+v", requirement, expected, actual)
+		}
+	}
+	for _, requirement := range []string{"", ">=1.0", "requests[socks", "requests (>=2.0"} {
+		if _, err := parsePEP508(requirement); err == nil {
+			t.Errorf("Expected %q to be rejected", requirement)
+		}
+	}
+
+	t.Run("Makes the dependencies of extras optional", func(t *testing.T) {
+		extra, _ := parsePEP508(`PySocks>=1.5.6; extra == "socks"`)
+		marker, _ := parsePEP508(`importlib-metadata; python_version < "3.8"`)
+		if !extra.dependency().Optional || marker.dependency().Optional {
+			t.Errorf("Expected only the dependency of the extra to be optional, got %+v and %+v", extra.dependency(), marker.dependency())
+		}
+	})
+}
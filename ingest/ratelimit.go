@@ -0,0 +1,98 @@
+package ingest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultRequestsPerMinute matches the libraries.io free tier.
+const defaultRequestsPerMinute = 60
+
+// now is used by the rate limiter to read the clock. Tests replace it together with sleep.
+var now = time.Now
+
+// rateLimiter is a token bucket that hands out one token per request. Tokens are refilled continuously at the
+// configured rate up to the bucket's capacity. Independently of the rate, the limiter can be paused, for example when
+// the server reports that the quota is used up. It is safe for concurrent use.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	capacity float64
+	tokens   float64
+	last     time.Time
+	// pausedUntil holds back all requests until the given time
+	pausedUntil time.Time
+}
+
+// newRateLimiter creates a limiter that allows requestsPerMinute requests per minute with bursts of up to burst
+// requests. A non-positive rate does not limit at all, but still honours pauses. A nil limiter does neither.
+func newRateLimiter(requestsPerMinute, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	limiter := &rateLimiter{
+		capacity: float64(burst),
+		tokens:   float64(burst),
+		last:     now(),
+	}
+	if requestsPerMinute > 0 {
+		limiter.interval = time.Minute / time.Duration(requestsPerMinute)
+	}
+	return limiter
+}
+
+// Pause holds back all requests for d, unless they are already held back for longer.
+func (l *rateLimiter) Pause(d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Wait blocks until a token is available and takes it. It returns ctx.Err() without taking a token if ctx is done
+// before that.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Sleeping while holding the lock makes concurrent callers queue up behind each other, which is what we want
+	if wait := l.pausedUntil.Sub(now()); wait > 0 {
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+	if l.interval == 0 {
+		return ctx.Err()
+	}
+
+	l.refill()
+	if l.tokens < 1 {
+		if err := sleep(ctx, time.Duration((1-l.tokens)*float64(l.interval))); err != nil {
+			return err
+		}
+		l.refill()
+		if l.tokens < 1 {
+			l.tokens = 1
+		}
+	}
+	l.tokens--
+	return nil
+}
+
+// refill adds the tokens that accumulated since the last refill.
+func (l *rateLimiter) refill() {
+	current := now()
+	l.tokens += float64(current.Sub(l.last)) / float64(l.interval)
+	if l.tokens > l.capacity {
+		l.tokens = l.capacity
+	}
+	l.last = current
+}
@@ -0,0 +1,108 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock replaces now and sleep for the duration of the test. Sleeping advances the clock instantly.
+func fakeClock(t *testing.T) *time.Time {
+	t.Helper()
+	current := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	previousNow, previousSleep := now, sleep
+	now = func() time.Time {
+		return current
+	}
+	sleep = func(ctx context.Context, d time.Duration) error {
+		current = current.Add(d)
+		return ctx.Err()
+	}
+	t.Cleanup(func() {
+		now, sleep = previousNow, previousSleep
+	})
+	return &current
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("Spaces requests out according to the rate", func(t *testing.T) {
+		clock := fakeClock(t)
+		start := *clock
+		limiter := newRateLimiter(60, 1)
+
+		for i := 0; i < 5; i++ {
+			limiter.Wait(context.Background())
+		}
+		if elapsed := clock.Sub(start); elapsed != 4*time.Second {
+			t.Errorf("Expected 5 requests at 60/min to take 4s, took %v", elapsed)
+		}
+	})
+
+	t.Run("Allows bursts up to the capacity", func(t *testing.T) {
+		clock := fakeClock(t)
+		start := *clock
+		limiter := newRateLimiter(60, 3)
+
+		for i := 0; i < 3; i++ {
+			limiter.Wait(context.Background())
+		}
+		if elapsed := clock.Sub(start); elapsed != 0 {
+			t.Errorf("Expected a burst of 3 to go through immediately, took %v", elapsed)
+		}
+		limiter.Wait(context.Background())
+		if elapsed := clock.Sub(start); elapsed != time.Second {
+			t.Errorf("Expected the 4th request to wait for a refill, took %v", elapsed)
+		}
+	})
+
+	t.Run("Refills while idle", func(t *testing.T) {
+		clock := fakeClock(t)
+		limiter := newRateLimiter(60, 1)
+		limiter.Wait(context.Background())
+		*clock = clock.Add(time.Second)
+		start := *clock
+
+		limiter.Wait(context.Background())
+		if elapsed := clock.Sub(start); elapsed != 0 {
+			t.Errorf("Expected no wait after being idle for a second, waited %v", elapsed)
+		}
+	})
+
+	t.Run("A non-positive rate disables limiting", func(t *testing.T) {
+		clock := fakeClock(t)
+		start := *clock
+		limiter := newRateLimiter(0, 1)
+		for i := 0; i < 100; i++ {
+			limiter.Wait(context.Background())
+		}
+		if elapsed := clock.Sub(start); elapsed != 0 {
+			t.Errorf("Expected no waits without a rate, waited %v", elapsed)
+		}
+	})
+
+	t.Run("Holds back requests while paused", func(t *testing.T) {
+		clock := fakeClock(t)
+		start := *clock
+		limiter := newRateLimiter(0, 1)
+		limiter.Pause(30 * time.Second)
+		limiter.Pause(10 * time.Second)
+
+		limiter.Wait(context.Background())
+		if elapsed := clock.Sub(start); elapsed != 30*time.Second {
+			t.Errorf("Expected to wait for the longest pause of 30s, waited %v", elapsed)
+		}
+	})
+}
+
+func TestRateLimiterCancellation(t *testing.T) {
+	fakeClock(t)
+	limiter := newRateLimiter(60, 1)
+	limiter.Wait(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
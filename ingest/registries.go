@@ -0,0 +1,234 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// mavenRepositoryURL is the Maven repository IngestRegistries downloads artifacts from. It is a variable so tests can
+// point it at a local server.
+var mavenRepositoryURL = MavenCentralURL
+
+// registryFetchers maps the platforms IngestRegistries supports to the function that fills in a package of that
+// platform from its registry. A fetcher is given a project with only its name and leaves its platform empty if the
+// registry does not know the package, like the fetch of ingestNamedPackages.
+var registryFetchers = map[string]func(ctx context.Context, f *fetcher, opts Options, project *Project) error{
+	"NPM":   fetchNPMPackage,
+	"Go":    fetchGoModulePackage,
+	"Pypi":  fetchPyPIPackage,
+	"Cargo": fetchCratePackage,
+	"Maven": fetchMavenPackage,
+}
+
+// RegistryPlatforms returns the platforms IngestRegistries can download packages of, in the spelling of libraries.io.
+func RegistryPlatforms() []string {
+	platforms := make([]string, 0, len(registryFetchers))
+	for platform := range registryFetchers {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+	return platforms
+}
+
+// ParseRegistryPackage splits a package given as platform:name, e.g. npm:react or maven:org.slf4j:slf4j-api, into the
+// libraries.io spelling of its platform and its name. The platform is matched regardless of case and must be one of
+// RegistryPlatforms.
+func ParseRegistryPackage(pkg string) (platform, name string, err error) {
+	platform, name, ok := strings.Cut(pkg, ":")
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("invalid package %q: expected platform:name, e.g. npm:react", pkg)
+	}
+	platform, err = normalizePlatform(platform)
+	if err != nil {
+		return "", "", err
+	}
+	if _, ok := registryFetchers[platform]; !ok {
+		return "", "", fmt.Errorf("%w %q: packages can only be downloaded from the registries of %s", ErrUnknownPlatform,
+			platform, strings.Join(RegistryPlatforms(), ", "))
+	}
+	return platform, name, nil
+}
+
+// IngestRegistries downloads packages of several platforms from their own registries and writes them all to outPath
+// in the format chosen in opts, with the same fields as Ingest, so that the platform column tells them apart. Packages
+// are given as platform:name, e.g. npm:react, go:github.com/spf13/cobra, pypi:requests, cargo:serde or
+// maven:org.slf4j:slf4j-api, and each one is downloaded the way IngestNPM, IngestGoModules, IngestPyPI, IngestCrates
+// and IngestMaven do for its platform. Maven artifacts come from Maven Central, with the dependencies and licenses the
+// pom.xml of their latest release declares, which takes a second request. Packages the registries do not know or
+// that have no releases left are skipped with a warning and listed in SkippedPackagesReport in the directory of
+// outPath.
+//
+// All packages are checked before anything is downloaded. As for IngestNPM, opts.Platform, APIKey, MaxPages and
+// Versions do not apply, responses are not cached, and the packages are fetched in batches of opts.PerPage with
+// opts.Workers concurrent requests, whichever their platform.
+func IngestRegistries(ctx context.Context, opts Options, packages []string, outPath string) (Stats, error) {
+	opts, err := opts.withDefaultsExceptAPIKey()
+	if err != nil {
+		return Stats{}, err
+	}
+	// The names are passed on in a canonical platform:name form, so that the fetch does not have to check them again
+	canonical := make([]string, len(packages))
+	for i, pkg := range packages {
+		platform, name, err := ParseRegistryPackage(pkg)
+		if err != nil {
+			return Stats{}, err
+		}
+		canonical[i] = platform + ":" + name
+	}
+	f := &fetcher{
+		client:      opts.HTTPClient,
+		limiter:     newRateLimiter(opts.RequestsPerMinute, 1),
+		maxAttempts: opts.MaxAttempts,
+		timeout:     opts.RequestTimeout,
+		backoff:     backoff,
+		userAgent:   userAgent,
+	}
+	stats := newStatsCollector()
+	f.stats = stats
+	skipped := newSkippedPackages()
+	// Already validated by withDefaultsExceptAPIKey
+	columns, _ := csvColumnIndices(opts.Columns)
+	_, err = writeProjectsFileAt(ctx, outPath, opts.Format, columns, resumePoint{}, opts.CompressionLevel, func(writer projectWriter, _ *outputFile) (int, error) {
+		total := len(canonical)
+		if opts.MaxPackages > 0 {
+			total = min(total, opts.MaxPackages)
+		}
+		return ingestNamedPackages(ctx, withProgress(writer, opts.Progress, 0, total), opts, canonical, stats, func(ctx context.Context, project *Project) error {
+			key := project.Name
+			platform, name, _ := strings.Cut(key, ":")
+			project.Name = name
+			if err := registryFetchers[platform](ctx, f, opts, project); err != nil {
+				return err
+			}
+			skipped.check(key, platform, project)
+			return nil
+		})
+	})
+	if err == nil {
+		err = skipped.write(ctx, outPath, canonical)
+	}
+	parameters := opts.manifestParameters(nil)
+	parameters.Packages = canonical
+	run := manifestRun{source: SourceRegistries, parameters: parameters, format: opts.Format, files: []string{outPath}}
+	return finish(ctx, outPath, run, stats.stats(), err)
+}
+
+// fetchNPMPackage fills in project from its document in the npm registry.
+func fetchNPMPackage(ctx context.Context, f *fetcher, opts Options, project *Project) error {
+	document, err := fetchNPMDocument(ctx, f, project.Name)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		slog.Warn("npm package not found, skipping it", "platform", "NPM", "package", project.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fetching npm package %s: %w", project.Name, err)
+	}
+	*project = document.toProject(opts.IncludePrerelease)
+	return nil
+}
+
+// fetchGoModulePackage fills in project from the versions the Go module proxy lists for it and the go.mod file of its
+// latest release.
+func fetchGoModulePackage(ctx context.Context, f *fetcher, opts Options, project *Project) error {
+	found, err := fetchGoModule(ctx, f, project.Name, opts.IncludePrerelease)
+	if err != nil || found.Platform == "" {
+		return err
+	}
+	*project = found
+	return fetchGoModRequiresOf(ctx, f, project)
+}
+
+// fetchPyPIPackage fills in project from the PyPI JSON API.
+func fetchPyPIPackage(ctx context.Context, f *fetcher, opts Options, project *Project) error {
+	found, err := fetchPyPIProject(ctx, f, project.Name)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		slog.Warn("PyPI project not found, skipping it", "platform", "Pypi", "package", project.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fetching PyPI project %s: %w", project.Name, err)
+	}
+	*project = withPrereleases(found.toProject(), opts.IncludePrerelease)
+	return nil
+}
+
+// fetchCratePackage fills in project from crates.io.
+func fetchCratePackage(ctx context.Context, f *fetcher, opts Options, project *Project) error {
+	crate, err := fetchCrate(ctx, f, project.Name)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		slog.Warn("Crate not found, skipping it", "platform", "Cargo", "package", project.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fetching crate %s: %w", project.Name, err)
+	}
+	*project = crate.toProject(opts.IncludePrerelease)
+	return nil
+}
+
+// fetchMavenPackage fills in project, named group:artifact, from the maven-metadata.xml file of the artifact and the
+// pom.xml file of its latest release. The metadata has no publication times, so the versions have none either.
+func fetchMavenPackage(ctx context.Context, f *fetcher, opts Options, project *Project) error {
+	groupID, artifactID, ok := strings.Cut(project.Name, ":")
+	if !ok {
+		return fmt.Errorf("invalid Maven coordinate %q: expected group:artifact", project.Name)
+	}
+	metadata, err := fetchMavenMetadata(ctx, f, mavenRepositoryURL, groupID, artifactID)
+	if errors.Is(err, ErrArtifactNotFound) {
+		slog.Warn("Maven artifact not found, skipping it", "platform", "Maven", "package", project.Name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	artifact := Project{Name: project.Name, Platform: "Maven", LatestReleaseNumber: metadata.Versioning.Release}
+	for _, number := range metadata.Versioning.Versions {
+		artifact.Versions = append(artifact.Versions, Version{Number: number})
+	}
+	artifact = withPrereleases(artifact, opts.IncludePrerelease)
+	if artifact.LatestReleaseNumber != "" {
+		pom, err := fetchPom(ctx, f, groupID, artifactID, artifact.LatestReleaseNumber)
+		if err != nil {
+			return err
+		}
+		artifact.Licenses = strings.Join(pom.Licenses, ",")
+		for _, dependency := range pom.Dependencies {
+			kind := dependency.Scope
+			if kind == "" {
+				kind = "compile"
+			}
+			artifact.Dependencies = append(artifact.Dependencies, Dependency{Name: dependency.GroupID + ":" + dependency.ArtifactID,
+				Platform: "Maven", Requirements: dependency.Version, Kind: kind, Optional: dependency.Optional})
+		}
+	}
+	*project = artifact
+	return nil
+}
+
+// fetchPom requests and decodes the pom.xml file of a version of an artifact from mavenRepositoryURL.
+func fetchPom(ctx context.Context, f *fetcher, groupID, artifactID, version string) (Pom, error) {
+	query := strings.TrimSuffix(mavenRepositoryURL, "/") + "/" + strings.ReplaceAll(groupID, ".", "/") + "/" + artifactID +
+		"/" + version + "/" + artifactID + "-" + version + ".pom"
+	body, err := f.fetchWithRetry(ctx, query)
+	if err != nil {
+		return Pom{}, fmt.Errorf("fetching the pom of %s:%s %s: %w", groupID, artifactID, version, err)
+	}
+	return ParsePom(bytes.NewReader(body))
+}
+
+// withPrereleases returns project as it is if includePrerelease is set, and without its prereleases otherwise.
+func withPrereleases(project Project, includePrerelease bool) Project {
+	if includePrerelease {
+		return project
+	}
+	return withoutPrereleases(project)
+}
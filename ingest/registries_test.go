@@ -0,0 +1,141 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// useRegistriesTestServer points the endpoints of every registry IngestRegistries supports at a local server, each
+// under its own prefix, and returns the paths it was asked for.
+func useRegistriesTestServer(t *testing.T, responses map[string]string) *[]string {
+	t.Helper()
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		body, ok := responses[r.URL.EscapedPath()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	previousNPM, previousGo, previousPyPI, previousCrates, previousMaven := npmEndpoint, goProxyEndpoint, pypiEndpoint,
+		cratesEndpoint, mavenRepositoryURL
+	npmEndpoint, goProxyEndpoint, pypiEndpoint, cratesEndpoint, mavenRepositoryURL = server.URL+"/npm", server.URL+"/go",
+		server.URL+"/pypi", server.URL+"/crates", server.URL+"/maven"
+	t.Cleanup(func() {
+		npmEndpoint, goProxyEndpoint, pypiEndpoint, cratesEndpoint, mavenRepositoryURL = previousNPM, previousGo, previousPyPI,
+			previousCrates, previousMaven
+		server.Close()
+	})
+	return &paths
+}
+
+func TestIngestRegistries(t *testing.T) {
+	useRegistriesTestServer(t, map[string]string{
+		"/npm/react": `{"name": "react", "dist-tags": {"latest": "18.0.0"}, "versions": {"18.0.0": {"dependencies": {"loose-envify": "^1.1.0"}}},
+			"time": {"18.0.0": "2022-03-29T00:00:00.000Z"}}`,
+		"/go/github.com/spf13/cobra/@v/list":       "v1.8.0\n",
+		"/go/github.com/spf13/cobra/@v/v1.8.0.mod": "module github.com/spf13/cobra\n\nrequire github.com/spf13/pflag v1.0.5\n",
+		"/pypi/requests/json": `{"info": {"name": "requests", "version": "2.31.0"},
+			"releases": {"2.31.0": [{"upload_time_iso_8601": "2023-05-22T00:00:00Z"}]}}`,
+		"/crates/serde": `{"crate": {"name": "serde"}, "versions": [{"num": "1.0.0", "created_at": "2017-01-01T00:00:00Z"}]}`,
+		"/maven/org/slf4j/slf4j-api/maven-metadata.xml": `<metadata><groupId>org.slf4j</groupId><artifactId>slf4j-api</artifactId>
+			<versioning><release>2.0.9</release><versions><version>2.0.0-alpha1</version><version>2.0.9</version></versions></versioning></metadata>`,
+		"/maven/org/slf4j/slf4j-api/2.0.9/slf4j-api-2.0.9.pom": `<project><groupId>org.slf4j</groupId><artifactId>slf4j-api</artifactId>
+			<version>2.0.9</version><licenses><license><name>MIT</name></license></licenses>
+			<dependencies><dependency><groupId>junit</groupId><artifactId>junit</artifactId><version>4.13</version><scope>test</scope></dependency></dependencies></project>`,
+	})
+	outPath := filepath.Join(t.TempDir(), "result.ndjson")
+
+	packages := []string{"npm:react", "go:github.com/spf13/cobra", "PyPI:requests", "cargo:serde", "maven:org.slf4j:slf4j-api", "npm:missing"}
+	stats, err := IngestRegistries(context.Background(), Options{Format: FormatNDJSON}, packages, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 5 {
+		t.Errorf("Expected 5 packages, got %d", stats.Packages)
+	}
+	report := readCSV(t, filepath.Join(filepath.Dir(outPath), SkippedPackagesReport))
+	if len(report) != 2 || !slices.Equal(report[1], []string{"NPM", "missing", "not found"}) {
+		t.Errorf("Expected only npm:missing in the report, got %v", report)
+	}
+
+	file, err := os.Open(outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer file.Close()
+	projects := make(map[string]Project)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var project Project
+		if err := json.Unmarshal(scanner.Bytes(), &project); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		projects[project.Platform+"/"+project.Name] = project
+	}
+	for _, key := range []string{"NPM/react", "Go/github.com/spf13/cobra", "Pypi/requests", "Cargo/serde", "Maven/org.slf4j:slf4j-api"} {
+		if _, ok := projects[key]; !ok {
+			t.Errorf("Expected %s in the output, got %v", key, projects)
+		}
+	}
+	if dependencies := projects["Go/github.com/spf13/cobra"].Dependencies; len(dependencies) != 1 || dependencies[0].Name != "github.com/spf13/pflag" {
+		t.Errorf("Expected the require directives of cobra, got %+v", dependencies)
+	}
+
+	maven := projects["Maven/org.slf4j:slf4j-api"]
+	if len(maven.Versions) != 1 || maven.Versions[0].Number != "2.0.9" || maven.LatestReleaseNumber != "2.0.9" {
+		t.Errorf("Expected only the release 2.0.9 of slf4j-api, got %+v", maven)
+	}
+	if maven.Licenses != "MIT" {
+		t.Errorf("Expected the license of the pom, got %q", maven.Licenses)
+	}
+	expected := Dependency{Name: "junit:junit", Platform: "Maven", Requirements: "4.13", Kind: "test"}
+	if len(maven.Dependencies) != 1 || maven.Dependencies[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, maven.Dependencies)
+	}
+}
+
+func TestParseRegistryPackage(t *testing.T) {
+	platform, name, err := ParseRegistryPackage("MAVEN:org.slf4j:slf4j-api")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if platform != "Maven" || name != "org.slf4j:slf4j-api" {
+		t.Errorf("Expected Maven and org.slf4j:slf4j-api, got %s and %s", platform, name)
+	}
+
+	for _, pkg := range []string{"react", "npm:", "rubygems:rails", "cobol:payroll"} {
+		if _, _, err := ParseRegistryPackage(pkg); err == nil {
+			t.Errorf("Expected an error for %q", pkg)
+		}
+	}
+	if _, _, err := ParseRegistryPackage("rubygems:rails"); !errors.Is(err, ErrUnknownPlatform) {
+		t.Errorf("Expected ErrUnknownPlatform, got %v", err)
+	}
+}
+
+func TestIngestRegistriesChecksPackagesFirst(t *testing.T) {
+	paths := useRegistriesTestServer(t, nil)
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+
+	if _, err := IngestRegistries(context.Background(), Options{}, []string{"npm:react", "react"}, outPath); err == nil {
+		t.Fatal("Expected an error for a package without a platform")
+	}
+	if len(*paths) != 0 {
+		t.Errorf("Expected no requests, got %v", *paths)
+	}
+	if _, err := os.Stat(outPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no output, got %v", err)
+	}
+}
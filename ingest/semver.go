@@ -0,0 +1,309 @@
+package ingest
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// UnsatisfiedRequirementError is returned by ResolveVersion when none of the known versions satisfies a requirement.
+type UnsatisfiedRequirementError struct {
+	Requirement string
+	// Candidates is the number of known versions that were checked.
+	Candidates int
+}
+
+func (e *UnsatisfiedRequirementError) Error() string {
+	return fmt.Sprintf("none of %d versions satisfies %q", e.Candidates, e.Requirement)
+}
+
+// SortVersions returns a copy of versions sorted by semver precedence, lowest first, so 9.0.0 comes before 10.0.0 and
+// 1.0.0-beta before 1.0.0. Versions of equal precedence, such as 1.0 and 1.0.0, keep their order. Versions that are
+// not valid semver come last, in the order they were given.
+func SortVersions(versions []string) []string {
+	type parsedVersion struct {
+		original string
+		// parsed is nil for versions that are not valid semver
+		parsed *semver.Version
+	}
+	parsed := make([]parsedVersion, len(versions))
+	for i, version := range versions {
+		parsed[i].original = version
+		parsed[i].parsed, _ = semver.NewVersion(version)
+	}
+	sort.SliceStable(parsed, func(i, j int) bool {
+		if parsed[i].parsed == nil || parsed[j].parsed == nil {
+			return parsed[j].parsed == nil && parsed[i].parsed != nil
+		}
+		return parsed[i].parsed.LessThan(parsed[j].parsed)
+	})
+	sorted := make([]string, len(parsed))
+	for i, version := range parsed {
+		sorted[i] = version.original
+	}
+	return sorted
+}
+
+// LatestStable returns the highest of versions by semver precedence that is not a prerelease, or an empty string if
+// there is none. Versions that are not valid semver are ignored.
+func LatestStable(versions []string) string {
+	var latest *semver.Version
+	for _, version := range versions {
+		parsed, err := semver.NewVersion(version)
+		if err != nil || parsed.Prerelease() != "" {
+			continue
+		}
+		if latest == nil || parsed.GreaterThan(latest) {
+			latest = parsed
+		}
+	}
+	if latest == nil {
+		return ""
+	}
+	return latest.Original()
+}
+
+// pep440PrereleasePattern matches the alpha, beta, release candidate and development releases of PEP 440, such as
+// 2.0.0rc1, 1.0b2 or 3.0.0.dev0, which PyPI uses instead of semver prerelease tags.
+var pep440PrereleasePattern = regexp.MustCompile(`(?i)^v?\d+(\.\d+)*[-_.]?(a|b|c|rc|alpha|beta|pre|preview|dev)[-_.]?\d*$`)
+
+// isPrerelease reports whether version is a prerelease, either a semver version with a prerelease component such as
+// 1.0.0-beta.1 or a PEP 440 pre- or development release.
+func isPrerelease(version string) bool {
+	if parsed, err := semver.NewVersion(version); err == nil {
+		return parsed.Prerelease() != ""
+	}
+	return pep440PrereleasePattern.MatchString(version)
+}
+
+// withoutPrereleases removes the prerelease versions of project. If its latest release is a prerelease, the highest
+// remaining release takes its place, or none if there is no release left. Ingestors that do not want prereleases in
+// their output apply it before anything else is derived from the versions.
+func withoutPrereleases(project Project) Project {
+	versions := make([]Version, 0, len(project.Versions))
+	numbers := make([]string, 0, len(project.Versions))
+	for _, version := range project.Versions {
+		if !isPrerelease(version.Number) {
+			versions = append(versions, version)
+			numbers = append(numbers, version.Number)
+		}
+	}
+	project.Versions = versions
+	if !isPrerelease(project.LatestReleaseNumber) {
+		return project
+	}
+	project.LatestReleaseNumber, project.LatestReleasePublishedAt = LatestStable(numbers), ""
+	for _, version := range versions {
+		if version.Number == project.LatestReleaseNumber {
+			project.LatestReleasePublishedAt = version.PublishedAt
+		}
+	}
+	return project
+}
+
+// withLatestRelease sets the latest release of project to its highest version by semver precedence, for registries
+// that do not name one. Unless includePrerelease is set, prereleases are removed like withoutPrereleases does, which
+// makes the highest stable version the latest release.
+func withLatestRelease(project Project, includePrerelease bool) Project {
+	numbers := make([]string, 0, len(project.Versions))
+	for _, version := range project.Versions {
+		numbers = append(numbers, version.Number)
+	}
+	if sorted := SortVersions(numbers); len(sorted) > 0 {
+		project.LatestReleaseNumber = sorted[len(sorted)-1]
+	}
+	for _, version := range project.Versions {
+		if version.Number == project.LatestReleaseNumber {
+			project.LatestReleasePublishedAt = version.PublishedAt
+		}
+	}
+	if !includePrerelease {
+		project = withoutPrereleases(project)
+	}
+	return project
+}
+
+// ResolveVersion returns the highest of versions that satisfies requirement, an NPM style semver range such as
+// ^1.2.0, ~0.3.x, >=2 <3, 1.2.3 - 2.3.4 or 1.x || 2.x. An empty requirement, * and latest match any version. Versions
+// that are not valid semver are ignored. Like NPM, prereleases only satisfy a range if one of its comparators names a
+// prerelease of the same major, minor and patch version, and only * and latest fall back to prereleases when there is
+// no release at all. An *UnsatisfiedRequirementError is returned if no version matches.
+func ResolveVersion(requirement string, versions []string) (string, error) {
+	requirement = strings.TrimSpace(requirement)
+	candidates := make([]*semver.Version, 0, len(versions))
+	for _, version := range versions {
+		if parsed, err := semver.NewVersion(version); err == nil {
+			candidates = append(candidates, parsed)
+		}
+	}
+
+	switch requirement {
+	case "", "*", "x", "X", "latest":
+		var best, bestPrerelease *semver.Version
+		for _, candidate := range candidates {
+			if candidate.Prerelease() == "" {
+				if best == nil || candidate.GreaterThan(best) {
+					best = candidate
+				}
+			} else if bestPrerelease == nil || candidate.GreaterThan(bestPrerelease) {
+				bestPrerelease = candidate
+			}
+		}
+		if best == nil {
+			best = bestPrerelease
+		}
+		if best == nil {
+			return "", &UnsatisfiedRequirementError{Requirement: requirement, Candidates: len(candidates)}
+		}
+		return best.Original(), nil
+	}
+
+	constraint, err := semver.NewConstraint(normalizeRange(requirement))
+	if err != nil {
+		return "", fmt.Errorf("parsing requirement %q: %w", requirement, err)
+	}
+	prereleaseTuples := prereleaseTuplesIn(requirement)
+	var best *semver.Version
+	for _, candidate := range candidates {
+		if candidate.Prerelease() != "" && !prereleaseTuples[tuple(candidate)] {
+			continue
+		}
+		if constraint.Check(candidate) && (best == nil || candidate.GreaterThan(best)) {
+			best = candidate
+		}
+	}
+	if best == nil {
+		return "", &UnsatisfiedRequirementError{Requirement: requirement, Candidates: len(candidates)}
+	}
+	return best.Original(), nil
+}
+
+// comparatorPattern splits a comparator such as >=1.2 into its operator and version.
+var comparatorPattern = regexp.MustCompile(`^(<=|>=|<|>|=|~|\^)?v?(.*)$`)
+
+// prereleasePattern finds the versions with a prerelease tag in a range.
+var prereleasePattern = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)-[0-9A-Za-z.-]+`)
+
+// normalizeRange rewrites an NPM range into the syntax of the semver library. Comparators may be separated by spaces
+// rather than commas there, and partial versions in comparisons mean the whole major or minor version as in NPM, so
+// <3 excludes 3.0.0 and >1.2 starts at 1.3.0.
+func normalizeRange(requirement string) string {
+	alternatives := strings.Split(requirement, "||")
+	for i, alternative := range alternatives {
+		alternative = strings.TrimSpace(alternative)
+		// Hyphen ranges are understood as they are
+		if strings.Contains(alternative, " - ") {
+			alternatives[i] = alternative
+			continue
+		}
+		var comparators []string
+		pendingOperator := ""
+		for _, token := range strings.FieldsFunc(alternative, func(r rune) bool { return r == ' ' || r == ',' }) {
+			// Allow a space between operator and version, as in >= 1.2
+			if strings.Trim(token, "<>=~^") == "" {
+				pendingOperator += token
+				continue
+			}
+			comparators = append(comparators, normalizeComparator(pendingOperator+token))
+			pendingOperator = ""
+		}
+		alternatives[i] = strings.Join(comparators, ", ")
+	}
+	return strings.Join(alternatives, " || ")
+}
+
+// normalizeComparator fills in a partial version in a <, <=, > or >= comparison the way NPM reads it, and spells out
+// caret ranges below 1.0.0.
+func normalizeComparator(comparator string) string {
+	match := comparatorPattern.FindStringSubmatch(comparator)
+	operator, version := match[1], match[2]
+	switch operator {
+	case "<", "<=", ">", ">=":
+	case "^":
+		return normalizeCaret(comparator, version)
+	default:
+		return comparator
+	}
+	var parts []int
+	for _, part := range strings.SplitN(version, ".", 3) {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			// A wildcard ends the version, anything else is left to the semver library
+			if part == "x" || part == "X" || part == "*" {
+				break
+			}
+			return comparator
+		}
+		parts = append(parts, number)
+	}
+	if len(parts) == 0 || len(parts) == 3 {
+		return comparator
+	}
+
+	last := len(parts) - 1
+	switch operator {
+	case ">":
+		// Greater than all of 1.2.x means at least 1.3.0
+		parts[last]++
+		operator = ">="
+	case "<=":
+		// Up to all of 1.2.x means below 1.3.0
+		parts[last]++
+		operator = "<"
+	}
+	for len(parts) < 3 {
+		parts = append(parts, 0)
+	}
+	return fmt.Sprintf("%s%d.%d.%d", operator, parts[0], parts[1], parts[2])
+}
+
+// prereleaseTuplesIn returns the major.minor.patch tuples that have a prerelease named in requirement.
+func prereleaseTuplesIn(requirement string) map[string]bool {
+	tuples := make(map[string]bool)
+	for _, match := range prereleasePattern.FindAllStringSubmatch(requirement, -1) {
+		tuples[match[1]+"."+match[2]+"."+match[3]] = true
+	}
+	return tuples
+}
+
+func tuple(version *semver.Version) string {
+	return fmt.Sprintf("%d.%d.%d", version.Major(), version.Minor(), version.Patch())
+}
+
+// normalizeCaret rewrites a caret range on a 0.x version. NPM lets ^ allow changes that do not modify the left-most
+// non-zero part, so ^0.2.3 stays below 0.3.0 and ^0.0.3 below 0.0.4, while the semver library allows anything below
+// 1.0.0. Other caret ranges are returned unchanged.
+func normalizeCaret(comparator, version string) string {
+	version, prerelease, _ := strings.Cut(version, "-")
+	var parts []int
+	for _, part := range strings.SplitN(version, ".", 3) {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			if part == "x" || part == "X" || part == "*" {
+				break
+			}
+			return comparator
+		}
+		parts = append(parts, number)
+	}
+	// ^0 and ^0.x already mean below 1.0.0
+	if len(parts) < 2 || parts[0] != 0 {
+		return comparator
+	}
+	upper := []int{0, parts[1] + 1, 0}
+	if parts[1] == 0 && len(parts) == 3 {
+		upper = []int{0, 0, parts[2] + 1}
+	}
+	for len(parts) < 3 {
+		parts = append(parts, 0)
+	}
+	lower := fmt.Sprintf(">=%d.%d.%d", parts[0], parts[1], parts[2])
+	if prerelease != "" {
+		lower += "-" + prerelease
+	}
+	return fmt.Sprintf("%s, <%d.%d.%d", lower, upper[0], upper[1], upper[2])
+}
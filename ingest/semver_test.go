@@ -0,0 +1,179 @@
+package ingest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResolveVersion(t *testing.T) {
+	versions := []string{
+		"0.3.0", "0.3.5", "0.4.0", "1.2.0", "1.2.5", "1.3.0-beta.1", "1.3.0", "2.0.0-rc.1", "2.0.0", "2.5.0",
+		"3.0.0", "not-semver", "0.0.3", "0.0.4",
+	}
+	tests := []struct {
+		requirement string
+		expected    string
+	}{
+		{"^1.2.0", "1.3.0"},
+		{"~1.2.0", "1.2.5"},
+		{"~0.3.x", "0.3.5"},
+		{"1.2.x", "1.2.5"},
+		{">=2 <3", "2.5.0"},
+		{">= 2, < 3", "2.5.0"},
+		{"<=2", "2.5.0"},
+		{">1.2", "3.0.0"},
+		{"<1.3", "1.2.5"},
+		{"1.2.0 - 2.0.0", "2.0.0"},
+		{"1.2.x || 0.x", "1.2.5"},
+		{"*", "3.0.0"},
+		{"", "3.0.0"},
+		{"latest", "3.0.0"},
+		{"1.2.0", "1.2.0"},
+		{"<1.3.0", "1.2.5"},
+		{">=1.3.0-beta.0 <2.0.0", "1.3.0"},
+		{"^2.0.0-rc.0", "2.5.0"},
+		{">=1.3.0-beta.0 <2", "1.3.0"},
+		{"2.0.0-rc.1", "2.0.0-rc.1"},
+		{"^0.3.0", "0.3.5"},
+		{"^0.3", "0.3.5"},
+		{"^0.0.3", "0.0.3"},
+		{"^0.0", "0.0.4"},
+		{"^0", "0.4.0"},
+		{"^0.x", "0.4.0"},
+		{"1 - 2", "2.5.0"},
+		{"1.X", "1.3.0"},
+		{"2.x.x", "2.5.0"},
+	}
+	for _, test := range tests {
+		t.Run(test.requirement, func(t *testing.T) {
+			actual, err := ResolveVersion(test.requirement, versions)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+
+	t.Run("Excludes prereleases of other versions", func(t *testing.T) {
+		if actual, err := ResolveVersion(">=1.3.0-beta.0", []string{"1.3.0-beta.1", "2.0.0-rc.1"}); err != nil || actual != "1.3.0-beta.1" {
+			t.Errorf("Expected 1.3.0-beta.1, got %s and %v", actual, err)
+		}
+		if _, err := ResolveVersion("^1.0.0", []string{"1.1.0-beta"}); err == nil {
+			t.Error("Expected a prerelease of another version not to satisfy the range")
+		}
+	})
+
+	t.Run("Falls back to prereleases for any version", func(t *testing.T) {
+		if actual, err := ResolveVersion("*", []string{"1.0.0-alpha", "1.0.0-beta"}); err != nil || actual != "1.0.0-beta" {
+			t.Errorf("Expected 1.0.0-beta, got %s and %v", actual, err)
+		}
+	})
+
+	t.Run("Reports unsatisfiable requirements", func(t *testing.T) {
+		_, err := ResolveVersion("^4.0.0", versions)
+		var unsatisfied *UnsatisfiedRequirementError
+		if !errors.As(err, &unsatisfied) || unsatisfied.Requirement != "^4.0.0" {
+			t.Errorf("Expected an UnsatisfiedRequirementError, got %v", err)
+		}
+		if _, err := ResolveVersion("*", nil); !errors.As(err, &unsatisfied) {
+			t.Errorf("Expected an UnsatisfiedRequirementError without versions, got %v", err)
+		}
+	})
+
+	t.Run("Reports malformed requirements", func(t *testing.T) {
+		var unsatisfied *UnsatisfiedRequirementError
+		if _, err := ResolveVersion("next", versions); err == nil || errors.As(err, &unsatisfied) {
+			t.Errorf("Expected a parse error, got %v", err)
+		}
+	})
+}
+
+func TestSortVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []string
+		expected []string
+	}{
+		{"Compares numerically", []string{"10.0.0", "9.0.0", "1.10.0", "1.9.0"}, []string{"1.9.0", "1.10.0", "9.0.0", "10.0.0"}},
+		{"Puts prereleases before their release", []string{"1.0.0", "1.0.0-rc.1", "1.0.0-beta.2", "1.0.0-beta.10"},
+			[]string{"1.0.0-beta.2", "1.0.0-beta.10", "1.0.0-rc.1", "1.0.0"}},
+		{"Keeps unparseable versions last in order", []string{"latest", "2.0.0", "not-semver", "v1.0.0"},
+			[]string{"v1.0.0", "2.0.0", "latest", "not-semver"}},
+		{"Keeps equal versions in order", []string{"1.0", "1.0.0", "1"}, []string{"1.0", "1.0.0", "1"}},
+		{"Handles no versions", nil, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := append([]string(nil), test.versions...)
+			actual := SortVersions(input)
+			if strings.Join(actual, ",") != strings.Join(test.expected, ",") {
+				t.Errorf("Expected %v, got %v", test.expected, actual)
+			}
+			if strings.Join(input, ",") != strings.Join(test.versions, ",") {
+				t.Errorf("Expected the input to be left alone, got %v", input)
+			}
+		})
+	}
+}
+
+func TestLatestStable(t *testing.T) {
+	tests := map[string][]string{
+		"10.0.0": {"9.0.0", "10.0.0", "10.1.0-beta.1", "not-semver"},
+		"1.2.0":  {"1.2.0", "1.0.0"},
+		"":       {"1.0.0-rc.1", "broken"},
+	}
+	for expected, versions := range tests {
+		if actual := LatestStable(versions); actual != expected {
+			t.Errorf("Expected %q for %v, got %q", expected, versions, actual)
+		}
+	}
+}
+
+func TestIsPrerelease(t *testing.T) {
+	tests := map[string]bool{
+		"1.0.0":         false,
+		"v2.1":          false,
+		"1.0.0-beta.1":  true,
+		"2.0.0-rc.1":    true,
+		"1.0-SNAPSHOT":  true,
+		"2.0.0rc1":      true,
+		"1.0b2":         true,
+		"3.0.0.dev0":    true,
+		"1.0.post1":     false,
+		"2022.12.07":    false,
+		"not-a-version": false,
+	}
+	for version, expected := range tests {
+		if actual := isPrerelease(version); actual != expected {
+			t.Errorf("Expected isPrerelease(%q) to be %v, got %v", version, expected, actual)
+		}
+	}
+}
+
+func TestWithoutPrereleases(t *testing.T) {
+	project := withoutPrereleases(Project{
+		Name:                     "left-pad",
+		LatestReleaseNumber:      "2.0.0-beta.1",
+		LatestReleasePublishedAt: "2019",
+		Versions: []Version{
+			{Number: "1.2.0", PublishedAt: "2017"},
+			{Number: "1.3.0", PublishedAt: "2018"},
+			{Number: "2.0.0-beta.1", PublishedAt: "2019"},
+		},
+	})
+	if len(project.Versions) != 2 {
+		t.Errorf("Expected the two releases to be kept, got %v", project.Versions)
+	}
+	if project.LatestReleaseNumber != "1.3.0" || project.LatestReleasePublishedAt != "2018" {
+		t.Errorf("Expected 1.3.0 of 2018 to become the latest release, got %s of %s", project.LatestReleaseNumber,
+			project.LatestReleasePublishedAt)
+	}
+
+	project = withoutPrereleases(Project{LatestReleaseNumber: "1.0.0-rc.1", Versions: []Version{{Number: "1.0.0-rc.1"}}})
+	if len(project.Versions) != 0 || project.LatestReleaseNumber != "" {
+		t.Errorf("Expected no releases to be left, got %v and latest %q", project.Versions, project.LatestReleaseNumber)
+	}
+}
@@ -0,0 +1,70 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SinceLastRun is the value of since in a config file, or of the --since flag, that continues from the time the last
+// ingestion from libraries.io into the same directory finished, as returned by LastRunFinished.
+const SinceLastRun = "last"
+
+// ErrNoLastRun is returned by LastRunFinished when the manifest records no ingestion from libraries.io.
+var ErrNoLastRun = errors.New("no earlier ingestion from libraries.io")
+
+// sinceDateLayout is the layout of a cutoff given as a date only, which is midnight UTC of that day.
+const sinceDateLayout = "2006-01-02"
+
+// ParseSince parses a cutoff for Options.Since or IngestGoIndex, either a date such as 2024-01-01, which stands for
+// midnight UTC, or an RFC 3339 timestamp such as 2024-01-01T12:00:00+02:00. The time is returned in UTC.
+func ParseSince(since string) (time.Time, error) {
+	since = strings.TrimSpace(since)
+	if parsed, err := time.Parse(sinceDateLayout, since); err == nil {
+		return parsed, nil
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, since)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("must be a date such as 2024-01-01 or an RFC 3339 timestamp such as 2019-04-10T19:08:52.997264Z, got %q", since)
+	}
+	return parsed.UTC(), nil
+}
+
+// formatSince formats a cutoff for the manifest and checkpoints, as RFC 3339 in UTC, or empty for the zero time.
+func formatSince(since time.Time) string {
+	if since.IsZero() {
+		return ""
+	}
+	return since.UTC().Format(time.RFC3339Nano)
+}
+
+// searchSort returns the field the search results are ordered by, which is the publication time of the latest release
+// with a Since, and the libraries.io default otherwise.
+func (o Options) searchSort() string {
+	if o.Since.IsZero() {
+		return ""
+	}
+	return "latest_release_published_at"
+}
+
+// LastRunFinished returns when the latest ingestion from libraries.io recorded in the manifest of the directory of
+// outPath finished, which the next incremental run passes as Options.Since to continue where that one ended.
+// ErrNoLastRun is returned if the manifest records none, and the error of ReadManifest if there is no manifest.
+func LastRunFinished(outPath string) (time.Time, error) {
+	manifest, err := ReadManifest(filepath.Dir(outPath))
+	if err != nil {
+		return time.Time{}, err
+	}
+	var finished time.Time
+	for _, output := range manifest.Outputs {
+		if output.Source == SourceLibrariesIO && output.FinishedAt.After(finished) {
+			finished = output.FinishedAt
+		}
+	}
+	if finished.IsZero() {
+		return time.Time{}, fmt.Errorf("%w in the manifest of %s", ErrNoLastRun, filepath.Dir(outPath))
+	}
+	return finished.UTC(), nil
+}
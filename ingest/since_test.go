@@ -0,0 +1,128 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	tests := map[string]time.Time{
+		"2024-01-01":                time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		"2024-01-01T12:00:00+02:00": time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+		"2024-01-01T10:00:00.5Z":    time.Date(2024, 1, 1, 10, 0, 0, 5e8, time.UTC),
+	}
+	for since, expected := range tests {
+		actual, err := ParseSince(since)
+		if err != nil {
+			t.Errorf("Expected %s to parse, got %v", since, err)
+		}
+		if !actual.Equal(expected) || actual.Location() != time.UTC {
+			t.Errorf("Expected %s to be %v, got %v", since, expected, actual)
+		}
+	}
+	for _, since := range []string{"yesterday", "2024-13-01", "01/01/2024"} {
+		if _, err := ParseSince(since); err == nil {
+			t.Errorf("Expected %s to be rejected", since)
+		}
+	}
+}
+
+func TestIngestSince(t *testing.T) {
+	pages := map[string]string{
+		"1": `[
+			{"name": "newest", "platform": "NPM", "latest_release_published_at": "2024-03-01T00:00:00Z"},
+			{"name": "new", "platform": "NPM", "latest_release_published_at": "2024-01-02T00:00:00+02:00"}
+		]`,
+		"2": `[
+			{"name": "recent", "platform": "NPM", "latest_release_published_at": "2024-01-01T00:00:01Z"},
+			{"name": "old", "platform": "NPM", "latest_release_published_at": "2024-01-01T00:00:00Z"}
+		]`,
+		"3": `[
+			{"name": "older", "platform": "NPM", "latest_release_published_at": "2023-06-01T00:00:00Z"},
+			{"name": "undated", "platform": "NPM", "latest_release_published_at": null}
+		]`,
+		"4": `[
+			{"name": "oldest", "platform": "NPM", "latest_release_published_at": "2020-01-01T00:00:00Z"}
+		]`,
+	}
+	var requested []string
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if sort := r.URL.Query().Get("sort"); sort != "latest_release_published_at" {
+			http.Error(w, fmt.Sprintf("unexpected sort %q", sort), http.StatusBadRequest)
+			return
+		}
+		page := r.URL.Query().Get("page")
+		requested = append(requested, page)
+		w.Write([]byte(pages[page]))
+	})
+	opts := Options{Platform: "NPM", APIKey: "secret", PerPage: 2, Workers: 1, Since: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	t.Run("Stops at the first page of older packages", func(t *testing.T) {
+		requested = nil
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+		stats, err := IngestContext(context.Background(), opts, outPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if expected := []string{"1", "2", "3"}; !slices.Equal(requested, expected) {
+			t.Errorf("Expected the pages %v to be requested, got %v", expected, requested)
+		}
+		expected := []string{"newest", "new", "recent"}
+		if names := readPackageNames(t, outPath, FormatCSV); !slices.Equal(names, expected) {
+			t.Errorf("Expected %v, got %v", expected, names)
+		}
+		if stats.Packages != 3 || stats.Filtered != 3 {
+			t.Errorf("Expected 3 packages and 3 filtered, got %d and %d", stats.Packages, stats.Filtered)
+		}
+
+		manifest, err := ReadManifest(filepath.Dir(outPath))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if since := manifest.Outputs[0].Parameters.Since; since != "2024-01-01T00:00:00Z" {
+			t.Errorf("Expected the cutoff in the manifest, got %q", since)
+		}
+		finished, err := LastRunFinished(outPath)
+		if err != nil || !finished.Equal(manifest.Outputs[0].FinishedAt) {
+			t.Errorf("Expected the run to have finished at %v, got %v and %v", manifest.Outputs[0].FinishedAt, finished, err)
+		}
+	})
+
+	t.Run("Keeps undated packages if asked to", func(t *testing.T) {
+		opts := opts
+		opts.IncludeUndated = true
+		outPath := filepath.Join(t.TempDir(), "result.csv")
+		if _, err := IngestContext(context.Background(), opts, outPath); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expected := []string{"newest", "new", "recent", "undated"}
+		if names := readPackageNames(t, outPath, FormatCSV); !slices.Equal(names, expected) {
+			t.Errorf("Expected %v, got %v", expected, names)
+		}
+	})
+}
+
+func TestLastRunFinished(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LastRunFinished(filepath.Join(dir, "result.csv")); err == nil {
+		t.Error("Expected an error without a manifest")
+	}
+	outPath := filepath.Join(dir, "merged.csv")
+	if err := os.WriteFile(outPath, []byte("name,platform\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run := manifestRun{source: SourceMerge, parameters: ManifestParameters{Format: "csv"}, format: FormatCSV, files: []string{outPath}}
+	if err := writeManifest(run, Stats{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LastRunFinished(outPath); !errors.Is(err, ErrNoLastRun) {
+		t.Errorf("Expected ErrNoLastRun, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package ingest
+
+import (
+	"context"
+	"encoding/csv"
+	"log/slog"
+	"path/filepath"
+	"sync"
+)
+
+// SkippedPackagesReport is the name of the CSV file IngestPyPI, IngestRegistries and IngestList write next to their
+// output, with the packages they were given but left out, and why: either the registry does not know them, or they
+// have no releases left, for example because all of them were yanked or are prereleases.
+const SkippedPackagesReport = "skipped_packages.csv"
+
+// skippedPackagesHeader is the header row of SkippedPackagesReport.
+var skippedPackagesHeader = []string{"platform", "name", "reason"}
+
+// The reasons SkippedPackagesReport gives for leaving out a package.
+const (
+	skippedNotFound   = "not found"
+	skippedNoReleases = "no releases"
+)
+
+// skippedPackages collects the packages an ingestion of named packages leaves out, from concurrent fetches. Each
+// package is known by the name it was given as, its key.
+type skippedPackages struct {
+	mu   sync.Mutex
+	rows map[string][]string
+}
+
+func newSkippedPackages() *skippedPackages {
+	return &skippedPackages{rows: make(map[string][]string)}
+}
+
+// check records project, as filled in by a fetch of ingestNamedPackages, if it is left out: because the registry does
+// not know it, which leaves its platform empty, or because it has no releases. The platform of a package without
+// releases is cleared, so that ingestNamedPackages leaves it out as well.
+func (s *skippedPackages) check(key, platform string, project *Project) {
+	reason := ""
+	switch {
+	case project.Platform == "":
+		reason = skippedNotFound
+	case len(project.Versions) == 0:
+		slog.Warn("Package has no releases, skipping it", "platform", platform, "package", project.Name)
+		reason = skippedNoReleases
+		project.Platform = ""
+	default:
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rows[key] = []string{platform, project.Name, reason}
+}
+
+// write writes SkippedPackagesReport to the directory of outPath, with the packages in the order of keys and each one
+// once. The report is written even if no package was left out, so that it never lists the packages of an earlier run.
+func (s *skippedPackages) write(ctx context.Context, outPath string, keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows [][]string
+	for _, key := range keys {
+		if row, ok := s.rows[key]; ok {
+			rows = append(rows, row)
+			// A package named twice is reported once
+			delete(s.rows, key)
+		}
+	}
+	_, err := writeCSVFile(ctx, filepath.Join(filepath.Dir(outPath), SkippedPackagesReport), skippedPackagesHeader,
+		func(w *csv.Writer) (int, error) { return len(rows), w.WriteAll(rows) })
+	return err
+}
@@ -0,0 +1,158 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	// Registers the pure Go sqlite driver, which keeps the build free of cgo
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the tables of FormatSQLite. They follow the files of IngestNormalized, so packages are referred
+// to by the same ids. last_updated is the time the package was ingested.
+const sqliteSchema = `
+CREATE TABLE packages (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	platform TEXT NOT NULL,
+	description TEXT,
+	homepage TEXT,
+	language TEXT,
+	keywords TEXT,
+	latest_release_number TEXT,
+	latest_release_published_at TEXT,
+	last_updated TEXT NOT NULL
+);
+CREATE TABLE versions (
+	package_id TEXT NOT NULL REFERENCES packages(id),
+	number TEXT NOT NULL,
+	published_at TEXT,
+	published_at_missing INTEGER NOT NULL,
+	PRIMARY KEY (package_id, number)
+);
+CREATE TABLE dependencies (
+	package_id TEXT NOT NULL REFERENCES packages(id),
+	version TEXT NOT NULL,
+	dependency_name TEXT NOT NULL,
+	dependency_platform TEXT,
+	requirements TEXT,
+	kind TEXT,
+	optional INTEGER NOT NULL,
+	resolved INTEGER NOT NULL,
+	markers TEXT
+);
+CREATE INDEX dependencies_by_name ON dependencies (dependency_platform, dependency_name);
+`
+
+// writeSQLiteFile creates a SQLite database at outPath, replacing any file that is there, and lets write fill it
+// through a projectWriter. Like writeFile, it builds the database in a temporary file that is only renamed to outPath
+// once it is complete, and removes it if writing fails or ctx is done.
+func writeSQLiteFile(ctx context.Context, outPath string, write func(writer projectWriter) (int, error)) (int, error) {
+	f, err := CreateAtomic(outPath)
+	if err != nil {
+		return 0, err
+	}
+	// SQLite opens the file itself and takes the empty file for a new database
+	temp := f.Name()
+	f.Close()
+	db, err := sql.Open("sqlite", temp)
+	if err != nil {
+		os.Remove(temp)
+		return 0, fmt.Errorf("creating database %s: %w", outPath, err)
+	}
+
+	written := 0
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		err = fmt.Errorf("creating tables in %s: %w", outPath, err)
+	} else {
+		written, err = write(&sqliteProjectWriter{db: db})
+	}
+	if closeErr := db.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("closing %s: %w", outPath, closeErr)
+	}
+	if ctx.Err() != nil {
+		os.Remove(temp)
+		return written, ctx.Err()
+	}
+	if err != nil {
+		os.Remove(temp)
+		return written, err
+	}
+	if renameErr := os.Rename(temp, outPath); renameErr != nil {
+		os.Remove(temp)
+		return written, fmt.Errorf("writing %s: %w", outPath, renameErr)
+	}
+	return written, nil
+}
+
+// sqliteProjectWriter inserts projects into the tables of sqliteSchema. Each call to writeProjects, which is a page
+// of results, is a single transaction, since committing every row on its own is orders of magnitude slower.
+type sqliteProjectWriter struct {
+	db *sql.DB
+}
+
+func (w *sqliteProjectWriter) writeProjects(projects []Project) (rows int, err error) {
+	// The transaction is not tied to the ingestion's context, so that a cancellation still commits the page
+	tx, err := w.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			rows = 0
+		}
+	}()
+
+	insertPackage, err := tx.Prepare(`INSERT OR IGNORE INTO packages VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("preparing package insert: %w", err)
+	}
+	insertVersion, err := tx.Prepare(`INSERT OR IGNORE INTO versions VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("preparing version insert: %w", err)
+	}
+	insertDependency, err := tx.Prepare(`INSERT INTO dependencies VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("preparing dependency insert: %w", err)
+	}
+
+	updated := now().UTC().Format(time.RFC3339)
+	for _, project := range projects {
+		id := packageID(project.Platform, project.Name)
+		result, err := insertPackage.Exec(id, project.Name, project.Platform, project.Description, project.Homepage,
+			project.Language, strings.Join(project.Keywords, ";"), project.LatestReleaseNumber,
+			project.LatestReleasePublishedAt, updated)
+		if err != nil {
+			return rows, fmt.Errorf("inserting package %s: %w", project.Name, err)
+		}
+		// libraries.io sometimes returns a package on two pages, keep the first one
+		if inserted, err := result.RowsAffected(); err == nil && inserted == 0 {
+			continue
+		}
+		rows++
+		for _, version := range project.Versions {
+			publishedAt, missing := publishedAtField(version)
+			if _, err := insertVersion.Exec(id, version.Number, publishedAt, missing); err != nil {
+				return rows, fmt.Errorf("inserting version %s of %s: %w", version.Number, project.Name, err)
+			}
+			rows++
+		}
+		for _, dependency := range project.Dependencies {
+			_, err := insertDependency.Exec(id, project.LatestReleaseNumber, dependency.Name, dependency.Platform,
+				dependency.Requirements, dependency.Kind, dependency.Optional, dependency.Resolved, dependency.Markers)
+			if err != nil {
+				return rows, fmt.Errorf("inserting dependency %s of %s: %w", dependency.Name, project.Name, err)
+			}
+			rows++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return rows, fmt.Errorf("committing transaction: %w", err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,82 @@
+package ingest
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIngestSQLite(t *testing.T) {
+	pages := 0
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			w.Write([]byte(`{"dependencies": [{"name": "tape", "platform": "NPM", "requirements": "^4.0.0", "kind": "Development"}]}`))
+			return
+		}
+		pages++
+		if pages > 2 {
+			w.Write([]byte("[]"))
+			return
+		}
+		// The same package on two pages must only be inserted once
+		w.Write([]byte(testProjectsPage))
+	})
+	outPath := filepath.Join(t.TempDir(), "result.sqlite")
+	opts := Options{Platform: "NPM", APIKey: "secret", Workers: 1, PerPage: 1, Format: FormatSQLite, Dependencies: true}
+
+	stats, err := Ingest(opts, outPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Rows != 4 {
+		t.Errorf("Expected a package, two versions and a dependency to be inserted, got %d rows", stats.Rows)
+	}
+	if _, err := os.Stat(checkpointPath(outPath)); !os.IsNotExist(err) {
+		t.Errorf("Expected no checkpoint for a database, got %v", err)
+	}
+
+	db, err := sql.Open("sqlite", outPath)
+	if err != nil {
+		t.Fatalf("Could not open database: %v", err)
+	}
+	defer db.Close()
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"SELECT count(*) FROM packages", "1"},
+		{"SELECT name || ' ' || latest_release_number || ' ' || keywords FROM packages", "left-pad 1.3.0 leftpad;pad"},
+		{"SELECT group_concat(number) FROM (SELECT number FROM versions ORDER BY number)", "1.2.0,1.3.0"},
+		{"SELECT published_at || ' ' || published_at_missing FROM versions WHERE number = '1.2.0'", "2017-11-20T10:12:00Z 0"},
+		{"SELECT p.name || ' ' || d.version || ' ' || d.dependency_name FROM dependencies d JOIN packages p ON p.id = d.package_id",
+			"left-pad 1.3.0 tape"},
+		{"SELECT count(*) FROM packages WHERE last_updated != ''", "1"},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			var result string
+			if err := db.QueryRow(test.query).Scan(&result); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("Expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestIngestSQLiteFailure(t *testing.T) {
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	outPath := filepath.Join(t.TempDir(), "result.db")
+
+	if _, err := Ingest(Options{Platform: "NPM", APIKey: "secret", Format: FormatSQLite}, outPath); err == nil {
+		t.Fatal("Expected an error for a rejected request")
+	}
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the database to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+package ingest
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats describes what a call to Ingest did.
+type Stats struct {
+	// Packages is the number of packages written.
+	Packages int `json:"packages"`
+	// Pages is the number of pages of search results that were fetched and written.
+	Pages int `json:"pages"`
+	// Requests is the number of HTTP requests sent, including retries.
+	Requests int64 `json:"requests"`
+	// Bytes is the size of all response bodies downloaded.
+	Bytes int64 `json:"bytes"`
+	// Rows is the number of rows written, over all files for IngestNormalized, not counting headers.
+	Rows int `json:"rows"`
+	// Retries is the number of requests that were sent again after a transient failure.
+	Retries int64 `json:"retries"`
+	// CacheHits is the number of responses that were read from the cache instead of being requested.
+	CacheHits int64 `json:"cache_hits"`
+	// NotModified is the number of requests for an expired cached response that the server answered with 304 Not
+	// Modified, so that the cached response was used again.
+	NotModified int64 `json:"not_modified"`
+	// Duplicates is the number of packages that were left out because they had been written already.
+	Duplicates int `json:"duplicates"`
+	// DuplicateVersions is the number of versions that were left out because their package listed them already.
+	DuplicateVersions int `json:"duplicate_versions"`
+	// Filtered is the number of packages that were left out by the filters of Options, such as MinStars or
+	// ExcludeLicenses.
+	Filtered int `json:"filtered"`
+	// Malformed is the number of packages in search results that could not be decoded and were left out with
+	// DecodeLenient.
+	Malformed int64 `json:"malformed"`
+	// Unchanged is the number of packages written with Options.Update whose versions and dependencies were taken from
+	// the earlier output because they had not changed since. Updated is the number of packages of the earlier output
+	// that had changed and were fetched again, and New the number of packages that were not in it.
+	Unchanged int `json:"unchanged"`
+	Updated   int `json:"updated"`
+	New       int `json:"new"`
+	// Duration is the wall-clock time the ingestion took.
+	Duration time.Duration `json:"duration_ns"`
+	// PeakHeapBytes is the largest heap size seen after writing a page.
+	PeakHeapBytes uint64 `json:"peak_heap_bytes"`
+}
+
+// String formats the stats as a one-line summary.
+func (s Stats) String() string {
+	return fmt.Sprintf("%d packages in %d rows from %d pages in %s: %d requests, %d retries, %d cache hits, "+
+		"%d not modified, %d duplicates, %d duplicate versions, %d filtered, %d malformed, %d unchanged, %d updated, "+
+		"%d new, %s downloaded, peak heap %s", s.Packages, s.Rows, s.Pages, s.Duration.Round(time.Millisecond),
+		s.Requests, s.Retries, s.CacheHits, s.NotModified, s.Duplicates, s.DuplicateVersions, s.Filtered, s.Malformed,
+		s.Unchanged, s.Updated, s.New, formatBytes(s.Bytes), formatBytes(int64(s.PeakHeapBytes)))
+}
+
+// LogValue logs the stats as a group of attributes named like their JSON fields.
+func (s Stats) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("packages", s.Packages),
+		slog.Int("rows", s.Rows),
+		slog.Int("pages", s.Pages),
+		slog.Duration("duration", s.Duration.Round(time.Millisecond)),
+		slog.Int64("requests", s.Requests),
+		slog.Int64("retries", s.Retries),
+		slog.Int64("cache_hits", s.CacheHits),
+		slog.Int64("not_modified", s.NotModified),
+		slog.Int("duplicates", s.Duplicates),
+		slog.Int("duplicate_versions", s.DuplicateVersions),
+		slog.Int("filtered", s.Filtered),
+		slog.Int64("malformed", s.Malformed),
+		slog.Int("unchanged", s.Unchanged),
+		slog.Int("updated", s.Updated),
+		slog.Int("new", s.New),
+		slog.Int64("bytes", s.Bytes),
+		slog.Uint64("peak_heap_bytes", s.PeakHeapBytes),
+	)
+}
+
+// formatBytes formats a byte count with a binary unit, e.g. 1.5 MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// heapMetric is the runtime metric for the memory occupied by heap objects, the same as runtime.MemStats.HeapAlloc.
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// statsCollector accumulates Stats while an ingestion runs. The counters updated by the fetcher are atomic because
+// several workers share it, the others are only touched by the goroutine writing the output. A nil collector ignores
+// everything, so fetchers outside of Ingest do not need one.
+type statsCollector struct {
+	requests             int64
+	bytes                int64
+	retries              int64
+	cacheHits            int64
+	notModifiedResponses int64
+	malformedPackages    int64
+
+	mu                sync.Mutex
+	started           time.Time
+	packages          int
+	pages             int
+	rows              int
+	duplicates        int
+	duplicateVersions int
+	filtered          int
+	unchanged         int
+	updated           int
+	added             int
+	peakHeap          uint64
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{started: time.Now()}
+}
+
+func (c *statsCollector) request() {
+	if c == nil {
+		return
+	}
+	atomic.AddInt64(&c.requests, 1)
+}
+
+func (c *statsCollector) downloaded(bytes int) {
+	if c == nil {
+		return
+	}
+	atomic.AddInt64(&c.bytes, int64(bytes))
+}
+
+func (c *statsCollector) retry() {
+	if c == nil {
+		return
+	}
+	atomic.AddInt64(&c.retries, 1)
+}
+
+func (c *statsCollector) cacheHit() {
+	if c == nil {
+		return
+	}
+	atomic.AddInt64(&c.cacheHits, 1)
+}
+
+// duplicate counts packages that were left out because they had been written already.
+func (c *statsCollector) duplicate(packages int) {
+	if c == nil || packages == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.duplicates += packages
+}
+
+// duplicateVersion counts versions that were left out because their package listed them already.
+func (c *statsCollector) duplicateVersion(versions int) {
+	if c == nil || versions == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.duplicateVersions += versions
+}
+
+// filteredOut counts packages that were left out by the filters of Options.
+func (c *statsCollector) filteredOut(packages int) {
+	if c == nil || packages == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.filtered += packages
+}
+
+// notModified counts a conditional request the server answered with 304 Not Modified.
+func (c *statsCollector) notModified() {
+	if c == nil {
+		return
+	}
+	atomic.AddInt64(&c.notModifiedResponses, 1)
+}
+
+// malformed counts a package in search results that could not be decoded and was left out.
+func (c *statsCollector) malformed() {
+	if c == nil {
+		return
+	}
+	atomic.AddInt64(&c.malformedPackages, 1)
+}
+
+// updatedPackages counts packages by how they compare to the earlier output of Options.Update.
+func (c *statsCollector) updatedPackages(counts updateCounts) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.unchanged += counts.unchanged
+	c.updated += counts.changed
+	c.added += counts.added
+}
+
+// page counts a page that was written with the given number of packages and rows, and samples the heap.
+func (c *statsCollector) page(packages, rows int) {
+	if c == nil {
+		return
+	}
+	// Unlike runtime.ReadMemStats, reading a metric does not stop the world
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	var heap uint64
+	if sample[0].Value.Kind() == metrics.KindUint64 {
+		heap = sample[0].Value.Uint64()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pages++
+	c.packages += packages
+	c.rows += rows
+	if heap > c.peakHeap {
+		c.peakHeap = heap
+	}
+}
+
+// stats returns the stats collected so far.
+func (c *statsCollector) stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Packages:          c.packages,
+		Pages:             c.pages,
+		Requests:          atomic.LoadInt64(&c.requests),
+		Bytes:             atomic.LoadInt64(&c.bytes),
+		Rows:              c.rows,
+		Retries:           atomic.LoadInt64(&c.retries),
+		CacheHits:         atomic.LoadInt64(&c.cacheHits),
+		NotModified:       atomic.LoadInt64(&c.notModifiedResponses),
+		Duplicates:        c.duplicates,
+		DuplicateVersions: c.duplicateVersions,
+		Filtered:          c.filtered,
+		Malformed:         atomic.LoadInt64(&c.malformedPackages),
+		Unchanged:         c.unchanged,
+		Updated:           c.updated,
+		New:               c.added,
+		Duration:          time.Since(c.started),
+		PeakHeapBytes:     c.peakHeap,
+	}
+}
+
+// progressWriter passes every write on to a projectWriter and then reports the number of packages written so far.
+type progressWriter struct {
+	projectWriter
+	progress       func(fetched, total int)
+	fetched, total int
+}
+
+// withProgress wraps writer so that progress is called after every write, counting from fetched packages that were
+// written already. It returns writer itself if progress is nil.
+func withProgress(writer projectWriter, progress func(fetched, total int), fetched, total int) projectWriter {
+	if progress == nil {
+		return writer
+	}
+	return &progressWriter{projectWriter: writer, progress: progress, fetched: fetched, total: total}
+}
+
+func (w *progressWriter) writeProjects(projects []Project) (int, error) {
+	rows, err := w.projectWriter.writeProjects(projects)
+	if err != nil {
+		return rows, err
+	}
+	w.fetched += len(projects)
+	w.progress(w.fetched, w.total)
+	return rows, nil
+}
+
+// packagesTotal returns the number of packages an ingestion of the given number of platforms writes at most, or -1 if
+// opts.MaxPackages does not bound it.
+func packagesTotal(opts Options, platforms int) int {
+	if opts.MaxPackages <= 0 {
+		return -1
+	}
+	return opts.MaxPackages * platforms
+}
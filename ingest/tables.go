@@ -0,0 +1,203 @@
+package ingest
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The files IngestNormalized writes to its output directory.
+const (
+	PackagesFile     = "packages.csv"
+	VersionsFile     = "versions.csv"
+	DependenciesFile = "dependencies.csv"
+)
+
+var (
+	packagesHeader = []string{
+		"id",
+		"name",
+		"platform",
+		"description",
+		"homepage",
+		"language",
+		"keywords",
+		"latest_release_number",
+		"latest_release_published_at",
+	}
+	versionsHeader = []string{
+		"package_id",
+		"number",
+		"published_at",
+		"published_at_missing",
+	}
+	dependenciesHeader = []string{
+		"package_id",
+		"version",
+		"dependency_name",
+		"dependency_platform",
+		"requirements",
+		"kind",
+		"optional",
+		"resolved",
+		"markers",
+	}
+)
+
+// IngestNormalized is like IngestPlatforms but writes three CSV files to outDir instead of one: PackagesFile with one
+// row per package, VersionsFile with one row per version and DependenciesFile with one row per dependency of the
+// latest release of each package. This takes an extra request per package, which counts towards the rate limit. The
+// other files refer to a package by its id, which is derived from its platform and name and so stays the same between
+// runs. opts.Format is ignored.
+//
+// Versions are written with their publication time in RFC 3339 UTC. Versions without a usable time have an empty
+// published_at and published_at_missing set to true, so they cannot be mistaken for releases at the Unix epoch.
+//
+// If the ingestion fails or ctx is done, the three files are left as they were before. A cancellation returns
+// ErrInterrupted.
+func IngestNormalized(ctx context.Context, opts Options, platforms []string, outDir string) (Stats, error) {
+	return defaultClient().IngestNormalized(ctx, opts, platforms, outDir)
+}
+
+// IngestNormalized is like the package-level IngestNormalized but sends all requests through c.
+func (c *Client) IngestNormalized(ctx context.Context, opts Options, platforms []string, outDir string) (Stats, error) {
+	opts, platforms, err := prepareIngest(opts, platforms)
+	if err != nil {
+		return Stats{}, err
+	}
+	opts.Dependencies = true
+
+	stats := newStatsCollector()
+	_, err = writeTablesFiles(ctx, outDir, func(writer projectWriter) (int, error) {
+		writer = withProgress(writer, opts.Progress, 0, packagesTotal(opts, len(platforms)))
+		return c.ingestPlatforms(ctx, writer, opts, platforms, packageSet{}, stats, nil, nil)
+	})
+	return finish(ctx, outDir, tablesRun(SourceLibrariesIO, opts.manifestParameters(platforms), outDir), stats.stats(), err)
+}
+
+// writeTablesFiles creates the three files of IngestNormalized in outDir and lets write fill them through a
+// projectWriter. Each file is nested in the one before it, so a failure removes all of them.
+func writeTablesFiles(ctx context.Context, outDir string, write func(writer projectWriter) (int, error)) (int, error) {
+	return writeTables(ctx, outDir, func(writer tablesProjectWriter) (int, error) {
+		return write(writer)
+	})
+}
+
+// writeTables is like writeTablesFiles but hands write the tablesProjectWriter itself, for sources that write the
+// rows of a package one at a time instead of whole projects.
+func writeTables(ctx context.Context, outDir string, write func(writer tablesProjectWriter) (int, error)) (int, error) {
+	return writeCSVFile(ctx, filepath.Join(outDir, PackagesFile), packagesHeader, func(packages *csv.Writer) (int, error) {
+		return writeCSVFile(ctx, filepath.Join(outDir, VersionsFile), versionsHeader, func(versions *csv.Writer) (int, error) {
+			return writeCSVFile(ctx, filepath.Join(outDir, DependenciesFile), dependenciesHeader, func(dependencies *csv.Writer) (int, error) {
+				return write(tablesProjectWriter{packages: packages, versions: versions, dependencies: dependencies})
+			})
+		})
+	})
+}
+
+// packageID returns the id of a package in the normalized output, a hash of its platform and name. libraries.io
+// treats platforms case-insensitively, so the platform is lowercased first.
+func packageID(platform, name string) string {
+	hash := fnv.New64a()
+	hash.Write([]byte(strings.ToLower(platform)))
+	hash.Write([]byte{0})
+	hash.Write([]byte(name))
+	return fmt.Sprintf("%016x", hash.Sum64())
+}
+
+// tablesProjectWriter spreads every project over the rows of the three normalized files.
+type tablesProjectWriter struct {
+	packages     *csv.Writer
+	versions     *csv.Writer
+	dependencies *csv.Writer
+}
+
+func (w tablesProjectWriter) writeProjects(projects []Project) (int, error) {
+	rows := 0
+	for _, project := range projects {
+		id, err := w.writePackage(project)
+		if err != nil {
+			return rows, err
+		}
+		rows++
+		for _, version := range project.Versions {
+			if err := w.writeVersion(id, version); err != nil {
+				return rows, err
+			}
+			rows++
+		}
+		for _, dependency := range project.Dependencies {
+			if err := w.writeDependency(id, project.LatestReleaseNumber, dependency); err != nil {
+				return rows, err
+			}
+			rows++
+		}
+	}
+	if err := w.flush(); err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+// writePackage writes the package row of project, leaving out its versions and dependencies, and returns its id.
+func (w tablesProjectWriter) writePackage(project Project) (id string, err error) {
+	id = packageID(project.Platform, project.Name)
+	err = w.packages.Write(sanitizeRecord([]string{
+		id,
+		project.Name,
+		project.Platform,
+		project.Description,
+		project.Homepage,
+		project.Language,
+		strings.Join(project.Keywords, ";"),
+		project.LatestReleaseNumber,
+		project.LatestReleasePublishedAt,
+	}))
+	if err != nil {
+		return "", fmt.Errorf("writing package row: %w", err)
+	}
+	return id, nil
+}
+
+// writeVersion writes a row for a version of the package with the given id.
+func (w tablesProjectWriter) writeVersion(id string, version Version) error {
+	publishedAt, missing := publishedAtField(version)
+	if err := w.versions.Write(sanitizeRecord([]string{id, version.Number, publishedAt, strconv.FormatBool(missing)})); err != nil {
+		return fmt.Errorf("writing version row: %w", err)
+	}
+	return nil
+}
+
+// writeDependency writes a row for a dependency of the given version of the package with the given id.
+func (w tablesProjectWriter) writeDependency(id, version string, dependency Dependency) error {
+	err := w.dependencies.Write(sanitizeRecord([]string{
+		id,
+		version,
+		dependency.Name,
+		dependency.Platform,
+		dependency.Requirements,
+		dependency.Kind,
+		strconv.FormatBool(dependency.Optional),
+		strconv.FormatBool(dependency.Resolved),
+		dependency.Markers,
+	}))
+	if err != nil {
+		return fmt.Errorf("writing dependency row: %w", err)
+	}
+	return nil
+}
+
+// flush writes the buffered rows of all three files.
+func (w tablesProjectWriter) flush() error {
+	for _, writer := range []*csv.Writer{w.packages, w.versions, w.dependencies} {
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("writing CSV: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIngestNormalized(t *testing.T) {
+	var dependencyRequests []string
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `[
+				{"name": "left-pad", "platform": "NPM", "latest_release_number": "1.3.0",
+					"versions": [
+						{"number": "1.1.0", "published_at": "1970-01-01T00:00:00.000Z"},
+						{"number": "1.2.0", "published_at": "2017-11-20T11:12:00.000+01:00"},
+						{"number": "1.3.0"}
+					]},
+				{"name": "deleted", "platform": "NPM", "latest_release_number": "0.1.0"},
+				{"name": "unreleased", "platform": "NPM"}
+			]`)
+		case "/NPM/left-pad/1.3.0/dependencies":
+			dependencyRequests = append(dependencyRequests, r.URL.Path)
+			if r.URL.Query().Get("api_key") != "secret" {
+				t.Errorf("Expected the API key to be sent, got %q", r.URL.Query().Get("api_key"))
+			}
+			fmt.Fprint(w, `{"dependencies": [
+				{"name": "tape", "platform": "NPM", "requirements": "^4.0.0", "kind": "Development", "optional": false,
+					"latest": "5.5.3"}
+			]}`)
+		default:
+			dependencyRequests = append(dependencyRequests, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	outDir := t.TempDir()
+
+	stats, err := IngestNormalized(context.Background(), Options{APIKey: "secret", Workers: 1}, []string{"NPM"}, outDir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Packages != 3 {
+		t.Errorf("Expected 3 packages, got %d", stats.Packages)
+	}
+	if stats.Rows != 7 {
+		t.Errorf("Expected 7 rows over all files, got %d", stats.Rows)
+	}
+	if len(dependencyRequests) != 2 {
+		t.Errorf("Expected dependencies to be requested for the two released packages, got %v", dependencyRequests)
+	}
+
+	id := packageID("NPM", "left-pad")
+	expected := map[string][]string{
+		PackagesFile: {
+			strings.Join(packagesHeader, "|"),
+			id + "|left-pad|NPM|||||1.3.0|",
+			packageID("NPM", "deleted") + "|deleted|NPM|||||0.1.0|",
+			packageID("NPM", "unreleased") + "|unreleased|NPM||||||",
+		},
+		VersionsFile: {
+			strings.Join(versionsHeader, "|"),
+			id + "|1.1.0||true",
+			id + "|1.2.0|2017-11-20T10:12:00Z|false",
+			id + "|1.3.0||true",
+		},
+		DependenciesFile: {
+			strings.Join(dependenciesHeader, "|"),
+			id + "|1.3.0|tape|NPM|^4.0.0|Development|false|true|",
+		},
+	}
+	for file, rows := range expected {
+		records := readCSV(t, filepath.Join(outDir, file))
+		if len(records) != len(rows) {
+			t.Errorf("Expected %d rows in %s, got %d", len(rows), file, len(records))
+			continue
+		}
+		for i, record := range records {
+			if row := strings.Join(record, "|"); row != rows[i] {
+				t.Errorf("Expected row %s in %s, got %s", rows[i], file, row)
+			}
+		}
+	}
+}
+
+func TestIngestNormalizedFailure(t *testing.T) {
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `[{"name": "left-pad", "platform": "NPM", "latest_release_number": "1.3.0"}]`)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	})
+	outDir := t.TempDir()
+
+	if _, err := IngestNormalized(context.Background(), Options{APIKey: "secret", Workers: 1}, []string{"NPM"}, outDir); err == nil {
+		t.Fatal("Expected an error for a rejected dependencies request")
+	}
+	for _, file := range []string{PackagesFile, VersionsFile, DependenciesFile} {
+		if _, err := os.Stat(filepath.Join(outDir, file)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed, got %v", file, err)
+		}
+	}
+}
+
+func TestPackageID(t *testing.T) {
+	if packageID("NPM", "left-pad") != packageID("npm", "left-pad") {
+		t.Error("Expected the id to ignore the case of the platform")
+	}
+	if packageID("NPM", "left-pad") == packageID("Pypi", "left-pad") {
+		t.Error("Expected packages of different platforms to get different ids")
+	}
+}
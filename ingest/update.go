@@ -0,0 +1,180 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+)
+
+// updateStateSuffix is appended to the output path to get the path of the state file Options.Update keeps.
+const updateStateSuffix = ".state.json"
+
+// errUpdateSQLite is returned when Options.Update is set for a database, whose rows cannot be read back as packages.
+var errUpdateSQLite = errors.New("updating needs a CSV, NDJSON or JSON output, not an SQLite database")
+
+// updateState is the state file of an output written with Options.Update. It records when every package in the output
+// last changed, along with the settings that determine what a row holds, since the rows of a run with different ones
+// cannot be reused.
+type updateState struct {
+	Format            string   `json:"format"`
+	Columns           []string `json:"columns,omitempty"`
+	Versions          bool     `json:"versions"`
+	Dependencies      bool     `json:"dependencies"`
+	IncludePrerelease bool     `json:"include_prerelease"`
+	// Updated maps the packageKey of every package in the output to its LastUpdated when it was written
+	Updated map[string]time.Time `json:"updated"`
+}
+
+// updateStatePath returns the path of the state file of the given output file.
+func updateStatePath(outPath string) string {
+	return outPath + updateStateSuffix
+}
+
+// LastUpdated returns when the package last changed as far as libraries.io tells, which is the latest publication time
+// of its latest release and its versions, or the zero time if none of them is known. libraries.io does not report when
+// anything else about a package, such as its description, changed.
+func (p Project) LastUpdated() time.Time {
+	var latest time.Time
+	if published, ok := p.latestReleaseTime(); ok {
+		latest = published
+	}
+	for _, version := range p.Versions {
+		if published, ok := version.PublishedTime(); ok && published.After(latest) {
+			latest = published
+		}
+	}
+	return latest
+}
+
+// incrementalUpdate carries the packages of an earlier run into the current one for Options.Update. The previous
+// packages are only read while pages are fetched and next is only written by the goroutine writing the output, so it
+// needs no locking. A nil incrementalUpdate reuses nothing and records nothing.
+type incrementalUpdate struct {
+	// previous maps the packageKey of every package of the earlier run that has not changed since, as far as its state
+	// file knows, to the package as it was written
+	previous map[string]Project
+	// updated is the state of the earlier run
+	updated map[string]time.Time
+	next    updateState
+}
+
+// loadIncrementalUpdate prepares the update of outPath with the settings of opts. The earlier output and its state
+// are read into memory; if either is missing, unreadable or from a run with different settings, every package is
+// fetched in full, as without Options.Update.
+func loadIncrementalUpdate(opts Options, outPath string) *incrementalUpdate {
+	update := &incrementalUpdate{next: updateState{
+		Format:            opts.Format.String(),
+		Columns:           opts.Columns,
+		Versions:          opts.Versions,
+		Dependencies:      opts.Dependencies,
+		IncludePrerelease: opts.IncludePrerelease,
+		Updated:           make(map[string]time.Time),
+	}}
+	data, err := os.ReadFile(updateStatePath(outPath))
+	if err != nil {
+		slog.Info("No state of an earlier run, fetching every package", "out", outPath)
+		return update
+	}
+	var saved updateState
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Format != update.next.Format ||
+		!slices.Equal(saved.Columns, update.next.Columns) || saved.Versions != opts.Versions ||
+		saved.Dependencies != opts.Dependencies || saved.IncludePrerelease != opts.IncludePrerelease {
+		slog.Info("The earlier run used other settings, fetching every package", "out", outPath)
+		return update
+	}
+	projects, err := ReadProjects(outPath)
+	if err != nil {
+		slog.Warn("Could not read the earlier output, fetching every package", "out", outPath, "error", err)
+		return update
+	}
+	update.updated = saved.Updated
+	update.previous = make(map[string]Project, len(projects))
+	for _, project := range projects {
+		update.previous[packageKey(project.Platform, project.Name)] = project
+	}
+	return update
+}
+
+// updateCounts counts packages by how they compare to the output of the earlier run of Options.Update.
+type updateCounts struct {
+	// unchanged packages are filled in from the earlier output, changed ones are in it but are fetched again, and
+	// added ones are not in it
+	unchanged, changed, added int
+}
+
+// reuse fills in the versions and dependencies of the projects that have not changed since the earlier run from the
+// packages it wrote, so that fetchProjectVersions and fetchProjectDependencies skip them, and returns the times the
+// projects last changed by packageKey along with how many of them it filled in. It must be called before anything is
+// derived from the versions, with projects as they came from libraries.io. A project counts as changed if its
+// LastUpdated is unknown or differs from the one in the state of the earlier run.
+func (u *incrementalUpdate) reuse(projects []Project, platform string) (map[string]time.Time, updateCounts) {
+	if u == nil {
+		return nil, updateCounts{}
+	}
+	updated := make(map[string]time.Time, len(projects))
+	var counts updateCounts
+	for i := range projects {
+		project := &projects[i]
+		if project.Platform == "" {
+			project.Platform = platform
+		}
+		key := packageKey(project.Platform, project.Name)
+		lastUpdated := project.LastUpdated()
+		updated[key] = lastUpdated
+		previous, ok := u.previous[key]
+		if !ok {
+			counts.added++
+			continue
+		}
+		if lastUpdated.IsZero() || !u.updated[key].Equal(lastUpdated) {
+			counts.changed++
+			continue
+		}
+		if len(project.Versions) == 0 {
+			project.Versions = previous.Versions
+		}
+		if u.next.Dependencies {
+			// Known to have no dependencies rather than not fetched yet
+			project.Dependencies = append([]Dependency{}, previous.Dependencies...)
+		}
+		counts.unchanged++
+	}
+	return updated, counts
+}
+
+// record notes the times projects, which were just written, last changed, taken from updated as returned by reuse.
+func (u *incrementalUpdate) record(projects []Project, updated map[string]time.Time) {
+	if u == nil {
+		return
+	}
+	for _, project := range projects {
+		key := packageKey(project.Platform, project.Name)
+		if lastUpdated, ok := updated[key]; ok && !lastUpdated.IsZero() {
+			u.next.Updated[key] = lastUpdated
+		}
+	}
+}
+
+// save writes the state of the run to the state file of outPath, replacing the one of the earlier run.
+func (u *incrementalUpdate) save(outPath string) error {
+	if u == nil {
+		return nil
+	}
+	data, err := json.Marshal(u.next)
+	if err != nil {
+		return fmt.Errorf("encoding update state: %w", err)
+	}
+	f, err := CreateAtomic(updateStatePath(outPath))
+	if err != nil {
+		return fmt.Errorf("writing update state: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Abort()
+		return fmt.Errorf("writing update state: %w", err)
+	}
+	return f.Commit()
+}
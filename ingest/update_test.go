@@ -0,0 +1,107 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLastUpdated(t *testing.T) {
+	project := Project{LatestReleasePublishedAt: "2021-01-01T00:00:00Z", Versions: []Version{
+		{Number: "1.0.0", PublishedAt: "2020-01-01T00:00:00Z"},
+		{Number: "2.0.0-rc.1", PublishedAt: "2022-03-01T12:00:00+02:00"},
+		{Number: "0.0.1", PublishedAt: "1970-01-01T00:00:00Z"},
+	}}
+	if expected, actual := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC), project.LastUpdated(); !actual.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+	if actual := (Project{Versions: []Version{{Number: "1.0.0"}}}).LastUpdated(); !actual.IsZero() {
+		t.Errorf("Expected the zero time without timestamps, got %v", actual)
+	}
+}
+
+func TestIngestUpdate(t *testing.T) {
+	leftPadPublished := "2020-01-01T00:00:00Z"
+	var dependencyRequests []string
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			dependencyRequests = append(dependencyRequests, r.URL.Path)
+			w.Write([]byte(`{"dependencies": [{"name": "tape", "requirements": "^4.0.0"}]}`))
+			return
+		}
+		w.Write([]byte(`[
+			{"name": "left-pad", "platform": "NPM", "latest_release_number": "1.3.0", "latest_release_published_at": "` + leftPadPublished + `",
+				"versions": [{"number": "1.3.0"}]},
+			{"name": "right-pad", "platform": "NPM", "latest_release_number": "1.0.0", "latest_release_published_at": "2019-01-01T00:00:00Z",
+				"versions": [{"number": "1.0.0"}]}
+		]`))
+	})
+	outPath := filepath.Join(t.TempDir(), "result.csv")
+	opts := Options{Platform: "NPM", APIKey: "secret", Workers: 1, Dependencies: true, Update: true}
+	ingest := func() Stats {
+		t.Helper()
+		dependencyRequests = nil
+		stats, err := IngestContext(context.Background(), opts, outPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return stats
+	}
+
+	t.Run("Fetches every package without an earlier run", func(t *testing.T) {
+		stats := ingest()
+		if len(dependencyRequests) != 2 || stats.Unchanged != 0 || stats.New != 2 {
+			t.Errorf("Expected the dependencies of both new packages to be fetched, got %v and %+v", dependencyRequests, stats)
+		}
+		if _, err := os.Stat(outPath + ".state.json"); err != nil {
+			t.Errorf("Expected a state file, got %v", err)
+		}
+	})
+
+	t.Run("Fetches only the package with a new release", func(t *testing.T) {
+		leftPadPublished = "2021-06-01T00:00:00Z"
+		stats := ingest()
+		if !slices.Equal(dependencyRequests, []string{"/NPM/left-pad/1.3.0/dependencies"}) {
+			t.Errorf("Expected only the dependencies of left-pad to be fetched, got %v", dependencyRequests)
+		}
+		if stats.Packages != 2 || stats.Unchanged != 1 || stats.Updated != 1 || stats.New != 0 {
+			t.Errorf("Expected 2 packages with 1 unchanged and 1 updated, got %+v", stats)
+		}
+		records := readCSV(t, outPath)
+		dependencies := slices.Index(csvHeader, "dependencies")
+		for _, record := range records[1:] {
+			if record[dependencies] != "tape@^4.0.0" {
+				t.Errorf("Expected the dependencies of %s to be kept, got %q", record[0], record[dependencies])
+			}
+		}
+	})
+
+	t.Run("Fetches nothing extra when nothing changed", func(t *testing.T) {
+		if stats := ingest(); len(dependencyRequests) != 0 || stats.Unchanged != 2 {
+			t.Errorf("Expected no dependency requests, got %v and %d unchanged", dependencyRequests, stats.Unchanged)
+		}
+	})
+
+	t.Run("Fetches every package after the settings changed", func(t *testing.T) {
+		opts.Columns = []string{"name", "platform", "dependencies"}
+		defer func() { opts.Columns = nil }()
+		if stats := ingest(); len(dependencyRequests) != 2 || stats.Unchanged != 0 {
+			t.Errorf("Expected the dependencies of both packages to be fetched, got %v and %d unchanged", dependencyRequests, stats.Unchanged)
+		}
+	})
+
+	t.Run("Does not update a database", func(t *testing.T) {
+		sqliteOpts := opts
+		sqliteOpts.Format = FormatSQLite
+		_, err := IngestContext(context.Background(), sqliteOpts, strings.TrimSuffix(outPath, ".csv")+".sqlite")
+		if !errors.Is(err, errUpdateSQLite) {
+			t.Errorf("Expected errUpdateSQLite, got %v", err)
+		}
+	})
+}